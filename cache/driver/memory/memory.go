@@ -5,6 +5,8 @@ import (
 	"errors"
 	"sync"
 	"time"
+
+	"github.com/gobeaver/beaver-kit/cache/internal/cacheerr"
 )
 
 // item represents a cached item with expiration
@@ -78,12 +80,12 @@ func (mc *Cache) Get(ctx context.Context, key string) ([]byte, error) {
 	fullKey := mc.keyPrefix + key
 	item, exists := mc.items[fullKey]
 	if !exists {
-		return nil, errors.New("key not found")
+		return nil, cacheerr.ErrKeyNotFound
 	}
 
 	// Check expiration
 	if item.expiration > 0 && time.Now().UnixNano() > item.expiration {
-		return nil, errors.New("key not found")
+		return nil, cacheerr.ErrKeyNotFound
 	}
 
 	return item.value, nil
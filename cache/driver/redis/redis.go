@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"github.com/gobeaver/beaver-kit/cache/internal/cacheerr"
 )
 
 // Cache implements cache using Redis
@@ -140,7 +142,7 @@ func (rc *Cache) Get(ctx context.Context, key string) ([]byte, error) {
 	val, err := rc.client.Get(ctx, fullKey).Bytes()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			return nil, errors.New("key not found")
+			return nil, cacheerr.ErrKeyNotFound
 		}
 		return nil, err
 	}
@@ -0,0 +1,8 @@
+// Package cacheerr holds the errors shared by the cache package and its
+// drivers, which cannot import cache without an import cycle
+package cacheerr
+
+import "errors"
+
+// ErrKeyNotFound is returned by Get for missing or expired keys
+var ErrKeyNotFound = errors.New("key not found")
@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/gobeaver/beaver-kit/cache/internal/cacheerr"
 	"github.com/gobeaver/beaver-kit/config"
 )
 
@@ -21,7 +22,7 @@ var (
 	ErrNotInitialized = errors.New("cache not initialized")
 	ErrInvalidDriver  = errors.New("invalid cache driver")
 	ErrInvalidConfig  = errors.New("invalid cache configuration")
-	ErrKeyNotFound    = errors.New("key not found")
+	ErrKeyNotFound    = cacheerr.ErrKeyNotFound // returned by Get, match with errors.Is
 	ErrInvalidTTL     = errors.New("invalid TTL value")
 )
 
@@ -2,6 +2,7 @@ package cache_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -168,3 +169,15 @@ func TestGlobalInstance(t *testing.T) {
 	// Cleanup
 	cache.Reset()
 }
+
+func TestKeyNotFound(t *testing.T) {
+	c, err := cache.New(cache.Config{Driver: "memory", MaxKeys: 10, DefaultTTL: "5m"})
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Get(context.Background(), "missing"); !errors.Is(err, cache.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
@@ -29,6 +29,14 @@ type Config struct {
 	// Auth token for Turso/LibSQL
 	AuthToken string `env:"DB_AUTH_TOKEN"`
 
+	// Rotating credentials (optional): whenever a connection is opened, the
+	// password (or Turso auth token) is read from PasswordFile, re-read when
+	// it changes, or printed by PasswordCommand. Credentials sets a custom
+	// provider in code.
+	PasswordFile    string             `env:"DB_PASSWORD_FILE"`
+	PasswordCommand string             `env:"DB_PASSWORD_COMMAND"`
+	Credentials     CredentialProvider `env:"-"`
+
 	// SSL/TLS Configuration
 	SSLMode   string `env:"DB_SSL_MODE" envDefault:"disable"` // For PostgreSQL
 	TLSConfig string `env:"DB_TLS_CONFIG"`                    // For MySQL
@@ -39,6 +47,25 @@ type Config struct {
 	ConnMaxLifetime int `env:"DB_CONN_MAX_LIFETIME" envDefault:"300"` // seconds
 	ConnMaxIdleTime int `env:"DB_CONN_MAX_IDLE_TIME" envDefault:"60"` // seconds
 
+	// Startup: the primary is pinged up to ConnectRetries+1 times, waiting
+	// ConnectBackoff (doubling, jittered) between attempts. With LazyConnect
+	// the pool is created without a ping and connects on first use.
+	ConnectRetries int  `env:"DB_CONNECT_RETRIES" envDefault:"0"`
+	ConnectBackoff int  `env:"DB_CONNECT_BACKOFF" envDefault:"500"` // milliseconds
+	ConnectTimeout int  `env:"DB_CONNECT_TIMEOUT" envDefault:"5"`   // seconds per attempt
+	LazyConnect    bool `env:"DB_LAZY_CONNECT" envDefault:"false"`
+
+	// Read replicas: comma-separated URLs, selected round_robin or
+	// least_connections and pinged every ReplicaHealthInterval seconds
+	ReplicaURLs           []string `env:"DB_REPLICA_URLS" envSeparator:","`
+	ReplicaPolicy         string   `env:"DB_REPLICA_POLICY" envDefault:"round_robin"`
+	ReplicaHealthInterval int      `env:"DB_REPLICA_HEALTH_INTERVAL" envDefault:"10"` // seconds
+
+	// Query metrics: latency, errors and pool statistics (see Metrics), with
+	// queries slower than SlowQueryThreshold logged normalized and redacted
+	EnableMetrics      bool `env:"DB_METRICS" envDefault:"false"`
+	SlowQueryThreshold int  `env:"DB_SLOW_QUERY_THRESHOLD" envDefault:"200"` // milliseconds
+
 	// Additional driver-specific parameters
 	Params string `env:"DB_PARAMS"`
 
@@ -49,7 +76,7 @@ type Config struct {
 	UseORM        string `env:"DB_ORM"`                              // "gorm" or empty
 	DisableORMLog bool   `env:"DB_DISABLE_ORM_LOG" envDefault:"true"` // Only applies when UseORM is set
 
-	// Migrations (optional, mainly for GORM users)
+	// Migrations (optional): applied by Init when AutoMigrate is set
 	AutoMigrate     bool   `env:"DB_AUTO_MIGRATE" envDefault:"false"`
 	MigrationsPath  string `env:"DB_MIGRATIONS_PATH" envDefault:"migrations"`
 	MigrationsTable string `env:"DB_MIGRATIONS_TABLE" envDefault:"schema_migrations"`
@@ -0,0 +1,64 @@
+// database/connect.go - startup connection retries
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+// maxConnectBackoff caps the delay between connection attempts
+const maxConnectBackoff = 30 * time.Second
+
+// pinger is implemented by *sql.DB
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// waitForDB pings db until it answers, up to cfg.ConnectRetries+1 attempts
+// of cfg.ConnectTimeout each, with jittered exponential backoff starting at
+// cfg.ConnectBackoff. Every failed attempt is logged.
+func waitForDB(ctx context.Context, db pinger, cfg Config) error {
+	timeout := time.Duration(cfg.ConnectTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	backoff := time.Duration(cfg.ConnectBackoff) * time.Millisecond
+	if backoff <= 0 {
+		backoff = 500 * time.Millisecond
+	}
+	attempts := max(cfg.ConnectRetries, 0) + 1
+
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := db.PingContext(pingCtx)
+		cancel()
+		if err == nil {
+			if attempt > 1 {
+				log.Printf("[DB] connected after %d attempts", attempt)
+			}
+			return nil
+		}
+		if attempt >= attempts {
+			if attempts > 1 {
+				return fmt.Errorf("failed to ping database after %d attempts: %w", attempts, err)
+			}
+			return fmt.Errorf("failed to ping database: %w", err)
+		}
+
+		// Half fixed, half random so restarting replicas don't retry in lockstep
+		delay := backoff/2 + rand.N(backoff/2+1)
+		log.Printf("[DB] connection attempt %d/%d failed: %v (retrying in %s)", attempt, attempts, err, delay.Round(time.Millisecond))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (last error: %w)", ctx.Err(), err)
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+}
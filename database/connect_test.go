@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// flakyPinger fails the first failures pings
+type flakyPinger struct {
+	failures int
+	calls    int
+}
+
+func (p *flakyPinger) PingContext(ctx context.Context) error {
+	p.calls++
+	if p.calls <= p.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestWaitForDBRetries(t *testing.T) {
+	ctx := context.Background()
+
+	p := &flakyPinger{failures: 2}
+	if err := waitForDB(ctx, p, Config{ConnectRetries: 3, ConnectBackoff: 1}); err != nil {
+		t.Fatalf("Expected success after retries: %v", err)
+	}
+	if p.calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", p.calls)
+	}
+
+	p = &flakyPinger{failures: 5}
+	err := waitForDB(ctx, p, Config{ConnectRetries: 2, ConnectBackoff: 1})
+	if err == nil || p.calls != 3 {
+		t.Errorf("Expected failure after 3 attempts, got %d: %v", p.calls, err)
+	}
+
+	p = &flakyPinger{failures: 1}
+	if err := waitForDB(ctx, p, Config{}); err == nil || p.calls != 1 {
+		t.Errorf("Expected a single attempt without retries, got %d: %v", p.calls, err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	p = &flakyPinger{failures: 5}
+	err = waitForDB(cancelled, p, Config{ConnectRetries: 5, ConnectBackoff: 60000})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancellation during backoff, got %v", err)
+	}
+}
+
+func TestLazyConnect(t *testing.T) {
+	// The directory does not exist, so connecting fails
+	path := filepath.Join(t.TempDir(), "missing", "test.db")
+
+	if _, err := NewSQL(Config{Driver: "sqlite", Database: path}); err == nil {
+		t.Fatal("Expected eager connect to fail")
+	}
+
+	db, err := NewSQL(Config{Driver: "sqlite", Database: path, LazyConnect: true})
+	if err != nil {
+		t.Fatalf("Expected lazy connect to skip the ping: %v", err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err == nil {
+		t.Error("Expected the first use to fail")
+	}
+}
@@ -0,0 +1,280 @@
+// database/credentials.go - rotating credentials for new connections
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrCredentials is returned when a CredentialProvider fails
+var ErrCredentials = errors.New("failed to load database credentials")
+
+// Credentials authenticate a new connection. For Turso/LibSQL the password
+// is the auth token.
+type Credentials struct {
+	Username string `json:"username"` // empty keeps the configured username
+	Password string `json:"password"`
+}
+
+// CredentialProvider is consulted whenever the pool opens a new connection,
+// so rotated passwords and short-lived auth tokens are picked up without
+// restarting the pool. Open connections keep their credentials until
+// DB_CONN_MAX_LIFETIME recycles them.
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialProviderFunc adapts a function, e.g. one generating IAM auth
+// tokens, to CredentialProvider
+type CredentialProviderFunc func(ctx context.Context) (Credentials, error)
+
+// Credentials implements CredentialProvider
+func (f CredentialProviderFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// credentialProvider returns the provider configured in cfg, if any
+func credentialProvider(cfg Config) CredentialProvider {
+	switch {
+	case cfg.Credentials != nil:
+		return cfg.Credentials
+	case cfg.PasswordFile != "":
+		return NewFileCredentials("", cfg.PasswordFile)
+	case cfg.PasswordCommand != "":
+		return NewCommandCredentials(cfg.PasswordCommand, 0)
+	}
+	return nil
+}
+
+// FileCredentials reads credentials from files, such as a mounted
+// Kubernetes secret, and re-reads them when they change
+type FileCredentials struct {
+	usernameFile string
+	passwordFile string
+
+	mu     sync.Mutex
+	creds  Credentials
+	stamps [2]fileStamp
+	loaded bool
+}
+
+// fileStamp detects file changes, including atomic symlink swaps
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewFileCredentials creates a provider reading the password from
+// passwordFile and, unless usernameFile is empty, the username from
+// usernameFile. Surrounding whitespace is trimmed.
+func NewFileCredentials(usernameFile, passwordFile string) *FileCredentials {
+	return &FileCredentials{usernameFile: usernameFile, passwordFile: passwordFile}
+}
+
+// Credentials implements CredentialProvider
+func (f *FileCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var stamps [2]fileStamp
+	for i, path := range []string{f.usernameFile, f.passwordFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return Credentials{}, err
+		}
+		stamps[i] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	if f.loaded && stamps == f.stamps {
+		return f.creds, nil
+	}
+
+	var creds Credentials
+	if f.usernameFile != "" {
+		username, err := os.ReadFile(f.usernameFile)
+		if err != nil {
+			return Credentials{}, err
+		}
+		creds.Username = strings.TrimSpace(string(username))
+	}
+	password, err := os.ReadFile(f.passwordFile)
+	if err != nil {
+		return Credentials{}, err
+	}
+	creds.Password = strings.TrimSpace(string(password))
+
+	f.creds, f.stamps, f.loaded = creds, stamps, true
+	return creds, nil
+}
+
+// CommandCredentials runs a shell command for credentials, e.g. a CLI that
+// issues IAM auth tokens, and caches the result
+type CommandCredentials struct {
+	command string
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	creds   Credentials
+	expires time.Time
+}
+
+// NewCommandCredentials creates a provider running command with sh -c at
+// most once per ttl (default 1 minute). The command prints the password, or
+// a JSON object with "username" and "password".
+func NewCommandCredentials(command string, ttl time.Duration) *CommandCredentials {
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	return &CommandCredentials{command: command, ttl: ttl}
+}
+
+// Credentials implements CredentialProvider
+func (c *CommandCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Now().Before(c.expires) {
+		return c.creds, nil
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.command)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return Credentials{}, fmt.Errorf("credential command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	output := bytes.TrimSpace(out)
+	var creds Credentials
+	if bytes.HasPrefix(output, []byte("{")) {
+		if err := json.Unmarshal(output, &creds); err != nil {
+			return Credentials{}, fmt.Errorf("invalid credential command output: %w", err)
+		}
+	} else {
+		creds.Password = string(output)
+	}
+
+	c.creds, c.expires = creds, time.Now().Add(c.ttl)
+	return creds, nil
+}
+
+// credentialConnector asks the provider for credentials on every new
+// connection and dials with a DSN built from them
+type credentialConnector struct {
+	driverName string
+	dsn        string
+	provider   CredentialProvider
+	driver     driver.Driver
+
+	mu      sync.Mutex
+	lastDSN string
+	base    driver.Connector
+}
+
+func newCredentialConnector(driverName, dsn string, provider CredentialProvider) (driver.Connector, error) {
+	drv, err := lookupDriver(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &credentialConnector{driverName: driverName, dsn: dsn, provider: provider, driver: drv}, nil
+}
+
+func (c *credentialConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	creds, err := c.provider.Credentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCredentials, err)
+	}
+	dsn, err := dsnWithCredentials(c.driverName, c.dsn, creds)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reuse the parsed connector until the credentials change
+	c.mu.Lock()
+	if c.base == nil || dsn != c.lastDSN {
+		base, err := driverConnector(c.driver, dsn)
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		c.base, c.lastDSN = base, dsn
+	}
+	base := c.base
+	c.mu.Unlock()
+
+	return base.Connect(ctx)
+}
+
+func (c *credentialConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// dsnWithCredentials returns dsn with the username (if set) and password
+// from creds
+func dsnWithCredentials(driverName, dsn string, creds Credentials) (string, error) {
+	switch driverName {
+	case "mysql":
+		mysqlCfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+		if creds.Username != "" {
+			mysqlCfg.User = creds.Username
+		}
+		mysqlCfg.Passwd = creds.Password
+		return mysqlCfg.FormatDSN(), nil
+
+	case "pgx":
+		if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+			u, err := url.Parse(dsn)
+			if err != nil {
+				return "", fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+			}
+			username := creds.Username
+			if username == "" && u.User != nil {
+				username = u.User.Username()
+			}
+			u.User = url.UserPassword(username, creds.Password)
+			return u.String(), nil
+		}
+		// Keyword/value DSN: later settings override earlier ones
+		if creds.Username != "" {
+			dsn += " user=" + quotePostgresValue(creds.Username)
+		}
+		return dsn + " password=" + quotePostgresValue(creds.Password), nil
+
+	case "libsql":
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+		query := u.Query()
+		query.Set("authToken", creds.Password)
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+
+	// SQLite has no credentials
+	return dsn, nil
+}
+
+var postgresValueEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+func quotePostgresValue(v string) string {
+	return "'" + postgresValueEscaper.Replace(v) + "'"
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDSNWithCredentials(t *testing.T) {
+	creds := Credentials{Username: "app", Password: "p@ss w'rd"}
+	tests := []struct {
+		driver, dsn, want string
+	}{
+		{"mysql", "old:secret@tcp(db:3306)/shop?parseTime=true", "app:p@ss w'rd@tcp(db:3306)/shop?parseTime=true"},
+		{"pgx", "postgres://old:secret@db:5432/shop?sslmode=disable", "postgres://app:p%40ss%20w%27rd@db:5432/shop?sslmode=disable"},
+		{"pgx", "host=db user=old password=secret dbname=shop", `host=db user=old password=secret dbname=shop user='app' password='p@ss w\'rd'`},
+		{"libsql", "libsql://db.turso.io?authToken=old", "libsql://db.turso.io?authToken=p%40ss+w%27rd"},
+		{"sqlite", "file.db", "file.db"},
+	}
+	for _, tt := range tests {
+		got, err := dsnWithCredentials(tt.driver, tt.dsn, creds)
+		if err != nil {
+			t.Errorf("%s: %v", tt.driver, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("dsnWithCredentials(%s, %q) = %q, want %q", tt.driver, tt.dsn, got, tt.want)
+		}
+	}
+
+	// An empty username keeps the configured one
+	got, _ := dsnWithCredentials("pgx", "postgres://old:secret@db/shop", Credentials{Password: "new"})
+	if got != "postgres://old:new@db/shop" {
+		t.Errorf("Expected the configured username, got %q", got)
+	}
+}
+
+func TestFileCredentialsRereadOnChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "password")
+	if err := os.WriteFile(path, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := NewFileCredentials("", path)
+	creds, err := provider.Credentials(context.Background())
+	if err != nil || creds.Password != "first" {
+		t.Fatalf("Expected trimmed password, got %q (%v)", creds.Password, err)
+	}
+
+	if err := os.WriteFile(path, []byte("second-password\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	creds, _ = provider.Credentials(context.Background())
+	if creds.Password != "second-password" {
+		t.Errorf("Expected the rotated password, got %q", creds.Password)
+	}
+
+	os.Remove(path)
+	if _, err := provider.Credentials(context.Background()); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestCommandCredentials(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "runs")
+	provider := NewCommandCredentials(`echo run >> `+counter+`; echo '{"username":"iam","password":"token"}'`, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		creds, err := provider.Credentials(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.Username != "iam" || creds.Password != "token" {
+			t.Errorf("Unexpected credentials: %+v", creds)
+		}
+	}
+	if runs, _ := os.ReadFile(counter); string(runs) != "run\n" {
+		t.Errorf("Expected the command to run once within the TTL, got %q", runs)
+	}
+
+	creds, err := NewCommandCredentials("printf 'secret\\n'", 0).Credentials(context.Background())
+	if err != nil || creds.Password != "secret" || creds.Username != "" {
+		t.Errorf("Expected a plain password, got %+v (%v)", creds, err)
+	}
+
+	if _, err := NewCommandCredentials("echo denied >&2; exit 1", 0).Credentials(context.Background()); err == nil {
+		t.Error("Expected the command failure")
+	}
+}
+
+func TestCredentialProviderPerConnection(t *testing.T) {
+	var calls atomic.Int32
+	fail := atomic.Bool{}
+	provider := CredentialProviderFunc(func(ctx context.Context) (Credentials, error) {
+		calls.Add(1)
+		if fail.Load() {
+			return Credentials{}, errors.New("secret store unavailable")
+		}
+		return Credentials{Password: "unused"}, nil
+	})
+
+	db, err := NewSQL(Config{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "test.db"), Credentials: provider})
+	if err != nil {
+		t.Fatalf("NewSQL failed: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	conn1, _ := db.Conn(ctx)
+	conn2, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected one provider call per new connection, got %d", calls.Load())
+	}
+
+	fail.Store(true)
+	conn1.Close()
+	conn2.Close()
+	db.SetMaxIdleConns(0) // force a new connection
+	if err := db.PingContext(ctx); !errors.Is(err, ErrCredentials) {
+		t.Errorf("Expected ErrCredentials, got %v", err)
+	}
+}
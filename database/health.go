@@ -0,0 +1,207 @@
+// database/health.go - primary and replica health checks
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// pingTimeout bounds each health check ping
+const pingTimeout = 2 * time.Second
+
+// ErrUnhealthy is returned by Ready when the primary does not answer
+var ErrUnhealthy = errors.New("database unhealthy")
+
+// HealthStatus represents the health status of the database
+type HealthStatus string
+
+const (
+	HealthStatusHealthy   HealthStatus = "healthy"
+	HealthStatusDegraded  HealthStatus = "degraded"
+	HealthStatusUnhealthy HealthStatus = "unhealthy"
+)
+
+// HealthReport is the result of HealthCheck. The status is unhealthy when
+// the primary is down and degraded when only replicas are down.
+type HealthReport struct {
+	Status    HealthStatus `json:"status"`
+	Timestamp time.Time    `json:"timestamp"`
+	Primary   NodeHealth   `json:"primary"`
+	Replicas  []NodeHealth `json:"replicas,omitempty"`
+}
+
+// NodeHealth is the health of one database node
+type NodeHealth struct {
+	Node            string        `json:"node"`
+	Status          HealthStatus  `json:"status"`
+	Error           string        `json:"error,omitempty"`
+	Latency         time.Duration `json:"latency"`
+	OpenConnections int           `json:"open_connections"`
+	InUse           int           `json:"in_use"`
+	Idle            int           `json:"idle"`
+	WaitCount       int64         `json:"wait_count"`
+}
+
+// HealthCheck pings the primary and every replica. Replicas are taken out of
+// or put back into read rotation according to the result.
+func (db *Database) HealthCheck(ctx context.Context) *HealthReport {
+	return healthCheck(ctx, db.SQL(), db.replicas)
+}
+
+// Ready returns nil when the primary answers a ping, for readiness probes
+// and checks such as oauth's DefaultHealthChecker.RegisterCheck
+func (db *Database) Ready(ctx context.Context) error {
+	return ready(ctx, db.SQL())
+}
+
+// HealthCheck checks the global instance, see Database.HealthCheck
+func HealthCheck(ctx context.Context) *HealthReport {
+	return healthCheck(ctx, defaultDB, defaultReplicas)
+}
+
+// Ready checks the global instance, see Database.Ready
+func Ready(ctx context.Context) error {
+	return ready(ctx, defaultDB)
+}
+
+func healthCheck(ctx context.Context, primary *sql.DB, replicas *replicaSet) *HealthReport {
+	report := &HealthReport{Timestamp: time.Now()}
+
+	var wg sync.WaitGroup
+	if replicas != nil {
+		report.Replicas = make([]NodeHealth, len(replicas.replicas))
+		for i, r := range replicas.replicas {
+			wg.Add(1)
+			go func(i int, r *replica) {
+				defer wg.Done()
+				report.Replicas[i] = pingNode(ctx, r.name, r.db)
+				r.healthy.Store(report.Replicas[i].Status == HealthStatusHealthy)
+			}(i, r)
+		}
+	}
+	report.Primary = pingNode(ctx, "primary", primary)
+	wg.Wait()
+
+	report.Status = HealthStatusHealthy
+	for _, r := range report.Replicas {
+		if r.Status != HealthStatusHealthy {
+			report.Status = HealthStatusDegraded
+		}
+	}
+	if report.Primary.Status != HealthStatusHealthy {
+		report.Status = HealthStatusUnhealthy
+	}
+	return report
+}
+
+// pingNode pings db and reports its pool statistics
+func pingNode(ctx context.Context, node string, db *sql.DB) NodeHealth {
+	health := NodeHealth{Node: node, Status: HealthStatusHealthy}
+	if db == nil {
+		health.Status = HealthStatusUnhealthy
+		health.Error = ErrNotInitialized.Error()
+		return health
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := db.PingContext(pingCtx)
+	health.Latency = time.Since(start)
+	if err != nil {
+		health.Status = HealthStatusUnhealthy
+		health.Error = err.Error()
+	}
+
+	stats := db.Stats()
+	health.OpenConnections = stats.OpenConnections
+	health.InUse = stats.InUse
+	health.Idle = stats.Idle
+	health.WaitCount = stats.WaitCount
+	return health
+}
+
+func ready(ctx context.Context, primary *sql.DB) error {
+	if health := pingNode(ctx, "primary", primary); health.Status != HealthStatusHealthy {
+		return fmt.Errorf("%w: %s", ErrUnhealthy, health.Error)
+	}
+	return nil
+}
+
+// HealthHandler provides HTTP handlers for database health checks
+type HealthHandler struct {
+	db *Database
+}
+
+// NewHealthHandler creates a health handler for db, or for the global
+// instance when db is nil
+func NewHealthHandler(db *Database) *HealthHandler {
+	return &HealthHandler{db: db}
+}
+
+func (h *HealthHandler) check(ctx context.Context) *HealthReport {
+	if h.db == nil {
+		return HealthCheck(ctx)
+	}
+	return h.db.HealthCheck(ctx)
+}
+
+// HandleHealth serves the full health report, with 503 when unhealthy
+func (h *HealthHandler) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	report := h.check(r.Context())
+
+	statusCode := http.StatusOK // degraded still serves traffic
+	if report.Status == HealthStatusUnhealthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// HandleLiveness handles the liveness probe endpoint. It does not touch the
+// database, so an outage does not get the process restarted.
+func (h *HealthHandler) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"status":    "alive",
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+// HandleReadiness handles the readiness probe endpoint, ready while the
+// primary answers
+func (h *HealthHandler) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+	var err error
+	if h.db == nil {
+		err = Ready(r.Context())
+	} else {
+		err = h.db.Ready(r.Context())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"status":    "not_ready",
+			"reason":    err.Error(),
+			"timestamp": time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"status":    "ready",
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthCheck(t *testing.T) {
+	db, replicaDBs := newTestReplicas(t, ReplicaRoundRobin)
+	ctx := context.Background()
+
+	report := db.HealthCheck(ctx)
+	if report.Status != HealthStatusHealthy || len(report.Replicas) != 2 {
+		t.Fatalf("Expected healthy report with 2 replicas, got %+v", report)
+	}
+	if report.Primary.Node != "primary" || report.Replicas[1].Node != "replica2" {
+		t.Errorf("Unexpected node names: %+v", report)
+	}
+
+	replicaDBs[0].Close()
+	report = db.HealthCheck(ctx)
+	if report.Status != HealthStatusDegraded || report.Replicas[0].Error == "" {
+		t.Errorf("Expected degraded report, got %+v", report)
+	}
+	for i := 0; i < 2; i++ {
+		if got := nodeName(t, db.Reader(ctx)); got != "replica2" {
+			t.Errorf("Expected the failed replica out of rotation, got %s", got)
+		}
+	}
+	if err := db.Ready(ctx); err != nil {
+		t.Errorf("Expected ready with the primary up: %v", err)
+	}
+
+	db.Writer().Close()
+	report = db.HealthCheck(ctx)
+	if report.Status != HealthStatusUnhealthy {
+		t.Errorf("Expected unhealthy report, got %s", report.Status)
+	}
+	if err := db.Ready(ctx); !errors.Is(err, ErrUnhealthy) {
+		t.Errorf("Expected ErrUnhealthy, got %v", err)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	db, _ := newTestReplicas(t, ReplicaRoundRobin)
+	handler := NewHealthHandler(db)
+
+	rec := httptest.NewRecorder()
+	handler.HandleHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var report HealthReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || report.Status != HealthStatusHealthy {
+		t.Errorf("Expected 200 healthy, got %d %s", rec.Code, report.Status)
+	}
+
+	db.Writer().Close()
+
+	rec = httptest.NewRecorder()
+	handler.HandleHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when the primary is down, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.HandleReadiness(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected not ready, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.HandleLiveness(rec, httptest.NewRequest(http.MethodGet, "/live", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected liveness to ignore the database, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,417 @@
+// database/instrument.go - instrumented driver connector
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+)
+
+// Query operations recorded by QueryMetrics
+const (
+	OperationExec     = "exec"
+	OperationQuery    = "query"
+	OperationBegin    = "begin"
+	OperationCommit   = "commit"
+	OperationRollback = "rollback"
+)
+
+// Error classes recorded by QueryMetrics
+const (
+	ErrorClassTimeout    = "timeout"
+	ErrorClassCanceled   = "canceled"
+	ErrorClassConnection = "connection"
+	ErrorClassConflict   = "conflict" // serialization failures, deadlocks, busy
+	ErrorClassConstraint = "constraint"
+	ErrorClassSyntax     = "syntax"
+	ErrorClassOther      = "other"
+)
+
+// SlowQuery describes a query that took longer than the slow query threshold
+type SlowQuery struct {
+	Node     string        `json:"node"`
+	Query    string        `json:"query"` // normalized: literals replaced by ?
+	Args     []string      `json:"args"`  // redacted: types and sizes only
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	Time     time.Time     `json:"time"`
+}
+
+// InstrumentConnector wraps a driver.Connector so every query, exec and
+// transaction on it is recorded in metrics under the node label (e.g.
+// "primary" or "replica1"). Open the result with sql.OpenDB.
+func InstrumentConnector(base driver.Connector, metrics *QueryMetrics, node string) driver.Connector {
+	return &instrumentedConnector{base: base, metrics: metrics, node: node}
+}
+
+// openConnector returns a connector for dsn with the named driver
+func openConnector(driverName, dsn string) (driver.Connector, error) {
+	drv, err := lookupDriver(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return driverConnector(drv, dsn)
+}
+
+// lookupDriver returns the registered driver; sql.Open does not connect
+func lookupDriver(driverName, dsn string) (driver.Driver, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	db.Close()
+	return drv, nil
+}
+
+// driverConnector returns drv's connector for dsn
+func driverConnector(drv driver.Driver, dsn string) (driver.Connector, error) {
+	if dc, ok := drv.(driver.DriverContext); ok {
+		return dc.OpenConnector(dsn)
+	}
+	return dsnConnector{dsn: dsn, driver: drv}, nil
+}
+
+// dsnConnector adapts a driver without DriverContext
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                        { return c.driver }
+
+type instrumentedConnector struct {
+	base    driver.Connector
+	metrics *QueryMetrics
+	node    string
+}
+
+func (c *instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.base.Connect(ctx)
+	if err != nil {
+		c.metrics.recordError(c.node, err)
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn, c: c}, nil
+}
+
+func (c *instrumentedConnector) Driver() driver.Driver {
+	return c.base.Driver()
+}
+
+// observe records one operation
+func (c *instrumentedConnector) observe(operation, query string, args []driver.NamedValue, start time.Time, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		return
+	}
+	c.metrics.observe(c.node, operation, query, args, time.Since(start), err)
+}
+
+// instrumentedConn forwards to the driver connection. Optional interfaces
+// the driver lacks fall back the way database/sql expects (driver.ErrSkip).
+// Driver-specific methods (e.g. pgx COPY or LISTEN) are not forwarded; reach
+// them through Unwrap or UnwrapConn.
+type instrumentedConn struct {
+	driver.Conn
+	c *instrumentedConnector
+}
+
+// Unwrap returns the driver's own connection
+func (ic *instrumentedConn) Unwrap() driver.Conn {
+	return ic.Conn
+}
+
+// UnwrapConn returns the driver's connection from sql.Conn.Raw when metrics
+// wrap it, and driverConn itself otherwise. Work done on the unwrapped
+// connection is not recorded in metrics.
+//
+//	err := conn.Raw(func(driverConn any) error {
+//	    pgxConn := database.UnwrapConn(driverConn).(*stdlib.Conn).Conn()
+//	    ...
+//	})
+func UnwrapConn(driverConn any) any {
+	if ic, ok := driverConn.(*instrumentedConn); ok {
+		return ic.Unwrap()
+	}
+	return driverConn
+}
+
+func (ic *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := ic.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	ic.c.observe(OperationExec, query, args, start, err)
+	return result, err
+}
+
+func (ic *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := ic.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	ic.c.observe(OperationQuery, query, args, start, err)
+	return rows, err
+}
+
+func (ic *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		stmt driver.Stmt
+		err  error
+	)
+	if preparer, ok := ic.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = ic.Conn.Prepare(query)
+	}
+	if err != nil {
+		ic.c.metrics.recordError(ic.c.node, err)
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, c: ic.c, query: query}, nil
+}
+
+func (ic *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	return ic.PrepareContext(context.Background(), query)
+}
+
+func (ic *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	var (
+		tx  driver.Tx
+		err error
+	)
+	if beginner, ok := ic.Conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else {
+		if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+			return nil, errors.New("database: driver does not support transaction options")
+		}
+		tx, err = ic.Conn.Begin() //nolint:staticcheck // fallback for drivers without ConnBeginTx
+	}
+	ic.c.observe(OperationBegin, "", nil, start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedTx{Tx: tx, c: ic.c}, nil
+}
+
+func (ic *instrumentedConn) Begin() (driver.Tx, error) {
+	return ic.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (ic *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := ic.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (ic *instrumentedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := ic.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (ic *instrumentedConn) IsValid() bool {
+	if validator, ok := ic.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (ic *instrumentedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := ic.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type instrumentedStmt struct {
+	driver.Stmt
+	c     *instrumentedConnector
+	query string
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var (
+		result driver.Result
+		err    error
+	)
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			result, err = s.Stmt.Exec(values) //nolint:staticcheck // fallback for drivers without StmtExecContext
+		}
+	}
+	s.c.observe(OperationExec, s.query, args, start, err)
+	return result, err
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var (
+		rows driver.Rows
+		err  error
+	)
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			rows, err = s.Stmt.Query(values) //nolint:staticcheck // fallback for drivers without StmtQueryContext
+		}
+	}
+	s.c.observe(OperationQuery, s.query, args, start, err)
+	return rows, err
+}
+
+func (s *instrumentedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// namedValues converts arguments for drivers without context-aware statements
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("database: driver does not support named parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+type instrumentedTx struct {
+	driver.Tx
+	c *instrumentedConnector
+}
+
+func (t *instrumentedTx) Commit() error {
+	start := time.Now()
+	err := t.Tx.Commit()
+	t.c.observe(OperationCommit, "", nil, start, err)
+	return err
+}
+
+func (t *instrumentedTx) Rollback() error {
+	start := time.Now()
+	err := t.Tx.Rollback()
+	t.c.observe(OperationRollback, "", nil, start, err)
+	return err
+}
+
+// ClassifyError returns the ErrorClass* label for a database error
+func ClassifyError(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone):
+		return ErrorClassConnection
+	case IsRetryable(err):
+		return ErrorClassConflict
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case strings.HasPrefix(pgErr.Code, "23"):
+			return ErrorClassConstraint
+		case strings.HasPrefix(pgErr.Code, "42"):
+			return ErrorClassSyntax
+		case strings.HasPrefix(pgErr.Code, "08"):
+			return ErrorClassConnection
+		case pgErr.Code == "57014": // query_canceled, e.g. statement_timeout
+			return ErrorClassTimeout
+		}
+		return ErrorClassOther
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1062, 1451, 1452, 1048, 3819:
+			return ErrorClassConstraint
+		case 1064, 1146, 1054:
+			return ErrorClassSyntax
+		}
+		return ErrorClassOther
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff {
+		case 19: // SQLITE_CONSTRAINT
+			return ErrorClassConstraint
+		case 1: // SQLITE_ERROR, mostly syntax and missing tables
+			return ErrorClassSyntax
+		}
+	}
+	return ErrorClassOther
+}
+
+var (
+	stringLiteralPattern = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numberLiteralPattern = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	placeholderPattern   = regexp.MustCompile(`\$\d+|:\w+|@\w+`)
+	inListPattern        = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)+\s*\)`)
+	whitespacePattern    = regexp.MustCompile(`\s+`)
+)
+
+// NormalizeQuery collapses whitespace and replaces literals and placeholders
+// with ?, so queries differing only in values group together and no values
+// are logged
+func NormalizeQuery(query string) string {
+	q := stringLiteralPattern.ReplaceAllString(query, "?")
+	q = placeholderPattern.ReplaceAllString(q, "?")
+	q = numberLiteralPattern.ReplaceAllString(q, "?")
+	q = inListPattern.ReplaceAllString(q, "(?)")
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(q, " "))
+}
+
+// redactArgs describes arguments by type and size only
+func redactArgs(args []driver.NamedValue) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.Value.(type) {
+		case nil:
+			redacted[i] = "nil"
+		case string:
+			redacted[i] = fmt.Sprintf("string(%d)", len(v))
+		case []byte:
+			redacted[i] = fmt.Sprintf("bytes(%d)", len(v))
+		default:
+			redacted[i] = fmt.Sprintf("%T", v)
+		}
+	}
+	return redacted
+}
+
+// logSlowQuery is the default slow query handler
+func logSlowQuery(q SlowQuery) {
+	log.Printf("[DB] slow query on %s (%s): %s args=%v", q.Node, q.Duration, q.Query, q.Args)
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func newInstrumentedTestDB(t *testing.T, threshold time.Duration) (*sql.DB, *QueryMetrics, *[]SlowQuery) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		slow []SlowQuery
+	)
+	metrics := NewQueryMetrics(QueryMetricsConfig{
+		SlowQueryThreshold: threshold,
+		OnSlowQuery: func(q SlowQuery) {
+			mu.Lock()
+			slow = append(slow, q)
+			mu.Unlock()
+		},
+	})
+	db, err := newSQL(Config{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "test.db")}, metrics)
+	if err != nil {
+		t.Fatalf("Failed to open instrumented database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, metrics, &slow
+}
+
+func TestInstrumentedQueries(t *testing.T) {
+	db, metrics, _ := newInstrumentedTestDB(t, -1)
+	ctx := context.Background()
+
+	if _, err := db.Exec(`CREATE TABLE users (email TEXT PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO users (email) VALUES (?)`, "a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO users (email) VALUES (?)`, "a@example.com"); err == nil {
+		t.Fatal("Expected a constraint violation")
+	}
+	if _, err := db.Query(`SELEC nonsense`); err == nil {
+		t.Fatal("Expected a syntax error")
+	}
+
+	stmt, err := db.Prepare(`SELECT COUNT(*) FROM users WHERE email = ?`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := stmt.QueryRow("a@example.com").Scan(&n); err != nil || n != 1 {
+		t.Fatalf("Prepared query failed: %d, %v", n, err)
+	}
+	stmt.Close()
+
+	if err := WithTx(ctx, db, nil, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM users`)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := metrics.WritePrometheus(&out); err != nil {
+		t.Fatal(err)
+	}
+	text := out.String()
+	for _, want := range []string{
+		`db_queries_total{node="primary",operation="exec",result="success"} 3`,
+		`db_queries_total{node="primary",operation="exec",result="failure"} 1`,
+		`db_queries_total{node="primary",operation="query",result="success"} 1`,
+		`db_queries_total{node="primary",operation="commit",result="success"} 1`,
+		`db_query_duration_seconds_count{node="primary",operation="exec"} 4`,
+		`db_query_duration_seconds_bucket{node="primary",operation="exec",le="+Inf"} 4`,
+		`db_errors_total{node="primary",class="constraint"} 1`,
+		`db_errors_total{node="primary",class="syntax"} 1`,
+		`# TYPE db_pool_open_connections gauge`,
+		`db_pool_max_open_connections{node="primary"} 0`,
+		`db_pool_closed_total{node="primary",reason="max_lifetime"} 0`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Missing %q in:\n%s", want, text)
+		}
+	}
+}
+
+func TestUnwrapConn(t *testing.T) {
+	db, _, _ := newInstrumentedTestDB(t, -1)
+	ctx := context.Background()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(driverConn any) error {
+		if _, ok := driverConn.(*instrumentedConn); !ok {
+			t.Errorf("Expected the instrumented connection, got %T", driverConn)
+		}
+		unwrapped := UnwrapConn(driverConn)
+		if _, ok := unwrapped.(*instrumentedConn); ok {
+			t.Error("Expected the driver connection after UnwrapConn")
+		}
+		if UnwrapConn(unwrapped) != unwrapped {
+			t.Error("Expected UnwrapConn to return driver connections unchanged")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSlowQueries(t *testing.T) {
+	db, metrics, slow := newInstrumentedTestDB(t, time.Nanosecond)
+
+	if _, err := db.Exec(`CREATE TABLE secrets (value TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO secrets (value)\n  VALUES (?), ('inline-secret'), (42)", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*slow) != 2 {
+		t.Fatalf("Expected 2 slow queries, got %d", len(*slow))
+	}
+	q := (*slow)[1]
+	if q.Node != "primary" || q.Duration <= 0 {
+		t.Errorf("Unexpected slow query: %+v", q)
+	}
+	if q.Query != "INSERT INTO secrets (value) VALUES (?), (?), (?)" {
+		t.Errorf("Unexpected normalized query: %q", q.Query)
+	}
+	if len(q.Args) != 1 || q.Args[0] != "string(7)" {
+		t.Errorf("Expected redacted args, got %v", q.Args)
+	}
+	if got := metrics.SlowQueries(); len(got) != 2 || got[1].Query != q.Query {
+		t.Errorf("Unexpected slow query log: %+v", got)
+	}
+
+	var out strings.Builder
+	_ = metrics.WritePrometheus(&out)
+	if !strings.Contains(out.String(), `db_slow_queries_total{node="primary"} 2`) {
+		t.Errorf("Missing slow query counter in:\n%s", out.String())
+	}
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"SELECT * FROM users WHERE id = 42", "SELECT * FROM users WHERE id = ?"},
+		{"SELECT * FROM users WHERE name = 'O''Brien'", "SELECT * FROM users WHERE name = ?"},
+		{"SELECT * FROM t WHERE a = $1 AND b = $2", "SELECT * FROM t WHERE a = ? AND b = ?"},
+		{"SELECT * FROM t WHERE id IN (1, 2, 3)", "SELECT * FROM t WHERE id IN (?)"},
+		{"SELECT * FROM t2 WHERE x = :name", "SELECT * FROM t2 WHERE x = ?"},
+		{"  SELECT\n\t1  ", "SELECT ?"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeQuery(tt.in); got != tt.want {
+			t.Errorf("NormalizeQuery(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{context.DeadlineExceeded, ErrorClassTimeout},
+		{context.Canceled, ErrorClassCanceled},
+		{sql.ErrConnDone, ErrorClassConnection},
+		{&pgconn.PgError{Code: "40001"}, ErrorClassConflict},
+		{&pgconn.PgError{Code: "23505"}, ErrorClassConstraint},
+		{&pgconn.PgError{Code: "42P01"}, ErrorClassSyntax},
+		{&pgconn.PgError{Code: "57014"}, ErrorClassTimeout},
+		{&mysql.MySQLError{Number: 1062}, ErrorClassConstraint},
+		{&mysql.MySQLError{Number: 1064}, ErrorClassSyntax},
+		{errors.New("boom"), ErrorClassOther},
+	}
+	for _, tt := range tests {
+		if got := ClassifyError(tt.err); got != tt.want {
+			t.Errorf("ClassifyError(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+// Package dbtest provides test databases for the database packages
+package dbtest
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/gobeaver/beaver-kit/database"
+)
+
+// SQLite opens an empty SQLite database that is closed when the test ends
+func SQLite(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := database.NewSQL(database.Config{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("Failed to open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
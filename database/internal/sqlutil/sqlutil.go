@@ -0,0 +1,25 @@
+// Package sqlutil holds SQL building helpers shared by the database
+// subpackages
+package sqlutil
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Placeholders returns n comma-separated ? placeholders, for IN lists
+func Placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// Truncate shortens s to at most n bytes without splitting a character, for
+// error message columns
+func Truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
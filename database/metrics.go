@@ -0,0 +1,365 @@
+// database/metrics.go - query and pool metrics in Prometheus text format
+package database
+
+import (
+	"bufio"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDurationBuckets are the histogram buckets (seconds) used when
+// QueryMetricsConfig.Buckets is empty
+var DefaultDurationBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// QueryMetricsConfig configures QueryMetrics
+type QueryMetricsConfig struct {
+	// Namespace prefixes every metric name (default "db")
+	Namespace string
+
+	// Buckets are the query duration histogram upper bounds in seconds
+	Buckets []float64
+
+	// SlowQueryThreshold marks queries as slow (default 200ms; negative
+	// disables slow query reporting)
+	SlowQueryThreshold time.Duration
+
+	// OnSlowQuery is called for each slow query (default: log.Printf)
+	OnSlowQuery func(SlowQuery)
+
+	// SlowQueryLogSize is how many recent slow queries SlowQueries keeps
+	// (default 100)
+	SlowQueryLogSize int
+}
+
+// QueryMetrics records query latency, errors by class and slow queries for
+// instrumented connections, and serves them together with connection pool
+// statistics in the Prometheus text exposition format.
+//
+// Exported series:
+//
+//	<ns>_queries_total{node,operation,result}
+//	<ns>_query_duration_seconds{node,operation} (histogram)
+//	<ns>_errors_total{node,class}
+//	<ns>_slow_queries_total{node}
+//	<ns>_pool_open_connections{node}, <ns>_pool_in_use_connections{node},
+//	<ns>_pool_idle_connections{node}, <ns>_pool_max_open_connections{node}
+//	<ns>_pool_wait_count_total{node}, <ns>_pool_wait_duration_seconds_total{node}
+//	<ns>_pool_closed_total{node,reason}
+type QueryMetrics struct {
+	namespace     string
+	buckets       []float64
+	slowThreshold time.Duration
+	onSlowQuery   func(SlowQuery)
+	slowLogSize   int
+
+	mu        sync.Mutex
+	queries   map[metricLabels]int64
+	durations map[metricLabels]*histogram
+	errors    map[metricLabels]int64
+	slow      map[string]int64
+	slowLog   []SlowQuery
+	pools     map[string]*sql.DB
+}
+
+// metricLabels identifies a series; value holds the result or error class
+type metricLabels struct {
+	node      string
+	operation string
+	value     string
+}
+
+// histogram holds non-cumulative bucket counts; the last entry is +Inf
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewQueryMetrics creates a query metrics recorder
+func NewQueryMetrics(config QueryMetricsConfig) *QueryMetrics {
+	if config.Namespace == "" {
+		config.Namespace = "db"
+	}
+	if config.SlowQueryThreshold == 0 {
+		config.SlowQueryThreshold = 200 * time.Millisecond
+	}
+	if config.OnSlowQuery == nil {
+		config.OnSlowQuery = logSlowQuery
+	}
+	if config.SlowQueryLogSize <= 0 {
+		config.SlowQueryLogSize = 100
+	}
+	buckets := config.Buckets
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &QueryMetrics{
+		namespace:     config.Namespace,
+		buckets:       buckets,
+		slowThreshold: config.SlowQueryThreshold,
+		onSlowQuery:   config.OnSlowQuery,
+		slowLogSize:   config.SlowQueryLogSize,
+		queries:       make(map[metricLabels]int64),
+		durations:     make(map[metricLabels]*histogram),
+		errors:        make(map[metricLabels]int64),
+		slow:          make(map[string]int64),
+		pools:         make(map[string]*sql.DB),
+	}
+}
+
+// newConfigMetrics creates the metrics for cfg, or nil when disabled
+func newConfigMetrics(cfg Config) *QueryMetrics {
+	if !cfg.EnableMetrics {
+		return nil
+	}
+	return NewQueryMetrics(QueryMetricsConfig{
+		SlowQueryThreshold: time.Duration(cfg.SlowQueryThreshold) * time.Millisecond,
+	})
+}
+
+// RegisterPool exports db's connection pool statistics under node
+func (m *QueryMetrics) RegisterPool(node string, db *sql.DB) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.pools[node] = db
+	m.mu.Unlock()
+}
+
+// SlowQueries returns the most recent slow queries, oldest first
+func (m *QueryMetrics) SlowQueries() []SlowQuery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]SlowQuery(nil), m.slowLog...)
+}
+
+// Reset clears recorded queries, errors and slow queries; registered pools
+// are kept
+func (m *QueryMetrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queries = make(map[metricLabels]int64)
+	m.durations = make(map[metricLabels]*histogram)
+	m.errors = make(map[metricLabels]int64)
+	m.slow = make(map[string]int64)
+	m.slowLog = nil
+}
+
+func (m *QueryMetrics) observe(node, operation, query string, args []driver.NamedValue, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	seconds := duration.Seconds()
+	isSlow := m.slowThreshold > 0 && duration >= m.slowThreshold && query != ""
+
+	var slowQuery SlowQuery
+	if isSlow {
+		slowQuery = SlowQuery{
+			Node:     node,
+			Query:    NormalizeQuery(query),
+			Args:     redactArgs(args),
+			Duration: duration,
+			Time:     time.Now(),
+		}
+		if err != nil {
+			slowQuery.Error = ClassifyError(err)
+		}
+	}
+
+	m.mu.Lock()
+	m.queries[metricLabels{node, operation, result}]++
+
+	key := metricLabels{node: node, operation: operation}
+	h, ok := m.durations[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets)+1)}
+		m.durations[key] = h
+	}
+	h.counts[sort.SearchFloat64s(m.buckets, seconds)]++
+	h.sum += seconds
+	h.count++
+
+	if err != nil {
+		m.errors[metricLabels{node: node, value: ClassifyError(err)}]++
+	}
+	if isSlow {
+		m.slow[node]++
+		m.slowLog = append(m.slowLog, slowQuery)
+		if len(m.slowLog) > m.slowLogSize {
+			m.slowLog = m.slowLog[len(m.slowLog)-m.slowLogSize:]
+		}
+	}
+	m.mu.Unlock()
+
+	if isSlow {
+		m.onSlowQuery(slowQuery)
+	}
+}
+
+// recordError counts an error outside a query, e.g. a failed connect
+func (m *QueryMetrics) recordError(node string, err error) {
+	m.mu.Lock()
+	m.errors[metricLabels{node: node, value: ClassifyError(err)}]++
+	m.mu.Unlock()
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format
+func (m *QueryMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.WritePrometheus(w)
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format
+func (m *QueryMetrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	ns := m.namespace
+
+	writeHeader(bw, ns+"_queries_total", "counter", "Database operations by node, operation and result.")
+	for _, l := range sortedLabels(m.queries) {
+		fmt.Fprintf(bw, "%s_queries_total%s %d\n", ns,
+			formatLabels("node", l.node, "operation", l.operation, "result", l.value), m.queries[l])
+	}
+
+	writeHeader(bw, ns+"_query_duration_seconds", "histogram", "Database operation latency in seconds.")
+	for _, l := range sortedLabels(m.durations) {
+		h := m.durations[l]
+		var cumulative uint64
+		for i, upper := range m.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(bw, "%s_query_duration_seconds_bucket%s %d\n", ns,
+				formatLabels("node", l.node, "operation", l.operation, "le", formatFloat(upper)), cumulative)
+		}
+		labels := formatLabels("node", l.node, "operation", l.operation)
+		fmt.Fprintf(bw, "%s_query_duration_seconds_bucket%s %d\n", ns,
+			formatLabels("node", l.node, "operation", l.operation, "le", "+Inf"), h.count)
+		fmt.Fprintf(bw, "%s_query_duration_seconds_sum%s %s\n", ns, labels, formatFloat(h.sum))
+		fmt.Fprintf(bw, "%s_query_duration_seconds_count%s %d\n", ns, labels, h.count)
+	}
+
+	writeHeader(bw, ns+"_errors_total", "counter", "Database errors by node and class.")
+	for _, l := range sortedLabels(m.errors) {
+		fmt.Fprintf(bw, "%s_errors_total%s %d\n", ns, formatLabels("node", l.node, "class", l.value), m.errors[l])
+	}
+
+	writeHeader(bw, ns+"_slow_queries_total", "counter", "Queries slower than the slow query threshold.")
+	for _, node := range sortedKeys(m.slow) {
+		fmt.Fprintf(bw, "%s_slow_queries_total%s %d\n", ns, formatLabels("node", node), m.slow[node])
+	}
+
+	nodes := sortedKeys(m.pools)
+	stats := make(map[string]sql.DBStats, len(nodes))
+	for _, node := range nodes {
+		stats[node] = m.pools[node].Stats()
+	}
+	gauges := []struct {
+		name, help string
+		value      func(sql.DBStats) int
+	}{
+		{"pool_open_connections", "Open connections, in use and idle.", func(s sql.DBStats) int { return s.OpenConnections }},
+		{"pool_in_use_connections", "Connections currently in use.", func(s sql.DBStats) int { return s.InUse }},
+		{"pool_idle_connections", "Idle connections.", func(s sql.DBStats) int { return s.Idle }},
+		{"pool_max_open_connections", "Maximum open connections (0 is unlimited).", func(s sql.DBStats) int { return s.MaxOpenConnections }},
+	}
+	for _, g := range gauges {
+		writeHeader(bw, ns+"_"+g.name, "gauge", g.help)
+		for _, node := range nodes {
+			fmt.Fprintf(bw, "%s_%s%s %d\n", ns, g.name, formatLabels("node", node), g.value(stats[node]))
+		}
+	}
+
+	writeHeader(bw, ns+"_pool_wait_count_total", "counter", "Connections waited for because the pool was exhausted.")
+	for _, node := range nodes {
+		fmt.Fprintf(bw, "%s_pool_wait_count_total%s %d\n", ns, formatLabels("node", node), stats[node].WaitCount)
+	}
+
+	writeHeader(bw, ns+"_pool_wait_duration_seconds_total", "counter", "Time spent waiting for a connection in seconds.")
+	for _, node := range nodes {
+		fmt.Fprintf(bw, "%s_pool_wait_duration_seconds_total%s %s\n", ns, formatLabels("node", node),
+			formatFloat(stats[node].WaitDuration.Seconds()))
+	}
+
+	writeHeader(bw, ns+"_pool_closed_total", "counter", "Connections closed by the pool by reason.")
+	for _, node := range nodes {
+		s := stats[node]
+		fmt.Fprintf(bw, "%s_pool_closed_total%s %d\n", ns, formatLabels("node", node, "reason", "max_idle"), s.MaxIdleClosed)
+		fmt.Fprintf(bw, "%s_pool_closed_total%s %d\n", ns, formatLabels("node", node, "reason", "max_idle_time"), s.MaxIdleTimeClosed)
+		fmt.Fprintf(bw, "%s_pool_closed_total%s %d\n", ns, formatLabels("node", node, "reason", "max_lifetime"), s.MaxLifetimeClosed)
+	}
+
+	return bw.Flush()
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sortedLabels returns map keys in a stable order so scrapes are diffable
+func sortedLabels[V any](m map[metricLabels]V) []metricLabels {
+	keys := make([]metricLabels, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.node != b.node {
+			return a.node < b.node
+		}
+		if a.operation != b.operation {
+			return a.operation < b.operation
+		}
+		return a.value < b.value
+	})
+	return keys
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatLabels renders name/value pairs as {a="1",b="2"}
+func formatLabels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,624 @@
+// database/migrate.go - versioned SQL migrations for *sql.DB
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration errors
+var (
+	ErrNoMigrations      = errors.New("no migrations found")
+	ErrMigrationChecksum = errors.New("applied migration was modified")
+	ErrMigrationMissing  = errors.New("applied migration not found in source")
+	ErrMigrationLocked   = errors.New("migration lock held by another process")
+	ErrIrreversible      = errors.New("migration has no down script")
+	ErrInvalidMigration  = errors.New("invalid migration file")
+)
+
+// staleMigrationLock is how long a table lock (sqlite, libsql) is honored
+// before it is assumed to belong to a crashed process
+const staleMigrationLock = 15 * time.Minute
+
+// migrationFilePattern matches 0001_create_users.up.sql and 0001_create_users.down.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([^.]+)\.(up|down)\.sql$`)
+
+// migrationTablePattern restricts table names to plain or schema-qualified identifiers
+var migrationTablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 of Up
+}
+
+// MigrationStatus describes a migration in the source, the database or both
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+
+	// Modified reports that the applied checksum differs from the source
+	Modified bool
+
+	// Missing reports an applied migration that is no longer in the source
+	Missing bool
+}
+
+// MigratorConfig configures a Migrator
+type MigratorConfig struct {
+	// Driver selects SQL syntax and locking: postgres, mysql, sqlite or libsql
+	// (and their aliases accepted by Config.Driver)
+	Driver string
+
+	// Table records applied migrations, default schema_migrations
+	Table string
+
+	// LockTimeout bounds the wait for another process's migrations, default 1 minute
+	LockTimeout time.Duration
+}
+
+// Migrator applies versioned up/down SQL files.
+//
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql and
+// read from any fs.FS, e.g. os.DirFS("migrations") or an embed.FS (use
+// fs.Sub for a subdirectory). Applied versions are recorded in the migrations
+// table with a checksum of the up script. Every run holds a database lock
+// (advisory locks on postgres and mysql, a lock table on sqlite and libsql)
+// so replicas starting together apply each migration once.
+//
+// Each migration runs in a transaction with its bookkeeping. MySQL commits
+// DDL implicitly, so a failing MySQL migration can be partially applied.
+// MySQL scripts are split into statements on semicolons; stored programs
+// containing semicolons are not supported there.
+type Migrator struct {
+	db          *sql.DB
+	dialect     string
+	table       string
+	lockTimeout time.Duration
+	migrations  []Migration
+}
+
+// NewMigrator loads the migrations in source
+func NewMigrator(db *sql.DB, source fs.FS, cfg MigratorConfig) (*Migrator, error) {
+	if db == nil {
+		return nil, fmt.Errorf("%w: sql.DB instance is required for migrations", ErrInvalidConfig)
+	}
+
+	dialect, err := Dialect(cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	table := cfg.Table
+	if table == "" {
+		table = "schema_migrations"
+	}
+	if !migrationTablePattern.MatchString(table) {
+		return nil, fmt.Errorf("%w: invalid migrations table %q", ErrInvalidConfig, table)
+	}
+
+	lockTimeout := cfg.LockTimeout
+	if lockTimeout <= 0 {
+		lockTimeout = time.Minute
+	}
+
+	migrations, err := loadMigrations(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:          db,
+		dialect:     dialect,
+		table:       table,
+		lockTimeout: lockTimeout,
+		migrations:  migrations,
+	}, nil
+}
+
+// Migrations returns the migrations loaded from the source, oldest first
+func (m *Migrator) Migrations() []Migration {
+	return append([]Migration(nil), m.migrations...)
+}
+
+// Up applies all pending migrations
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.run(ctx, func(conn *sql.Conn, applied map[int64]appliedMigration) error {
+		return m.up(ctx, conn, applied, -1)
+	})
+}
+
+// Down rolls back the last steps applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.run(ctx, func(conn *sql.Conn, applied map[int64]appliedMigration) error {
+		versions := appliedVersions(applied)
+		if steps <= 0 {
+			return nil
+		}
+		if steps > len(versions) {
+			steps = len(versions)
+		}
+		return m.down(ctx, conn, versions[len(versions)-steps:])
+	})
+}
+
+// To migrates up or down until version is the latest applied migration.
+// To(ctx, 0) rolls back every migration.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	return m.run(ctx, func(conn *sql.Conn, applied map[int64]appliedMigration) error {
+		if version > 0 {
+			if _, ok := m.find(version); !ok {
+				return fmt.Errorf("%w: version %d", ErrNoMigrations, version)
+			}
+		}
+
+		var rollback []int64
+		for _, v := range appliedVersions(applied) {
+			if v > version {
+				rollback = append(rollback, v)
+			}
+		}
+		if err := m.down(ctx, conn, rollback); err != nil {
+			return err
+		}
+		return m.up(ctx, conn, applied, version)
+	})
+}
+
+// Version returns the latest applied migration version, or 0
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	applied, err := m.lockedApplied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	versions := appliedVersions(applied)
+	if len(versions) == 0 {
+		return 0, nil
+	}
+	return versions[len(versions)-1], nil
+}
+
+// Status lists every migration in the source or the database, oldest first
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.lockedApplied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.appliedAt
+			status.Modified = record.checksum != migration.Checksum
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for version, record := range applied {
+		statuses = append(statuses, MigrationStatus{
+			Version:   version,
+			Name:      record.name,
+			Applied:   true,
+			AppliedAt: record.appliedAt,
+			Missing:   true,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// lockedApplied reads the migrations table under the migration lock
+func (m *Migrator) lockedApplied(ctx context.Context) (applied map[int64]appliedMigration, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err = m.applied(ctx, conn)
+		return err
+	})
+	return applied, err
+}
+
+// appliedMigration is a row of the migrations table
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// run holds the migration lock while it validates checksums and runs fn
+func (m *Migrator) run(ctx context.Context, fn func(*sql.Conn, map[int64]appliedMigration) error) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for version, record := range applied {
+			if migration, ok := m.find(version); ok && migration.Checksum != record.checksum {
+				return fmt.Errorf("%w: %d_%s", ErrMigrationChecksum, version, migration.Name)
+			}
+		}
+
+		return fn(conn, applied)
+	})
+}
+
+// locked holds the migration lock on a dedicated connection while fn runs.
+// The migrations table is created under the lock, because concurrent
+// CREATE TABLE IF NOT EXISTS can fail on PostgreSQL.
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	unlock, err := m.lock(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if unlockErr := unlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+
+	if err := m.createTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// up applies pending migrations up to target (-1 for all)
+func (m *Migrator) up(ctx context.Context, conn *sql.Conn, applied map[int64]appliedMigration, target int64) error {
+	for _, migration := range m.migrations {
+		if target >= 0 && migration.Version > target {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err := m.apply(ctx, conn, migration.Up, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, m.rebind(fmt.Sprintf(
+				`INSERT INTO %s (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`, m.table)),
+				migration.Version, migration.Name, migration.Checksum, time.Now().Unix())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// down rolls back versions, newest first
+func (m *Migrator) down(ctx context.Context, conn *sql.Conn, versions []int64) error {
+	for i := len(versions) - 1; i >= 0; i-- {
+		version := versions[i]
+		migration, ok := m.find(version)
+		if !ok {
+			return fmt.Errorf("%w: version %d", ErrMigrationMissing, version)
+		}
+		if strings.TrimSpace(migration.Down) == "" {
+			return fmt.Errorf("%w: %d_%s", ErrIrreversible, version, migration.Name)
+		}
+
+		err := m.apply(ctx, conn, migration.Down, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, m.rebind(fmt.Sprintf(`DELETE FROM %s WHERE version = ?`, m.table)), version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("rollback of %d_%s failed: %w", version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// apply runs a script and its bookkeeping in one transaction
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, script string, record func(*sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	statements := []string{script}
+	if m.dialect == "mysql" {
+		statements = splitStatements(script)
+	}
+	for _, statement := range statements {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	if err := record(tx); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) createTable(ctx context.Context, q Querier) error {
+	_, err := q.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version BIGINT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	checksum VARCHAR(64) NOT NULL,
+	applied_at BIGINT NOT NULL
+)`, m.table))
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	return nil
+}
+
+func (m *Migrator) applied(ctx context.Context, q Querier) (map[int64]appliedMigration, error) {
+	rows, err := q.QueryContext(ctx, fmt.Sprintf(`SELECT version, name, checksum, applied_at FROM %s`, m.table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations table: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var (
+			version   int64
+			record    appliedMigration
+			appliedAt int64
+		)
+		if err := rows.Scan(&version, &record.name, &record.checksum, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read migrations table: %w", err)
+		}
+		record.appliedAt = time.Unix(appliedAt, 0)
+		applied[version] = record
+	}
+	return applied, rows.Err()
+}
+
+// lock takes the migration lock on conn and returns its release function
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) (func() error, error) {
+	lockCtx, cancel := context.WithTimeout(ctx, m.lockTimeout)
+	defer cancel()
+
+	switch m.dialect {
+	case "postgres":
+		key := m.lockKey()
+		if _, err := conn.ExecContext(lockCtx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+			if lockCtx.Err() != nil {
+				return nil, ErrMigrationLocked
+			}
+			return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		return func() error {
+			_, err := conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, key)
+			return err
+		}, nil
+
+	case "mysql":
+		name := fmt.Sprintf("beaver_migrate_%d", m.lockKey())
+		var acquired sql.NullInt64
+		err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, name, int(m.lockTimeout.Seconds())).Scan(&acquired)
+		if err != nil {
+			return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if acquired.Int64 != 1 {
+			return nil, ErrMigrationLocked
+		}
+		return func() error {
+			_, err := conn.ExecContext(context.WithoutCancel(ctx), `SELECT RELEASE_LOCK(?)`, name)
+			return err
+		}, nil
+
+	default:
+		return m.tableLock(ctx, lockCtx, conn)
+	}
+}
+
+// tableLock emulates an advisory lock with a single-row table for databases
+// without one (sqlite, libsql)
+func (m *Migrator) tableLock(ctx, lockCtx context.Context, conn *sql.Conn) (func() error, error) {
+	lockTable := m.table + "_lock"
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s (id INTEGER PRIMARY KEY, locked_at BIGINT NOT NULL)`, lockTable)); err != nil {
+		return nil, fmt.Errorf("failed to create migration lock table: %w", err)
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		_, _ = conn.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE locked_at < ?`, lockTable),
+			now.Add(-staleMigrationLock).Unix())
+		_, err := conn.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, locked_at) VALUES (1, ?)`, lockTable), now.Unix())
+		if err == nil {
+			return func() error {
+				_, err := conn.ExecContext(context.WithoutCancel(ctx), fmt.Sprintf(`DELETE FROM %s WHERE id = 1`, lockTable))
+				return err
+			}, nil
+		}
+
+		select {
+		case <-lockCtx.Done():
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, ErrMigrationLocked
+		case <-ticker.C:
+		}
+	}
+}
+
+// lockKey derives the advisory lock key from the migrations table
+func (m *Migrator) lockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte("beaver-kit/database:" + m.table))
+	return int64(h.Sum64() >> 1)
+}
+
+// appliedVersions returns the applied versions, oldest first
+func appliedVersions(applied map[int64]appliedMigration) []int64 {
+	versions := make([]int64, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	i := sort.Search(len(m.migrations), func(i int) bool { return m.migrations[i].Version >= version })
+	if i < len(m.migrations) && m.migrations[i].Version == version {
+		return m.migrations[i], true
+	}
+	return Migration{}, false
+}
+
+// rebind converts ? placeholders for the migrator's dialect
+func (m *Migrator) rebind(query string) string {
+	return Rebind(m.dialect, query)
+}
+
+// loadMigrations reads and pairs the up and down scripts in source
+func loadMigrations(source fs.FS) ([]Migration, error) {
+	if source == nil {
+		return nil, fmt.Errorf("%w: migration source is required", ErrInvalidConfig)
+	}
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, entry.Name())
+		}
+
+		content, err := fs.ReadFile(source, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("%w: version %d used by %s and %s", ErrInvalidMigration, version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("%w: %d_%s has no up script", ErrInvalidMigration, migration.Version, migration.Name)
+		}
+		sum := sha256.Sum256([]byte(migration.Up))
+		migration.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *migration)
+	}
+	if len(migrations) == 0 {
+		return nil, ErrNoMigrations
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// splitStatements splits a script on semicolons outside quotes and comments
+func splitStatements(script string) []string {
+	var (
+		statements []string
+		start      int
+		quote      byte
+	)
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '-' && i+1 < len(script) && script[i+1] == '-', c == '#':
+			if end := strings.IndexByte(script[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(script)
+			}
+		case c == '/' && i+1 < len(script) && script[i+1] == '*':
+			if end := strings.Index(script[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(script)
+			}
+		case c == ';':
+			statements = append(statements, script[start:i])
+			start = i + 1
+		}
+	}
+	if rest := script[start:]; strings.TrimSpace(rest) != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// autoMigrate applies the migrations in source, or cfg.MigrationsPath when
+// source is nil, for Init with DB_AUTO_MIGRATE=true
+func autoMigrate(db *sql.DB, cfg Config, source fs.FS) error {
+	if source == nil {
+		if _, err := os.Stat(cfg.MigrationsPath); err != nil {
+			return fmt.Errorf("migrations path %q: %w", cfg.MigrationsPath, err)
+		}
+		source = os.DirFS(cfg.MigrationsPath)
+	}
+
+	driverName, _, err := resolveDSN(cfg)
+	if err != nil {
+		return err
+	}
+	migrator, err := NewMigrator(db, source, MigratorConfig{
+		Driver: driverName,
+		Table:  cfg.MigrationsTable,
+	})
+	if err != nil {
+		return err
+	}
+	return migrator.Up(context.Background())
+}
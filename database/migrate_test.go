@@ -0,0 +1,259 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT);")},
+		"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"0002_add_name.up.sql":       {Data: []byte("ALTER TABLE users ADD COLUMN name TEXT;\nCREATE INDEX users_email ON users (email);")},
+		"0002_add_name.down.sql":     {Data: []byte("DROP INDEX users_email;\nALTER TABLE users DROP COLUMN name;")},
+		"0003_create_posts.up.sql":   {Data: []byte("CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER);")},
+		"0003_create_posts.down.sql": {Data: []byte("DROP TABLE posts;")},
+		"README.md":                  {Data: []byte("ignored")},
+	}
+}
+
+func openTestSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := NewSQL(Config{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("Failed to open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&count); err != nil {
+		t.Fatalf("Failed to query sqlite_master: %v", err)
+	}
+	return count == 1
+}
+
+func TestMigratorUpDownTo(t *testing.T) {
+	db := openTestSQLite(t)
+	ctx := context.Background()
+
+	m, err := NewMigrator(db, testMigrations(), MigratorConfig{Driver: "sqlite3"})
+	if err != nil {
+		t.Fatalf("NewMigrator failed: %v", err)
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	if version, _ := m.Version(ctx); version != 3 {
+		t.Errorf("Expected version 3, got %d", version)
+	}
+	if !tableExists(t, db, "users") || !tableExists(t, db, "posts") {
+		t.Fatal("Expected users and posts tables")
+	}
+
+	// Running again is a no-op
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Second Up failed: %v", err)
+	}
+
+	if err := m.Down(ctx, 1); err != nil {
+		t.Fatalf("Down failed: %v", err)
+	}
+	if tableExists(t, db, "posts") {
+		t.Error("Expected posts to be dropped")
+	}
+
+	if err := m.To(ctx, 1); err != nil {
+		t.Fatalf("To(1) failed: %v", err)
+	}
+	if version, _ := m.Version(ctx); version != 1 {
+		t.Errorf("Expected version 1, got %d", version)
+	}
+
+	if err := m.To(ctx, 3); err != nil {
+		t.Fatalf("To(3) failed: %v", err)
+	}
+	if err := m.To(ctx, 0); err != nil {
+		t.Fatalf("To(0) failed: %v", err)
+	}
+	if tableExists(t, db, "users") {
+		t.Error("Expected every migration to be rolled back")
+	}
+	if err := m.To(ctx, 42); !errors.Is(err, ErrNoMigrations) {
+		t.Errorf("Expected ErrNoMigrations for unknown version, got %v", err)
+	}
+}
+
+func TestMigratorStatusAndChecksum(t *testing.T) {
+	db := openTestSQLite(t)
+	ctx := context.Background()
+
+	source := testMigrations()
+	m, _ := NewMigrator(db, source, MigratorConfig{Driver: "sqlite", Table: "app_migrations"})
+	if err := m.To(ctx, 2); err != nil {
+		t.Fatalf("To(2) failed: %v", err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	var applied []bool
+	for _, status := range statuses {
+		applied = append(applied, status.Applied)
+		if status.Applied && status.AppliedAt.IsZero() {
+			t.Errorf("Expected applied time for %d", status.Version)
+		}
+	}
+	if !reflect.DeepEqual(applied, []bool{true, true, false}) {
+		t.Errorf("Unexpected applied flags: %v", applied)
+	}
+
+	// Editing an applied migration is detected
+	source["0001_create_users.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE users (id BIGINT);")}
+	delete(source, "0002_add_name.up.sql")
+	delete(source, "0002_add_name.down.sql")
+	edited, err := NewMigrator(db, source, MigratorConfig{Driver: "sqlite", Table: "app_migrations"})
+	if err != nil {
+		t.Fatalf("NewMigrator failed: %v", err)
+	}
+	if err := edited.Up(ctx); !errors.Is(err, ErrMigrationChecksum) {
+		t.Errorf("Expected ErrMigrationChecksum, got %v", err)
+	}
+
+	statuses, _ = edited.Status(ctx)
+	if len(statuses) != 3 || !statuses[0].Modified || !statuses[1].Missing || statuses[2].Applied {
+		t.Errorf("Unexpected status: %+v", statuses)
+	}
+}
+
+func TestMigratorFailedMigrationRollsBack(t *testing.T) {
+	db := openTestSQLite(t)
+	ctx := context.Background()
+
+	source := testMigrations()
+	source["0004_broken.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE tags (id INTEGER);\nINSERT INTO missing_table VALUES (1);")}
+	m, _ := NewMigrator(db, source, MigratorConfig{Driver: "sqlite"})
+
+	if err := m.Up(ctx); err == nil {
+		t.Fatal("Expected broken migration to fail")
+	}
+	if version, _ := m.Version(ctx); version != 3 {
+		t.Errorf("Expected version 3 after failure, got %d", version)
+	}
+	if tableExists(t, db, "tags") {
+		t.Error("Expected the failed migration to be rolled back")
+	}
+	if err := m.Down(ctx, 1); err != nil {
+		t.Errorf("Expected Down to work after a failed Up: %v", err)
+	}
+
+	source["0005_irreversible.up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	delete(source, "0004_broken.up.sql")
+	m, _ = NewMigrator(db, source, MigratorConfig{Driver: "sqlite"})
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	if err := m.Down(ctx, 1); !errors.Is(err, ErrIrreversible) {
+		t.Errorf("Expected ErrIrreversible, got %v", err)
+	}
+}
+
+func TestMigratorLock(t *testing.T) {
+	db := openTestSQLite(t)
+	ctx := context.Background()
+
+	holder, _ := NewMigrator(db, testMigrations(), MigratorConfig{Driver: "sqlite"})
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get connection: %v", err)
+	}
+	defer conn.Close()
+	unlock, err := holder.lock(ctx, conn)
+	if err != nil {
+		t.Fatalf("Failed to take lock: %v", err)
+	}
+
+	waiter, _ := NewMigrator(db, testMigrations(), MigratorConfig{Driver: "sqlite", LockTimeout: 200 * time.Millisecond})
+	if err := waiter.Up(ctx); !errors.Is(err, ErrMigrationLocked) {
+		t.Fatalf("Expected ErrMigrationLocked, got %v", err)
+	}
+	if _, err := waiter.Status(ctx); !errors.Is(err, ErrMigrationLocked) {
+		t.Fatalf("Expected Status to wait for the lock, got %v", err)
+	}
+	if tableExists(t, db, "schema_migrations") {
+		t.Error("Expected the migrations table to be created only under the lock")
+	}
+
+	done := make(chan error, 1)
+	waiter.lockTimeout = 5 * time.Second
+	go func() { done <- waiter.Up(ctx) }()
+	time.Sleep(150 * time.Millisecond)
+	if err := unlock(); err != nil {
+		t.Fatalf("Failed to release lock: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Expected Up to proceed once the lock was released: %v", err)
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"bad name":   {"create_users.up.sql": {Data: []byte("SELECT 1;")}},
+		"missing up": {"0001_users.down.sql": {Data: []byte("SELECT 1;")}},
+		"version clash": {
+			"0001_users.up.sql": {Data: []byte("SELECT 1;")},
+			"0001_posts.up.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, source := range tests {
+		if _, err := loadMigrations(source); !errors.Is(err, ErrInvalidMigration) {
+			t.Errorf("%s: expected ErrInvalidMigration, got %v", name, err)
+		}
+	}
+	if _, err := loadMigrations(fstest.MapFS{}); !errors.Is(err, ErrNoMigrations) {
+		t.Errorf("Expected ErrNoMigrations, got %v", err)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := "CREATE TABLE a (v TEXT DEFAULT ';');\n-- comment; still comment\nINSERT INTO a VALUES ('it''s; fine');\n/* block; */ INSERT INTO a VALUES (\"x;y\");\n"
+	got := splitStatements(script)
+	if len(got) != 3 {
+		t.Fatalf("Expected 3 statements, got %d: %q", len(got), got)
+	}
+}
+
+func TestAutoMigrateFromPath(t *testing.T) {
+	dir := t.TempDir()
+	for name, file := range testMigrations() {
+		if err := os.WriteFile(filepath.Join(dir, name), file.Data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := openTestSQLite(t)
+	cfg := Config{Driver: "sqlite", MigrationsPath: dir, MigrationsTable: "schema_migrations"}
+	if err := autoMigrate(db, cfg, nil); err != nil {
+		t.Fatalf("autoMigrate failed: %v", err)
+	}
+	if !tableExists(t, db, "posts") {
+		t.Error("Expected migrations to be applied")
+	}
+
+	cfg.MigrationsPath = filepath.Join(dir, "missing")
+	if err := autoMigrate(db, cfg, nil); err == nil {
+		t.Error("Expected a missing migrations path to fail")
+	}
+}
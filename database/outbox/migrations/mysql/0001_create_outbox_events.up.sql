@@ -0,0 +1,16 @@
+CREATE TABLE outbox_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    topic VARCHAR(255) NOT NULL,
+    event_key VARCHAR(255) NOT NULL DEFAULT '',
+    payload LONGBLOB,
+    headers TEXT,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    available_at BIGINT NOT NULL,
+    claim_token VARCHAR(64),
+    last_error TEXT,
+    created_at BIGINT NOT NULL,
+    published_at BIGINT
+);
+
+CREATE INDEX idx_outbox_events_pending ON outbox_events (status, available_at);
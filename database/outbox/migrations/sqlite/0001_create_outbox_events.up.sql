@@ -0,0 +1,16 @@
+CREATE TABLE outbox_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    topic TEXT NOT NULL,
+    event_key TEXT NOT NULL DEFAULT '',
+    payload BLOB,
+    headers TEXT,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    available_at INTEGER NOT NULL,
+    claim_token TEXT,
+    last_error TEXT,
+    created_at INTEGER NOT NULL,
+    published_at INTEGER
+);
+
+CREATE INDEX idx_outbox_events_pending ON outbox_events (status, available_at);
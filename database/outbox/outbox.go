@@ -0,0 +1,234 @@
+// Package outbox implements the transactional outbox pattern: events are
+// written to an outbox table in the same transaction as the business data,
+// and a Relay publishes them afterwards. Events are delivered at least once,
+// so consumers should deduplicate by Event.ID.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/database"
+	"github.com/gobeaver/beaver-kit/database/internal/sqlutil"
+)
+
+// Event statuses
+const (
+	StatusPending   = "pending"
+	StatusPublished = "published"
+	StatusDead      = "dead"
+)
+
+// MigrationsTable records the outbox schema version, separate from the
+// application's migrations
+const MigrationsTable = "outbox_schema_migrations"
+
+// Common errors
+var (
+	ErrInvalidConfig = errors.New("invalid outbox configuration")
+	ErrInvalidEvent  = errors.New("invalid outbox event")
+
+	// ErrEventLost is passed to OnDead for an event whose last attempt's
+	// lease expired without an outcome, e.g. because its relay crashed
+	ErrEventLost = errors.New("event lost: lease expired on its last attempt")
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+// defaultTable is the table created by the embedded migrations
+const defaultTable = "outbox_events"
+
+var tablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Event is a message in the outbox
+type Event struct {
+	ID        int64
+	Topic     string
+	Key       string // optional partition or aggregate key
+	Payload   []byte
+	Headers   map[string]string
+	Attempts  int // delivery attempts so far, including the current one
+	CreatedAt time.Time
+	LastError string
+}
+
+// Config configures an Outbox
+type Config struct {
+	// Driver selects SQL syntax: pgx (postgres), mysql, sqlite or libsql.
+	// Empty uses the driver of the global database instance.
+	Driver string
+
+	// Table holds the events, default outbox_events. Migrate only creates
+	// the default table; create a custom one yourself with the columns of
+	// Migrations.
+	Table string
+}
+
+// Outbox writes and manages events in the outbox table
+type Outbox struct {
+	driver  string
+	dialect string
+	table   string
+	now     func() time.Time
+}
+
+// New creates an Outbox
+func New(config Config) (*Outbox, error) {
+	if config.Driver == "" {
+		config.Driver = database.DriverName()
+	}
+	dialect, err := dialectFor(config.Driver)
+	if err != nil {
+		return nil, err
+	}
+	if config.Table == "" {
+		config.Table = defaultTable
+	}
+	if !tablePattern.MatchString(config.Table) {
+		return nil, fmt.Errorf("%w: invalid table %q", ErrInvalidConfig, config.Table)
+	}
+	return &Outbox{driver: config.Driver, dialect: dialect, table: config.Table, now: time.Now}, nil
+}
+
+// dialectFor maps a driver name to the migrations directory
+func dialectFor(driver string) (string, error) {
+	dialect, err := database.Dialect(driver)
+	if err != nil {
+		return "", fmt.Errorf("%w: unsupported driver %q", ErrInvalidConfig, driver)
+	}
+	return dialect, nil
+}
+
+// Migrations returns the schema of the default outbox_events table for
+// driver, for database.NewMigrator
+func Migrations(driver string) (fs.FS, error) {
+	dialect, err := dialectFor(driver)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Sub(migrations, "migrations/"+dialect)
+}
+
+// Migrate creates or upgrades the outbox_events table, recording versions in
+// MigrationsTable. It fails with ErrInvalidConfig when Config.Table names
+// another table, which Migrate would not create.
+func (o *Outbox) Migrate(ctx context.Context, db *sql.DB) error {
+	if o.table != defaultTable {
+		return fmt.Errorf("%w: Migrate only creates %s, create table %s yourself", ErrInvalidConfig, defaultTable, o.table)
+	}
+	source, err := Migrations(o.driver)
+	if err != nil {
+		return err
+	}
+	migrator, err := database.NewMigrator(db, source, database.MigratorConfig{Driver: o.driver, Table: MigrationsTable})
+	if err != nil {
+		return err
+	}
+	return migrator.Up(ctx)
+}
+
+// Write adds events to the outbox. Pass the transaction that changes the
+// business data, so the events are stored if and only if it commits.
+func (o *Outbox) Write(ctx context.Context, tx database.Querier, events ...Event) error {
+	now := o.now().UnixMilli()
+	query := o.rebind(`INSERT INTO ` + o.table + ` (topic, event_key, payload, headers, status, attempts, available_at, created_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?)`)
+
+	for _, event := range events {
+		if event.Topic == "" {
+			return fmt.Errorf("%w: topic is required", ErrInvalidEvent)
+		}
+		var headers []byte
+		if len(event.Headers) > 0 {
+			var err error
+			if headers, err = json.Marshal(event.Headers); err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, query, event.Topic, event.Key, event.Payload, sql.NullString{String: string(headers), Valid: headers != nil}, StatusPending, now, now); err != nil {
+			return fmt.Errorf("failed to write outbox event: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeadLetters returns up to limit events that exhausted their attempts,
+// oldest first
+func (o *Outbox) DeadLetters(ctx context.Context, db database.Querier, limit int) ([]Event, error) {
+	query := o.rebind(`SELECT id, topic, event_key, payload, headers, attempts, created_at, last_error
+		FROM ` + o.table + ` WHERE status = ? ORDER BY id LIMIT ?`)
+	rows, err := db.QueryContext(ctx, query, StatusDead, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+// Requeue returns dead events to pending with their attempts reset
+func (o *Outbox) Requeue(ctx context.Context, db database.Querier, ids ...int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := []any{StatusPending, o.now().UnixMilli(), StatusDead}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	query := o.rebind(`UPDATE ` + o.table + ` SET status = ?, attempts = 0, available_at = ?, claim_token = NULL
+		WHERE status = ? AND id IN (` + sqlutil.Placeholders(len(ids)) + `)`)
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Purge deletes events published before olderThan ago
+func (o *Outbox) Purge(ctx context.Context, db database.Querier, olderThan time.Duration) (int64, error) {
+	query := o.rebind(`DELETE FROM ` + o.table + ` WHERE status = ? AND published_at < ?`)
+	result, err := db.ExecContext(ctx, query, StatusPublished, o.now().Add(-olderThan).UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (o *Outbox) rebind(query string) string {
+	return database.Rebind(o.driver, query)
+}
+
+// scanEvents reads id, topic, event_key, payload, headers, attempts,
+// created_at and last_error rows
+func scanEvents(rows *sql.Rows) ([]Event, error) {
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var (
+			event     Event
+			headers   sql.NullString
+			createdAt int64
+			lastError sql.NullString
+		)
+		if err := rows.Scan(&event.ID, &event.Topic, &event.Key, &event.Payload, &headers,
+			&event.Attempts, &createdAt, &lastError); err != nil {
+			return nil, err
+		}
+		if headers.Valid && headers.String != "" {
+			if err := json.Unmarshal([]byte(headers.String), &event.Headers); err != nil {
+				return nil, fmt.Errorf("invalid headers on outbox event %d: %w", event.ID, err)
+			}
+		}
+		event.CreatedAt = time.UnixMilli(createdAt)
+		event.LastError = lastError.String
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
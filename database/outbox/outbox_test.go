@@ -0,0 +1,270 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/database"
+	"github.com/gobeaver/beaver-kit/database/internal/dbtest"
+)
+
+func newTestOutbox(t *testing.T) (*Outbox, *sql.DB) {
+	t.Helper()
+	db := dbtest.SQLite(t)
+
+	o, err := New(Config{Driver: "sqlite"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	return o, db
+}
+
+// recordingPublisher records events and fails those whose topic is in fail
+type recordingPublisher struct {
+	mu        sync.Mutex
+	published []Event
+	fail      map[string]bool
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail[event.Topic] {
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, event)
+	return nil
+}
+
+func countStatus(t *testing.T, db *sql.DB, status string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM outbox_events WHERE status = ?`, status).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestWriteIsTransactional(t *testing.T) {
+	o, db := newTestOutbox(t)
+	ctx := context.Background()
+
+	err := database.WithTx(ctx, db, nil, func(tx *sql.Tx) error {
+		return o.Write(ctx, tx, Event{Topic: "user.created", Key: "42", Payload: []byte(`{"id":42}`), Headers: map[string]string{"trace": "abc"}})
+	})
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	_ = database.WithTx(ctx, db, nil, func(tx *sql.Tx) error {
+		if err := o.Write(ctx, tx, Event{Topic: "user.deleted"}); err != nil {
+			return err
+		}
+		return errors.New("business logic failed")
+	})
+
+	if n := countStatus(t, db, StatusPending); n != 1 {
+		t.Errorf("Expected only the committed event, got %d", n)
+	}
+	if err := o.Write(ctx, db, Event{}); !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("Expected ErrInvalidEvent, got %v", err)
+	}
+}
+
+func TestRelayPublishes(t *testing.T) {
+	o, db := newTestOutbox(t)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if err := o.Write(ctx, db, Event{Topic: "order.placed", Payload: []byte{byte(i)}, Headers: map[string]string{"n": "x"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pub := &recordingPublisher{}
+	relay := o.NewRelay(db, pub, RelayConfig{BatchSize: 3})
+
+	if n, err := relay.ProcessBatch(ctx); err != nil || n != 3 {
+		t.Fatalf("Expected a batch of 3, got %d (%v)", n, err)
+	}
+	if n, _ := relay.ProcessBatch(ctx); n != 2 {
+		t.Errorf("Expected the remaining 2, got %d", n)
+	}
+	if n, _ := relay.ProcessBatch(ctx); n != 0 {
+		t.Errorf("Expected nothing left, got %d", n)
+	}
+
+	if len(pub.published) != 5 || pub.published[0].Payload[0] != 0 || pub.published[4].Payload[0] != 4 {
+		t.Fatalf("Expected 5 events in order, got %+v", pub.published)
+	}
+	if e := pub.published[0]; e.Topic != "order.placed" || e.Headers["n"] != "x" || e.Attempts != 1 || e.CreatedAt.IsZero() {
+		t.Errorf("Unexpected event: %+v", e)
+	}
+	if n := countStatus(t, db, StatusPublished); n != 5 {
+		t.Errorf("Expected 5 published, got %d", n)
+	}
+
+	o.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if n, err := o.Purge(ctx, db, time.Hour); err != nil || n != 5 {
+		t.Errorf("Expected 5 purged, got %d (%v)", n, err)
+	}
+}
+
+func TestRelayRetriesAndDeadLetters(t *testing.T) {
+	o, db := newTestOutbox(t)
+	ctx := context.Background()
+	clock := time.Now()
+	o.now = func() time.Time { return clock }
+
+	if err := o.Write(ctx, db, Event{Topic: "flaky"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var dead []Event
+	pub := &recordingPublisher{fail: map[string]bool{"flaky": true}}
+	relay := o.NewRelay(db, pub, RelayConfig{
+		MaxAttempts: 3,
+		MinBackoff:  time.Minute,
+		OnDead:      func(e Event, err error) { dead = append(dead, e) },
+	})
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		if n, _ := relay.ProcessBatch(ctx); n != 1 {
+			t.Fatalf("Attempt %d: expected the event to be due", attempt)
+		}
+		if n, _ := relay.ProcessBatch(ctx); n != 0 {
+			t.Fatalf("Attempt %d: expected backoff before the retry", attempt)
+		}
+		clock = clock.Add(time.Hour)
+	}
+
+	if len(dead) != 1 || dead[0].Attempts != 3 {
+		t.Fatalf("Expected the event dead after 3 attempts, got %+v", dead)
+	}
+	letters, err := o.DeadLetters(ctx, db, 10)
+	if err != nil || len(letters) != 1 || letters[0].LastError != "broker unavailable" {
+		t.Fatalf("Unexpected dead letters: %+v (%v)", letters, err)
+	}
+
+	pub.fail = nil
+	if n, err := o.Requeue(ctx, db, letters[0].ID); err != nil || n != 1 {
+		t.Fatalf("Requeue failed: %d (%v)", n, err)
+	}
+	if n, _ := relay.ProcessBatch(ctx); n != 1 || len(pub.published) != 1 {
+		t.Error("Expected the requeued event to be published")
+	}
+}
+
+func TestRelayLeaseExpiry(t *testing.T) {
+	o, db := newTestOutbox(t)
+	ctx := context.Background()
+	clock := time.Now()
+	o.now = func() time.Time { return clock }
+
+	if err := o.Write(ctx, db, Event{Topic: "t"}); err != nil {
+		t.Fatal(err)
+	}
+
+	relay := o.NewRelay(db, &recordingPublisher{}, RelayConfig{Lease: time.Minute})
+	crashed, err := relay.claim(ctx, "crashed-relay")
+	if err != nil || len(crashed) != 1 {
+		t.Fatalf("Expected a claimed event, got %d (%v)", len(crashed), err)
+	}
+	if n, _ := relay.ProcessBatch(ctx); n != 0 {
+		t.Error("Expected the leased event to be hidden")
+	}
+
+	clock = clock.Add(2 * time.Minute)
+	if n, _ := relay.ProcessBatch(ctx); n != 1 {
+		t.Error("Expected the event to be reclaimed after the lease")
+	}
+
+	// The crashed relay can no longer complete it
+	if err := relay.complete(ctx, "crashed-relay", crashed[0]); err != nil {
+		t.Fatal(err)
+	}
+	var attempts int
+	_ = db.QueryRow(`SELECT attempts FROM outbox_events`).Scan(&attempts)
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestRelayDeadLettersLostEvents(t *testing.T) {
+	o, db := newTestOutbox(t)
+	ctx := context.Background()
+	clock := time.Now()
+	o.now = func() time.Time { return clock }
+
+	if err := o.Write(ctx, db, Event{Topic: "t"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var dead []error
+	publisher := &recordingPublisher{}
+	relay := o.NewRelay(db, publisher, RelayConfig{
+		Lease:       time.Minute,
+		MaxAttempts: 1,
+		OnDead:      func(event Event, err error) { dead = append(dead, err) },
+	})
+	if crashed, err := relay.claim(ctx, "crashed-relay"); err != nil || len(crashed) != 1 {
+		t.Fatalf("Expected a claimed event, got %d (%v)", len(crashed), err)
+	}
+
+	clock = clock.Add(2 * time.Minute)
+	if n, err := relay.ProcessBatch(ctx); err != nil || n != 0 {
+		t.Errorf("Expected the lost event not to be reclaimed, got %d (%v)", n, err)
+	}
+	if len(publisher.published) != 0 {
+		t.Errorf("Expected nothing published, got %d", len(publisher.published))
+	}
+	if len(dead) != 1 || !errors.Is(dead[0], ErrEventLost) {
+		t.Errorf("Expected OnDead with ErrEventLost, got %v", dead)
+	}
+	if countStatus(t, db, StatusDead) != 1 {
+		t.Error("Expected the event to be dead")
+	}
+
+	var lastError string
+	var token sql.NullString
+	if err := db.QueryRow(`SELECT last_error, claim_token FROM outbox_events`).Scan(&lastError, &token); err != nil {
+		t.Fatal(err)
+	}
+	if lastError != ErrEventLost.Error() || token.Valid {
+		t.Errorf("Unexpected dead event: %q %v", lastError, token)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	for _, driver := range []string{"pgx", "postgres", "mysql", "sqlite", "libsql"} {
+		source, err := Migrations(driver)
+		if err != nil {
+			t.Fatalf("Migrations(%s) failed: %v", driver, err)
+		}
+		if _, err := database.NewMigrator(&sql.DB{}, source, database.MigratorConfig{Driver: driver}); err != nil {
+			t.Errorf("Invalid migrations for %s: %v", driver, err)
+		}
+	}
+	if _, err := New(Config{Driver: "oracle"}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected unsupported driver to be rejected, got %v", err)
+	}
+}
+
+func TestMigrateRejectsCustomTable(t *testing.T) {
+	_, db := newTestOutbox(t)
+
+	o, err := New(Config{Driver: "sqlite", Table: "events"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Migrate(context.Background(), db); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected a custom table to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/database/internal/sqlutil"
+	"github.com/google/uuid"
+)
+
+// Publisher delivers events, e.g. to a message broker or webhook
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// PublisherFunc adapts a function to Publisher
+type PublisherFunc func(ctx context.Context, event Event) error
+
+// Publish implements Publisher
+func (f PublisherFunc) Publish(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// RelayConfig configures a Relay
+type RelayConfig struct {
+	// BatchSize is how many events are claimed at once (default 100)
+	BatchSize int
+
+	// PollInterval is the wait after a batch that was not full (default 1s)
+	PollInterval time.Duration
+
+	// Lease is how long claimed events are hidden from other relays; events
+	// of a relay that crashes are published again after it (default 30s)
+	Lease time.Duration
+
+	// MaxAttempts moves an event to the dead status after this many failed
+	// deliveries (default 10)
+	MaxAttempts int
+
+	// MinBackoff and MaxBackoff bound the exponential delay before an event
+	// is retried (default 1s and 5 minutes)
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// OnDead is called when an event moves to the dead status
+	OnDead func(event Event, err error)
+}
+
+// Relay claims pending events, publishes them and marks them done. Several
+// relays can run against the same table: PostgreSQL and MySQL claim with
+// FOR UPDATE SKIP LOCKED, SQLite and LibSQL with a single atomic UPDATE.
+type Relay struct {
+	outbox    *Outbox
+	db        *sql.DB
+	publisher Publisher
+	config    RelayConfig
+}
+
+// NewRelay creates a relay publishing the events in db
+func (o *Outbox) NewRelay(db *sql.DB, publisher Publisher, config RelayConfig) *Relay {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.Lease <= 0 {
+		config.Lease = 30 * time.Second
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 10
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = time.Second
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 5 * time.Minute
+	}
+	return &Relay{outbox: o, db: db, publisher: publisher, config: config}
+}
+
+// Run relays events until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		n, err := r.ProcessBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[OUTBOX] relay batch failed: %v", err)
+		}
+
+		wait := r.config.PollInterval
+		if err == nil && n == r.config.BatchSize {
+			wait = 0 // more events are likely waiting
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// ProcessBatch claims and publishes one batch, returning how many events it
+// claimed. Events whose last attempt's lease expired without an outcome,
+// because their relay crashed, are moved to dead first rather than claimed
+// again.
+func (r *Relay) ProcessBatch(ctx context.Context) (int, error) {
+	token := uuid.NewString()
+	lost, err := r.sweep(ctx, token)
+	if err != nil {
+		return 0, fmt.Errorf("failed to dead-letter lost outbox events: %w", err)
+	}
+	for _, event := range lost {
+		log.Printf("[OUTBOX] event %d (%s) dead after %d attempts: %v", event.ID, event.Topic, event.Attempts, ErrEventLost)
+		if r.config.OnDead != nil {
+			r.config.OnDead(event, ErrEventLost)
+		}
+	}
+
+	events, err := r.claim(ctx, token)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+
+	for _, event := range events {
+		if ctx.Err() != nil {
+			// Unpublished claims become available again when the lease ends
+			return len(events), ctx.Err()
+		}
+		if pubErr := r.publisher.Publish(ctx, event); pubErr != nil {
+			err = r.fail(ctx, token, event, pubErr)
+		} else {
+			err = r.complete(ctx, token, event)
+		}
+		if err != nil {
+			log.Printf("[OUTBOX] failed to update event %d: %v", event.ID, err)
+		}
+	}
+	return len(events), nil
+}
+
+// sweep moves due pending events that used up their attempts to dead and
+// returns them
+func (r *Relay) sweep(ctx context.Context, token string) ([]Event, error) {
+	o := r.outbox
+	err := r.update(ctx, `status = ?, claim_token = ?, last_error = ?`,
+		[]any{StatusDead, token, ErrEventLost.Error()},
+		`status = ? AND available_at <= ? AND attempts >= ?`,
+		[]any{StatusPending, o.now().UnixMilli(), r.config.MaxAttempts})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, o.rebind(`SELECT id, topic, event_key, payload, headers, attempts, created_at, last_error
+		FROM `+o.table+` WHERE claim_token = ? AND status = ? ORDER BY id`), token, StatusDead)
+	if err != nil {
+		return nil, err
+	}
+	events, err := scanEvents(rows)
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+
+	query := o.rebind(`UPDATE ` + o.table + ` SET claim_token = NULL WHERE claim_token = ? AND status = ?`)
+	if _, err := r.db.ExecContext(ctx, query, token, StatusDead); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// claim leases up to BatchSize due events to token
+func (r *Relay) claim(ctx context.Context, token string) ([]Event, error) {
+	o := r.outbox
+	now := o.now()
+
+	err := r.update(ctx, `available_at = ?, attempts = attempts + 1, claim_token = ?`,
+		[]any{now.Add(r.config.Lease).UnixMilli(), token},
+		`status = ? AND available_at <= ? AND attempts < ? ORDER BY id LIMIT ?`,
+		[]any{StatusPending, now.UnixMilli(), r.config.MaxAttempts, r.config.BatchSize})
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, o.rebind(`SELECT id, topic, event_key, payload, headers, attempts, created_at, last_error
+		FROM `+o.table+` WHERE claim_token = ? AND status = ? ORDER BY id`), token, StatusPending)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+// update applies set to the rows matching where, skipping rows locked by
+// other relays. SQLite and LibSQL serialize writes, so a single statement is
+// atomic there; PostgreSQL and MySQL lock the rows with FOR UPDATE SKIP
+// LOCKED first.
+func (r *Relay) update(ctx context.Context, set string, setArgs []any, where string, whereArgs []any) error {
+	o := r.outbox
+	if o.dialect == "sqlite" {
+		query := o.rebind(`UPDATE ` + o.table + ` SET ` + set + `
+			WHERE id IN (SELECT id FROM ` + o.table + ` WHERE ` + where + `)`)
+		_, err := r.db.ExecContext(ctx, query, append(setArgs, whereArgs...)...)
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, o.rebind(`SELECT id FROM `+o.table+` WHERE `+where+` FOR UPDATE SKIP LOCKED`), whereArgs...)
+	if err != nil {
+		return err
+	}
+	args := append([]any{}, setArgs...)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		args = append(args, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(args) == len(setArgs) {
+		return tx.Commit()
+	}
+
+	query := o.rebind(`UPDATE ` + o.table + ` SET ` + set + `
+		WHERE id IN (` + sqlutil.Placeholders(len(args)-len(setArgs)) + `)`)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// complete marks a published event, unless its lease was lost
+func (r *Relay) complete(ctx context.Context, token string, event Event) error {
+	o := r.outbox
+	query := o.rebind(`UPDATE ` + o.table + ` SET status = ?, published_at = ?, claim_token = NULL, last_error = NULL
+		WHERE id = ? AND claim_token = ?`)
+	_, err := r.db.ExecContext(context.WithoutCancel(ctx), query, StatusPublished, o.now().UnixMilli(), event.ID, token)
+	return err
+}
+
+// fail schedules a retry with backoff, or moves the event to dead
+func (r *Relay) fail(ctx context.Context, token string, event Event, pubErr error) error {
+	o := r.outbox
+	status := StatusPending
+	if event.Attempts >= r.config.MaxAttempts {
+		status = StatusDead
+	}
+
+	backoff := r.config.MinBackoff << min(event.Attempts-1, 30)
+	if backoff <= 0 || backoff > r.config.MaxBackoff {
+		backoff = r.config.MaxBackoff
+	}
+
+	query := o.rebind(`UPDATE ` + o.table + ` SET status = ?, available_at = ?, claim_token = NULL, last_error = ?
+		WHERE id = ? AND claim_token = ?`)
+	_, err := r.db.ExecContext(context.WithoutCancel(ctx), query,
+		status, o.now().Add(backoff).UnixMilli(), sqlutil.Truncate(pubErr.Error(), 1000), event.ID, token)
+	if err != nil {
+		return errors.Join(pubErr, err)
+	}
+
+	if status == StatusDead {
+		log.Printf("[OUTBOX] event %d (%s) dead after %d attempts: %v", event.ID, event.Topic, event.Attempts, pubErr)
+		if r.config.OnDead != nil {
+			r.config.OnDead(event, pubErr)
+		}
+	}
+	return nil
+}
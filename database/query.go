@@ -0,0 +1,399 @@
+// database/query.go - generic query helpers with struct scanning
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gobeaver/beaver-kit/database/sqldialect"
+)
+
+// Query helper errors
+var (
+	ErrMissingArgument = errors.New("missing named argument")
+	ErrUnmappedColumn  = errors.New("column has no matching struct field")
+)
+
+// driverNamer is implemented by queriers that know their driver, see
+// BindDriver
+type driverNamer interface {
+	DriverName() string
+}
+
+// boundQuerier is a Querier with a known driver
+type boundQuerier struct {
+	Querier
+	driverName string
+}
+
+func (q boundQuerier) DriverName() string {
+	return q.driverName
+}
+
+// BindDriver returns q with the driver name ("pgx", "mysql", "sqlite",
+// "libsql") whose placeholder style QueryOne, QueryAll and Exec rewrite
+// queries to. A *sql.DB needs no binding, and neither does the transaction
+// QuerierFromContext returns; a bare *sql.Tx or *sql.Conn does.
+func BindDriver(q Querier, driverName string) Querier {
+	return boundQuerier{Querier: q, driverName: driverName}
+}
+
+// QueryOne runs query and scans the first row into a T: a struct whose
+// fields are matched to columns by `db` tag (or snake_case field name), or a
+// single-column value such as int64 or string. It returns sql.ErrNoRows when
+// there is no row.
+//
+// Queries use ? placeholders, rewritten to $1, $2, ... for PostgreSQL, or
+// :name parameters bound from sql.Named arguments or a single struct or
+// map[string]any argument. Use ?? for a literal ?.
+func QueryOne[T any](ctx context.Context, q Querier, query string, args ...any) (T, error) {
+	var zero T
+	rows, err := queryRows(ctx, q, query, args)
+	if err != nil {
+		return zero, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return zero, err
+		}
+		return zero, sql.ErrNoRows
+	}
+	scan, err := newRowScanner[T](rows)
+	if err != nil {
+		return zero, err
+	}
+	var dest T
+	if err := scan(rows, &dest); err != nil {
+		return zero, err
+	}
+	return dest, rows.Close()
+}
+
+// QueryAll runs query and scans every row into a T, see QueryOne
+func QueryAll[T any](ctx context.Context, q Querier, query string, args ...any) ([]T, error) {
+	rows, err := queryRows(ctx, q, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		results []T
+		scan    func(*sql.Rows, *T) error
+	)
+	for rows.Next() {
+		if scan == nil {
+			if scan, err = newRowScanner[T](rows); err != nil {
+				return nil, err
+			}
+		}
+		var dest T
+		if err := scan(rows, &dest); err != nil {
+			return nil, err
+		}
+		results = append(results, dest)
+	}
+	return results, rows.Err()
+}
+
+// Exec runs a statement with placeholders rewritten as for QueryOne
+func Exec(ctx context.Context, q Querier, query string, args ...any) (sql.Result, error) {
+	driverName, err := querierDriver(q)
+	if err != nil {
+		return nil, err
+	}
+	query, args, err = BindQuery(driverName, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return q.ExecContext(ctx, query, args...)
+}
+
+func queryRows(ctx context.Context, q Querier, query string, args []any) (*sql.Rows, error) {
+	driverName, err := querierDriver(q)
+	if err != nil {
+		return nil, err
+	}
+	query, args, err = BindQuery(driverName, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return q.QueryContext(ctx, query, args...)
+}
+
+// querierDriver returns the driver name for q. A *sql.DB reports its own
+// driver; transactions and connections can't, so they must be bound with
+// BindDriver rather than assumed to use the global instance's driver.
+func querierDriver(q Querier) (string, error) {
+	switch q := q.(type) {
+	case driverNamer:
+		return q.DriverName(), nil
+	case *sql.DB:
+		if name := driverNameOf(q.Driver()); name != "" {
+			return name, nil
+		}
+		return "", fmt.Errorf("%w: unknown driver %T, use BindDriver", ErrInvalidDriver, q.Driver())
+	}
+	return "", fmt.Errorf("%w: no driver known for %T, use BindDriver", ErrInvalidDriver, q)
+}
+
+// driverNames caches the registered name of each driver type
+var driverNames sync.Map // reflect.Type -> string
+
+// driverNameOf returns the name drv is registered under with database/sql,
+// or "" if it isn't
+func driverNameOf(drv driver.Driver) string {
+	t := reflect.TypeOf(drv)
+	if name, ok := driverNames.Load(t); ok {
+		return name.(string)
+	}
+	for _, name := range sql.Drivers() {
+		if registered, err := lookupDriver(name, ""); err == nil && reflect.TypeOf(registered) == t {
+			driverNames.Store(t, name)
+			return name
+		}
+	}
+	return ""
+}
+
+// Dialect returns the SQL dialect of a driver name, see sqldialect.Of
+func Dialect(driverName string) (string, error) {
+	return sqldialect.Of(driverName)
+}
+
+// BindQuery resolves :name parameters and rewrites ? placeholders for
+// driverName, returning the query and positional arguments to execute
+func BindQuery(driverName, query string, args ...any) (string, []any, error) {
+	if hasNamedParams(query) {
+		if lookup, ok := namedLookup(args); ok {
+			var err error
+			if query, args, err = bindNamed(query, lookup); err != nil {
+				return "", nil, err
+			}
+		}
+	}
+	return Rebind(driverName, query), args, nil
+}
+
+// Rebind rewrites ? placeholders for driverName, see sqldialect.Rebind
+func Rebind(driverName, query string) string {
+	return sqldialect.Rebind(driverName, query)
+}
+
+// hasNamedParams reports whether query has :name parameters; :: casts
+// don't count
+func hasNamedParams(query string) bool {
+	found := false
+	sqldialect.Walk(query, func(i int) int {
+		if _, n := namedParamAt(query, i); n > 0 {
+			found = true
+			return n
+		}
+		if query[i] == ':' && i+1 < len(query) && query[i+1] == ':' {
+			return 2
+		}
+		return 1
+	}, func(string) {})
+	return found
+}
+
+// namedParamAt returns the parameter starting at query[i] and its length
+func namedParamAt(query string, i int) (string, int) {
+	if query[i] != ':' || (i > 0 && query[i-1] == ':') || i+1 >= len(query) {
+		return "", 0
+	}
+	end := i + 1
+	for end < len(query) && (query[end] == '_' || unicode.IsLetter(rune(query[end])) ||
+		(end > i+1 && unicode.IsDigit(rune(query[end])))) {
+		end++
+	}
+	if end == i+1 {
+		return "", 0
+	}
+	return query[i+1 : end], end - i
+}
+
+// bindNamed replaces :name parameters with ? and returns their values
+func bindNamed(query string, lookup func(string) (any, bool)) (string, []any, error) {
+	var (
+		b    strings.Builder
+		args []any
+		err  error
+	)
+	sqldialect.Walk(query, func(i int) int {
+		if name, n := namedParamAt(query, i); n > 0 {
+			value, ok := lookup(name)
+			if !ok && err == nil {
+				err = fmt.Errorf("%w: %s", ErrMissingArgument, name)
+			}
+			args = append(args, value)
+			b.WriteByte('?')
+			return n
+		}
+		if query[i] == ':' && i+1 < len(query) && query[i+1] == ':' {
+			b.WriteString("::")
+			return 2
+		}
+		b.WriteByte(query[i])
+		return 1
+	}, func(s string) { b.WriteString(s) })
+	return b.String(), args, err
+}
+
+// namedLookup returns a lookup for sql.Named arguments or a single struct or
+// map[string]any argument
+func namedLookup(args []any) (func(string) (any, bool), bool) {
+	if len(args) == 0 {
+		return nil, false
+	}
+
+	if _, ok := args[0].(sql.NamedArg); ok {
+		values := make(map[string]any, len(args))
+		for _, arg := range args {
+			named, ok := arg.(sql.NamedArg)
+			if !ok {
+				return nil, false
+			}
+			values[named.Name] = named.Value
+		}
+		return func(name string) (any, bool) { v, ok := values[name]; return v, ok }, true
+	}
+
+	if len(args) != 1 {
+		return nil, false
+	}
+	if values, ok := args[0].(map[string]any); ok {
+		return func(name string) (any, bool) { v, ok := values[name]; return v, ok }, true
+	}
+
+	v := reflect.ValueOf(args[0])
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct || isScalar(v.Type()) {
+		return nil, false
+	}
+	fields := structFields(v.Type())
+	return func(name string) (any, bool) {
+		index, ok := fields[name]
+		if !ok {
+			return nil, false
+		}
+		return v.FieldByIndex(index).Interface(), true
+	}, true
+}
+
+// newRowScanner returns a function scanning the current row into a *T
+func newRowScanner[T any](rows *sql.Rows) (func(*sql.Rows, *T) error, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct || isScalar(typ) {
+		if len(columns) != 1 {
+			return nil, fmt.Errorf("scanning %d columns into %s requires a struct", len(columns), typ)
+		}
+		return func(rows *sql.Rows, dest *T) error { return rows.Scan(dest) }, nil
+	}
+
+	fields := structFields(typ)
+	indexes := make([][]int, len(columns))
+	for i, column := range columns {
+		index, ok := fields[strings.ToLower(column)]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s in %s", ErrUnmappedColumn, column, typ)
+		}
+		indexes[i] = index
+	}
+
+	return func(rows *sql.Rows, dest *T) error {
+		v := reflect.ValueOf(dest).Elem()
+		targets := make([]any, len(indexes))
+		for i, index := range indexes {
+			targets[i] = v.FieldByIndex(index).Addr().Interface()
+		}
+		return rows.Scan(targets...)
+	}, nil
+}
+
+var (
+	scannerType = reflect.TypeFor[sql.Scanner]()
+	valuerType  = reflect.TypeFor[driver.Valuer]()
+	timeType    = reflect.TypeFor[time.Time]()
+)
+
+// isScalar reports whether a struct type is scanned as a single value
+func isScalar(typ reflect.Type) bool {
+	return typ == timeType || reflect.PointerTo(typ).Implements(scannerType) || typ.Implements(valuerType)
+}
+
+var fieldCache sync.Map // reflect.Type -> map[string][]int
+
+// structFields maps column names to field indexes: the `db` tag, or the
+// field name in snake_case. Fields of embedded structs are promoted and
+// `db:"-"` skips a field.
+func structFields(typ reflect.Type) map[string][]int {
+	if cached, ok := fieldCache.Load(typ); ok {
+		return cached.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	collectFields(typ, nil, fields)
+	fieldCache.Store(typ, fields)
+	return fields
+}
+
+func collectFields(typ reflect.Type, parent []int, fields map[string][]int) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := strings.Split(field.Tag.Get("db"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		index := append(append([]int(nil), parent...), i)
+
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct && !isScalar(field.Type) {
+			collectFields(field.Type, index, fields)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = snakeCase(field.Name)
+		}
+		if _, exists := fields[strings.ToLower(name)]; !exists || len(parent) == 0 {
+			fields[strings.ToLower(name)] = index
+		}
+	}
+}
+
+// snakeCase converts a Go field name, e.g. UserID to user_id
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
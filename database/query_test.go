@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type queryTestUser struct {
+	ID       int64
+	Email    string `db:"email_address"`
+	Nickname sql.NullString
+	Ignored  string `db:"-"`
+	queryTestAudit
+}
+
+type queryTestAudit struct {
+	CreatedAt time.Time
+}
+
+func openQueryTestDB(t *testing.T) Querier {
+	t.Helper()
+	db := openTestSQLite(t)
+	if _, err := db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, email_address TEXT, nickname TEXT, created_at DATETIME)`); err != nil {
+		t.Fatal(err)
+	}
+	return BindDriver(db, "sqlite")
+}
+
+func TestQueryHelpers(t *testing.T) {
+	q := openQueryTestDB(t)
+	ctx := context.Background()
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, err := Exec(ctx, q, `INSERT INTO users (id, email_address, created_at) VALUES (?, ?, ?)`, 1, "a@example.com", created); err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+	user := queryTestUser{ID: 2, Email: "b@example.com", Nickname: sql.NullString{String: "bee", Valid: true}}
+	user.CreatedAt = created
+	if _, err := Exec(ctx, q, `INSERT INTO users (id, email_address, nickname, created_at) VALUES (:id, :email_address, :nickname, :created_at)`, user); err != nil {
+		t.Fatalf("Named Exec failed: %v", err)
+	}
+
+	got, err := QueryOne[queryTestUser](ctx, q, `SELECT * FROM users WHERE email_address = :email`, sql.Named("email", "b@example.com"))
+	if err != nil {
+		t.Fatalf("QueryOne failed: %v", err)
+	}
+	if got.ID != 2 || got.Nickname.String != "bee" || !got.CreatedAt.Equal(created) {
+		t.Errorf("Unexpected row: %+v", got)
+	}
+
+	all, err := QueryAll[queryTestUser](ctx, q, `SELECT id, email_address FROM users ORDER BY id`)
+	if err != nil || len(all) != 2 || all[0].Email != "a@example.com" || all[1].Email != "b@example.com" {
+		t.Errorf("Unexpected rows: %+v (%v)", all, err)
+	}
+
+	count, err := QueryOne[int](ctx, q, `SELECT COUNT(*) FROM users WHERE id > ?`, 0)
+	if err != nil || count != 2 {
+		t.Errorf("Expected scalar count 2, got %d (%v)", count, err)
+	}
+
+	emails, err := QueryAll[string](ctx, q, `SELECT email_address FROM users WHERE id IN (:a, :b) ORDER BY id`, map[string]any{"a": 1, "b": 2})
+	if err != nil || !reflect.DeepEqual(emails, []string{"a@example.com", "b@example.com"}) {
+		t.Errorf("Unexpected scalar rows: %v (%v)", emails, err)
+	}
+
+	if _, err := QueryOne[queryTestUser](ctx, q, `SELECT * FROM users WHERE id = ?`, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows, got %v", err)
+	}
+	if none, err := QueryAll[queryTestUser](ctx, q, `SELECT * FROM users WHERE id = ?`, 99); err != nil || len(none) != 0 {
+		t.Errorf("Expected no rows, got %v (%v)", none, err)
+	}
+
+	if _, err := QueryOne[queryTestUser](ctx, q, `SELECT id, 1 AS unknown FROM users`); !errors.Is(err, ErrUnmappedColumn) {
+		t.Errorf("Expected ErrUnmappedColumn, got %v", err)
+	}
+	if _, err := Exec(ctx, q, `DELETE FROM users WHERE id = :id`, map[string]any{"other": 1}); !errors.Is(err, ErrMissingArgument) {
+		t.Errorf("Expected ErrMissingArgument, got %v", err)
+	}
+}
+
+func TestQuerierDriver(t *testing.T) {
+	db := openTestSQLite(t)
+	ctx := context.Background()
+
+	// A pool reports its own driver, whatever the global instance uses
+	saved := defaultDriver
+	defaultDriver = "pgx"
+	defer func() { defaultDriver = saved }()
+	if n, err := QueryOne[int](ctx, db, `SELECT ?`, 7); err != nil || n != 7 {
+		t.Fatalf("Expected the pool's own driver, got %d (%v)", n, err)
+	}
+	if name, err := querierDriver(db); err != nil || name != "sqlite" {
+		t.Errorf("Expected sqlite, got %q (%v)", name, err)
+	}
+
+	// Transactions can't report theirs, and the global driver is not assumed
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := QueryOne[int](ctx, tx, `SELECT ?`, 7); !errors.Is(err, ErrInvalidDriver) {
+		t.Errorf("Expected ErrInvalidDriver for an unbound transaction, got %v", err)
+	}
+	if n, err := QueryOne[int](ctx, BindDriver(tx, "sqlite"), `SELECT ?`, 7); err != nil || n != 7 {
+		t.Errorf("Expected the bound driver, got %d (%v)", n, err)
+	}
+
+	// A WithTxContext transaction is bound to its pool's driver
+	err = WithTxContext(ctx, db, nil, func(ctx context.Context, _ *sql.Tx) error {
+		n, err := QueryOne[int](ctx, QuerierFromContext(ctx, db), `SELECT ?`, 7)
+		if err == nil && n != 7 {
+			err = fmt.Errorf("got %d", n)
+		}
+		return err
+	})
+	if err != nil {
+		t.Errorf("Expected the transaction's pool driver: %v", err)
+	}
+}
+
+func TestBindQueryNamed(t *testing.T) {
+	query, args, err := BindQuery("pgx",
+		`SELECT id::text FROM t WHERE a = :a AND b = ':b' AND c = :a`,
+		sql.Named("a", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != `SELECT id::text FROM t WHERE a = $1 AND b = ':b' AND c = $2` {
+		t.Errorf("Unexpected query: %s", query)
+	}
+	if !reflect.DeepEqual(args, []any{1, 1}) {
+		t.Errorf("Unexpected args: %v", args)
+	}
+
+	// A single time.Time is a value, not a struct of named parameters
+	query, args, _ = BindQuery("mysql", `SELECT :x`, time.Time{})
+	if query != `SELECT :x` || len(args) != 1 {
+		t.Errorf("Expected no named binding, got %s %v", query, args)
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"ID": "id", "UserID": "user_id", "CreatedAt": "created_at", "HTTPServer": "http_server",
+	} {
+		if got := snakeCase(in); got != want {
+			t.Errorf("snakeCase(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+CREATE TABLE queue_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    queue VARCHAR(255) NOT NULL,
+    payload BYTEA,
+    priority INTEGER NOT NULL DEFAULT 0,
+    unique_key VARCHAR(255),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    run_at BIGINT NOT NULL,
+    locked_by VARCHAR(64),
+    last_error TEXT,
+    created_at BIGINT NOT NULL,
+    UNIQUE (queue, unique_key)
+);
+
+CREATE INDEX idx_queue_jobs_due ON queue_jobs (queue, run_at);
+
+CREATE TABLE queue_dead_jobs (
+    id BIGINT PRIMARY KEY,
+    queue VARCHAR(255) NOT NULL,
+    payload BYTEA,
+    priority INTEGER NOT NULL,
+    unique_key VARCHAR(255),
+    attempts INTEGER NOT NULL,
+    max_attempts INTEGER NOT NULL,
+    last_error TEXT,
+    created_at BIGINT NOT NULL,
+    failed_at BIGINT NOT NULL
+);
+
+CREATE INDEX idx_queue_dead_jobs_queue ON queue_dead_jobs (queue, failed_at);
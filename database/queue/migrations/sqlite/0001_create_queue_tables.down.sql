@@ -0,0 +1,2 @@
+DROP TABLE queue_dead_jobs;
+DROP TABLE queue_jobs;
@@ -0,0 +1,31 @@
+CREATE TABLE queue_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    queue TEXT NOT NULL,
+    payload BLOB,
+    priority INTEGER NOT NULL DEFAULT 0,
+    unique_key TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    run_at INTEGER NOT NULL,
+    locked_by TEXT,
+    last_error TEXT,
+    created_at INTEGER NOT NULL,
+    UNIQUE (queue, unique_key)
+);
+
+CREATE INDEX idx_queue_jobs_due ON queue_jobs (queue, run_at);
+
+CREATE TABLE queue_dead_jobs (
+    id INTEGER PRIMARY KEY,
+    queue TEXT NOT NULL,
+    payload BLOB,
+    priority INTEGER NOT NULL,
+    unique_key TEXT,
+    attempts INTEGER NOT NULL,
+    max_attempts INTEGER NOT NULL,
+    last_error TEXT,
+    created_at INTEGER NOT NULL,
+    failed_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_queue_dead_jobs_queue ON queue_dead_jobs (queue, failed_at);
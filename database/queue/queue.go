@@ -0,0 +1,307 @@
+// Package queue implements a durable job queue on the application database.
+// Jobs are enqueued with an optional delay, priority and unique key, and
+// Workers claim them with a visibility timeout, retry failures with backoff
+// and move jobs that exhausted their attempts to a dead-letter table. Jobs
+// are delivered at least once, so handlers should be idempotent.
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/database"
+	"github.com/gobeaver/beaver-kit/database/internal/sqlutil"
+)
+
+// MigrationsTable records the queue schema version, separate from the
+// application's migrations
+const MigrationsTable = "queue_schema_migrations"
+
+// DefaultMaxAttempts is how often a job runs before it is dead-lettered,
+// unless set with WithMaxAttempts
+const DefaultMaxAttempts = 5
+
+// Common errors
+var (
+	ErrInvalidConfig = errors.New("invalid queue configuration")
+	ErrInvalidJob    = errors.New("invalid job")
+	ErrDuplicateJob  = errors.New("job with this unique key already queued")
+
+	// ErrJobLost is passed to OnDead for a job whose last attempt timed out
+	// without an outcome, e.g. because its worker crashed
+	ErrJobLost = errors.New("job lost: visibility timeout expired on its last attempt")
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+const (
+	jobsTable = "queue_jobs"
+	deadTable = "queue_dead_jobs"
+
+	jobColumns = `id, queue, payload, priority, unique_key, attempts, max_attempts, created_at, last_error`
+)
+
+// Job is a unit of work in a queue
+type Job struct {
+	ID          int64
+	Queue       string
+	Payload     []byte
+	Priority    int    // higher runs first
+	UniqueKey   string // optional, at most one queued job per key and queue
+	Attempts    int    // runs so far, including the current one
+	MaxAttempts int
+	CreatedAt   time.Time
+	LastError   string
+}
+
+// EnqueueOption configures a job passed to Enqueue
+type EnqueueOption func(*enqueueOptions)
+
+type enqueueOptions struct {
+	delay       time.Duration
+	runAt       time.Time
+	priority    int
+	uniqueKey   string
+	maxAttempts int
+}
+
+// WithDelay runs the job no earlier than d from now
+func WithDelay(d time.Duration) EnqueueOption {
+	return func(o *enqueueOptions) { o.delay = d }
+}
+
+// WithRunAt runs the job no earlier than t
+func WithRunAt(t time.Time) EnqueueOption {
+	return func(o *enqueueOptions) { o.runAt = t }
+}
+
+// WithPriority sets the job priority; higher priorities run first
+func WithPriority(priority int) EnqueueOption {
+	return func(o *enqueueOptions) { o.priority = priority }
+}
+
+// WithUniqueKey rejects the job with ErrDuplicateJob while another job with
+// the same key is queued or running in the same queue
+func WithUniqueKey(key string) EnqueueOption {
+	return func(o *enqueueOptions) { o.uniqueKey = key }
+}
+
+// WithMaxAttempts sets how often the job runs before it is dead-lettered
+func WithMaxAttempts(n int) EnqueueOption {
+	return func(o *enqueueOptions) { o.maxAttempts = n }
+}
+
+// Config configures a Queue
+type Config struct {
+	// Driver selects SQL syntax: pgx (postgres), sqlite or libsql. Empty
+	// uses the driver of the global database instance.
+	Driver string
+}
+
+// Queue enqueues and manages jobs in the queue_jobs table
+type Queue struct {
+	driver  string
+	dialect string
+	now     func() time.Time
+}
+
+// New creates a Queue
+func New(config Config) (*Queue, error) {
+	if config.Driver == "" {
+		config.Driver = database.DriverName()
+	}
+	dialect, err := dialectFor(config.Driver)
+	if err != nil {
+		return nil, err
+	}
+	return &Queue{driver: config.Driver, dialect: dialect, now: time.Now}, nil
+}
+
+// dialectFor maps a driver name to the migrations directory
+func dialectFor(driver string) (string, error) {
+	dialect, err := database.Dialect(driver)
+	if err != nil || dialect == "mysql" {
+		return "", fmt.Errorf("%w: unsupported driver %q", ErrInvalidConfig, driver)
+	}
+	return dialect, nil
+}
+
+// Migrations returns the schema of the queue tables for driver, for
+// database.NewMigrator
+func Migrations(driver string) (fs.FS, error) {
+	dialect, err := dialectFor(driver)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Sub(migrations, "migrations/"+dialect)
+}
+
+// Migrate creates or upgrades the queue tables, recording versions in
+// MigrationsTable
+func (q *Queue) Migrate(ctx context.Context, db *sql.DB) error {
+	source, err := Migrations(q.driver)
+	if err != nil {
+		return err
+	}
+	migrator, err := database.NewMigrator(db, source, database.MigratorConfig{Driver: q.driver, Table: MigrationsTable})
+	if err != nil {
+		return err
+	}
+	return migrator.Up(ctx)
+}
+
+// Enqueue adds a job to queue and returns its ID. Pass a transaction to
+// enqueue the job if and only if it commits.
+func (q *Queue) Enqueue(ctx context.Context, db database.Querier, queue string, payload []byte, opts ...EnqueueOption) (int64, error) {
+	if queue == "" {
+		return 0, fmt.Errorf("%w: queue is required", ErrInvalidJob)
+	}
+	options := enqueueOptions{maxAttempts: DefaultMaxAttempts}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.maxAttempts <= 0 {
+		return 0, fmt.Errorf("%w: max attempts must be positive", ErrInvalidJob)
+	}
+
+	now := q.now()
+	runAt := now.Add(options.delay)
+	if !options.runAt.IsZero() {
+		runAt = options.runAt
+	}
+
+	// A conflicting unique key inserts nothing and so returns no row
+	query := q.rebind(`INSERT INTO ` + jobsTable + ` (queue, payload, priority, unique_key, attempts, max_attempts, run_at, created_at)
+		VALUES (?, ?, ?, ?, 0, ?, ?, ?) ON CONFLICT (queue, unique_key) DO NOTHING RETURNING id`)
+	var id int64
+	err := db.QueryRowContext(ctx, query, queue, payload, options.priority, sql.NullString{String: options.uniqueKey, Valid: options.uniqueKey != ""},
+		options.maxAttempts, runAt.UnixMilli(), now.UnixMilli()).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%w: %s", ErrDuplicateJob, options.uniqueKey)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	return id, nil
+}
+
+// Cancel deletes a job that is not running. It reports whether the job was
+// deleted.
+func (q *Queue) Cancel(ctx context.Context, db database.Querier, id int64) (bool, error) {
+	query := q.rebind(`DELETE FROM ` + jobsTable + ` WHERE id = ? AND (locked_by IS NULL OR run_at <= ?)`)
+	result, err := db.ExecContext(ctx, query, id, q.now().UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// Pending returns how many jobs are queued or running in queue
+func (q *Queue) Pending(ctx context.Context, db database.Querier, queue string) (int, error) {
+	var n int
+	err := db.QueryRowContext(ctx, q.rebind(`SELECT COUNT(*) FROM `+jobsTable+` WHERE queue = ?`), queue).Scan(&n)
+	return n, err
+}
+
+// DeadJobs returns up to limit jobs of queue that exhausted their attempts,
+// oldest first
+func (q *Queue) DeadJobs(ctx context.Context, db database.Querier, queue string, limit int) ([]Job, error) {
+	query := q.rebind(`SELECT ` + jobColumns + ` FROM ` + deadTable + ` WHERE queue = ? ORDER BY failed_at, id LIMIT ?`)
+	rows, err := db.QueryContext(ctx, query, queue, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+// Requeue moves dead jobs back to their queue with their attempts reset. Jobs
+// whose unique key was enqueued again in the meantime stay dead.
+func (q *Queue) Requeue(ctx context.Context, db *sql.DB, ids ...int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	var requeued int64
+	err := database.WithTx(ctx, db, nil, func(tx *sql.Tx) error {
+		args := []any{q.now().UnixMilli()}
+		for _, id := range ids {
+			args = append(args, id)
+		}
+		insert := q.rebind(`INSERT INTO ` + jobsTable + ` (id, queue, payload, priority, unique_key, attempts, max_attempts, run_at, last_error, created_at)
+			SELECT id, queue, payload, priority, unique_key, 0, max_attempts, ?, last_error, created_at
+			FROM ` + deadTable + ` WHERE id IN (` + sqlutil.Placeholders(len(ids)) + `)
+			ON CONFLICT DO NOTHING RETURNING id`)
+		rows, err := tx.QueryContext(ctx, insert, args...)
+		if err != nil {
+			return err
+		}
+		var moved []any
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			moved = append(moved, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(moved) == 0 {
+			return nil
+		}
+
+		remove := q.rebind(`DELETE FROM ` + deadTable + ` WHERE id IN (` + sqlutil.Placeholders(len(moved)) + `)`)
+		if _, err := tx.ExecContext(ctx, remove, moved...); err != nil {
+			return err
+		}
+		requeued = int64(len(moved))
+		return nil
+	})
+	return requeued, err
+}
+
+// PurgeDead deletes dead jobs that failed before olderThan ago
+func (q *Queue) PurgeDead(ctx context.Context, db database.Querier, olderThan time.Duration) (int64, error) {
+	query := q.rebind(`DELETE FROM ` + deadTable + ` WHERE failed_at < ?`)
+	result, err := db.ExecContext(ctx, query, q.now().Add(-olderThan).UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (q *Queue) rebind(query string) string {
+	return database.Rebind(q.driver, query)
+}
+
+// scanJobs reads jobColumns rows
+func scanJobs(rows *sql.Rows) ([]Job, error) {
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var (
+			job       Job
+			uniqueKey sql.NullString
+			createdAt int64
+			lastError sql.NullString
+		)
+		if err := rows.Scan(&job.ID, &job.Queue, &job.Payload, &job.Priority, &uniqueKey,
+			&job.Attempts, &job.MaxAttempts, &createdAt, &lastError); err != nil {
+			return nil, err
+		}
+		job.UniqueKey = uniqueKey.String
+		job.CreatedAt = time.UnixMilli(createdAt)
+		job.LastError = lastError.String
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
@@ -0,0 +1,341 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/database"
+	"github.com/gobeaver/beaver-kit/database/internal/dbtest"
+)
+
+func newTestQueue(t *testing.T) (*Queue, *sql.DB) {
+	t.Helper()
+	db := dbtest.SQLite(t)
+
+	q, err := New(Config{Driver: "sqlite"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	return q, db
+}
+
+// recordingHandler records the payloads it ran and fails those in fail
+type recordingHandler struct {
+	mu   sync.Mutex
+	ran  []string
+	fail map[string]bool
+}
+
+func (h *recordingHandler) Handle(ctx context.Context, job Job) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.fail[string(job.Payload)] {
+		return errors.New("handler failed")
+	}
+	h.ran = append(h.ran, string(job.Payload))
+	return nil
+}
+
+func TestEnqueuePriorityAndDelay(t *testing.T) {
+	q, db := newTestQueue(t)
+	ctx := context.Background()
+	clock := time.Now()
+	q.now = func() time.Time { return clock }
+
+	for _, job := range []struct {
+		payload string
+		opts    []EnqueueOption
+	}{
+		{"low", nil},
+		{"high", []EnqueueOption{WithPriority(10)}},
+		{"later", []EnqueueOption{WithDelay(time.Hour), WithPriority(100)}},
+		{"low2", nil},
+	} {
+		if _, err := q.Enqueue(ctx, db, "emails", []byte(job.payload), job.opts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := q.Enqueue(ctx, db, "", nil); !errors.Is(err, ErrInvalidJob) {
+		t.Errorf("Expected ErrInvalidJob, got %v", err)
+	}
+
+	h := &recordingHandler{}
+	worker, err := q.NewWorker(db, h, WorkerConfig{Queue: "emails", Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if n, err := worker.ProcessBatch(ctx); err != nil || n != 1 {
+			t.Fatalf("Expected one job, got %d (%v)", n, err)
+		}
+	}
+	if n, _ := worker.ProcessBatch(ctx); n != 0 {
+		t.Error("Expected the delayed job to wait")
+	}
+	if want := []string{"high", "low", "low2"}; len(h.ran) != 3 || h.ran[0] != want[0] || h.ran[1] != want[1] || h.ran[2] != want[2] {
+		t.Errorf("Expected %v, got %v", want, h.ran)
+	}
+
+	clock = clock.Add(2 * time.Hour)
+	if n, _ := worker.ProcessBatch(ctx); n != 1 || h.ran[3] != "later" {
+		t.Error("Expected the delayed job to run once due")
+	}
+	if n, _ := q.Pending(ctx, db, "emails"); n != 0 {
+		t.Errorf("Expected completed jobs deleted, %d left", n)
+	}
+}
+
+func TestEnqueueUniqueKey(t *testing.T) {
+	q, db := newTestQueue(t)
+	ctx := context.Background()
+
+	if _, err := q.Enqueue(ctx, db, "reports", nil, WithUniqueKey("daily")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue(ctx, db, "reports", nil, WithUniqueKey("daily")); !errors.Is(err, ErrDuplicateJob) {
+		t.Errorf("Expected ErrDuplicateJob, got %v", err)
+	}
+	if _, err := q.Enqueue(ctx, db, "other", nil, WithUniqueKey("daily")); err != nil {
+		t.Errorf("Expected keys scoped to the queue: %v", err)
+	}
+	if _, err := q.Enqueue(ctx, db, "reports", nil); err != nil {
+		t.Errorf("Expected jobs without key to be allowed: %v", err)
+	}
+
+	worker, _ := q.NewWorker(db, &recordingHandler{}, WorkerConfig{Queue: "reports"})
+	if _, err := worker.ProcessBatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Enqueue(ctx, db, "reports", nil, WithUniqueKey("daily")); err != nil {
+		t.Errorf("Expected the key to be free after completion: %v", err)
+	}
+
+	// Enqueueing joins the caller's transaction
+	_ = database.WithTx(ctx, db, nil, func(tx *sql.Tx) error {
+		if _, err := q.Enqueue(ctx, tx, "rollback", nil); err != nil {
+			return err
+		}
+		return errors.New("business logic failed")
+	})
+	if n, _ := q.Pending(ctx, db, "rollback"); n != 0 {
+		t.Errorf("Expected the rolled back job discarded, got %d", n)
+	}
+}
+
+func TestWorkerRetriesAndDeadLetters(t *testing.T) {
+	q, db := newTestQueue(t)
+	ctx := context.Background()
+	clock := time.Now()
+	q.now = func() time.Time { return clock }
+
+	if _, err := q.Enqueue(ctx, db, "flaky", []byte("x"), WithMaxAttempts(3), WithUniqueKey("k")); err != nil {
+		t.Fatal(err)
+	}
+
+	var dead []Job
+	h := &recordingHandler{fail: map[string]bool{"x": true}}
+	worker, _ := q.NewWorker(db, h, WorkerConfig{
+		Queue:      "flaky",
+		MinBackoff: time.Minute,
+		OnDead:     func(job Job, err error) { dead = append(dead, job) },
+	})
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		if n, _ := worker.ProcessBatch(ctx); n != 1 {
+			t.Fatalf("Attempt %d: expected the job to be due", attempt)
+		}
+		if n, _ := worker.ProcessBatch(ctx); n != 0 {
+			t.Fatalf("Attempt %d: expected backoff before the retry", attempt)
+		}
+		clock = clock.Add(time.Hour)
+	}
+
+	if len(dead) != 1 || dead[0].Attempts != 3 || dead[0].LastError != "handler failed" {
+		t.Fatalf("Expected the job dead after 3 attempts, got %+v", dead)
+	}
+	jobs, err := q.DeadJobs(ctx, db, "flaky", 10)
+	if err != nil || len(jobs) != 1 || jobs[0].UniqueKey != "k" {
+		t.Fatalf("Unexpected dead jobs: %+v (%v)", jobs, err)
+	}
+	if n, _ := q.Pending(ctx, db, "flaky"); n != 0 {
+		t.Errorf("Expected the job moved out of the queue, %d left", n)
+	}
+
+	h.fail = nil
+	if n, err := q.Requeue(ctx, db, jobs[0].ID); err != nil || n != 1 {
+		t.Fatalf("Requeue failed: %d (%v)", n, err)
+	}
+	if n, _ := worker.ProcessBatch(ctx); n != 1 || len(h.ran) != 1 {
+		t.Error("Expected the requeued job to run")
+	}
+	if jobs, _ := q.DeadJobs(ctx, db, "flaky", 10); len(jobs) != 0 {
+		t.Errorf("Expected the dead-letter table empty, got %d", len(jobs))
+	}
+}
+
+func TestWorkerVisibilityTimeout(t *testing.T) {
+	q, db := newTestQueue(t)
+	ctx := context.Background()
+	clock := time.Now()
+	q.now = func() time.Time { return clock }
+
+	if _, err := q.Enqueue(ctx, db, "q", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	worker, _ := q.NewWorker(db, &recordingHandler{}, WorkerConfig{Queue: "q", VisibilityTimeout: time.Minute})
+	crashed, err := worker.claim(ctx, "crashed-worker", 10)
+	if err != nil || len(crashed) != 1 {
+		t.Fatalf("Expected a claimed job, got %d (%v)", len(crashed), err)
+	}
+	if n, _ := worker.ProcessBatch(ctx); n != 0 {
+		t.Error("Expected the claimed job to be hidden")
+	}
+	if ok, _ := q.Cancel(ctx, db, crashed[0].ID); ok {
+		t.Error("Expected a running job not to be cancelled")
+	}
+
+	clock = clock.Add(2 * time.Minute)
+	if n, _ := worker.ProcessBatch(ctx); n != 1 {
+		t.Error("Expected the job to be visible again after the timeout")
+	}
+}
+
+func TestWorkerDeadLettersLostJobs(t *testing.T) {
+	q, db := newTestQueue(t)
+	ctx := context.Background()
+	clock := time.Now()
+	q.now = func() time.Time { return clock }
+
+	if _, err := q.Enqueue(ctx, db, "q", []byte("x"), WithMaxAttempts(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	var dead []error
+	h := &recordingHandler{}
+	worker, _ := q.NewWorker(db, h, WorkerConfig{
+		Queue:             "q",
+		VisibilityTimeout: time.Minute,
+		OnDead:            func(job Job, err error) { dead = append(dead, err) },
+	})
+	if crashed, err := worker.claim(ctx, "crashed-worker", 10); err != nil || len(crashed) != 1 {
+		t.Fatalf("Expected a claimed job, got %d (%v)", len(crashed), err)
+	}
+
+	clock = clock.Add(2 * time.Minute)
+	if n, err := worker.ProcessBatch(ctx); err != nil || n != 0 {
+		t.Errorf("Expected the lost job not to be reclaimed, got %d (%v)", n, err)
+	}
+	if len(h.ran) != 0 {
+		t.Errorf("Expected the handler not to run, got %v", h.ran)
+	}
+	if len(dead) != 1 || !errors.Is(dead[0], ErrJobLost) {
+		t.Errorf("Expected OnDead with ErrJobLost, got %v", dead)
+	}
+
+	jobs, err := q.DeadJobs(ctx, db, "q", 10)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Expected one dead job, got %d (%v)", len(jobs), err)
+	}
+	if jobs[0].Attempts != 1 || jobs[0].LastError != ErrJobLost.Error() {
+		t.Errorf("Unexpected dead job: %+v", jobs[0])
+	}
+	var pending int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM queue_jobs`).Scan(&pending); err != nil || pending != 0 {
+		t.Errorf("Expected the job to leave queue_jobs, got %d (%v)", pending, err)
+	}
+}
+
+func TestWorkerGracefulShutdown(t *testing.T) {
+	q, db := newTestQueue(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	for i := 0; i < 4; i++ {
+		if _, err := q.Enqueue(ctx, db, "slow", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	started := make(chan struct{}, 4)
+	var finished atomic.Int32
+	handler := HandlerFunc(func(jobCtx context.Context, job Job) error {
+		started <- struct{}{}
+		select {
+		case <-time.After(100 * time.Millisecond):
+			finished.Add(1)
+			return nil
+		case <-jobCtx.Done():
+			return jobCtx.Err()
+		}
+	})
+	worker, _ := q.NewWorker(db, handler, WorkerConfig{Queue: "slow", Concurrency: 2, PollInterval: 10 * time.Millisecond})
+
+	done := make(chan error)
+	go func() { done <- worker.Run(ctx) }()
+	<-started
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	if n := finished.Load(); n == 0 || n > 2 {
+		t.Errorf("Expected only the in-flight jobs to finish, got %d", n)
+	}
+	if n, _ := q.Pending(context.Background(), db, "slow"); n != 4-int(finished.Load()) {
+		t.Errorf("Expected unfinished jobs left queued, got %d", n)
+	}
+}
+
+func TestWorkerShutdownTimeoutReleasesJobs(t *testing.T) {
+	q, db := newTestQueue(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if _, err := q.Enqueue(ctx, db, "stuck", nil); err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	handler := HandlerFunc(func(jobCtx context.Context, job Job) error {
+		close(started)
+		<-jobCtx.Done()
+		return jobCtx.Err()
+	})
+	worker, _ := q.NewWorker(db, handler, WorkerConfig{Queue: "stuck", ShutdownTimeout: 50 * time.Millisecond})
+
+	done := make(chan error)
+	go func() { done <- worker.Run(ctx) }()
+	<-started
+	cancel()
+	<-done
+
+	var attempts int
+	var lockedBy sql.NullString
+	if err := db.QueryRow(`SELECT attempts, locked_by FROM queue_jobs`).Scan(&attempts, &lockedBy); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 0 || lockedBy.Valid {
+		t.Errorf("Expected the job released without an attempt, got %d attempts (locked %v)", attempts, lockedBy.Valid)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	for _, driver := range []string{"pgx", "postgres", "sqlite", "libsql"} {
+		source, err := Migrations(driver)
+		if err != nil {
+			t.Fatalf("Migrations(%s) failed: %v", driver, err)
+		}
+		if _, err := database.NewMigrator(&sql.DB{}, source, database.MigratorConfig{Driver: driver}); err != nil {
+			t.Errorf("Invalid migrations for %s: %v", driver, err)
+		}
+	}
+	if _, err := New(Config{Driver: "mysql"}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected unsupported driver to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,395 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/database"
+	"github.com/gobeaver/beaver-kit/database/internal/sqlutil"
+	"github.com/google/uuid"
+)
+
+// Handler processes jobs. A returned error retries the job with backoff
+// until its attempts are exhausted.
+type Handler interface {
+	Handle(ctx context.Context, job Job) error
+}
+
+// HandlerFunc adapts a function to Handler
+type HandlerFunc func(ctx context.Context, job Job) error
+
+// Handle implements Handler
+func (f HandlerFunc) Handle(ctx context.Context, job Job) error {
+	return f(ctx, job)
+}
+
+// WorkerConfig configures a Worker
+type WorkerConfig struct {
+	// Queue is the queue to process (required)
+	Queue string
+
+	// Concurrency is how many jobs run at once (default 10)
+	Concurrency int
+
+	// PollInterval is the wait when no job is due (default 1s)
+	PollInterval time.Duration
+
+	// VisibilityTimeout is how long a claimed job is hidden from other
+	// workers. It is extended while the handler runs, so a job only becomes
+	// visible again if its worker crashes (default 30s).
+	VisibilityTimeout time.Duration
+
+	// MinBackoff and MaxBackoff bound the exponential delay before a failed
+	// job is retried (default 1s and 10 minutes)
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// ShutdownTimeout is how long Run waits for in-flight jobs after its
+	// context is cancelled before cancelling theirs (default 30s)
+	ShutdownTimeout time.Duration
+
+	// OnDead is called when a job is moved to the dead-letter table
+	OnDead func(job Job, err error)
+}
+
+// Worker runs jobs of one queue with a pool of goroutines. Several workers
+// can process the same queue: PostgreSQL claims with FOR UPDATE SKIP LOCKED,
+// SQLite and LibSQL with a single atomic UPDATE.
+type Worker struct {
+	queue   *Queue
+	db      *sql.DB
+	handler Handler
+	config  WorkerConfig
+	wake    chan struct{}
+}
+
+// NewWorker creates a worker running the jobs in db with handler
+func (q *Queue) NewWorker(db *sql.DB, handler Handler, config WorkerConfig) (*Worker, error) {
+	if config.Queue == "" {
+		return nil, fmt.Errorf("%w: worker queue required", ErrInvalidConfig)
+	}
+	if handler == nil {
+		return nil, fmt.Errorf("%w: worker handler required", ErrInvalidConfig)
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 10
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.VisibilityTimeout <= 0 {
+		config.VisibilityTimeout = 30 * time.Second
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = time.Second
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 10 * time.Minute
+	}
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = 30 * time.Second
+	}
+	return &Worker{
+		queue:   q,
+		db:      db,
+		handler: handler,
+		config:  config,
+		wake:    make(chan struct{}, 1),
+	}, nil
+}
+
+// Run processes jobs until ctx is cancelled, then stops claiming and waits
+// for in-flight jobs. Jobs still running after ShutdownTimeout have their
+// context cancelled and are returned to the queue without using an attempt.
+func (w *Worker) Run(ctx context.Context) error {
+	// Job contexts outlive ctx so in-flight jobs can finish
+	jobCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+
+	var running sync.WaitGroup
+	slots := make(chan struct{}, w.config.Concurrency)
+
+	for {
+		free := cap(slots) - len(slots)
+		token := uuid.NewString()
+		var jobs []Job
+		if free > 0 {
+			var err error
+			if jobs, err = w.claim(ctx, token, free); err != nil && ctx.Err() == nil {
+				log.Printf("[QUEUE] failed to claim %s jobs: %v", w.config.Queue, err)
+			}
+		}
+		for _, job := range jobs {
+			slots <- struct{}{}
+			running.Add(1)
+			go func() {
+				defer running.Done()
+				w.process(jobCtx, token, job)
+				<-slots
+				select {
+				case w.wake <- struct{}{}:
+				default:
+				}
+			}()
+		}
+
+		wait := w.config.PollInterval
+		if free > 0 && len(jobs) == free {
+			wait = 0 // more jobs are likely due
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			w.shutdown(&running, cancelJobs)
+			return ctx.Err()
+		case <-w.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// shutdown waits for in-flight jobs, cancelling them after ShutdownTimeout
+func (w *Worker) shutdown(running *sync.WaitGroup, cancelJobs context.CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(w.config.ShutdownTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		log.Printf("[QUEUE] %s jobs still running after %s, cancelling them", w.config.Queue, w.config.ShutdownTimeout)
+		cancelJobs()
+		<-done
+	}
+}
+
+// ProcessBatch claims up to Concurrency due jobs and runs them to completion,
+// returning how many it claimed. It is an alternative to Run for cron-style
+// processing.
+func (w *Worker) ProcessBatch(ctx context.Context) (int, error) {
+	token := uuid.NewString()
+	jobs, err := w.claim(ctx, token, w.config.Concurrency)
+	if err != nil {
+		return 0, err
+	}
+	var running sync.WaitGroup
+	for _, job := range jobs {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			w.process(ctx, token, job)
+		}()
+	}
+	running.Wait()
+	return len(jobs), nil
+}
+
+// claim leases up to limit due jobs to token, highest priority first. Jobs
+// whose last attempt expired without an outcome, because their worker
+// crashed, are dead-lettered first rather than claimed again.
+func (w *Worker) claim(ctx context.Context, token string, limit int) ([]Job, error) {
+	q := w.queue
+	now := q.now()
+
+	lock := ""
+	if q.dialect == "postgres" {
+		lock = " FOR UPDATE SKIP LOCKED"
+	}
+	sweep := q.rebind(`INSERT INTO ` + deadTable + ` (id, queue, payload, priority, unique_key, attempts, max_attempts, last_error, created_at, failed_at)
+		SELECT id, queue, payload, priority, unique_key, attempts, max_attempts, ?, created_at, ?
+		FROM ` + jobsTable + ` WHERE queue = ? AND run_at <= ? AND attempts >= max_attempts` + lock + `
+		RETURNING ` + jobColumns)
+	query := q.rebind(`UPDATE ` + jobsTable + ` SET run_at = ?, locked_by = ?, attempts = attempts + 1
+		WHERE id IN (SELECT id FROM ` + jobsTable + ` WHERE queue = ? AND run_at <= ? AND attempts < max_attempts
+			ORDER BY priority DESC, run_at, id LIMIT ?` + lock + `)
+		RETURNING ` + jobColumns)
+	var jobs, lost []Job
+	err := database.WithTx(ctx, w.db, nil, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, sweep, ErrJobLost.Error(), now.UnixMilli(), w.config.Queue, now.UnixMilli())
+		if err != nil {
+			return err
+		}
+		if lost, err = scanJobs(rows); err != nil {
+			return err
+		}
+		if len(lost) > 0 {
+			ids := make([]any, len(lost))
+			for i, job := range lost {
+				ids[i] = job.ID
+			}
+			remove := q.rebind(`DELETE FROM ` + jobsTable + ` WHERE id IN (` + sqlutil.Placeholders(len(ids)) + `)`)
+			if _, err := tx.ExecContext(ctx, remove, ids...); err != nil {
+				return err
+			}
+		}
+
+		rows, err = tx.QueryContext(ctx, query, now.Add(w.config.VisibilityTimeout).UnixMilli(), token,
+			w.config.Queue, now.UnixMilli(), limit)
+		if err != nil {
+			return err
+		}
+		jobs, err = scanJobs(rows)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim jobs: %w", err)
+	}
+
+	for _, job := range lost {
+		log.Printf("[QUEUE] job %d (%s) dead after %d attempts: %v", job.ID, job.Queue, job.Attempts, ErrJobLost)
+		if w.config.OnDead != nil {
+			w.config.OnDead(job, ErrJobLost)
+		}
+	}
+
+	// RETURNING order is unspecified
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Priority != jobs[j].Priority {
+			return jobs[i].Priority > jobs[j].Priority
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs, nil
+}
+
+// process runs a claimed job, extending its visibility while the handler
+// runs, and records the outcome
+func (w *Worker) process(ctx context.Context, token string, job Job) {
+	stop := make(chan struct{})
+	var heartbeat sync.WaitGroup
+	heartbeat.Add(1)
+	go func() {
+		defer heartbeat.Done()
+		w.extendLoop(ctx, token, job, stop)
+	}()
+
+	err := w.run(ctx, job)
+	close(stop)
+	heartbeat.Wait()
+
+	switch {
+	case err == nil:
+		err = w.complete(ctx, token, job)
+	case ctx.Err() != nil:
+		err = w.release(ctx, token, job)
+	default:
+		err = w.fail(ctx, token, job, err)
+	}
+	if err != nil {
+		log.Printf("[QUEUE] failed to update job %d: %v", job.ID, err)
+	}
+}
+
+// run calls the handler, turning a panic into an error
+func (w *Worker) run(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return w.handler.Handle(ctx, job)
+}
+
+func (w *Worker) extendLoop(ctx context.Context, token string, job Job, stop <-chan struct{}) {
+	ticker := time.NewTicker(w.config.VisibilityTimeout / 2)
+	defer ticker.Stop()
+
+	q := w.queue
+	query := q.rebind(`UPDATE ` + jobsTable + ` SET run_at = ? WHERE id = ? AND locked_by = ?`)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			until := q.now().Add(w.config.VisibilityTimeout).UnixMilli()
+			if err := w.exec(ctx, query, until, job.ID, token); err != nil && ctx.Err() == nil {
+				log.Printf("[QUEUE] failed to extend job %d: %v", job.ID, err)
+			}
+		}
+	}
+}
+
+// complete deletes a finished job, unless another worker reclaimed it
+func (w *Worker) complete(ctx context.Context, token string, job Job) error {
+	query := w.queue.rebind(`DELETE FROM ` + jobsTable + ` WHERE id = ? AND locked_by = ?`)
+	return w.exec(context.WithoutCancel(ctx), query, job.ID, token)
+}
+
+// release returns an interrupted job to the queue without using an attempt
+func (w *Worker) release(ctx context.Context, token string, job Job) error {
+	q := w.queue
+	query := q.rebind(`UPDATE ` + jobsTable + ` SET run_at = ?, locked_by = NULL, attempts = attempts - 1
+		WHERE id = ? AND locked_by = ?`)
+	return w.exec(context.WithoutCancel(ctx), query, q.now().UnixMilli(), job.ID, token)
+}
+
+// fail schedules a retry with backoff, or moves the job to the dead-letter
+// table
+func (w *Worker) fail(ctx context.Context, token string, job Job, jobErr error) error {
+	q := w.queue
+	ctx = context.WithoutCancel(ctx)
+	message := sqlutil.Truncate(jobErr.Error(), 1000)
+
+	if job.Attempts < job.MaxAttempts {
+		backoff := w.config.MinBackoff << min(job.Attempts-1, 30)
+		if backoff <= 0 || backoff > w.config.MaxBackoff {
+			backoff = w.config.MaxBackoff
+		}
+		query := q.rebind(`UPDATE ` + jobsTable + ` SET run_at = ?, locked_by = NULL, last_error = ?
+			WHERE id = ? AND locked_by = ?`)
+		if err := w.exec(ctx, query, q.now().Add(backoff).UnixMilli(), message, job.ID, token); err != nil {
+			return errors.Join(jobErr, err)
+		}
+		return nil
+	}
+
+	dead := false
+	err := database.WithTx(ctx, w.db, nil, func(tx *sql.Tx) error {
+		insert := q.rebind(`INSERT INTO ` + deadTable + ` (id, queue, payload, priority, unique_key, attempts, max_attempts, last_error, created_at, failed_at)
+			SELECT id, queue, payload, priority, unique_key, attempts, max_attempts, ?, created_at, ?
+			FROM ` + jobsTable + ` WHERE id = ? AND locked_by = ?`)
+		result, err := tx.ExecContext(ctx, insert, message, q.now().UnixMilli(), job.ID, token)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return err // reclaimed by another worker
+		}
+		if _, err := tx.ExecContext(ctx, q.rebind(`DELETE FROM `+jobsTable+` WHERE id = ?`), job.ID); err != nil {
+			return err
+		}
+		dead = true
+		return nil
+	})
+	if err != nil || !dead {
+		return errors.Join(jobErr, err)
+	}
+
+	job.LastError = message
+	log.Printf("[QUEUE] job %d (%s) dead after %d attempts: %v", job.ID, job.Queue, job.Attempts, jobErr)
+	if w.config.OnDead != nil {
+		w.config.OnDead(job, jobErr)
+	}
+	return nil
+}
+
+// exec runs a statement in its own transaction, so writes that hit a busy
+// SQLite database or a deadlock are retried (see database.IsRetryable)
+func (w *Worker) exec(ctx context.Context, query string, args ...any) error {
+	return database.WithTx(ctx, w.db, nil, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query, args...)
+		return err
+	})
+}
@@ -0,0 +1,219 @@
+// database/replicas.go - read replica routing
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Replica selection policies for Config.ReplicaPolicy
+const (
+	ReplicaRoundRobin       = "round_robin"
+	ReplicaLeastConnections = "least_connections"
+)
+
+type primaryKey struct{}
+
+// ForcePrimary returns a context whose reads go to the primary, e.g. to read
+// your own writes before replicas have caught up
+func ForcePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// primaryForced reports whether ctx was returned by ForcePrimary
+func primaryForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(primaryKey{}).(bool)
+	return forced
+}
+
+// replica is one read replica connection
+type replica struct {
+	name    string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// replicaSet selects healthy replicas and pings them in the background
+type replicaSet struct {
+	replicas []*replica
+	policy   string
+	next     atomic.Uint64
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// newReplicaSet connects to cfg.ReplicaURLs with the primary's pool
+// settings, instrumented as replica1, replica2, ... when metrics is set.
+// Replicas that are down at startup join once they answer a ping.
+func newReplicaSet(cfg Config, metrics *QueryMetrics) (*replicaSet, error) {
+	policy := cfg.ReplicaPolicy
+	if policy == "" {
+		policy = ReplicaRoundRobin
+	}
+	if policy != ReplicaRoundRobin && policy != ReplicaLeastConnections {
+		return nil, fmt.Errorf("%w: unknown replica policy %q", ErrInvalidConfig, policy)
+	}
+
+	rs := &replicaSet{policy: policy, stop: make(chan struct{})}
+	for _, replicaURL := range cfg.ReplicaURLs {
+		replicaURL = strings.TrimSpace(replicaURL)
+		if replicaURL == "" {
+			continue
+		}
+
+		replicaCfg := cfg
+		replicaCfg.URL = replicaURL
+		replicaCfg.LegacyURL = ""
+		name := fmt.Sprintf("replica%d", len(rs.replicas)+1)
+		db, err := openSQL(replicaCfg, metrics, name)
+		if err != nil {
+			rs.close()
+			return nil, fmt.Errorf("failed to open replica: %w", err)
+		}
+		rs.replicas = append(rs.replicas, &replica{name: name, db: db})
+	}
+	rs.checkHealth(context.Background())
+
+	interval := time.Duration(cfg.ReplicaHealthInterval) * time.Second
+	if interval > 0 && len(rs.replicas) > 0 {
+		rs.wg.Add(1)
+		go rs.healthLoop(interval)
+	}
+	return rs, nil
+}
+
+// pick returns a healthy replica, or nil if none is available
+func (rs *replicaSet) pick() *sql.DB {
+	if rs == nil {
+		return nil
+	}
+
+	healthy := make([]*replica, 0, len(rs.replicas))
+	for _, r := range rs.replicas {
+		if r.healthy.Load() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	if rs.policy == ReplicaLeastConnections {
+		best := healthy[0]
+		for _, r := range healthy[1:] {
+			if r.db.Stats().InUse < best.db.Stats().InUse {
+				best = r
+			}
+		}
+		return best.db
+	}
+	return healthy[(rs.next.Add(1)-1)%uint64(len(healthy))].db
+}
+
+// checkHealth pings every replica and updates its rotation status
+func (rs *replicaSet) checkHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, r := range rs.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+			defer cancel()
+			r.healthy.Store(r.db.PingContext(pingCtx) == nil)
+		}(r)
+	}
+	wg.Wait()
+}
+
+func (rs *replicaSet) healthLoop(interval time.Duration) {
+	defer rs.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rs.stop:
+			return
+		case <-ticker.C:
+			rs.checkHealth(context.Background())
+		}
+	}
+}
+
+// close stops health checks and closes the replica connections
+func (rs *replicaSet) close() error {
+	if rs == nil {
+		return nil
+	}
+
+	var firstErr error
+	rs.stopOnce.Do(func() {
+		close(rs.stop)
+		rs.wg.Wait()
+
+		for _, r := range rs.replicas {
+			if err := r.db.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	})
+	return firstErr
+}
+
+// gormReplicaResolver routes GORM reads to replicas. Queries in a
+// transaction, locking reads (FOR UPDATE) and contexts from ForcePrimary
+// stay on the primary.
+type gormReplicaResolver struct {
+	replicas *replicaSet
+}
+
+// Name implements gorm.Plugin
+func (r *gormReplicaResolver) Name() string {
+	return "beaver:replicas"
+}
+
+// Initialize implements gorm.Plugin
+func (r *gormReplicaResolver) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").Register("beaver:replicas:query", r.route); err != nil {
+		return err
+	}
+	return db.Callback().Row().Before("gorm:row").Register("beaver:replicas:row", r.routeRow)
+}
+
+func (r *gormReplicaResolver) route(db *gorm.DB) {
+	stmt := db.Statement
+	if _, inTx := stmt.ConnPool.(gorm.TxCommitter); inTx {
+		return
+	}
+	if _, locking := stmt.Clauses["FOR"]; locking {
+		return
+	}
+	if stmt.Context != nil && primaryForced(stmt.Context) {
+		return
+	}
+	if replicaDB := r.replicas.pick(); replicaDB != nil {
+		stmt.ConnPool = replicaDB
+	}
+}
+
+// routeRow routes Raw(...).Row(s) only when the SQL is a read
+func (r *gormReplicaResolver) routeRow(db *gorm.DB) {
+	if raw := strings.TrimSpace(db.Statement.SQL.String()); raw != "" {
+		upper := strings.ToUpper(raw)
+		if !strings.HasPrefix(upper, "SELECT") {
+			return
+		}
+		if strings.Contains(upper, "FOR UPDATE") || strings.Contains(upper, "FOR SHARE") {
+			return
+		}
+	}
+	r.route(db)
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// newTestReplicas opens a primary and two replicas as separate sqlite files,
+// each with a marker table naming the node
+func newTestReplicas(t *testing.T, policy string) (*Database, []*sql.DB) {
+	t.Helper()
+	dir := t.TempDir()
+	nodes := []string{"primary", "replica1", "replica2"}
+	for _, node := range nodes {
+		db, err := NewSQL(Config{Driver: "sqlite", Database: filepath.Join(dir, node+".db")})
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", node, err)
+		}
+		if _, err := db.Exec(`CREATE TABLE nodes (id INTEGER PRIMARY KEY, name TEXT)`); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO nodes (id, name) VALUES (1, ?)`, node); err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+	}
+
+	cfg := Config{
+		Driver:        "sqlite",
+		Database:      filepath.Join(dir, "primary.db"),
+		ReplicaURLs:   []string{"sqlite://" + filepath.Join(dir, "replica1.db"), " sqlite://" + filepath.Join(dir, "replica2.db")},
+		ReplicaPolicy: policy,
+	}
+	primary, err := NewSQL(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open primary: %v", err)
+	}
+	replicas, err := newReplicaSet(cfg, nil)
+	if err != nil {
+		t.Fatalf("newReplicaSet failed: %v", err)
+	}
+	gormDB, err := newGORM(cfg, primary, replicas)
+	if err != nil {
+		t.Fatalf("newGORM failed: %v", err)
+	}
+
+	db := &Database{gormDB: gormDB, useGORM: true, replicas: replicas}
+	t.Cleanup(func() { db.Close() })
+
+	var replicaDBs []*sql.DB
+	for _, r := range replicas.replicas {
+		replicaDBs = append(replicaDBs, r.db)
+	}
+	return db, replicaDBs
+}
+
+func nodeName(t *testing.T, db *sql.DB) string {
+	t.Helper()
+	var name string
+	if err := db.QueryRow(`SELECT name FROM nodes WHERE id = 1`).Scan(&name); err != nil {
+		t.Fatalf("Failed to read node name: %v", err)
+	}
+	return name
+}
+
+func TestReaderRoundRobin(t *testing.T) {
+	db, _ := newTestReplicas(t, "")
+	ctx := context.Background()
+
+	seen := map[string]int{}
+	for i := 0; i < 4; i++ {
+		seen[nodeName(t, db.Reader(ctx))]++
+	}
+	if seen["replica1"] != 2 || seen["replica2"] != 2 {
+		t.Errorf("Expected reads spread over both replicas, got %v", seen)
+	}
+
+	if got := nodeName(t, db.Writer()); got != "primary" {
+		t.Errorf("Writer returned %s", got)
+	}
+	if got := nodeName(t, db.Reader(ForcePrimary(ctx))); got != "primary" {
+		t.Errorf("ForcePrimary read returned %s", got)
+	}
+}
+
+func TestReaderSkipsUnhealthyReplicas(t *testing.T) {
+	db, replicaDBs := newTestReplicas(t, ReplicaLeastConnections)
+	ctx := context.Background()
+
+	replicaDBs[0].Close()
+	db.replicas.checkHealth(ctx)
+	for i := 0; i < 3; i++ {
+		if got := nodeName(t, db.Reader(ctx)); got != "replica2" {
+			t.Fatalf("Expected only the healthy replica, got %s", got)
+		}
+	}
+
+	replicaDBs[1].Close()
+	db.replicas.checkHealth(ctx)
+	if got := nodeName(t, db.Reader(ctx)); got != "primary" {
+		t.Errorf("Expected fallback to the primary, got %s", got)
+	}
+}
+
+func TestGORMReplicaRouting(t *testing.T) {
+	db, _ := newTestReplicas(t, ReplicaRoundRobin)
+	gormDB := db.MustGORM()
+	ctx := context.Background()
+
+	type node struct {
+		ID   int
+		Name string
+	}
+
+	var n node
+	if err := gormDB.Table("nodes").First(&n).Error; err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if n.Name == "primary" {
+		t.Error("Expected GORM reads to use a replica")
+	}
+
+	var name string
+	if err := gormDB.Raw(`SELECT name FROM nodes WHERE id = 1`).Row().Scan(&name); err != nil {
+		t.Fatalf("Raw query failed: %v", err)
+	}
+	if name == "primary" {
+		t.Error("Expected raw SELECT to use a replica")
+	}
+
+	n = node{}
+	gormDB.WithContext(ForcePrimary(ctx)).Table("nodes").First(&n)
+	if n.Name != "primary" {
+		t.Errorf("Expected ForcePrimary read from primary, got %s", n.Name)
+	}
+
+	n = node{}
+	gormDB.Clauses(clause.Locking{Strength: "UPDATE"}).Table("nodes").First(&n)
+	if n.Name != "primary" {
+		t.Errorf("Expected locking read from primary, got %s", n.Name)
+	}
+
+	err := gormDB.Transaction(func(tx *gorm.DB) error {
+		n = node{}
+		return tx.Table("nodes").First(&n).Error
+	})
+	if err != nil || n.Name != "primary" {
+		t.Errorf("Expected transactional read from primary, got %s (%v)", n.Name, err)
+	}
+
+	// Writes always go to the primary
+	if err := gormDB.Table("nodes").Create(&node{ID: 2, Name: "written"}).Error; err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	var count int
+	_ = db.Writer().QueryRow(`SELECT COUNT(*) FROM nodes`).Scan(&count)
+	if count != 2 {
+		t.Errorf("Expected the write on the primary, found %d rows", count)
+	}
+}
+
+func TestReplicaPolicyValidation(t *testing.T) {
+	if _, err := newReplicaSet(Config{ReplicaPolicy: "random"}, nil); err == nil {
+		t.Error("Expected unknown policy to be rejected")
+	}
+}
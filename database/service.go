@@ -6,14 +6,17 @@ package database
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"io/fs"
 	"net/url"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gobeaver/beaver-kit/config"
+	"github.com/gobeaver/beaver-kit/database/sqldialect"
 
 	// Database drivers - pure Go implementations for CGO-free builds
 	_ "github.com/go-sql-driver/mysql"                   // MySQL - already pure Go
@@ -31,29 +34,37 @@ import (
 
 // Global instances
 var (
-	defaultDB     *sql.DB  // Primary instance - always *sql.DB
-	defaultGORM   *gorm.DB // Optional GORM instance
-	defaultConfig *Config  // Stored config
-	defaultOnce   sync.Once
-	defaultErr    error
-	gormOnce      sync.Once
-	gormErr       error
+	defaultDB       *sql.DB       // Primary instance - always *sql.DB
+	defaultGORM     *gorm.DB      // Optional GORM instance
+	defaultReplicas *replicaSet   // Optional read replicas
+	defaultMetrics  *QueryMetrics // Optional query metrics
+	defaultDriver   string        // Resolved driver name, e.g. "pgx"
+	defaultConfig   *Config       // Stored config
+	defaultOnce     sync.Once
+	defaultErr      error
+	gormOnce        sync.Once
+	gormErr         error
 )
 
 // Common errors
 var (
 	ErrNotInitialized = errors.New("database not initialized")
-	ErrInvalidDriver  = errors.New("invalid database driver")
+	ErrInvalidDriver  = sqldialect.ErrInvalidDriver
 	ErrInvalidConfig  = errors.New("invalid database configuration")
 	ErrGORMNotEnabled = errors.New("GORM not enabled - set BEAVER_DB_ORM=gorm or use InitWithGORM()")
 )
 
 // Database wraps both sql.DB and gorm.DB providing unified access
 type Database struct {
-	sqlDB   *sql.DB
-	gormDB  *gorm.DB
-	prefix  string
-	useGORM bool
+	sqlDB       *sql.DB
+	gormDB      *gorm.DB
+	prefix      string
+	useGORM     bool
+	migrations  fs.FS
+	replicas    *replicaSet
+	metrics     *QueryMetrics
+	credentials CredentialProvider
+	driverName  string
 }
 
 // New creates a new Database with default settings
@@ -83,6 +94,27 @@ func (db *Database) WithGORM() *Database {
 	return db
 }
 
+// WithMigrations sets the migrations applied when DB_AUTO_MIGRATE is true,
+// e.g. an embed.FS, instead of reading DB_MIGRATIONS_PATH
+func (db *Database) WithMigrations(source fs.FS) *Database {
+	db.migrations = source
+	return db
+}
+
+// WithMetrics instruments connections with m instead of the metrics created
+// when DB_METRICS is true, e.g. to set a custom slow query handler
+func (db *Database) WithMetrics(m *QueryMetrics) *Database {
+	db.metrics = m
+	return db
+}
+
+// WithCredentials opens connections with credentials from p instead of
+// DB_USERNAME/DB_PASSWORD, e.g. a rotating secret or an IAM auth token
+func (db *Database) WithCredentials(p CredentialProvider) *Database {
+	db.credentials = p
+	return db
+}
+
 // Init initializes the global database instance with the configured settings
 func (db *Database) Init() error {
 	cfg := &Config{}
@@ -92,7 +124,10 @@ func (db *Database) Init() error {
 	if db.useGORM {
 		cfg.UseORM = "gorm"
 	}
-	return Init(*cfg)
+	if db.credentials != nil {
+		cfg.Credentials = db.credentials
+	}
+	return initDefault(*cfg, db.migrations, db.metrics)
 }
 
 // Connect creates a new database connection with the configured settings
@@ -101,32 +136,54 @@ func (db *Database) Connect() (*Database, error) {
 	if err := config.Load(cfg, config.WithPrefix(db.prefix)); err != nil {
 		return nil, err
 	}
+	if db.credentials != nil {
+		cfg.Credentials = db.credentials
+	}
 
-	if db.useGORM {
-		cfg.UseORM = "gorm"
-		sqlDB, err := NewSQL(*cfg)
-		if err != nil {
+	metrics := db.metrics
+	if metrics == nil {
+		metrics = newConfigMetrics(*cfg)
+	}
+
+	sqlDB, err := newSQL(*cfg, metrics)
+	if err != nil {
+		return nil, err
+	}
+	driverName, _, _ := resolveDSN(*cfg)
+
+	var replicas *replicaSet
+	if len(cfg.ReplicaURLs) > 0 {
+		if replicas, err = newReplicaSet(*cfg, metrics); err != nil {
+			sqlDB.Close()
 			return nil, err
 		}
-		gormDB, err := NewGORM(*cfg, sqlDB)
+	}
+
+	if db.useGORM {
+		cfg.UseORM = "gorm"
+		gormDB, err := newGORM(*cfg, sqlDB, replicas)
 		if err != nil {
+			_ = replicas.close()
+			sqlDB.Close()
 			return nil, err
 		}
 		return &Database{
-			gormDB:  gormDB,
-			prefix:  db.prefix,
-			useGORM: db.useGORM,
+			gormDB:     gormDB,
+			prefix:     db.prefix,
+			useGORM:    db.useGORM,
+			replicas:   replicas,
+			metrics:    metrics,
+			driverName: driverName,
 		}, nil
 	}
 
-	sqlDB, err := NewSQL(*cfg)
-	if err != nil {
-		return nil, err
-	}
 	return &Database{
-		sqlDB:   sqlDB,
-		prefix:  db.prefix,
-		useGORM: db.useGORM,
+		sqlDB:      sqlDB,
+		prefix:     db.prefix,
+		useGORM:    db.useGORM,
+		replicas:   replicas,
+		metrics:    metrics,
+		driverName: driverName,
 	}, nil
 }
 
@@ -139,6 +196,38 @@ func (db *Database) SQL() *sql.DB {
 	return db.sqlDB
 }
 
+// Writer returns the primary database
+func (db *Database) Writer() *sql.DB {
+	return db.SQL()
+}
+
+// Reader returns a healthy read replica, or the primary when no replica is
+// configured or healthy, or ctx comes from ForcePrimary
+func (db *Database) Reader(ctx context.Context) *sql.DB {
+	if !primaryForced(ctx) {
+		if replicaDB := db.replicas.pick(); replicaDB != nil {
+			return replicaDB
+		}
+	}
+	return db.SQL()
+}
+
+// DriverName returns the database/sql driver name, e.g. "pgx" or "mysql"
+func (db *Database) DriverName() string {
+	return db.driverName
+}
+
+// Querier returns the transaction in ctx (see WithTxContext) or the primary,
+// bound to the driver for QueryOne, QueryAll and Exec
+func (db *Database) Querier(ctx context.Context) Querier {
+	return BindDriver(QuerierFromContext(ctx, db.SQL()), db.driverName)
+}
+
+// Metrics returns the query metrics, or nil when metrics are disabled
+func (db *Database) Metrics() *QueryMetrics {
+	return db.metrics
+}
+
 // GORM returns the GORM instance or error if not enabled
 func (db *Database) GORM() (*gorm.DB, error) {
 	if db.gormDB == nil {
@@ -156,8 +245,9 @@ func (db *Database) MustGORM() *gorm.DB {
 	return gormDB
 }
 
-// Close closes the database connection
+// Close closes the database connection and any replicas
 func (db *Database) Close() error {
+	_ = db.replicas.close()
 	if db.gormDB != nil {
 		if sqlDB, err := db.gormDB.DB(); err == nil {
 			return sqlDB.Close()
@@ -184,26 +274,63 @@ func (db *Database) Stats() sql.DBStats {
 	return db.SQL().Stats()
 }
 
-// Init initializes the global SQL database instance with optional config
+// Init initializes the global SQL database instance with optional config.
+// With AutoMigrate set, pending migrations from MigrationsPath are applied.
 func Init(configs ...Config) error {
+	if len(configs) > 0 {
+		return initDefault(configs[0], nil, nil)
+	}
+	cfg, err := GetConfig()
+	if err != nil {
+		return err
+	}
+	return initDefault(*cfg, nil, nil)
+}
+
+// initDefault initializes the global instance once, applying migrations from
+// source (or cfg.MigrationsPath) when cfg.AutoMigrate is set and
+// instrumenting connections with metrics (or those for cfg.EnableMetrics)
+func initDefault(cfg Config, migrations fs.FS, metrics *QueryMetrics) error {
 	defaultOnce.Do(func() {
-		var cfg *Config
-		if len(configs) > 0 {
-			cfg = &configs[0]
-		} else {
-			cfg, defaultErr = GetConfig()
-			if defaultErr != nil {
+		defaultConfig = &cfg
+		defaultMetrics = metrics
+		if defaultMetrics == nil {
+			defaultMetrics = newConfigMetrics(cfg)
+		}
+		defaultDriver, _, _ = resolveDSN(cfg)
+		defaultDB, defaultErr = newSQL(cfg, defaultMetrics)
+
+		// A failure after the primary opened must not leave a half
+		// initialized instance behind for DB(); closing the replicas also
+		// stops their health checks
+		defer func() {
+			if defaultErr == nil {
+				return
+			}
+			_ = defaultReplicas.close()
+			if defaultDB != nil {
+				defaultDB.Close()
+			}
+			defaultDB, defaultReplicas, defaultGORM = nil, nil, nil
+		}()
+
+		if defaultErr == nil && len(cfg.ReplicaURLs) > 0 {
+			if defaultReplicas, defaultErr = newReplicaSet(cfg, defaultMetrics); defaultErr != nil {
 				return
 			}
 		}
 
-		defaultConfig = cfg
-		defaultDB, defaultErr = NewSQL(*cfg)
+		if defaultErr == nil && cfg.AutoMigrate {
+			if err := autoMigrate(defaultDB, cfg, migrations); err != nil {
+				defaultErr = fmt.Errorf("failed to apply migrations: %w", err)
+				return
+			}
+		}
 
 		// Check if GORM is requested via config or environment
-		if defaultErr == nil && shouldInitGORM(cfg) {
+		if defaultErr == nil && shouldInitGORM(&cfg) {
 			gormOnce.Do(func() {
-				defaultGORM, gormErr = NewGORM(*cfg, defaultDB)
+				defaultGORM, gormErr = newGORM(cfg, defaultDB, defaultReplicas)
 			})
 			if gormErr != nil {
 				defaultErr = fmt.Errorf("failed to initialize GORM: %w", gormErr)
@@ -285,14 +412,84 @@ func parseURLForDriver(databaseURL string) (driver, dsn string) {
 
 // NewSQL creates a new SQL database connection with given config
 func NewSQL(cfg Config) (*sql.DB, error) {
+	return newSQL(cfg, nil)
+}
+
+// newSQL opens the primary, instrumented when metrics is set, and waits for
+// it to answer unless cfg.LazyConnect is set
+func newSQL(cfg Config, metrics *QueryMetrics) (*sql.DB, error) {
+	db, err := openSQL(cfg, metrics, "primary")
+	if err != nil {
+		return nil, err
+	}
+	if cfg.LazyConnect {
+		return db, nil
+	}
+
+	// Ping to verify connection, retrying while the database starts
+	if err := waitForDB(context.Background(), db, cfg); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// openSQL opens and configures a connection pool without verifying it. With
+// metrics set, queries and pool statistics are recorded under node.
+func openSQL(cfg Config, metrics *QueryMetrics, node string) (*sql.DB, error) {
 	// Validation
 	if err := validateConfig(cfg); err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
 	}
 
-	var dsn string
-	var driverName string
+	driverName, dsn, err := resolveDSN(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open connection: through a connector when credentials come from a
+	// provider or queries are instrumented
+	var db *sql.DB
+	provider := credentialProvider(cfg)
+	if provider != nil || metrics != nil {
+		var connector driver.Connector
+		if provider != nil {
+			connector, err = newCredentialConnector(driverName, dsn, provider)
+		} else {
+			connector, err = openConnector(driverName, dsn)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+		if metrics != nil {
+			connector = InstrumentConnector(connector, metrics, node)
+		}
+		db = sql.OpenDB(connector)
+	} else if db, err = sql.Open(driverName, dsn); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	metrics.RegisterPool(node, db)
+
+	// Configure connection pool
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
+	}
+	if cfg.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTime) * time.Second)
+	}
+
+	return db, nil
+}
 
+// resolveDSN returns the database/sql driver name and DSN for cfg
+func resolveDSN(cfg Config) (driverName, dsn string, err error) {
 	// Resolve URL with fallback: DATABASE_URL > DB_URL (legacy)
 	effectiveURL := cfg.URL
 	if effectiveURL == "" && cfg.LegacyURL != "" {
@@ -329,7 +526,7 @@ func NewSQL(cfg Config) (*sql.DB, error) {
 				driverName = "libsql"
 				dsn = effectiveURL
 			default:
-				return nil, fmt.Errorf("%w: unable to determine driver from URL", ErrInvalidDriver)
+				return "", "", fmt.Errorf("%w: unable to determine driver from URL", ErrInvalidDriver)
 			}
 		}
 	} else {
@@ -361,48 +558,24 @@ func NewSQL(cfg Config) (*sql.DB, error) {
 					dsn = fmt.Sprintf("%s?authToken=%s", dsn, cfg.AuthToken)
 				}
 			} else {
-				return nil, fmt.Errorf("%w: libsql/turso requires DATABASE_URL or DB_HOST to be set", ErrInvalidConfig)
+				return "", "", fmt.Errorf("%w: libsql/turso requires DATABASE_URL or DB_HOST to be set", ErrInvalidConfig)
 			}
 
 		default:
-			return nil, fmt.Errorf("%w: %s", ErrInvalidDriver, cfg.Driver)
+			return "", "", fmt.Errorf("%w: %s", ErrInvalidDriver, cfg.Driver)
 		}
 	}
 
-	// Open connection
-	db, err := sql.Open(driverName, dsn)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
-	}
-
-	// Configure connection pool
-	if cfg.MaxOpenConns > 0 {
-		db.SetMaxOpenConns(cfg.MaxOpenConns)
-	}
-	if cfg.MaxIdleConns > 0 {
-		db.SetMaxIdleConns(cfg.MaxIdleConns)
-	}
-	if cfg.ConnMaxLifetime > 0 {
-		db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
-	}
-	if cfg.ConnMaxIdleTime > 0 {
-		db.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTime) * time.Second)
-	}
-
-	// Ping to verify connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := db.PingContext(ctx); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to ping database: %w", err)
-	}
-
-	return db, nil
+	return driverName, dsn, nil
 }
 
 // NewGORM creates a GORM instance from an existing SQL connection
 func NewGORM(cfg Config, sqlDB *sql.DB) (*gorm.DB, error) {
+	return newGORM(cfg, sqlDB, nil)
+}
+
+// newGORM creates a GORM instance that routes reads to replicas, if any
+func newGORM(cfg Config, sqlDB *sql.DB, replicas *replicaSet) (*gorm.DB, error) {
 	if sqlDB == nil {
 		return nil, fmt.Errorf("sql.DB instance is required for GORM")
 	}
@@ -444,9 +617,11 @@ func NewGORM(cfg Config, sqlDB *sql.DB) (*gorm.DB, error) {
 		return nil, err
 	}
 
-	// Note: Auto-migrations would need a migration registry
-	// For now, users should handle migrations manually via GORM's AutoMigrate
-	_ = cfg.AutoMigrate // Acknowledge the config field exists but is not implemented
+	if replicas != nil {
+		if err := gormDB.Use(&gormReplicaResolver{replicas: replicas}); err != nil {
+			return nil, fmt.Errorf("failed to register replica resolver: %w", err)
+		}
+	}
 
 	return gormDB, nil
 }
@@ -459,6 +634,34 @@ func DB() *sql.DB {
 	return defaultDB
 }
 
+// Writer returns the global primary database
+func Writer() *sql.DB {
+	return DB()
+}
+
+// Reader returns a healthy read replica of the global instance, or the
+// primary when no replica is configured or healthy, or ctx comes from
+// ForcePrimary
+func Reader(ctx context.Context) *sql.DB {
+	primary := DB()
+	if !primaryForced(ctx) {
+		if replicaDB := defaultReplicas.pick(); replicaDB != nil {
+			return replicaDB
+		}
+	}
+	return primary
+}
+
+// DriverName returns the global instance's database/sql driver name
+func DriverName() string {
+	return defaultDriver
+}
+
+// Metrics returns the global query metrics, or nil when DB_METRICS is false
+func Metrics() *QueryMetrics {
+	return defaultMetrics
+}
+
 // GORM returns the global GORM instance (returns error if not enabled)
 func GORM() (*gorm.DB, error) {
 	if defaultDB == nil {
@@ -470,7 +673,7 @@ func GORM() (*gorm.DB, error) {
 	// Check if GORM should be initialized
 	if defaultGORM == nil && defaultConfig != nil && shouldInitGORM(defaultConfig) {
 		gormOnce.Do(func() {
-			defaultGORM, gormErr = NewGORM(*defaultConfig, defaultDB)
+			defaultGORM, gormErr = newGORM(*defaultConfig, defaultDB, defaultReplicas)
 		})
 	}
 
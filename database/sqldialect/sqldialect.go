@@ -0,0 +1,105 @@
+// Package sqldialect maps database/sql driver names to SQL dialects and
+// rewrites ? placeholders for them. It imports only the standard library, so
+// packages that build SQL for a *sql.DB they are given can use it without
+// linking the drivers that package database registers.
+package sqldialect
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidDriver is returned for driver names without a known dialect
+var ErrInvalidDriver = errors.New("invalid database driver")
+
+// Dialects returned by Of
+const (
+	Postgres = "postgres"
+	MySQL    = "mysql"
+	SQLite   = "sqlite"
+)
+
+// Of returns the dialect of a driver name: Postgres for pgx, postgres and
+// postgresql, MySQL for mysql, or SQLite for sqlite, sqlite3, libsql and
+// turso
+func Of(driverName string) (string, error) {
+	switch strings.ToLower(driverName) {
+	case "pgx", "postgres", "postgresql":
+		return Postgres, nil
+	case "mysql":
+		return MySQL, nil
+	case "sqlite", "sqlite3", "libsql", "turso":
+		return SQLite, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrInvalidDriver, driverName)
+}
+
+// Rebind rewrites ? placeholders to $1, $2, ... for PostgreSQL and turns ??
+// into a literal ?. Quoted strings, identifiers and comments are left alone.
+// driverName may also be a dialect name returned by Of.
+func Rebind(driverName, query string) string {
+	dialect, _ := Of(driverName)
+	numbered := dialect == Postgres
+	if !numbered && !strings.Contains(query, "??") {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	Walk(query, func(i int) int {
+		if query[i] != '?' {
+			b.WriteByte(query[i])
+			return 1
+		}
+		if i+1 < len(query) && query[i+1] == '?' {
+			b.WriteByte('?')
+			return 2
+		}
+		if numbered {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteByte('?')
+		}
+		return 1
+	}, func(s string) { b.WriteString(s) })
+	return b.String()
+}
+
+// Walk calls code for each byte of query outside quotes and comments, which
+// returns how many bytes it consumed, and skip for quoted or commented text
+func Walk(query string, code func(i int) int, skip func(string)) {
+	for i := 0; i < len(query); {
+		var end int
+		switch {
+		case query[i] == '\'' || query[i] == '"' || query[i] == '`':
+			end = strings.IndexByte(query[i+1:], query[i])
+			if end < 0 {
+				end = len(query)
+			} else {
+				end += i + 2
+			}
+		case strings.HasPrefix(query[i:], "--"):
+			end = strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query)
+			} else {
+				end += i
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			end = strings.Index(query[i:], "*/")
+			if end < 0 {
+				end = len(query)
+			} else {
+				end += i + 2
+			}
+		default:
+			i += code(i)
+			continue
+		}
+		skip(query[i:end])
+		i = end
+	}
+}
@@ -0,0 +1,38 @@
+package sqldialect
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		driver, in, want string
+	}{
+		{"pgx", "SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = $1 AND b = $2"},
+		{"pgx", "SELECT '?', \"col?\" FROM t WHERE a = ? -- why?\nAND b = ?", "SELECT '?', \"col?\" FROM t WHERE a = $1 -- why?\nAND b = $2"},
+		{"pgx", "SELECT data ?? 'key' FROM t WHERE id = ?", "SELECT data ? 'key' FROM t WHERE id = $1"},
+		{"mysql", "SELECT * FROM t WHERE a = ?", "SELECT * FROM t WHERE a = ?"},
+		{"sqlite", "SELECT ?? FROM t", "SELECT ? FROM t"},
+		{"postgres", "SELECT ? FROM t", "SELECT $1 FROM t"},
+	}
+	for _, tt := range tests {
+		if got := Rebind(tt.driver, tt.in); got != tt.want {
+			t.Errorf("Rebind(%s, %q) = %q, want %q", tt.driver, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestOf(t *testing.T) {
+	for driver, want := range map[string]string{
+		"pgx": "postgres", "PostgreSQL": "postgres", "mysql": "mysql",
+		"sqlite3": "sqlite", "libsql": "sqlite", "turso": "sqlite",
+	} {
+		if got, err := Of(driver); err != nil || got != want {
+			t.Errorf("Of(%s) = %q (%v), want %q", driver, got, err, want)
+		}
+	}
+	if _, err := Of("oracle"); !errors.Is(err, ErrInvalidDriver) {
+		t.Errorf("Expected ErrInvalidDriver, got %v", err)
+	}
+}
@@ -0,0 +1,493 @@
+// database/tenant.go - multi-tenant pool routing
+package database
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Tenant routing errors
+var (
+	ErrNoTenant     = errors.New("no tenant in context")
+	ErrRouterClosed = errors.New("tenant router closed")
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a context routed to tenantID by TenantRouter
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant set by WithTenant
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantKey{}).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+// TenantConfig says where a tenant's data lives
+type TenantConfig struct {
+	// Config connects to the tenant's own database; nil uses
+	// TenantRouterConfig.Base
+	Config *Config
+
+	// Schema is the PostgreSQL search_path of the tenant, for
+	// schema-per-tenant layouts. Tenants on the same server share one pool;
+	// TenantDB sets the schema on each connection or transaction it hands out.
+	Schema string
+}
+
+// TenantResolver returns the connection settings for a tenant, e.g. from a
+// tenants table or secret store
+type TenantResolver func(ctx context.Context, tenantID string) (TenantConfig, error)
+
+// TenantRouterConfig configures a TenantRouter
+type TenantRouterConfig struct {
+	// Resolver is called once per tenant while its pool is open (required)
+	Resolver TenantResolver
+
+	// Base is the connection for tenants whose TenantConfig has no Config
+	Base Config
+
+	// TenantFromContext extracts the tenant ID (default TenantFromContext),
+	// e.g. to reuse a key set by authentication middleware
+	TenantFromContext func(ctx context.Context) (string, bool)
+
+	// MaxPools is how many pools stay open (default 50), one per database
+	// server and credentials. Beyond it the least recently used pool without
+	// unreleased handles is closed.
+	MaxPools int
+
+	// IdleTimeout closes pools unused for this long (default 10 minutes)
+	IdleTimeout time.Duration
+}
+
+// TenantRouter resolves the tenant in a context to its database. Pools are
+// opened on first use, shared by tenants on the same server and closed when
+// idle or evicted, but never while a TenantDB handle to them is unreleased.
+type TenantRouter struct {
+	config TenantRouterConfig
+
+	mu      sync.Mutex
+	pools   map[string]*list.Element // by server, see poolKey
+	tenants map[string]tenantRoute
+	lru     *list.List // front is most recently used
+	group   singleflight.Group
+	closed  bool
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// tenantPool is an open pool shared by the tenants routed to it
+type tenantPool struct {
+	key        string
+	db         *sql.DB
+	driverName string
+	tenants    []string // routed tenant IDs
+	refs       int      // unreleased handles
+	lastUsed   time.Time
+}
+
+// tenantRoute is a resolved tenant
+type tenantRoute struct {
+	pool   *list.Element
+	schema string
+}
+
+// TenantDB is a handle to a tenant's database. Release it when done: the
+// router does not close a pool while handles to it are held.
+type TenantDB struct {
+	db         *sql.DB
+	driverName string
+	schema     string
+	release    sync.Once
+	router     *TenantRouter
+	pool       *tenantPool
+}
+
+// NewTenantRouter creates a tenant router
+func NewTenantRouter(config TenantRouterConfig) (*TenantRouter, error) {
+	if config.Resolver == nil {
+		return nil, fmt.Errorf("%w: tenant resolver required", ErrInvalidConfig)
+	}
+	if config.TenantFromContext == nil {
+		config.TenantFromContext = TenantFromContext
+	}
+	if config.MaxPools <= 0 {
+		config.MaxPools = 50
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = 10 * time.Minute
+	}
+
+	r := &TenantRouter{
+		config:  config,
+		pools:   make(map[string]*list.Element),
+		tenants: make(map[string]tenantRoute),
+		lru:     list.New(),
+		stop:    make(chan struct{}),
+	}
+	r.stopped.Add(1)
+	go r.closeIdleLoop()
+	return r, nil
+}
+
+// DB returns a handle to the database of the tenant in ctx
+func (r *TenantRouter) DB(ctx context.Context) (*TenantDB, error) {
+	tenantID, ok := r.config.TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	return r.Tenant(ctx, tenantID)
+}
+
+// Tenant returns a handle to the database of tenantID, resolving the tenant
+// and opening its pool if needed
+func (r *TenantRouter) Tenant(ctx context.Context, tenantID string) (*TenantDB, error) {
+	for {
+		if handle, err := r.acquire(tenantID); handle != nil || err != nil {
+			return handle, err
+		}
+
+		// One resolver call per tenant, however many requests arrive at once
+		_, err, _ := r.group.Do(tenantID, func() (any, error) {
+			return nil, r.resolve(ctx, tenantID)
+		})
+		if err != nil {
+			return nil, err
+		}
+		// The route may have been evicted again before acquire; resolve anew
+	}
+}
+
+// acquire returns a handle to a resolved tenant, or nil if it isn't
+func (r *TenantRouter) acquire(tenantID string) (*TenantDB, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, ErrRouterClosed
+	}
+	route, ok := r.tenants[tenantID]
+	if !ok {
+		return nil, nil
+	}
+	pool := route.pool.Value.(*tenantPool)
+	pool.refs++
+	pool.lastUsed = time.Now()
+	r.lru.MoveToFront(route.pool)
+	return &TenantDB{db: pool.db, driverName: pool.driverName, schema: route.schema, router: r, pool: pool}, nil
+}
+
+// resolve routes tenantID to the pool of its server, opening it if needed
+func (r *TenantRouter) resolve(ctx context.Context, tenantID string) error {
+	r.mu.Lock()
+	_, resolved := r.tenants[tenantID]
+	r.mu.Unlock()
+	if resolved {
+		return nil
+	}
+
+	tenant, err := r.config.Resolver(ctx, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve tenant %s: %w", tenantID, err)
+	}
+	cfg := r.config.Base
+	if tenant.Config != nil {
+		cfg = *tenant.Config
+	}
+	key, driverName, err := poolKey(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to resolve tenant %s: %w", tenantID, err)
+	}
+	if tenant.Schema != "" {
+		if err := validateSchema(driverName, tenant.Schema); err != nil {
+			return err
+		}
+	}
+
+	// Opening doesn't connect; a pool opened concurrently for the same
+	// server wins and this one is discarded
+	db, err := openSQL(cfg, nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to open database for tenant %s: %w", tenantID, err)
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		db.Close()
+		return ErrRouterClosed
+	}
+	elem, ok := r.pools[key]
+	if ok {
+		defer db.Close()
+	} else {
+		elem = r.lru.PushFront(&tenantPool{key: key, db: db, driverName: driverName, lastUsed: time.Now()})
+		r.pools[key] = elem
+	}
+	pool := elem.Value.(*tenantPool)
+	pool.tenants = append(pool.tenants, tenantID)
+	r.tenants[tenantID] = tenantRoute{pool: elem, schema: tenant.Schema}
+
+	var evicted []*sql.DB
+	for e := r.lru.Back(); e != nil && r.lru.Len() > r.config.MaxPools; {
+		prev := e.Prev()
+		if e != elem && e.Value.(*tenantPool).refs == 0 {
+			evicted = append(evicted, r.remove(e))
+		}
+		e = prev
+	}
+	r.mu.Unlock()
+
+	return closeAll(evicted)
+}
+
+// remove unlinks a pool and its tenants; the caller closes it outside the lock
+func (r *TenantRouter) remove(elem *list.Element) *sql.DB {
+	pool := r.lru.Remove(elem).(*tenantPool)
+	delete(r.pools, pool.key)
+	for _, tenantID := range pool.tenants {
+		delete(r.tenants, tenantID)
+	}
+	return pool.db
+}
+
+// Evict forgets the routing of tenantID, e.g. after its configuration
+// changed, so the next request resolves it again. Its pool is closed once no
+// other tenant uses it and its handles are released.
+func (r *TenantRouter) Evict(tenantID string) error {
+	r.mu.Lock()
+	route, ok := r.tenants[tenantID]
+	if !ok {
+		r.mu.Unlock()
+		return nil
+	}
+	delete(r.tenants, tenantID)
+	pool := route.pool.Value.(*tenantPool)
+	pool.tenants = slices.DeleteFunc(pool.tenants, func(id string) bool { return id == tenantID })
+
+	var db *sql.DB
+	if len(pool.tenants) == 0 && pool.refs == 0 {
+		db = r.remove(route.pool)
+	}
+	r.mu.Unlock()
+
+	if db != nil {
+		return db.Close()
+	}
+	return nil
+}
+
+// closeIdle closes pools unused for IdleTimeout
+func (r *TenantRouter) closeIdle() {
+	cutoff := time.Now().Add(-r.config.IdleTimeout)
+
+	r.mu.Lock()
+	var idle []*sql.DB
+	for elem := r.lru.Back(); elem != nil; {
+		prev := elem.Prev()
+		pool := elem.Value.(*tenantPool)
+		if pool.lastUsed.After(cutoff) {
+			break // the rest were used more recently
+		}
+		if pool.refs == 0 {
+			idle = append(idle, r.remove(elem))
+		}
+		elem = prev
+	}
+	r.mu.Unlock()
+
+	_ = closeAll(idle)
+}
+
+func (r *TenantRouter) closeIdleLoop() {
+	defer r.stopped.Done()
+	ticker := time.NewTicker(max(r.config.IdleTimeout/2, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.closeIdle()
+		}
+	}
+}
+
+// Close closes every pool, including those with unreleased handles
+func (r *TenantRouter) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	var pools []*sql.DB
+	for r.lru.Len() > 0 {
+		pools = append(pools, r.remove(r.lru.Front()))
+	}
+	r.mu.Unlock()
+
+	close(r.stop)
+	r.stopped.Wait()
+	return closeAll(pools)
+}
+
+func closeAll(pools []*sql.DB) error {
+	var firstErr error
+	for _, db := range pools {
+		if err := db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Release returns the handle; the TenantDB and connections from DB must not
+// be used afterwards. Releasing twice is a no-op.
+func (t *TenantDB) Release() {
+	t.release.Do(func() {
+		t.router.mu.Lock()
+		t.pool.refs--
+		t.pool.lastUsed = time.Now()
+		t.router.mu.Unlock()
+	})
+}
+
+// DB returns the pool. For schema tenants it is shared with the other
+// tenants of the server and its connections carry no particular
+// search_path, so use Conn, BeginTx or WithTx instead.
+func (t *TenantDB) DB() *sql.DB {
+	return t.db
+}
+
+// DriverName returns the database/sql driver name, for BindDriver
+func (t *TenantDB) DriverName() string {
+	return t.driverName
+}
+
+// Schema returns the tenant's schema, or "" for a dedicated database
+func (t *TenantDB) Schema() string {
+	return t.schema
+}
+
+// TenantConn is a connection with a tenant's search_path set
+type TenantConn struct {
+	*sql.Conn
+	tenant *TenantDB
+}
+
+// DriverName returns the database/sql driver name, so the connection can be
+// passed to QueryOne, QueryAll and Exec
+func (c *TenantConn) DriverName() string {
+	return c.tenant.driverName
+}
+
+// Close resets the search_path and returns the connection to the pool, which
+// other tenants share. A connection whose reset fails is discarded instead.
+func (c *TenantConn) Close() error {
+	if c.tenant.schema != "" {
+		if _, err := c.Conn.ExecContext(context.Background(), `RESET search_path`); err != nil {
+			discard(c.Conn)
+			return fmt.Errorf("failed to reset search_path: %w", err)
+		}
+	}
+	return c.Conn.Close()
+}
+
+// Conn returns a connection with the tenant's search_path set for the
+// session. Close it, which resets the search_path, before Release.
+func (t *TenantDB) Conn(ctx context.Context) (*TenantConn, error) {
+	conn, err := t.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.setSearchPath(ctx, conn, false); err != nil {
+		discard(conn)
+		return nil, err
+	}
+	return &TenantConn{Conn: conn, tenant: t}, nil
+}
+
+// discard closes conn and removes it from its pool
+func discard(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+}
+
+// BeginTx starts a transaction with the tenant's search_path set for its
+// duration only (SET LOCAL)
+func (t *TenantDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	tx, err := t.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.setSearchPath(ctx, tx, true); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// WithTx is database.WithTx on the tenant's database, see BeginTx
+func (t *TenantDB) WithTx(ctx context.Context, opts *TxOptions, fn func(tx *sql.Tx) error) error {
+	return t.WithTxContext(ctx, opts, func(_ context.Context, tx *sql.Tx) error {
+		return fn(tx)
+	})
+}
+
+// WithTxContext is database.WithTxContext on the tenant's database, see
+// BeginTx
+func (t *TenantDB) WithTxContext(ctx context.Context, opts *TxOptions, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	return WithTxContext(ctx, t.db, opts, func(ctx context.Context, tx *sql.Tx) error {
+		if err := t.setSearchPath(ctx, tx, true); err != nil {
+			return err
+		}
+		return fn(ctx, tx)
+	})
+}
+
+// setSearchPath sets the tenant's schema on q, for the current transaction
+// only when local is true
+func (t *TenantDB) setSearchPath(ctx context.Context, q Querier, local bool) error {
+	if t.schema == "" {
+		return nil
+	}
+	if _, err := q.ExecContext(ctx, `SELECT set_config('search_path', $1, $2)`, t.schema, local); err != nil {
+		return fmt.Errorf("failed to set search_path: %w", err)
+	}
+	return nil
+}
+
+// poolKey identifies the server and credentials cfg connects to
+func poolKey(cfg Config) (key, driverName string, err error) {
+	driverName, dsn, err := resolveDSN(cfg)
+	if err != nil {
+		return "", "", err
+	}
+	return driverName + " " + dsn, driverName, nil
+}
+
+var schemaPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+
+// validateSchema checks a schema-per-tenant schema name
+func validateSchema(driverName, schema string) error {
+	if !schemaPattern.MatchString(schema) {
+		return fmt.Errorf("%w: invalid schema name %q", ErrInvalidConfig, schema)
+	}
+	if driverName != "pgx" {
+		return fmt.Errorf("%w: schema-per-tenant requires PostgreSQL", ErrInvalidConfig)
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestTenantRouter routes each tenant to its own sqlite file
+func newTestTenantRouter(t *testing.T, maxPools int) (*TenantRouter, *atomic.Int32) {
+	t.Helper()
+	dir := t.TempDir()
+	var resolves atomic.Int32
+	router, err := NewTenantRouter(TenantRouterConfig{
+		MaxPools: maxPools,
+		Resolver: func(ctx context.Context, tenantID string) (TenantConfig, error) {
+			resolves.Add(1)
+			if tenantID == "unknown" {
+				return TenantConfig{}, errors.New("no such tenant")
+			}
+			return TenantConfig{Config: &Config{Driver: "sqlite", Database: filepath.Join(dir, tenantID+".db")}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { router.Close() })
+	return router, &resolves
+}
+
+func TestTenantRouterRouting(t *testing.T) {
+	router, resolves := newTestTenantRouter(t, 10)
+
+	if _, err := router.DB(context.Background()); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("Expected ErrNoTenant, got %v", err)
+	}
+
+	for _, tenant := range []string{"acme", "globex"} {
+		handle, err := router.DB(WithTenant(context.Background(), tenant))
+		if err != nil {
+			t.Fatalf("DB(%s) failed: %v", tenant, err)
+		}
+		db := handle.DB()
+		if _, err := db.Exec(`CREATE TABLE owner (name TEXT)`); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`INSERT INTO owner (name) VALUES (?)`, tenant); err != nil {
+			t.Fatal(err)
+		}
+		handle.Release()
+	}
+
+	handle, _ := router.Tenant(context.Background(), "acme")
+	defer handle.Release()
+	var owner string
+	if err := handle.DB().QueryRow(`SELECT name FROM owner`).Scan(&owner); err != nil || owner != "acme" {
+		t.Errorf("Expected the acme database, got %q (%v)", owner, err)
+	}
+	if handle.DriverName() != "sqlite" || handle.Schema() != "" {
+		t.Errorf("Unexpected handle %q/%q", handle.DriverName(), handle.Schema())
+	}
+	if resolves.Load() != 2 {
+		t.Errorf("Expected one resolve per tenant, got %d", resolves.Load())
+	}
+
+	if _, err := router.Tenant(context.Background(), "unknown"); err == nil {
+		t.Error("Expected the resolver error")
+	}
+
+	// Concurrent first requests share one resolve
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handle, err := router.Tenant(context.Background(), "initech")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			handle.Release()
+		}()
+	}
+	wg.Wait()
+	if resolves.Load() != 4 {
+		t.Errorf("Expected a single resolve for concurrent requests, got %d", resolves.Load()-3)
+	}
+}
+
+func TestTenantRouterSharedPool(t *testing.T) {
+	base := Config{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "shared.db")}
+	router, err := NewTenantRouter(TenantRouterConfig{
+		Base: base,
+		Resolver: func(ctx context.Context, tenantID string) (TenantConfig, error) {
+			return TenantConfig{}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer router.Close()
+
+	a, _ := router.Tenant(context.Background(), "a")
+	b, _ := router.Tenant(context.Background(), "b")
+	defer a.Release()
+	defer b.Release()
+	if a.DB() != b.DB() || len(router.pools) != 1 {
+		t.Errorf("Expected tenants on one server to share a pool, have %d", len(router.pools))
+	}
+}
+
+func TestTenantRouterEviction(t *testing.T) {
+	router, resolves := newTestTenantRouter(t, 2)
+	ctx := context.Background()
+	tenant := func(id string) *TenantDB {
+		t.Helper()
+		handle, err := router.Tenant(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return handle
+	}
+
+	a := tenant("a")
+	a.Release()
+	tenant("b").Release()
+	tenant("a").Release() // a is now the most recently used
+	tenant("c").Release() // evicts b
+
+	if _, ok := router.tenants["b"]; ok || len(router.pools) != 2 {
+		t.Errorf("Expected b evicted, have %d pools", len(router.pools))
+	}
+	if err := a.DB().Ping(); err != nil {
+		t.Errorf("Expected a to stay open: %v", err)
+	}
+
+	// Pools with unreleased handles are not evicted, even before their first query
+	held := tenant("a")
+	tenant("c").Release()
+	tenant("d").Release()
+	if _, ok := router.tenants["a"]; !ok {
+		t.Error("Expected the held pool to stay open")
+	}
+	if err := held.DB().Ping(); err != nil {
+		t.Errorf("Expected the held pool to work: %v", err)
+	}
+
+	// Evicting a held tenant closes its pool only once released
+	if err := router.Evict("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := held.DB().Ping(); err != nil {
+		t.Errorf("Expected the held pool to stay open after Evict: %v", err)
+	}
+	held.Release()
+	held.Release()
+	for _, elem := range router.pools {
+		elem.Value.(*tenantPool).lastUsed = time.Now().Add(-time.Hour)
+	}
+	router.closeIdle()
+	if err := held.DB().Ping(); err == nil {
+		t.Error("Expected the released pool to be closed")
+	}
+
+	before := resolves.Load()
+	tenant("a").Release()
+	if resolves.Load() != before+1 {
+		t.Error("Expected an evicted tenant to be resolved again")
+	}
+	if err := router.Evict("a"); err != nil {
+		t.Fatal(err)
+	}
+	if len(router.pools) != 0 {
+		t.Errorf("Expected the unused pool closed on Evict, have %d", len(router.pools))
+	}
+
+	router.Close()
+	if _, err := router.Tenant(ctx, "a"); !errors.Is(err, ErrRouterClosed) {
+		t.Errorf("Expected ErrRouterClosed, got %v", err)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	if err := validateSchema("pgx", "tenant_42"); err != nil {
+		t.Errorf("Expected a valid schema, got %v", err)
+	}
+	if err := validateSchema("pgx", "x; DROP TABLE users"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected an invalid schema name to be rejected, got %v", err)
+	}
+	if err := validateSchema("sqlite", "tenant_42"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected schemas to require PostgreSQL, got %v", err)
+	}
+
+	router, _ := NewTenantRouter(TenantRouterConfig{
+		Base: Config{Driver: "sqlite", Database: filepath.Join(t.TempDir(), "app.db")},
+		Resolver: func(ctx context.Context, tenantID string) (TenantConfig, error) {
+			return TenantConfig{Schema: "tenant_" + tenantID}, nil
+		},
+	})
+	defer router.Close()
+	if _, err := router.Tenant(context.Background(), "42"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected schema tenants on sqlite to be rejected, got %v", err)
+	}
+}
+
+func TestTenantConnResetsSearchPath(t *testing.T) {
+	db := sql.OpenDB(&sessionConnector{})
+	defer db.Close()
+	db.SetMaxOpenConns(1) // the next user gets the same connection
+	tenant := &TenantDB{db: db, driverName: "pgx", schema: "tenant_a"}
+
+	searchPath := func(q Querier) string {
+		t.Helper()
+		var path string
+		if err := q.QueryRowContext(context.Background(), `SELECT current_setting('search_path')`).Scan(&path); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	conn, err := tenant.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path := searchPath(conn); path != "tenant_a" {
+		t.Errorf("Expected the tenant's search_path, got %q", path)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if path := searchPath(db); path != defaultSearchPath {
+		t.Errorf("Expected the search_path reset for the next user, got %q", path)
+	}
+}
+
+// defaultSearchPath is the session default of sessionConn
+const defaultSearchPath = `"$user", public`
+
+// sessionConnector opens sessionConns, fake PostgreSQL sessions that only
+// track their search_path
+type sessionConnector struct{}
+
+func (c *sessionConnector) Connect(context.Context) (driver.Conn, error) {
+	return &sessionConn{searchPath: defaultSearchPath}, nil
+}
+
+func (c *sessionConnector) Driver() driver.Driver { return nil }
+
+type sessionConn struct {
+	searchPath string
+}
+
+func (c *sessionConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *sessionConn) Close() error                        { return nil }
+func (c *sessionConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c *sessionConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	switch {
+	case query == `RESET search_path`:
+		c.searchPath = defaultSearchPath
+	case strings.Contains(query, "set_config('search_path'") && !args[1].Value.(bool):
+		c.searchPath = args[0].Value.(string)
+	default:
+		return nil, fmt.Errorf("unexpected statement %q", query)
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (c *sessionConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if query != `SELECT current_setting('search_path')` {
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+	return &settingRows{value: c.searchPath}, nil
+}
+
+// settingRows is a single-row, single-column result
+type settingRows struct {
+	value string
+	done  bool
+}
+
+func (r *settingRows) Columns() []string { return []string{"current_setting"} }
+func (r *settingRows) Close() error      { return nil }
+
+func (r *settingRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
@@ -0,0 +1,215 @@
+// database/tx.go - transaction helper with retries and savepoints
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+)
+
+// Querier is implemented by *sql.DB, *sql.Conn and *sql.Tx
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// TxOptions configures WithTx
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+
+	// MaxRetries is how often a transaction failing with a retryable error
+	// (see IsRetryable) is run again, default 3; negative disables retries
+	MaxRetries int
+
+	// MinBackoff and MaxBackoff bound the jittered exponential delay between
+	// attempts, default 10ms and 1s
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+type txKey struct{}
+
+// txState is the transaction carried in a context
+type txState struct {
+	tx         *sql.Tx
+	driverName string // of the pool the transaction runs on, "" if unknown
+	depth      int
+}
+
+// TxFromContext returns the transaction started by WithTxContext, if any
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		return nil, false
+	}
+	return state.tx, true
+}
+
+// QuerierFromContext returns the transaction in ctx, or db outside one, so
+// repository code works the same inside and outside WithTxContext. The
+// transaction is bound to its pool's driver for QueryOne, QueryAll and Exec.
+func QuerierFromContext(ctx context.Context, db *sql.DB) Querier {
+	state, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		return db
+	}
+	if state.driverName != "" {
+		return BindDriver(state.tx, state.driverName)
+	}
+	return state.tx
+}
+
+// WithTx runs fn in a transaction, committing if it returns nil and rolling
+// back if it returns an error or panics (the panic is re-raised).
+//
+// Serialization failures and deadlocks (see IsRetryable) roll back and run fn
+// again with backoff, so fn must be safe to repeat. If ctx already carries a
+// transaction from WithTxContext, fn runs in a savepoint of it instead; a
+// nested error rolls back to the savepoint only, and retries are left to the
+// outermost call.
+func WithTx(ctx context.Context, db *sql.DB, opts *TxOptions, fn func(tx *sql.Tx) error) error {
+	return WithTxContext(ctx, db, opts, func(_ context.Context, tx *sql.Tx) error {
+		return fn(tx)
+	})
+}
+
+// WithTxContext is WithTx with a context carrying the transaction, for code
+// that looks it up with TxFromContext or QuerierFromContext
+func WithTxContext(ctx context.Context, db *sql.DB, opts *TxOptions, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	if state, ok := ctx.Value(txKey{}).(*txState); ok {
+		return withSavepoint(ctx, state, fn)
+	}
+	if db == nil {
+		return ErrNotInitialized
+	}
+
+	o := TxOptions{MaxRetries: 3, MinBackoff: 10 * time.Millisecond, MaxBackoff: time.Second}
+	if opts != nil {
+		o.Isolation, o.ReadOnly = opts.Isolation, opts.ReadOnly
+		if opts.MaxRetries != 0 {
+			o.MaxRetries = max(opts.MaxRetries, 0)
+		}
+		if opts.MinBackoff > 0 {
+			o.MinBackoff = opts.MinBackoff
+		}
+		if opts.MaxBackoff > 0 {
+			o.MaxBackoff = opts.MaxBackoff
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := runTx(ctx, db, &o, fn)
+		if err == nil || attempt >= o.MaxRetries || !IsRetryable(err) {
+			return err
+		}
+
+		backoff := o.MinBackoff << attempt
+		if backoff <= 0 || backoff > o.MaxBackoff {
+			backoff = o.MaxBackoff
+		}
+		timer := time.NewTimer(rand.N(backoff) + 1)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (last error: %w)", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// runTx runs one attempt of a top-level transaction
+func runTx(ctx context.Context, db *sql.DB, opts *TxOptions, fn func(context.Context, *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	state := &txState{tx: tx, driverName: driverNameOf(db.Driver())}
+	if err := fn(context.WithValue(ctx, txKey{}, state), tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// withSavepoint runs fn in a savepoint of the transaction in state
+func withSavepoint(ctx context.Context, state *txState, fn func(context.Context, *sql.Tx) error) (err error) {
+	nested := &txState{tx: state.tx, driverName: state.driverName, depth: state.depth + 1}
+	name := fmt.Sprintf("beaver_sp_%d", nested.depth)
+
+	if _, err := state.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_, _ = state.tx.ExecContext(context.WithoutCancel(ctx), "ROLLBACK TO SAVEPOINT "+name)
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txKey{}, nested), state.tx); err != nil {
+		if _, rbErr := state.tx.ExecContext(context.WithoutCancel(ctx), "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+			return fmt.Errorf("%w (rollback to savepoint failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	if _, err := state.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+	return nil
+}
+
+// IsRetryable reports whether err means the transaction lost a conflict and
+// can succeed if run again: serialization failures and deadlocks on
+// PostgreSQL (40001, 40P01), deadlocks and lock wait timeouts on MySQL
+// (1213, 1205), and busy or locked databases on SQLite and LibSQL
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1213 || mysqlErr.Number == 1205
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code() & 0xff // primary result code
+		return code == 5 || code == 6   // SQLITE_BUSY, SQLITE_LOCKED
+	}
+
+	// LibSQL reports SQLite errors as text
+	msg := err.Error()
+	return strings.Contains(msg, "SQLITE_BUSY") || strings.Contains(msg, "database is locked")
+}
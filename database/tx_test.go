@@ -0,0 +1,202 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func openTxTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := openTestSQLite(t)
+	if _, err := db.Exec(`CREATE TABLE items (name TEXT PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func countItems(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM items`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestWithTxCommitAndRollback(t *testing.T) {
+	db := openTxTestDB(t)
+	ctx := context.Background()
+
+	err := WithTx(ctx, db, nil, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO items (name) VALUES ('a')`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx failed: %v", err)
+	}
+
+	errBoom := errors.New("boom")
+	err = WithTx(ctx, db, nil, func(tx *sql.Tx) error {
+		_, _ = tx.Exec(`INSERT INTO items (name) VALUES ('b')`)
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Errorf("Expected fn error, got %v", err)
+	}
+	if n := countItems(t, db); n != 1 {
+		t.Errorf("Expected only the committed row, got %d", n)
+	}
+}
+
+func TestWithTxPanicRollsBack(t *testing.T) {
+	db := openTxTestDB(t)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected the panic to be re-raised")
+			}
+		}()
+		_ = WithTx(context.Background(), db, nil, func(tx *sql.Tx) error {
+			_, _ = tx.Exec(`INSERT INTO items (name) VALUES ('a')`)
+			panic("boom")
+		})
+	}()
+
+	if n := countItems(t, db); n != 0 {
+		t.Errorf("Expected panic to roll back, got %d rows", n)
+	}
+}
+
+func TestWithTxRetries(t *testing.T) {
+	db := openTxTestDB(t)
+	ctx := context.Background()
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}
+
+	attempts := 0
+	err := WithTx(ctx, db, &TxOptions{MinBackoff: time.Millisecond}, func(tx *sql.Tx) error {
+		attempts++
+		if _, err := tx.Exec(`INSERT INTO items (name) VALUES ('a')`); err != nil {
+			return err
+		}
+		if attempts < 3 {
+			return fmt.Errorf("update failed: %w", deadlock)
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("Expected success on the third attempt, got %d attempts: %v", attempts, err)
+	}
+	if n := countItems(t, db); n != 1 {
+		t.Errorf("Expected failed attempts to roll back, got %d rows", n)
+	}
+
+	attempts = 0
+	err = WithTx(ctx, db, &TxOptions{MaxRetries: -1}, func(tx *sql.Tx) error {
+		attempts++
+		return deadlock
+	})
+	if !errors.Is(err, deadlock) || attempts != 1 {
+		t.Errorf("Expected a single attempt without retries, got %d: %v", attempts, err)
+	}
+
+	attempts = 0
+	err = WithTx(ctx, db, &TxOptions{MaxRetries: 2, MinBackoff: time.Millisecond}, func(tx *sql.Tx) error {
+		attempts++
+		return deadlock
+	})
+	if !errors.Is(err, deadlock) || attempts != 3 {
+		t.Errorf("Expected retries to stop after MaxRetries, got %d: %v", attempts, err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	err = WithTx(cancelled, db, &TxOptions{MinBackoff: time.Hour, MaxBackoff: time.Hour}, func(tx *sql.Tx) error {
+		cancel()
+		return deadlock
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancellation during backoff, got %v", err)
+	}
+}
+
+func TestWithTxSavepoints(t *testing.T) {
+	db := openTxTestDB(t)
+	ctx := context.Background()
+
+	insert := func(ctx context.Context, name string) error {
+		_, err := QuerierFromContext(ctx, db).ExecContext(ctx, `INSERT INTO items (name) VALUES (?)`, name)
+		return err
+	}
+
+	err := WithTxContext(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error {
+		if inTx, ok := TxFromContext(ctx); !ok || inTx != tx {
+			t.Error("Expected the transaction in the context")
+		}
+		if err := insert(ctx, "outer"); err != nil {
+			return err
+		}
+
+		// A failing nested transaction only rolls back its savepoint
+		nestedErr := WithTxContext(ctx, db, nil, func(ctx context.Context, _ *sql.Tx) error {
+			if err := insert(ctx, "discarded"); err != nil {
+				return err
+			}
+			return errors.New("nested failure")
+		})
+		if nestedErr == nil {
+			t.Error("Expected the nested error")
+		}
+
+		return WithTx(ctx, db, nil, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`INSERT INTO items (name) VALUES ('inner')`)
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTxContext failed: %v", err)
+	}
+
+	rows, _ := db.Query(`SELECT name FROM items ORDER BY name`)
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		_ = rows.Scan(&name)
+		names = append(names, name)
+	}
+	if fmt.Sprint(names) != "[inner outer]" {
+		t.Errorf("Unexpected rows: %v", names)
+	}
+
+	if _, ok := TxFromContext(ctx); ok {
+		t.Error("Expected no transaction outside WithTxContext")
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&pgconn.PgError{Code: "40001"}, true},
+		{fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: "40P01"}), true},
+		{&pgconn.PgError{Code: "23505"}, false},
+		{&mysql.MySQLError{Number: 1213}, true},
+		{&mysql.MySQLError{Number: 1062}, false},
+		{errors.New("hrana: SQLITE_BUSY: database is locked"), true},
+		{sql.ErrNoRows, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
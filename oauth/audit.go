@@ -0,0 +1,142 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// AuditEventType identifies an authentication activity
+type AuditEventType string
+
+// Audit event types
+const (
+	AuditLoginSucceeded     AuditEventType = "login_succeeded"
+	AuditLoginFailed        AuditEventType = "login_failed"
+	AuditStateInvalid       AuditEventType = "state_invalid"
+	AuditTokenRefreshed     AuditEventType = "token_refreshed"
+	AuditTokenRefreshFailed AuditEventType = "token_refresh_failed"
+	AuditTokenRevoked       AuditEventType = "token_revoked"
+	AuditGrantRevoked       AuditEventType = "grant_revoked"
+	AuditRateLimitExceeded  AuditEventType = "rate_limit_exceeded"
+)
+
+// AuditEvent is one entry of the authentication audit trail
+type AuditEvent struct {
+	Time      time.Time         `json:"time"`
+	Type      AuditEventType    `json:"type"`
+	Provider  string            `json:"provider,omitempty"`
+	UserID    string            `json:"user_id,omitempty"`
+	IP        string            `json:"ip,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// auditRecordTimeout bounds a single AuditSink.Record call
+const auditRecordTimeout = 5 * time.Second
+
+// AuditSink records audit events. Record is called on the request path with a
+// timeout, and its errors are ignored by the emitting service. Wrap sinks that
+// may be slow, such as SQLAuditSink, in NewAsyncAuditSink so that auditing
+// never blocks authentication; sinks that must not lose events should buffer
+// or retry internally.
+type AuditSink interface {
+	Record(ctx context.Context, event AuditEvent) error
+}
+
+// AuditSinkFunc adapts a function to AuditSink
+type AuditSinkFunc func(ctx context.Context, event AuditEvent) error
+
+// Record calls f(ctx, event)
+func (f AuditSinkFunc) Record(ctx context.Context, event AuditEvent) error {
+	return f(ctx, event)
+}
+
+// AuditClient describes who triggered an event
+type AuditClient struct {
+	UserID    string
+	IP        string
+	UserAgent string
+}
+
+const auditClientKey contextKey = "audit_client"
+
+// WithAuditClient returns a context whose audit events carry client's user
+// ID, IP and user agent. Middleware.AuditClient sets IP and user agent for
+// incoming requests; set UserID once the user is known.
+func WithAuditClient(ctx context.Context, client AuditClient) context.Context {
+	if existing, ok := ctx.Value(auditClientKey).(AuditClient); ok {
+		if client.UserID == "" {
+			client.UserID = existing.UserID
+		}
+		if client.IP == "" {
+			client.IP = existing.IP
+		}
+		if client.UserAgent == "" {
+			client.UserAgent = existing.UserAgent
+		}
+	}
+	return context.WithValue(ctx, auditClientKey, client)
+}
+
+// AuditClientFromContext returns the client stored by WithAuditClient
+func AuditClientFromContext(ctx context.Context) AuditClient {
+	client, _ := ctx.Value(auditClientKey).(AuditClient)
+	return client
+}
+
+// AuditClient stores the client IP and user agent of each request for audit events
+func (m *Middleware) AuditClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := WithAuditClient(r.Context(), AuditClient{
+			IP:        m.getClientIP(r),
+			UserAgent: r.UserAgent(),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// recordAudit fills in time and client details and sends the event to sink
+func recordAudit(ctx context.Context, sink AuditSink, event AuditEvent) {
+	if sink == nil {
+		return
+	}
+
+	event.Time = time.Now().UTC()
+	client := AuditClientFromContext(ctx)
+	if event.UserID == "" {
+		event.UserID = client.UserID
+	}
+	if event.IP == "" {
+		event.IP = client.IP
+	}
+	if event.UserAgent == "" {
+		event.UserAgent = client.UserAgent
+	}
+
+	// Record even if the request was cancelled meanwhile, but not forever
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditRecordTimeout)
+	defer cancel()
+	_ = sink.Record(ctx, event)
+}
+
+// auditOutcome records success, or failure (AuditStateInvalid for state
+// errors) with the error message. An empty type skips that outcome.
+func auditOutcome(ctx context.Context, sink AuditSink, provider string, success, failure AuditEventType, err error) {
+	if err == nil {
+		if success != "" {
+			recordAudit(ctx, sink, AuditEvent{Type: success, Provider: provider})
+		}
+		return
+	}
+
+	eventType := failure
+	if errors.Is(err, ErrInvalidState) {
+		eventType = AuditStateInvalid
+	}
+	if eventType != "" {
+		recordAudit(ctx, sink, AuditEvent{Type: eventType, Provider: provider, Error: err.Error()})
+	}
+}
@@ -0,0 +1,340 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/database/sqldialect"
+)
+
+// JSONAuditSink writes one JSON object per line
+type JSONAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONAuditSink creates a sink writing JSON lines to w
+func NewJSONAuditSink(w io.Writer) *JSONAuditSink {
+	return &JSONAuditSink{w: w}
+}
+
+// NewStdoutAuditSink creates a sink writing JSON lines to stdout, for
+// platforms that collect container output
+func NewStdoutAuditSink() *JSONAuditSink {
+	return NewJSONAuditSink(os.Stdout)
+}
+
+// Record writes the event as a JSON line
+func (s *JSONAuditSink) Record(_ context.Context, event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(line)
+	return err
+}
+
+// FileAuditSinkConfig configures a rotating audit log file
+type FileAuditSinkConfig struct {
+	Path string
+
+	// MaxSize rotates the file once it reaches this many bytes, default 100 MiB
+	MaxSize int64
+
+	// MaxBackups is how many rotated files (path.1 is the newest) to keep, default 5
+	MaxBackups int
+}
+
+// FileAuditSink appends JSON lines to a file and rotates it by size
+type FileAuditSink struct {
+	mu     sync.Mutex
+	config FileAuditSinkConfig
+	file   *os.File
+	size   int64
+}
+
+// NewFileAuditSink opens (or creates) the audit log for appending
+func NewFileAuditSink(cfg FileAuditSinkConfig) (*FileAuditSink, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("%w: audit log path is required", ErrInvalidConfig)
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = 100 << 20
+	}
+	if cfg.MaxBackups <= 0 {
+		cfg.MaxBackups = 5
+	}
+
+	s := &FileAuditSink{config: cfg}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Record appends the event, rotating first if the file is full
+func (s *FileAuditSink) Record(_ context.Context, event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("audit log %s is closed", s.config.Path)
+	}
+	if s.size > 0 && s.size+int64(len(line)) > s.config.MaxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// Close closes the audit log
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *FileAuditSink) open() error {
+	file, err := os.OpenFile(s.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate shifts path.N to path.N+1, moves the current file to path.1 and
+// starts a new one; s.mu must be held
+func (s *FileAuditSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+	s.file = nil
+
+	path := s.config.Path
+	_ = os.Remove(fmt.Sprintf("%s.%d", path, s.config.MaxBackups))
+	for i := s.config.MaxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+
+	return s.open()
+}
+
+// SQLAuditSinkConfig configures the SQL audit sink
+type SQLAuditSinkConfig struct {
+	// Dialect selects placeholder and DDL syntax: postgres, mysql or sqlite
+	Dialect string
+
+	// Table defaults to oauth_audit_events
+	Table string
+}
+
+// SQLAuditSink inserts audit events into a database table
+type SQLAuditSink struct {
+	db      *sql.DB
+	dialect string
+	table   string
+}
+
+// NewSQLAuditSink creates a sink backed by a SQL database, e.g. database.DB().
+// Call CreateSchema once (or run the equivalent migration) before use.
+func NewSQLAuditSink(db *sql.DB, cfg SQLAuditSinkConfig) (*SQLAuditSink, error) {
+	if db == nil {
+		return nil, fmt.Errorf("%w: database is required", ErrInvalidConfig)
+	}
+
+	dialect, err := sqlDialect(cfg.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	table := cfg.Table
+	if table == "" {
+		table = "oauth_audit_events"
+	}
+	if !sqlTablePattern.MatchString(table) {
+		return nil, fmt.Errorf("%w: invalid table name %q", ErrInvalidConfig, table)
+	}
+
+	return &SQLAuditSink{db: db, dialect: dialect, table: table}, nil
+}
+
+// CreateSchema creates the audit table if it does not exist
+func (s *SQLAuditSink) CreateSchema(ctx context.Context) error {
+	id, timestamp := "INTEGER PRIMARY KEY AUTOINCREMENT", "TIMESTAMP"
+	switch s.dialect {
+	case "postgres":
+		id, timestamp = "BIGSERIAL PRIMARY KEY", "TIMESTAMPTZ"
+	case "mysql":
+		id, timestamp = "BIGINT AUTO_INCREMENT PRIMARY KEY", "DATETIME(6)"
+	}
+
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id %s,
+	occurred_at %s NOT NULL,
+	event_type VARCHAR(64) NOT NULL,
+	provider VARCHAR(64) NOT NULL DEFAULT '',
+	user_id VARCHAR(255) NOT NULL DEFAULT '',
+	ip VARCHAR(64) NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL,
+	error TEXT NOT NULL,
+	details TEXT NOT NULL
+)`, s.table, id, timestamp))
+	if err != nil {
+		return fmt.Errorf("failed to create audit schema: %w", err)
+	}
+	return nil
+}
+
+// Record inserts the event
+func (s *SQLAuditSink) Record(ctx context.Context, event AuditEvent) error {
+	details := []byte("{}")
+	if len(event.Details) > 0 {
+		var err error
+		if details, err = json.Marshal(event.Details); err != nil {
+			return fmt.Errorf("failed to marshal audit details: %w", err)
+		}
+	}
+
+	_, err := s.db.ExecContext(ctx, sqldialect.Rebind(s.dialect, fmt.Sprintf(
+		`INSERT INTO %s (occurred_at, event_type, provider, user_id, ip, user_agent, error, details) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, s.table)),
+		event.Time, string(event.Type), event.Provider, event.UserID, event.IP, event.UserAgent, event.Error, string(details))
+	if err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
+
+// AsyncAuditSinkConfig configures an AsyncAuditSink
+type AsyncAuditSinkConfig struct {
+	// BufferSize is how many events may wait for the sink, default 1024.
+	// Events arriving while the buffer is full are dropped.
+	BufferSize int
+
+	// Timeout bounds each Record call on the wrapped sink, default 5s
+	Timeout time.Duration
+}
+
+// AsyncAuditSink records events on a background goroutine so that a slow or
+// unavailable sink never delays authentication. Events that don't fit in the
+// buffer are dropped and counted.
+type AsyncAuditSink struct {
+	sink    AuditSink
+	timeout time.Duration
+	events  chan AuditEvent
+	dropped atomic.Uint64
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+// NewAsyncAuditSink wraps sink in a bounded buffer. Call Close to flush
+// buffered events on shutdown.
+func NewAsyncAuditSink(sink AuditSink, cfg AsyncAuditSinkConfig) (*AsyncAuditSink, error) {
+	if sink == nil {
+		return nil, fmt.Errorf("%w: audit sink is required", ErrInvalidConfig)
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 1024
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = auditRecordTimeout
+	}
+
+	s := &AsyncAuditSink{
+		sink:    sink,
+		timeout: cfg.Timeout,
+		events:  make(chan AuditEvent, cfg.BufferSize),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Record queues the event without waiting. It drops the event when the
+// buffer is full or the sink is closed.
+func (s *AsyncAuditSink) Record(_ context.Context, event AuditEvent) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		s.dropped.Add(1)
+		return nil
+	}
+	select {
+	case s.events <- event:
+	default:
+		s.dropped.Add(1)
+	}
+	return nil
+}
+
+// Dropped returns how many events were dropped because the buffer was full
+// or the sink was closed
+func (s *AsyncAuditSink) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops accepting events and waits until buffered events are recorded
+// or ctx is done. It does not close the wrapped sink.
+func (s *AsyncAuditSink) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *AsyncAuditSink) run() {
+	defer close(s.done)
+	for event := range s.events {
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		_ = s.sink.Record(ctx, event)
+		cancel()
+	}
+}
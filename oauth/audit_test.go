@@ -0,0 +1,336 @@
+package oauth_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/oauth"
+	_ "modernc.org/sqlite"
+)
+
+// auditRecorder collects audit events in memory
+type auditRecorder struct {
+	mu     sync.Mutex
+	events []oauth.AuditEvent
+}
+
+func (r *auditRecorder) Record(_ context.Context, event oauth.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *auditRecorder) snapshot() []oauth.AuditEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]oauth.AuditEvent(nil), r.events...)
+}
+
+func TestJSONAuditSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := oauth.NewJSONAuditSink(&buf)
+
+	event := oauth.AuditEvent{
+		Time:     time.Now().UTC(),
+		Type:     oauth.AuditLoginSucceeded,
+		Provider: "google",
+		UserID:   "user-1",
+		Details:  map[string]string{"scope": "openid"},
+	}
+	if err := sink.Record(context.Background(), event); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	_ = sink.Record(context.Background(), oauth.AuditEvent{Type: oauth.AuditLoginFailed})
+
+	scanner := bufio.NewScanner(&buf)
+	var lines []oauth.AuditEvent
+	for scanner.Scan() {
+		var decoded oauth.AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &decoded); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, decoded)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+	if lines[0].Type != oauth.AuditLoginSucceeded || lines[0].UserID != "user-1" || lines[0].Details["scope"] != "openid" {
+		t.Errorf("Unexpected event: %+v", lines[0])
+	}
+}
+
+func TestFileAuditSinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := oauth.NewFileAuditSink(oauth.FileAuditSinkConfig{Path: path, MaxSize: 200, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("NewFileAuditSink failed: %v", err)
+	}
+	defer sink.Close()
+
+	for i := 0; i < 10; i++ {
+		err := sink.Record(context.Background(), oauth.AuditEvent{
+			Time:     time.Now().UTC(),
+			Type:     oauth.AuditTokenRefreshed,
+			Provider: "github",
+			UserID:   "user-1",
+		})
+		if err != nil {
+			t.Fatalf("Record %d failed: %v", i, err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("Expected %s to exist: %v", name, err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("%s exceeds MaxSize: %d bytes", name, info.Size())
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Errorf("%s has mode %v, want 0600", name, info.Mode().Perm())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected at most 2 backups, found %s.3", path)
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := sink.Record(context.Background(), oauth.AuditEvent{Type: oauth.AuditLoginFailed}); err == nil {
+		t.Error("Expected Record after Close to fail")
+	}
+}
+
+func TestSQLAuditSink(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	if _, err := oauth.NewSQLAuditSink(db, oauth.SQLAuditSinkConfig{Dialect: "sqlite", Table: "audit; DROP"}); err == nil {
+		t.Error("Expected invalid table name to be rejected")
+	}
+
+	sink, err := oauth.NewSQLAuditSink(db, oauth.SQLAuditSinkConfig{Dialect: "sqlite"})
+	if err != nil {
+		t.Fatalf("NewSQLAuditSink failed: %v", err)
+	}
+	ctx := context.Background()
+	if err := sink.CreateSchema(ctx); err != nil {
+		t.Fatalf("CreateSchema failed: %v", err)
+	}
+
+	err = sink.Record(ctx, oauth.AuditEvent{
+		Time:     time.Now().UTC(),
+		Type:     oauth.AuditGrantRevoked,
+		Provider: "google",
+		UserID:   "user-1",
+		IP:       "203.0.113.7",
+		Details:  map[string]string{"reason": oauth.RevokeReasonReuse},
+	})
+	if err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	var eventType, userID, ip, details string
+	err = db.QueryRow(`SELECT event_type, user_id, ip, details FROM oauth_audit_events`).Scan(&eventType, &userID, &ip, &details)
+	if err != nil {
+		t.Fatalf("Failed to read audit row: %v", err)
+	}
+	if eventType != string(oauth.AuditGrantRevoked) || userID != "user-1" || ip != "203.0.113.7" {
+		t.Errorf("Unexpected row: %s %s %s", eventType, userID, ip)
+	}
+	if details != `{"reason":"refresh_token_reuse"}` {
+		t.Errorf("Unexpected details: %s", details)
+	}
+}
+
+func TestMultiProviderServiceAudit(t *testing.T) {
+	recorder := &auditRecorder{}
+	service, err := oauth.NewMultiProviderService(oauth.MultiProviderConfig{SessionTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	service.WithAuditSink(recorder)
+	_ = service.RegisterProvider("google", oauth.NewGoogle(oauth.ProviderConfig{
+		ClientID:    "client",
+		RedirectURL: "http://localhost/callback",
+	}))
+
+	ctx := oauth.WithAuditClient(context.Background(), oauth.AuditClient{IP: "198.51.100.1", UserAgent: "test-agent"})
+	ctx = oauth.WithAuditClient(ctx, oauth.AuditClient{UserID: "user-1"})
+
+	if _, err := service.Exchange(ctx, "google", "code", "unknown-state"); err == nil {
+		t.Fatal("Expected exchange with unknown state to fail")
+	}
+	if _, err := service.ValidateState(ctx, "unknown-state"); err == nil {
+		t.Fatal("Expected unknown state to be invalid")
+	}
+
+	events := recorder.snapshot()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 audit events, got %+v", events)
+	}
+	for _, event := range events {
+		if event.Type != oauth.AuditStateInvalid {
+			t.Errorf("Expected state_invalid, got %s", event.Type)
+		}
+		if event.IP != "198.51.100.1" || event.UserAgent != "test-agent" || event.UserID != "user-1" {
+			t.Errorf("Client details missing: %+v", event)
+		}
+		if event.Time.IsZero() || event.Error == "" {
+			t.Errorf("Expected time and error to be set: %+v", event)
+		}
+	}
+	if events[0].Provider != "google" {
+		t.Errorf("Expected provider google, got %q", events[0].Provider)
+	}
+}
+
+func TestMiddlewareAuditsRateLimit(t *testing.T) {
+	recorder := &auditRecorder{}
+	m := oauth.NewMiddleware(oauth.MiddlewareConfig{
+		EnableRateLimiting: true,
+		RateLimit:          1,
+		RateInterval:       time.Minute,
+		RateBurstSize:      1,
+	}).WithAuditSink(recorder)
+
+	handler := m.AuditClient(m.RateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	codes := make([]int, 3)
+	for i := range codes {
+		req := httptest.NewRequest(http.MethodGet, "/auth/callback", nil)
+		req.RemoteAddr = "192.0.2.10:4321"
+		req.Header.Set("User-Agent", "burst-client")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		codes[i] = rec.Code
+	}
+	if codes[0] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Fatalf("Unexpected status codes: %v", codes)
+	}
+
+	events := recorder.snapshot()
+	if len(events) == 0 {
+		t.Fatal("Expected rate limit audit events")
+	}
+	event := events[0]
+	if event.Type != oauth.AuditRateLimitExceeded || event.IP != "192.0.2.10" || event.UserAgent != "burst-client" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+	if event.Details["path"] != "/auth/callback" {
+		t.Errorf("Expected path detail, got %+v", event.Details)
+	}
+}
+
+func TestTokenManagerAudit(t *testing.T) {
+	server, _ := newRotatingTokenServer(t)
+	provider, err := oauth.NewCustom(oauth.ProviderConfig{
+		ClientID:    "client",
+		RedirectURL: "http://localhost/callback",
+		AuthURL:     "http://localhost/authorize",
+		TokenURL:    server.URL,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	service, _ := oauth.NewMultiProviderService(oauth.MultiProviderConfig{})
+	_ = service.RegisterProvider("custom", provider)
+
+	recorder := &auditRecorder{}
+	tm := oauth.NewAdvancedTokenManager(oauth.TokenManagerConfig{
+		Store:           oauth.NewMemoryTokenStore(time.Hour),
+		ProviderService: service,
+		AuditSink:       recorder,
+	})
+	defer tm.Stop()
+	ctx := oauth.WithAuditClient(context.Background(), oauth.AuditClient{IP: "192.0.2.20", UserAgent: "refresh-client"})
+
+	_ = tm.CacheToken(ctx, "user-1", "custom", expiringToken("rt-0"))
+	if _, err := tm.RefreshIfNeeded(ctx, "user-1", "custom"); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	_ = tm.CacheToken(ctx, "user-2", "custom", expiringToken("revoked"))
+	_, _ = tm.RefreshIfNeeded(ctx, "user-2", "custom")
+
+	events := recorder.snapshot()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 audit events, got %+v", events)
+	}
+	if events[0].Type != oauth.AuditTokenRefreshed || events[0].UserID != "user-1" || events[0].Details["rotated"] != "true" {
+		t.Errorf("Unexpected refresh event: %+v", events[0])
+	}
+	if events[1].Type != oauth.AuditGrantRevoked || events[1].UserID != "user-2" || events[1].Details["reason"] != oauth.RevokeReasonInvalidGrant {
+		t.Errorf("Unexpected revocation event: %+v", events[1])
+	}
+	for _, event := range events {
+		if event.IP != "192.0.2.20" || event.UserAgent != "refresh-client" {
+			t.Errorf("Expected the caller's client on %s, got %+v", event.Type, event)
+		}
+	}
+}
+
+func TestAsyncAuditSink(t *testing.T) {
+	release := make(chan struct{})
+	recorder := &auditRecorder{}
+	var deadlines int
+	slow := oauth.AuditSinkFunc(func(ctx context.Context, event oauth.AuditEvent) error {
+		if _, ok := ctx.Deadline(); ok {
+			deadlines++
+		}
+		<-release
+		return recorder.Record(ctx, event)
+	})
+
+	sink, err := oauth.NewAsyncAuditSink(slow, oauth.AsyncAuditSinkConfig{BufferSize: 2, Timeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		_ = sink.Record(context.Background(), oauth.AuditEvent{Type: oauth.AuditRateLimitExceeded})
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Record not to wait for the sink, took %v", elapsed)
+	}
+	// One event is in flight, two are buffered
+	if dropped := sink.Dropped(); dropped < 7 {
+		t.Errorf("Expected overflowing events dropped, got %d", dropped)
+	}
+
+	close(release)
+	if err := sink.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	recorded := len(recorder.snapshot())
+	if recorded+int(sink.Dropped()) != 10 {
+		t.Errorf("Expected every event recorded or dropped, got %d recorded and %d dropped", recorded, sink.Dropped())
+	}
+	if deadlines != recorded {
+		t.Errorf("Expected a timeout on every record, got %d of %d", deadlines, recorded)
+	}
+
+	_ = sink.Record(context.Background(), oauth.AuditEvent{Type: oauth.AuditLoginFailed})
+	if len(recorder.snapshot()) != recorded {
+		t.Error("Expected events after Close to be dropped")
+	}
+}
@@ -402,6 +402,17 @@ func (p *ProviderWithCircuitBreaker) GetAuthURL(state string, pkce *PKCEChalleng
 	return p.provider.GetAuthURL(state, pkce)
 }
 
+// AuthURLContext builds the authorization URL, protecting PAR requests with the breaker
+func (p *ProviderWithCircuitBreaker) AuthURLContext(ctx context.Context, state string, pkce *PKCEChallenge) (string, error) {
+	var result string
+	err := p.breaker.Call(ctx, func() error {
+		var urlErr error
+		result, urlErr = buildAuthURL(ctx, p.provider, state, pkce)
+		return urlErr
+	})
+	return result, err
+}
+
 // Exchange exchanges an authorization code for tokens
 func (p *ProviderWithCircuitBreaker) Exchange(ctx context.Context, code string, pkce *PKCEChallenge) (*Token, error) {
 	var token *Token
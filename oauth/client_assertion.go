@@ -0,0 +1,138 @@
+package oauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/gobeaver/beaver-kit/krypto"
+)
+
+// clientAssertionType is the client_assertion_type for private_key_jwt (RFC 7523 section 2.2)
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// ErrInvalidSigningKey indicates a private key that cannot sign JWTs
+var ErrInvalidSigningKey = errors.New("invalid signing key")
+
+// JWTSigner signs JWT assertions with an RSA or ECDSA private key.
+//
+// Keys are PEM encoded. PKCS#1 RSA keys produced by krypto.GenerateRSAKeyPair,
+// PKCS#8 keys and SEC 1 EC keys are accepted. The signing algorithm is derived
+// from the key: RS256 for RSA, ES256/ES384/ES512 for P-256/P-384/P-521.
+type JWTSigner struct {
+	key    crypto.Signer
+	method jwt.SigningMethod
+	keyID  string
+}
+
+// NewJWTSigner creates a signer from a PEM encoded private key
+func NewJWTSigner(privateKeyPEM, keyID string) (*JWTSigner, error) {
+	if privateKeyPEM == "" {
+		return nil, fmt.Errorf("%w: private key is required", ErrInvalidSigningKey)
+	}
+
+	if key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKeyPEM)); err == nil {
+		return NewJWTSignerFromKey(key, keyID)
+	}
+	if key, err := jwt.ParseECPrivateKeyFromPEM([]byte(privateKeyPEM)); err == nil {
+		return NewJWTSignerFromKey(key, keyID)
+	}
+
+	return nil, fmt.Errorf("%w: expected an RSA or ECDSA private key in PEM format", ErrInvalidSigningKey)
+}
+
+// NewJWTSignerFromKeyPair creates a signer from a krypto RSA key pair
+func NewJWTSignerFromKeyPair(pair krypto.PublicPrivatePair, keyID string) (*JWTSigner, error) {
+	return NewJWTSigner(pair.PrivateKey, keyID)
+}
+
+// NewJWTSignerFromKey creates a signer from an *rsa.PrivateKey or *ecdsa.PrivateKey
+func NewJWTSignerFromKey(key crypto.Signer, keyID string) (*JWTSigner, error) {
+	signer := &JWTSigner{key: key, keyID: keyID}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signer.method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			signer.method = jwt.SigningMethodES256
+		case elliptic.P384():
+			signer.method = jwt.SigningMethodES384
+		case elliptic.P521():
+			signer.method = jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("%w: unsupported curve %s", ErrInvalidSigningKey, k.Curve.Params().Name)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrInvalidSigningKey, key)
+	}
+
+	return signer, nil
+}
+
+// Algorithm returns the JWS algorithm used by the signer
+func (s *JWTSigner) Algorithm() string {
+	return s.method.Alg()
+}
+
+// KeyID returns the key ID placed in the JWT header
+func (s *JWTSigner) KeyID() string {
+	return s.keyID
+}
+
+// PublicKey returns the public half of the signing key
+func (s *JWTSigner) PublicKey() crypto.PublicKey {
+	return s.key.Public()
+}
+
+// Sign signs the claims and returns a compact JWT
+func (s *JWTSigner) Sign(claims jwt.Claims) (string, error) {
+	return s.signWithHeader(claims, nil)
+}
+
+// signWithHeader signs the claims with additional JOSE header parameters
+func (s *JWTSigner) signWithHeader(claims jwt.Claims, header map[string]interface{}) (string, error) {
+	token := jwt.NewWithClaims(s.method, claims)
+	if s.keyID != "" {
+		token.Header["kid"] = s.keyID
+	}
+	for k, v := range header {
+		token.Header[k] = v
+	}
+
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+	return signed, nil
+}
+
+// assertion builds a short-lived assertion JWT (RFC 7523 section 3)
+func (s *JWTSigner) assertion(issuer, subject, audience string, lifetime time.Duration, extra map[string]interface{}) (string, error) {
+	jti, err := krypto.GenerateSecureToken(16)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate jti: %w", err)
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": issuer,
+		"sub": subject,
+		"aud": audience,
+		"iat": now.Unix(),
+		"exp": now.Add(lifetime).Unix(),
+		"jti": jti,
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+
+	return s.Sign(claims)
+}
@@ -6,15 +6,17 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 )
 
 // CustomProvider implements a generic OAuth 2.0 provider
 type CustomProvider struct {
-	config     ProviderConfig
-	httpClient HTTPClient
-	name       string
+	config        ProviderConfig
+	httpClient    HTTPClient
+	name          string
+	requestSigner *JWTSigner
 }
 
 // NewCustom creates a new custom OAuth provider
@@ -23,10 +25,13 @@ func NewCustom(config ProviderConfig) (*CustomProvider, error) {
 	if config.ClientID == "" {
 		return nil, fmt.Errorf("client ID is required")
 	}
-	if config.RedirectURL == "" {
+	// Device-only clients (CLIs, TVs) have no redirect URI and never use
+	// the authorization endpoint
+	deviceOnly := config.isDeviceOnly()
+	if config.RedirectURL == "" && !deviceOnly {
 		return nil, fmt.Errorf("redirect URL is required")
 	}
-	if config.AuthURL == "" {
+	if config.AuthURL == "" && !deviceOnly {
 		return nil, fmt.Errorf("auth URL is required for custom provider")
 	}
 	if config.TokenURL == "" {
@@ -52,6 +57,23 @@ func NewCustom(config ProviderConfig) (*CustomProvider, error) {
 		provider.name = config.Type
 	}
 
+	// Signed request objects (JAR)
+	provider.requestSigner = config.RequestObjectSigner
+	if provider.requestSigner == nil && config.RequestObjectKey == "" && config.RequestObjectKeyFile != "" {
+		key, err := os.ReadFile(config.RequestObjectKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request object key: %w", err)
+		}
+		config.RequestObjectKey = string(key)
+	}
+	if provider.requestSigner == nil && config.RequestObjectKey != "" {
+		signer, err := NewJWTSigner(config.RequestObjectKey, config.RequestObjectKeyID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request object key: %w", err)
+		}
+		provider.requestSigner = signer
+	}
+
 	return provider, nil
 }
 
@@ -62,29 +84,15 @@ func (c *CustomProvider) SetHTTPClient(client HTTPClient) {
 
 // GetAuthURL returns the authorization URL with optional PKCE parameters
 func (c *CustomProvider) GetAuthURL(state string, pkce *PKCEChallenge) string {
-	params := url.Values{
-		"client_id":     {c.config.ClientID},
-		"redirect_uri":  {c.config.RedirectURL},
-		"response_type": {"code"},
-		"state":         {state},
-	}
-
-	// Add scopes
-	if len(c.config.Scopes) > 0 {
-		params.Set("scope", strings.Join(c.config.Scopes, " "))
-	}
-
-	// Add PKCE parameters if provided
-	if pkce != nil {
-		params.Set("code_challenge", pkce.Challenge)
-		params.Set("code_challenge_method", pkce.ChallengeMethod)
-	}
-
-	return c.config.AuthURL + "?" + params.Encode()
+	return c.config.AuthURL + "?" + c.authParams(state, pkce).Encode()
 }
 
 // Exchange exchanges an authorization code for tokens
 func (c *CustomProvider) Exchange(ctx context.Context, code string, pkce *PKCEChallenge) (*Token, error) {
+	if c.config.RedirectURL == "" {
+		return nil, fmt.Errorf("%w: redirect URL is required for the authorization code flow", ErrInvalidConfig)
+	}
+
 	data := url.Values{
 		"grant_type":   {"authorization_code"},
 		"code":         {code},
@@ -308,8 +316,14 @@ func (c *CustomProvider) GetUserInfo(ctx context.Context, accessToken string) (*
 	return userInfo, nil
 }
 
-// RevokeToken revokes the access token
+// RevokeToken revokes a token (RFC 7009)
 func (c *CustomProvider) RevokeToken(ctx context.Context, token string) error {
+	return c.RevokeTokenWithHint(ctx, token, "")
+}
+
+// RevokeTokenWithHint revokes a token, passing token_type_hint
+// ("access_token" or "refresh_token") to help the server find it (RFC 7009 section 2.1)
+func (c *CustomProvider) RevokeTokenWithHint(ctx context.Context, token, tokenTypeHint string) error {
 	if c.config.RevokeURL == "" {
 		// If no revoke URL is configured, we can't revoke the token
 		// This is not an error for providers that don't support revocation
@@ -320,6 +334,9 @@ func (c *CustomProvider) RevokeToken(ctx context.Context, token string) error {
 		"token":     {token},
 		"client_id": {c.config.ClientID},
 	}
+	if tokenTypeHint != "" {
+		data.Set("token_type_hint", tokenTypeHint)
+	}
 
 	// Add client secret if configured
 	if c.config.ClientSecret != "" {
@@ -339,11 +356,23 @@ func (c *CustomProvider) RevokeToken(ctx context.Context, token string) error {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("failed to revoke token: status code %d", resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		// Invalid or already revoked tokens also return 200 (RFC 7009 section 2.2)
+		return nil
+	case http.StatusServiceUnavailable:
+		// The client may retry after the Retry-After delay (RFC 7009 section 2.2.1)
+		return fmt.Errorf("%w: token revocation unavailable", ErrTemporarilyUnavailable)
 	}
 
-	return nil
+	var errResp struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil && errResp.Error != "" {
+		return ParseError(c.name, errResp.Error, errResp.ErrorDescription, "")
+	}
+	return fmt.Errorf("failed to revoke token: status code %d", resp.StatusCode)
 }
 
 // ValidateConfig validates the provider configuration
@@ -351,6 +380,9 @@ func (c *CustomProvider) ValidateConfig() error {
 	if c.config.ClientID == "" {
 		return fmt.Errorf("missing client ID")
 	}
+	if c.config.isDeviceOnly() {
+		return nil
+	}
 	if c.config.RedirectURL == "" {
 		return fmt.Errorf("missing redirect URL")
 	}
@@ -380,6 +412,29 @@ func (c *CustomProvider) SupportsPKCE() bool {
 	return true
 }
 
+// StartDeviceAuth starts the device authorization grant.
+// Returns ErrDeviceFlowNotSupported unless DeviceAuthURL is configured.
+func (c *CustomProvider) StartDeviceAuth(ctx context.Context) (*DeviceAuthResponse, error) {
+	return c.deviceFlow().StartDeviceAuth(ctx)
+}
+
+// PollDeviceToken polls until the user authorizes the device
+func (c *CustomProvider) PollDeviceToken(ctx context.Context, auth *DeviceAuthResponse) (*Token, error) {
+	return c.deviceFlow().PollDeviceToken(ctx, auth)
+}
+
+func (c *CustomProvider) deviceFlow() *deviceFlow {
+	return &deviceFlow{
+		provider:      c.name,
+		deviceAuthURL: c.config.DeviceAuthURL,
+		tokenURL:      c.config.TokenURL,
+		clientID:      c.config.ClientID,
+		clientSecret:  c.config.ClientSecret,
+		scopes:        c.config.Scopes,
+		httpClient:    func() HTTPClient { return c.httpClient },
+	}
+}
+
 // Helper functions to extract values from raw data
 
 func getString(data map[string]interface{}, keys ...string) (string, bool) {
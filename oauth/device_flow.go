@@ -0,0 +1,282 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Device flow errors (RFC 8628 section 3.5)
+var (
+	// ErrDeviceFlowNotSupported indicates the provider has no device authorization endpoint
+	ErrDeviceFlowNotSupported = errors.New("device authorization grant not supported by provider")
+
+	// ErrAuthorizationPending indicates the user has not yet completed authorization
+	ErrAuthorizationPending = errors.New("authorization pending")
+
+	// ErrSlowDown indicates the client is polling too frequently
+	ErrSlowDown = errors.New("polling too frequently")
+
+	// ErrDeviceCodeExpired indicates the device code expired before the user authorized it
+	ErrDeviceCodeExpired = errors.New("device code expired")
+)
+
+// DeviceAuthProvider is implemented by providers that support the
+// OAuth 2.0 Device Authorization Grant (RFC 8628), used by CLIs, TVs and
+// other input-constrained clients that cannot receive redirects.
+type DeviceAuthProvider interface {
+	// StartDeviceAuth requests a device code and user code from the provider
+	StartDeviceAuth(ctx context.Context) (*DeviceAuthResponse, error)
+
+	// PollDeviceToken polls the token endpoint until the user authorizes the
+	// device, the code expires, or ctx is cancelled
+	PollDeviceToken(ctx context.Context, auth *DeviceAuthResponse) (*Token, error)
+}
+
+// DeviceAuthResponse is the device authorization response (RFC 8628 section 3.2)
+type DeviceAuthResponse struct {
+	DeviceCode              string    `json:"device_code"`
+	UserCode                string    `json:"user_code"`
+	VerificationURI         string    `json:"verification_uri"`
+	VerificationURIComplete string    `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int       `json:"expires_in"`
+	Interval                int       `json:"interval,omitempty"`
+	ExpiresAt               time.Time `json:"expires_at"`
+}
+
+// IsExpired checks if the device code is expired
+func (d *DeviceAuthResponse) IsExpired() bool {
+	if d.ExpiresAt.IsZero() {
+		return false
+	}
+	return time.Now().After(d.ExpiresAt)
+}
+
+// deviceFlow implements the device grant against a pair of endpoints.
+// Providers embed it to satisfy DeviceAuthProvider.
+type deviceFlow struct {
+	provider      string
+	deviceAuthURL string
+	tokenURL      string
+	clientID      string
+	clientSecret  string
+	scopes        []string
+	httpClient    func() HTTPClient
+
+	// maxBackoff caps the delay applied after transient polling failures
+	maxBackoff time.Duration
+}
+
+// deviceGrantType is the grant_type used when polling (RFC 8628 section 3.4)
+const deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// StartDeviceAuth requests a device code and user code from the provider
+func (d *deviceFlow) StartDeviceAuth(ctx context.Context) (*DeviceAuthResponse, error) {
+	if d.deviceAuthURL == "" {
+		return nil, ErrDeviceFlowNotSupported
+	}
+
+	data := url.Values{
+		"client_id": {d.clientID},
+	}
+	if len(d.scopes) > 0 {
+		data.Set("scope", strings.Join(d.scopes, " "))
+	}
+	if d.clientSecret != "" {
+		data.Set("client_secret", d.clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", d.deviceAuthURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := d.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to start device authorization: %v", ErrNetworkError, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device authorization response: %w", err)
+	}
+
+	var authResp struct {
+		DeviceAuthResponse
+		// Google returns verification_url instead of verification_uri
+		VerificationURL  string `json:"verification_url"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &authResp); err != nil {
+		return nil, fmt.Errorf("%w: unexpected status code %d", ErrInvalidResponse, resp.StatusCode)
+	}
+
+	if authResp.Error != "" {
+		return nil, ParseError(d.provider, authResp.Error, authResp.ErrorDescription, "")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status code %d", ErrInvalidResponse, resp.StatusCode)
+	}
+
+	result := authResp.DeviceAuthResponse
+	if result.VerificationURI == "" {
+		result.VerificationURI = authResp.VerificationURL
+	}
+	if result.DeviceCode == "" || result.UserCode == "" || result.VerificationURI == "" {
+		return nil, fmt.Errorf("%w: incomplete device authorization response", ErrInvalidResponse)
+	}
+	if result.Interval <= 0 {
+		result.Interval = 5 // RFC 8628 default
+	}
+	if result.ExpiresIn > 0 {
+		result.ExpiresAt = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+
+	return &result, nil
+}
+
+// PollDeviceToken polls the token endpoint until the user authorizes the device.
+//
+// authorization_pending keeps polling at the current interval, slow_down
+// increases the interval by 5 seconds as required by RFC 8628, and transient
+// network or server failures back off exponentially up to maxBackoff.
+func (d *deviceFlow) PollDeviceToken(ctx context.Context, auth *DeviceAuthResponse) (*Token, error) {
+	if auth == nil || auth.DeviceCode == "" {
+		return nil, fmt.Errorf("%w: device code required", ErrInvalidCode)
+	}
+
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	maxBackoff := d.maxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = time.Minute
+	}
+
+	// Bound polling by the device code lifetime
+	if !auth.ExpiresAt.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, auth.ExpiresAt)
+		defer cancel()
+	}
+
+	delay := interval
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if auth.IsExpired() {
+				return nil, ErrDeviceCodeExpired
+			}
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		token, err := d.requestDeviceToken(ctx, auth.DeviceCode)
+		switch {
+		case err == nil:
+			return token, nil
+		case errors.Is(err, ErrAuthorizationPending):
+			delay = interval
+		case errors.Is(err, ErrSlowDown):
+			interval += 5 * time.Second
+			delay = interval
+		case IsRetryable(err):
+			delay = min(delay*2, maxBackoff)
+		default:
+			return nil, err
+		}
+	}
+}
+
+// requestDeviceToken performs a single device token request
+func (d *deviceFlow) requestDeviceToken(ctx context.Context, deviceCode string) (*Token, error) {
+	data := url.Values{
+		"grant_type":  {deviceGrantType},
+		"device_code": {deviceCode},
+		"client_id":   {d.clientID},
+	}
+	if d.clientSecret != "" {
+		data.Set("client_secret", d.clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", d.tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := d.httpClient().Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %v", ErrNetworkError, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("%w: status code %d", ErrServerError, resp.StatusCode)
+	}
+
+	var tokenResp struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		IDToken          string `json:"id_token"`
+		Scope            string `json:"scope"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	// Some providers (GitHub) report errors with a 200 status
+	switch tokenResp.Error {
+	case "":
+	case "authorization_pending":
+		return nil, ErrAuthorizationPending
+	case "slow_down":
+		return nil, ErrSlowDown
+	case "expired_token":
+		return nil, ErrDeviceCodeExpired
+	default:
+		return nil, ParseError(d.provider, tokenResp.Error, tokenResp.ErrorDescription, "")
+	}
+
+	if resp.StatusCode != http.StatusOK || tokenResp.AccessToken == "" {
+		return nil, fmt.Errorf("%w: unexpected status code %d", ErrInvalidResponse, resp.StatusCode)
+	}
+
+	var expiresAt time.Time
+	if tokenResp.ExpiresIn > 0 {
+		expiresAt = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	}
+
+	return &Token{
+		AccessToken:  tokenResp.AccessToken,
+		TokenType:    tokenResp.TokenType,
+		RefreshToken: tokenResp.RefreshToken,
+		ExpiresIn:    tokenResp.ExpiresIn,
+		ExpiresAt:    expiresAt,
+		IDToken:      tokenResp.IDToken,
+		Scope:        tokenResp.Scope,
+	}, nil
+}
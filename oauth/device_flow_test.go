@@ -0,0 +1,211 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/oauth"
+)
+
+func TestDeviceFlow_PendingThenSuccess(t *testing.T) {
+	var polls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/device":
+			// Google-style response uses verification_url
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"device_code":      "dev-123",
+				"user_code":        "ABCD-EFGH",
+				"verification_url": "https://example.com/device",
+				"expires_in":       60,
+				"interval":         1,
+			})
+		case "/token":
+			if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:device_code" {
+				t.Errorf("Unexpected grant_type %q", r.FormValue("grant_type"))
+			}
+			if atomic.AddInt32(&polls, 1) < 2 {
+				// GitHub-style error with a 200 status
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": "authorization_pending"})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "access-123",
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+			})
+		}
+	}))
+	defer server.Close()
+
+	provider, err := oauth.NewCustom(oauth.ProviderConfig{
+		ClientID:      "client",
+		RedirectURL:   "http://localhost/callback",
+		AuthURL:       server.URL + "/authorize",
+		TokenURL:      server.URL + "/token",
+		DeviceAuthURL: server.URL + "/device",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	ctx := context.Background()
+	auth, err := provider.StartDeviceAuth(ctx)
+	if err != nil {
+		t.Fatalf("Failed to start device auth: %v", err)
+	}
+	if auth.UserCode != "ABCD-EFGH" || auth.VerificationURI != "https://example.com/device" {
+		t.Errorf("Unexpected device auth response: %+v", auth)
+	}
+	if auth.ExpiresAt.IsZero() {
+		t.Error("ExpiresAt should be set")
+	}
+
+	token, err := provider.PollDeviceToken(ctx, auth)
+	if err != nil {
+		t.Fatalf("Failed to poll device token: %v", err)
+	}
+	if token.AccessToken != "access-123" {
+		t.Errorf("Expected access-123, got %s", token.AccessToken)
+	}
+	if got := atomic.LoadInt32(&polls); got != 2 {
+		t.Errorf("Expected 2 polls, got %d", got)
+	}
+}
+
+func TestDeviceFlow_Errors(t *testing.T) {
+	tests := []struct {
+		code    string
+		wantErr error
+	}{
+		{"access_denied", oauth.ErrAccessDenied},
+		{"expired_token", oauth.ErrDeviceCodeExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": tt.code})
+			}))
+			defer server.Close()
+
+			provider, _ := oauth.NewCustom(oauth.ProviderConfig{
+				ClientID:    "client",
+				RedirectURL: "http://localhost/callback",
+				AuthURL:     server.URL + "/authorize",
+				TokenURL:    server.URL + "/token",
+			})
+
+			auth := &oauth.DeviceAuthResponse{DeviceCode: "dev", Interval: 1}
+			_, err := provider.PollDeviceToken(context.Background(), auth)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDeviceFlow_ContextCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "authorization_pending"})
+	}))
+	defer server.Close()
+
+	provider, _ := oauth.NewCustom(oauth.ProviderConfig{
+		ClientID:    "client",
+		RedirectURL: "http://localhost/callback",
+		AuthURL:     server.URL + "/authorize",
+		TokenURL:    server.URL + "/token",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	auth := &oauth.DeviceAuthResponse{DeviceCode: "dev", Interval: 1}
+	if _, err := provider.PollDeviceToken(ctx, auth); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestDeviceFlow_NotSupported(t *testing.T) {
+	provider, _ := oauth.NewCustom(oauth.ProviderConfig{
+		ClientID:    "client",
+		RedirectURL: "http://localhost/callback",
+		AuthURL:     "https://example.com/authorize",
+		TokenURL:    "https://example.com/token",
+	})
+
+	if _, err := provider.StartDeviceAuth(context.Background()); !errors.Is(err, oauth.ErrDeviceFlowNotSupported) {
+		t.Errorf("Expected ErrDeviceFlowNotSupported, got %v", err)
+	}
+}
+
+func TestMicrosoftProvider_Defaults(t *testing.T) {
+	provider, err := oauth.NewMicrosoft(oauth.ProviderConfig{
+		ClientID:    "client",
+		RedirectURL: "http://localhost/callback",
+		Tenant:      "contoso.onmicrosoft.com",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	if provider.Name() != "microsoft" {
+		t.Errorf("Expected name microsoft, got %s", provider.Name())
+	}
+
+	authURL := provider.GetAuthURL("state", nil)
+	if !strings.HasPrefix(authURL, "https://login.microsoftonline.com/contoso.onmicrosoft.com/oauth2/v2.0/authorize") {
+		t.Errorf("Unexpected auth URL: %s", authURL)
+	}
+	if !strings.Contains(authURL, "offline_access") {
+		t.Error("Default scopes should include offline_access")
+	}
+
+	var _ oauth.DeviceAuthProvider = provider
+}
+
+func TestDeviceFlow_DeviceOnlyClients(t *testing.T) {
+	custom, err := oauth.NewCustom(oauth.ProviderConfig{
+		ClientID:      "cli",
+		TokenURL:      "https://example.com/token",
+		DeviceAuthURL: "https://example.com/device",
+	})
+	if err != nil {
+		t.Fatalf("Expected a device-only custom provider without redirect URL: %v", err)
+	}
+	if err := custom.ValidateConfig(); err != nil {
+		t.Errorf("Expected a valid device-only config: %v", err)
+	}
+	if _, err := custom.Exchange(context.Background(), "code", nil); !errors.Is(err, oauth.ErrInvalidConfig) {
+		t.Errorf("Expected the code flow to require a redirect URL, got %v", err)
+	}
+
+	microsoft, err := oauth.NewMicrosoftProvider(oauth.ProviderConfig{ClientID: "tv-app", Tenant: "consumers"})
+	if err != nil {
+		t.Fatalf("Expected a device-only Microsoft provider without redirect URL: %v", err)
+	}
+	if _, ok := microsoft.(oauth.DeviceAuthProvider); !ok {
+		t.Error("Expected the Microsoft provider to support the device flow")
+	}
+
+	if _, err := oauth.NewCustom(oauth.ProviderConfig{
+		ClientID: "web",
+		AuthURL:  "https://example.com/authorize",
+		TokenURL: "https://example.com/token",
+	}); err == nil {
+		t.Error("Expected a redirect URL to be required without a device endpoint")
+	}
+}
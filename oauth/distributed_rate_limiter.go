@@ -0,0 +1,249 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/cache"
+)
+
+// RateLimitAlgorithm selects the algorithm used by distributed rate limiters
+type RateLimitAlgorithm string
+
+const (
+	// AlgorithmTokenBucket refills Rate tokens per Interval up to BurstSize
+	AlgorithmTokenBucket RateLimitAlgorithm = "token_bucket"
+
+	// AlgorithmGCRA is the generic cell rate algorithm: it stores a single
+	// timestamp per key and spaces requests evenly, allowing BurstSize at once
+	AlgorithmGCRA RateLimitAlgorithm = "gcra"
+)
+
+// RateLimiterWithStatus is implemented by limiters that can report the
+// resulting status together with the decision in a single round trip
+type RateLimiterWithStatus interface {
+	RateLimiter
+
+	// AllowNWithStatus consumes n requests if allowed and returns the new status
+	AllowNWithStatus(ctx context.Context, key string, n int) (bool, *RateLimitStatus, error)
+}
+
+// limiterState is the persisted per-key state of the distributed limiters
+type limiterState struct {
+	Tokens float64 `json:"t,omitempty"`   // Token bucket: available tokens
+	TS     float64 `json:"ts,omitempty"`  // Token bucket: last update (unix ms)
+	TAT    float64 `json:"tat,omitempty"` // GCRA: theoretical arrival time (unix ms)
+}
+
+// limitDecision is the outcome of evaluating a request against the state
+type limitDecision struct {
+	allowed    bool
+	remaining  int
+	retryAfter float64 // ms
+	resetAfter float64 // ms until the limit is fully replenished
+}
+
+// applyDistributedDefaults fills in defaults shared by the distributed limiters
+func applyDistributedDefaults(config RateLimiterConfig) RateLimiterConfig {
+	if config.Rate <= 0 {
+		config.Rate = 100
+	}
+	if config.Interval <= 0 {
+		config.Interval = 1 * time.Minute
+	}
+	if config.BurstSize <= 0 {
+		config.BurstSize = config.Rate * 2
+	}
+	if config.Algorithm == "" {
+		config.Algorithm = AlgorithmTokenBucket
+	}
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = "ratelimit:"
+	}
+	return config
+}
+
+// evaluateLimit applies the configured algorithm. The Redis Lua scripts
+// implement exactly the same arithmetic.
+func evaluateLimit(config RateLimiterConfig, state *limiterState, now float64, n int, peek bool) limitDecision {
+	if config.Algorithm == AlgorithmGCRA {
+		return evaluateGCRA(config, state, now, n, peek)
+	}
+	return evaluateTokenBucket(config, state, now, n, peek)
+}
+
+func evaluateTokenBucket(config RateLimiterConfig, state *limiterState, now float64, n int, peek bool) limitDecision {
+	rate := float64(config.Rate) / float64(config.Interval.Milliseconds()) // tokens per ms
+	burst := float64(config.BurstSize)
+
+	tokens, ts := state.Tokens, state.TS
+	if ts == 0 {
+		tokens, ts = burst, now
+	}
+	tokens = math.Min(burst, tokens+math.Max(0, now-ts)*rate)
+
+	d := limitDecision{}
+	if !peek && tokens >= float64(n) {
+		tokens -= float64(n)
+		d.allowed = true
+	}
+	if !peek {
+		state.Tokens, state.TS = tokens, now
+	}
+
+	need := float64(n)
+	if peek {
+		need = 1
+	}
+	if !d.allowed && tokens < need {
+		d.retryAfter = math.Ceil((need - tokens) / rate)
+	}
+	d.remaining = int(math.Floor(tokens + 1e-9))
+	d.resetAfter = math.Ceil((burst - tokens) / rate)
+	return d
+}
+
+func evaluateGCRA(config RateLimiterConfig, state *limiterState, now float64, n int, peek bool) limitDecision {
+	emission := float64(config.Interval.Milliseconds()) / float64(config.Rate) // ms per request
+	tau := emission * float64(config.BurstSize)
+
+	tat := math.Max(state.TAT, now)
+	need := float64(n)
+	if peek {
+		need = 1
+	}
+	newTAT := tat + need*emission
+	allowAt := newTAT - tau
+
+	d := limitDecision{}
+	if now >= allowAt {
+		if !peek {
+			d.allowed = true
+			tat = newTAT
+			state.TAT = tat
+		}
+	} else {
+		d.retryAfter = math.Ceil(allowAt - now)
+	}
+	d.remaining = max(0, int(math.Floor((tau-(tat-now))/emission+1e-9)))
+	d.resetAfter = math.Ceil(tat - now)
+	return d
+}
+
+// status converts a decision into a RateLimitStatus
+func (d limitDecision) status(limit int, now time.Time) *RateLimitStatus {
+	return &RateLimitStatus{
+		Limit:      limit,
+		Remaining:  d.remaining,
+		Reset:      now.Add(time.Duration(d.resetAfter) * time.Millisecond),
+		RetryAfter: time.Duration(d.retryAfter) * time.Millisecond,
+	}
+}
+
+// CacheRateLimiter implements RateLimiter on any cache.Cache backend.
+//
+// Updates are serialized within the process, but cache.Cache has no atomic
+// read-modify-write, so replicas sharing a cache can briefly exceed the limit
+// under contention. Use RedisRateLimiter where exact limits matter.
+type CacheRateLimiter struct {
+	cache  cache.Cache
+	config RateLimiterConfig
+	mu     sync.Mutex
+}
+
+// NewCacheRateLimiter creates a rate limiter that keeps state in a cache.Cache
+func NewCacheRateLimiter(c cache.Cache, config RateLimiterConfig) *CacheRateLimiter {
+	return &CacheRateLimiter{
+		cache:  c,
+		config: applyDistributedDefaults(config),
+	}
+}
+
+// Allow checks if a single request should be allowed
+func (l *CacheRateLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+// AllowN checks if n requests should be allowed
+func (l *CacheRateLimiter) AllowN(ctx context.Context, key string, n int) (bool, error) {
+	allowed, _, err := l.AllowNWithStatus(ctx, key, n)
+	return allowed, err
+}
+
+// AllowNWithStatus consumes n requests if allowed and returns the new status
+func (l *CacheRateLimiter) AllowNWithStatus(ctx context.Context, key string, n int) (bool, *RateLimitStatus, error) {
+	if n <= 0 {
+		return false, nil, fmt.Errorf("n must be positive")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state, err := l.load(ctx, key)
+	if err != nil {
+		return false, nil, err
+	}
+
+	now := time.Now()
+	d := evaluateLimit(l.config, state, unixMillis(now), n, false)
+	if d.allowed {
+		data, err := json.Marshal(state)
+		if err != nil {
+			return false, nil, fmt.Errorf("failed to marshal rate limit state: %w", err)
+		}
+		ttl := time.Duration(d.resetAfter)*time.Millisecond + time.Second
+		if err := l.cache.Set(ctx, l.config.KeyPrefix+key, data, ttl); err != nil {
+			return false, nil, fmt.Errorf("failed to store rate limit state: %w", err)
+		}
+	}
+
+	return d.allowed, d.status(l.config.BurstSize, now), nil
+}
+
+// Reset resets the rate limit for a key
+func (l *CacheRateLimiter) Reset(ctx context.Context, key string) error {
+	return l.cache.Delete(ctx, l.config.KeyPrefix+key)
+}
+
+// GetStatus returns the current rate limit status for a key without consuming it
+func (l *CacheRateLimiter) GetStatus(ctx context.Context, key string) (*RateLimitStatus, error) {
+	state, err := l.load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return evaluateLimit(l.config, state, unixMillis(now), 1, true).status(l.config.BurstSize, now), nil
+}
+
+func (l *CacheRateLimiter) load(ctx context.Context, key string) (*limiterState, error) {
+	state := &limiterState{}
+
+	data, err := l.cache.Get(ctx, l.config.KeyPrefix+key)
+	if err != nil {
+		if isCacheMiss(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to load rate limit state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		// Corrupt state is replaced rather than blocking the key forever
+		return &limiterState{}, nil
+	}
+	return state, nil
+}
+
+// isCacheMiss reports whether a cache.Cache Get error means the key is absent
+func isCacheMiss(err error) bool {
+	return errors.Is(err, cache.ErrKeyNotFound)
+}
+
+func unixMillis(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Millisecond)
+}
@@ -0,0 +1,160 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/gobeaver/beaver-kit/cache/driver/memory"
+	"github.com/gobeaver/beaver-kit/oauth"
+)
+
+func newCacheLimiter(t *testing.T, config oauth.RateLimiterConfig) *oauth.CacheRateLimiter {
+	t.Helper()
+	c, err := memory.New(memory.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return oauth.NewCacheRateLimiter(c, config)
+}
+
+func testDistributedLimiter(t *testing.T, limiter oauth.RateLimiter) {
+	t.Helper()
+	ctx := context.Background()
+	key := "client-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	// Burst of 3 is allowed, the 4th request is not
+	for i := 0; i < 3; i++ {
+		allowed, err := limiter.Allow(ctx, key)
+		if err != nil || !allowed {
+			t.Fatalf("Request %d should be allowed (err: %v)", i+1, err)
+		}
+	}
+	if allowed, _ := limiter.Allow(ctx, key); allowed {
+		t.Fatal("Request beyond burst should be denied")
+	}
+
+	status, err := limiter.GetStatus(ctx, key)
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	if status.Limit != 3 || status.Remaining != 0 {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+	if status.RetryAfter <= 0 || status.RetryAfter > 100*time.Millisecond {
+		t.Errorf("Expected RetryAfter within one emission interval, got %v", status.RetryAfter)
+	}
+
+	// GetStatus does not consume
+	if again, _ := limiter.GetStatus(ctx, key); again.Remaining != 0 {
+		t.Errorf("GetStatus should not change state: %+v", again)
+	}
+
+	// One request is replenished every 100ms
+	time.Sleep(status.RetryAfter + 10*time.Millisecond)
+	if allowed, _ := limiter.Allow(ctx, key); !allowed {
+		t.Error("Request should be allowed after RetryAfter")
+	}
+
+	// AllowN larger than the burst can never succeed
+	if allowed, _ := limiter.AllowN(ctx, key, 4); allowed {
+		t.Error("AllowN beyond burst should be denied")
+	}
+
+	if err := limiter.Reset(ctx, key); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if allowed, _ := limiter.AllowN(ctx, key, 3); !allowed {
+		t.Error("Full burst should be available after reset")
+	}
+}
+
+func TestCacheRateLimiter(t *testing.T) {
+	for _, algorithm := range []oauth.RateLimitAlgorithm{oauth.AlgorithmTokenBucket, oauth.AlgorithmGCRA} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			testDistributedLimiter(t, newCacheLimiter(t, oauth.RateLimiterConfig{
+				Rate:      10,
+				Interval:  time.Second,
+				BurstSize: 3,
+				Algorithm: algorithm,
+			}))
+		})
+	}
+}
+
+func TestRedisRateLimiter(t *testing.T) {
+	client := goredis.NewClient(&goredis.Options{Addr: "localhost:6379", DB: 1})
+	defer client.Close()
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+
+	for _, algorithm := range []oauth.RateLimitAlgorithm{oauth.AlgorithmTokenBucket, oauth.AlgorithmGCRA} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			testDistributedLimiter(t, oauth.NewRedisRateLimiter(client, oauth.RateLimiterConfig{
+				Rate:      10,
+				Interval:  time.Second,
+				BurstSize: 3,
+				Algorithm: algorithm,
+				KeyPrefix: "test:ratelimit:",
+			}))
+		})
+	}
+}
+
+func TestMiddleware_RateLimitHeaders(t *testing.T) {
+	limiter := newCacheLimiter(t, oauth.RateLimiterConfig{
+		Rate:      1,
+		Interval:  time.Minute,
+		BurstSize: 2,
+		Algorithm: oauth.AlgorithmGCRA,
+	})
+	mw := oauth.NewMiddleware(oauth.MiddlewareConfig{EnableRateLimiting: true}).WithRateLimiter(limiter)
+	handler := mw.RateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := do()
+	if first.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", first.Code)
+	}
+	if got := first.Header().Get("RateLimit-Limit"); got != "2" {
+		t.Errorf("Expected RateLimit-Limit 2, got %q", got)
+	}
+	if got := first.Header().Get("RateLimit-Remaining"); got != "1" {
+		t.Errorf("Expected RateLimit-Remaining 1, got %q", got)
+	}
+	if got := first.Header().Get("RateLimit-Reset"); got != "60" {
+		t.Errorf("Expected RateLimit-Reset 60, got %q", got)
+	}
+	if first.Header().Get("X-RateLimit-Limit") == "" {
+		t.Error("Expected legacy X-RateLimit-Limit header")
+	}
+
+	do()
+	denied := do()
+	if denied.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", denied.Code)
+	}
+	retry, err := strconv.Atoi(denied.Header().Get("Retry-After"))
+	if err != nil || retry < 59 || retry > 60 {
+		t.Errorf("Expected Retry-After of about 60s, got %q", denied.Header().Get("Retry-After"))
+	}
+	if got := denied.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("Expected RateLimit-Remaining 0, got %q", got)
+	}
+}
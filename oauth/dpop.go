@@ -0,0 +1,282 @@
+package oauth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/gobeaver/beaver-kit/krypto"
+)
+
+// TokenTypeDPoP is the token_type of DPoP-bound access tokens (RFC 9449)
+const TokenTypeDPoP = "DPoP"
+
+// dpopProofType is the JOSE typ header of DPoP proofs
+const dpopProofType = "dpop+jwt"
+
+// DPoPKey is an ES256 key pair used to sign DPoP proofs (RFC 9449).
+// Tokens issued to a key are bound to its thumbprint, so the key must be
+// persisted for as long as those tokens (including refresh tokens) are used.
+type DPoPKey struct {
+	key        *ecdsa.PrivateKey
+	signer     *JWTSigner
+	jwk        *JWK
+	thumbprint string
+}
+
+// GenerateDPoPKey creates a new P-256 DPoP key
+func GenerateDPoPKey() (*DPoPKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate DPoP key: %w", err)
+	}
+	return newDPoPKey(key)
+}
+
+// ParseDPoPKey loads a DPoP key from a PKCS#8 PEM encoded P-256 private key
+func ParseDPoPKey(pemKey string) (*DPoPKey, error) {
+	key, err := parseApplePrivateKey(pemKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSigningKey, err)
+	}
+	return newDPoPKey(key)
+}
+
+// LoadOrGenerateDPoPKey reads the key stored at path, or generates one and
+// writes it there with 0600 permissions
+func LoadOrGenerateDPoPKey(path string) (*DPoPKey, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return ParseDPoPKey(string(data))
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read DPoP key: %w", err)
+	}
+
+	key, err := GenerateDPoPKey()
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := key.PEM()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create DPoP key directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(encoded), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write DPoP key: %w", err)
+	}
+	return key, nil
+}
+
+func newDPoPKey(key *ecdsa.PrivateKey) (*DPoPKey, error) {
+	if key.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%w: DPoP keys must use P-256", ErrInvalidSigningKey)
+	}
+
+	signer, err := NewJWTSignerFromKey(key, "")
+	if err != nil {
+		return nil, err
+	}
+	jwk, err := NewJWK(&key.PublicKey, "")
+	if err != nil {
+		return nil, err
+	}
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+
+	return &DPoPKey{key: key, signer: signer, jwk: jwk, thumbprint: thumbprint}, nil
+}
+
+// PEM returns the private key in PKCS#8 PEM format for persistence
+func (k *DPoPKey) PEM() (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal DPoP key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// PublicJWK returns the public key embedded in proofs
+func (k *DPoPKey) PublicJWK() *JWK {
+	jwk := *k.jwk
+	return &jwk
+}
+
+// Thumbprint returns the JWK thumbprint that bound tokens carry as cnf.jkt
+func (k *DPoPKey) Thumbprint() string {
+	return k.thumbprint
+}
+
+// Proof creates a DPoP proof for a request. accessToken is set for resource
+// requests (ath claim) and empty for token requests; nonce is the last
+// DPoP-Nonce received from the server, if any.
+func (k *DPoPKey) Proof(method, targetURL, accessToken, nonce string) (string, error) {
+	htu, err := dpopTargetURI(targetURL)
+	if err != nil {
+		return "", err
+	}
+	jti, err := krypto.GenerateSecureToken(16)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate jti: %w", err)
+	}
+
+	claims := jwt.MapClaims{
+		"jti": jti,
+		"htm": strings.ToUpper(method),
+		"htu": htu,
+		"iat": time.Now().Unix(),
+	}
+	if accessToken != "" {
+		claims["ath"] = accessTokenHash(accessToken)
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	return k.signer.signWithHeader(claims, map[string]interface{}{
+		"typ": dpopProofType,
+		"jwk": k.jwk,
+	})
+}
+
+// DPoPTransport is an http.RoundTripper that adds DPoP proofs to requests.
+// Use it as the transport of the provider's HTTP client for token requests,
+// and as the base of Transport for resource requests with DPoP tokens.
+// use_dpop_nonce challenges are answered by retrying once with the server nonce.
+type DPoPTransport struct {
+	Key  *DPoPKey
+	Base http.RoundTripper
+
+	nonces sync.Map // origin -> latest DPoP-Nonce
+}
+
+// NewDPoPTransport creates a DPoP transport. A nil base uses http.DefaultTransport.
+func NewDPoPTransport(key *DPoPKey, base http.RoundTripper) *DPoPTransport {
+	return &DPoPTransport{Key: key, Base: base}
+}
+
+// RoundTrip adds a DPoP proof and sends the request
+func (t *DPoPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, sentNonce, err := t.send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := resp.Header.Get("DPoP-Nonce")
+	if nonce == "" {
+		return resp, nil
+	}
+	t.nonces.Store(origin(req.URL), nonce)
+
+	if nonce == sentNonce || !isNonceChallenge(resp) {
+		return resp, nil
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	resp, _, err = t.send(retry)
+	return resp, err
+}
+
+func (t *DPoPTransport) send(req *http.Request) (*http.Response, string, error) {
+	accessToken := ""
+	if auth := req.Header.Get("Authorization"); len(auth) > 5 && strings.EqualFold(auth[:5], "DPoP ") {
+		accessToken = strings.TrimSpace(auth[5:])
+	}
+
+	nonce := ""
+	if v, ok := t.nonces.Load(origin(req.URL)); ok {
+		nonce = v.(string)
+	}
+
+	proof, err := t.Key.Proof(req.Method, req.URL.String(), accessToken, nonce)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, "", err
+	}
+
+	// RoundTrippers must not modify the caller's request
+	signed := req.Clone(req.Context())
+	signed.Header.Set("DPoP", proof)
+
+	resp, err := t.base().RoundTrip(signed)
+	return resp, nonce, err
+}
+
+func (t *DPoPTransport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// isNonceChallenge reports whether the server rejected the proof for a
+// missing or stale nonce: a 401 challenge from a resource server, or a 400
+// error from the token endpoint. The body is restored after inspection.
+func isNonceChallenge(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return strings.Contains(resp.Header.Get("WWW-Authenticate"), "use_dpop_nonce")
+	case http.StatusBadRequest:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return err == nil && bytes.Contains(body, []byte("use_dpop_nonce"))
+	}
+	return false
+}
+
+// dpopTargetURI strips the query and fragment from a URL (htu claim)
+func dpopTargetURI(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid DPoP target URL: %w", err)
+	}
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host) + u.EscapedPath(), nil
+}
+
+// accessTokenHash computes the ath claim
+func accessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func origin(u *url.URL) string {
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
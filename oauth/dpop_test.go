@@ -0,0 +1,260 @@
+package oauth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/gobeaver/beaver-kit/oauth"
+)
+
+func TestDPoPKey_PersistAndProof(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "dpop.pem")
+
+	key, err := oauth.LoadOrGenerateDPoPKey(path)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	reloaded, err := oauth.LoadOrGenerateDPoPKey(path)
+	if err != nil {
+		t.Fatalf("Failed to reload key: %v", err)
+	}
+	if key.Thumbprint() == "" || key.Thumbprint() != reloaded.Thumbprint() {
+		t.Fatalf("Expected persisted key to keep its thumbprint")
+	}
+
+	proof, err := key.Proof("get", "https://API.example.com/orders?page=2#top", "access-123", "n-1")
+	if err != nil {
+		t.Fatalf("Proof failed: %v", err)
+	}
+
+	token, _, err := jwt.NewParser().ParseUnverified(proof, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("Failed to parse proof: %v", err)
+	}
+	if token.Header["typ"] != "dpop+jwt" || token.Header["alg"] != "ES256" {
+		t.Errorf("Unexpected header: %v", token.Header)
+	}
+	jwk, _ := token.Header["jwk"].(map[string]interface{})
+	if jwk["kty"] != "EC" || jwk["d"] != nil {
+		t.Errorf("Expected public EC jwk, got %v", jwk)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["htm"] != "GET" || claims["htu"] != "https://api.example.com/orders" || claims["nonce"] != "n-1" {
+		t.Errorf("Unexpected claims: %v", claims)
+	}
+	if claims["ath"] == "" || claims["jti"] == "" {
+		t.Errorf("Expected ath and jti, got %v", claims)
+	}
+}
+
+// dpopResourceServer returns an API protected by a DPoP-aware resource server
+// and a function that issues access tokens bound to a thumbprint
+func dpopResourceServer(t *testing.T, cfg oauth.DPoPConfig) (*httptest.Server, func(jkt string) string) {
+	t.Helper()
+
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	rs, err := oauth.NewResourceServer(oauth.ResourceServerConfig{
+		KeySet: oauth.StaticKeySet{"as-1": &issuerKey.PublicKey},
+		DPoP:   oauth.NewDPoPVerifier(cfg),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create resource server: %v", err)
+	}
+
+	server := httptest.NewServer(rs.RequireScopes("orders:read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(oauth.PrincipalFromContext(r.Context()).Subject))
+	})))
+	t.Cleanup(server.Close)
+
+	issue := func(jkt string) string {
+		claims := jwt.MapClaims{
+			"sub":   "user-1",
+			"scope": "orders:read",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+		if jkt != "" {
+			claims["cnf"] = map[string]interface{}{"jkt": jkt}
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["kid"] = "as-1"
+		signed, err := token.SignedString(issuerKey)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return signed
+	}
+
+	return server, issue
+}
+
+func TestDPoP_ResourceServer(t *testing.T) {
+	server, issue := dpopResourceServer(t, oauth.DPoPConfig{RequireNonce: true})
+
+	key, _ := oauth.GenerateDPoPKey()
+	accessToken := issue(key.Thumbprint())
+
+	var calls int32
+	counting := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	source := oauth.TokenSourceFunc(func(ctx context.Context) (*oauth.Token, error) {
+		return &oauth.Token{AccessToken: accessToken, TokenType: "DPoP"}, nil
+	})
+	client := &http.Client{Transport: oauth.NewTransport(source, oauth.NewDPoPTransport(key, counting))}
+
+	resp, err := client.Get(server.URL + "/orders?page=1")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d (%s)", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+	if calls != 2 {
+		t.Errorf("Expected a nonce challenge and one retry, got %d calls", calls)
+	}
+
+	// The learned nonce is reused without another challenge
+	resp, _ = client.Get(server.URL + "/orders")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls != 3 {
+		t.Errorf("Expected 200 without retry, got %d after %d calls", resp.StatusCode, calls)
+	}
+
+	t.Run("bound token as bearer", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/orders", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		resp, _ := http.DefaultClient.Do(req)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(resp.Header.Get("WWW-Authenticate"), "invalid_token") {
+			t.Errorf("Expected invalid_token, got %d %q", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+		}
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		other, _ := oauth.GenerateDPoPKey()
+		client := &http.Client{Transport: oauth.NewTransport(source, oauth.NewDPoPTransport(other, nil))}
+		resp, _ := client.Get(server.URL + "/orders")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for a proof from another key, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("replayed proof", func(t *testing.T) {
+		// Learn the current nonce from a challenge
+		probe, _ := http.NewRequest(http.MethodGet, server.URL+"/orders", nil)
+		probe.Header.Set("Authorization", "DPoP "+accessToken)
+		proof, _ := key.Proof(http.MethodGet, server.URL+"/orders", accessToken, "")
+		probe.Header.Set("DPoP", proof)
+		resp, _ := http.DefaultClient.Do(probe)
+		resp.Body.Close()
+		nonce := resp.Header.Get("DPoP-Nonce")
+		if resp.StatusCode != http.StatusUnauthorized || nonce == "" {
+			t.Fatalf("Expected use_dpop_nonce challenge, got %d", resp.StatusCode)
+		}
+
+		proof, _ = key.Proof(http.MethodGet, server.URL+"/orders", accessToken, nonce)
+		for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/orders", nil)
+			req.Header.Set("Authorization", "DPoP "+accessToken)
+			req.Header.Set("DPoP", proof)
+			resp, _ := http.DefaultClient.Do(req)
+			resp.Body.Close()
+			if resp.StatusCode != want {
+				t.Errorf("Attempt %d: expected %d, got %d", i+1, want, resp.StatusCode)
+			}
+		}
+	})
+}
+
+func TestDPoP_RequiredRejectsBearer(t *testing.T) {
+	server, issue := dpopResourceServer(t, oauth.DPoPConfig{Required: true})
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+issue(""))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", resp.StatusCode)
+	}
+	if challenge := resp.Header.Values("WWW-Authenticate"); len(challenge) != 1 || !strings.HasPrefix(challenge[0], "DPoP ") {
+		t.Errorf("Expected only a DPoP challenge, got %v", challenge)
+	}
+}
+
+func TestDPoP_TokenEndpointNonce(t *testing.T) {
+	verifier := oauth.NewDPoPVerifier(oauth.DPoPConfig{RequireNonce: true})
+	key, _ := oauth.GenerateDPoPKey()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		proof, err := verifier.Verify(r, "")
+		if errors.Is(err, oauth.ErrUseDPoPNonce) {
+			w.Header().Set("DPoP-Nonce", verifier.Nonce())
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "use_dpop_nonce"})
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_dpop_proof", "error_description": err.Error()})
+			return
+		}
+		if proof.Thumbprint != key.Thumbprint() {
+			t.Errorf("Unexpected thumbprint %s", proof.Thumbprint)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "bound-token",
+			"token_type":   "DPoP",
+			"expires_in":   3600,
+		})
+	}))
+	defer server.Close()
+
+	provider, err := oauth.NewCustom(oauth.ProviderConfig{
+		ClientID:    "client",
+		RedirectURL: "http://localhost/callback",
+		AuthURL:     server.URL + "/authorize",
+		TokenURL:    server.URL + "/token",
+		HTTPClient:  &http.Client{Transport: oauth.NewDPoPTransport(key, nil)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	token, err := provider.Exchange(context.Background(), "code", nil)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if token.TokenType != oauth.TokenTypeDPoP {
+		t.Errorf("Expected DPoP token type, got %q", token.TokenType)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
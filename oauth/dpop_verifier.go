@@ -0,0 +1,229 @@
+package oauth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/gobeaver/beaver-kit/krypto"
+)
+
+// DPoP verification errors (RFC 9449 section 7.1)
+var (
+	// ErrInvalidDPoPProof indicates a missing, malformed, replayed or mismatched proof
+	ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+
+	// ErrUseDPoPNonce indicates the proof must carry the server's current nonce
+	ErrUseDPoPNonce = errors.New("DPoP nonce required")
+)
+
+// maxSeenProofs bounds the jti replay cache
+const maxSeenProofs = 100000
+
+// DPoPConfig configures DPoP proof verification
+type DPoPConfig struct {
+	// Algorithms accepted for proofs (default ES256, ES384, ES512, RS256, PS256)
+	Algorithms []string
+
+	// MaxAge is how old a proof's iat may be (default 60s)
+	MaxAge time.Duration
+
+	// Leeway tolerates client clocks running ahead (default 5s)
+	Leeway time.Duration
+
+	// RequireNonce makes clients include a server-issued nonce (DPoP-Nonce)
+	RequireNonce bool
+
+	// NonceLifetime is how long a nonce stays valid (default 5m)
+	NonceLifetime time.Duration
+
+	// Required rejects bearer tokens on routes protected by the resource server
+	Required bool
+
+	// BaseURL is the public origin (e.g. https://api.example.com) used to
+	// check htu behind proxies. By default it is derived from the request.
+	BaseURL string
+}
+
+// DPoPProof is a verified DPoP proof
+type DPoPProof struct {
+	ID         string
+	Method     string
+	URL        string
+	IssuedAt   time.Time
+	Nonce      string
+	JWK        *JWK
+	Thumbprint string // Matches cnf.jkt of bound tokens
+}
+
+// DPoPVerifier validates DPoP proofs and tracks replay and nonce state
+type DPoPVerifier struct {
+	config DPoPConfig
+	parser *jwt.Parser
+
+	mu            sync.Mutex
+	seen          map[string]time.Time // jti -> expiry
+	nonce         string
+	previousNonce string
+	nonceIssuedAt time.Time
+}
+
+// NewDPoPVerifier creates a DPoP proof verifier
+func NewDPoPVerifier(cfg DPoPConfig) *DPoPVerifier {
+	if len(cfg.Algorithms) == 0 {
+		cfg.Algorithms = []string{"ES256", "ES384", "ES512", "RS256", "PS256"}
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = 60 * time.Second
+	}
+	if cfg.Leeway <= 0 {
+		cfg.Leeway = 5 * time.Second
+	}
+	if cfg.NonceLifetime <= 0 {
+		cfg.NonceLifetime = 5 * time.Minute
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+
+	return &DPoPVerifier{
+		config: cfg,
+		parser: jwt.NewParser(jwt.WithValidMethods(cfg.Algorithms), jwt.WithoutClaimsValidation()),
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// Nonce returns the current server nonce, rotating it after NonceLifetime.
+// The previous nonce is still accepted so in-flight requests do not fail.
+func (v *DPoPVerifier) Nonce() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.currentNonce()
+}
+
+func (v *DPoPVerifier) currentNonce() string {
+	if v.nonce == "" || time.Since(v.nonceIssuedAt) > v.config.NonceLifetime {
+		next, err := krypto.GenerateSecureToken(16)
+		if err != nil {
+			// Keep the old nonce rather than issuing an empty one
+			return v.nonce
+		}
+		v.previousNonce, v.nonce, v.nonceIssuedAt = v.nonce, next, time.Now()
+	}
+	return v.nonce
+}
+
+// Verify validates the DPoP header of a request. For resource requests pass
+// the access token so the ath claim is checked; pass "" at token endpoints.
+func (v *DPoPVerifier) Verify(r *http.Request, accessToken string) (*DPoPProof, error) {
+	headers := r.Header.Values("DPoP")
+	if len(headers) != 1 {
+		return nil, fmt.Errorf("%w: expected exactly one DPoP header", ErrInvalidDPoPProof)
+	}
+
+	var jwk JWK
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(headers[0], claims, func(t *jwt.Token) (interface{}, error) {
+		if typ, _ := t.Header["typ"].(string); typ != dpopProofType {
+			return nil, fmt.Errorf("unexpected typ %q", typ)
+		}
+		raw, ok := t.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("missing jwk header")
+		}
+		if _, private := raw["d"]; private {
+			return nil, fmt.Errorf("jwk header contains a private key")
+		}
+		data, _ := json.Marshal(raw)
+		if err := json.Unmarshal(data, &jwk); err != nil {
+			return nil, fmt.Errorf("invalid jwk header: %w", err)
+		}
+		return jwk.PublicKey()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+
+	proof := &DPoPProof{JWK: &jwk}
+	proof.ID, _ = claims["jti"].(string)
+	proof.Method, _ = claims["htm"].(string)
+	proof.URL, _ = claims["htu"].(string)
+	proof.Nonce, _ = claims["nonce"].(string)
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		proof.IssuedAt = iat.Time
+	}
+	if proof.ID == "" || proof.Method == "" || proof.URL == "" || proof.IssuedAt.IsZero() {
+		return nil, fmt.Errorf("%w: jti, htm, htu and iat are required", ErrInvalidDPoPProof)
+	}
+
+	if proof.Method != r.Method {
+		return nil, fmt.Errorf("%w: htm does not match request method", ErrInvalidDPoPProof)
+	}
+	htu, err := dpopTargetURI(proof.URL)
+	if err != nil || htu != v.requestURI(r) {
+		return nil, fmt.Errorf("%w: htu does not match request URL", ErrInvalidDPoPProof)
+	}
+
+	now := time.Now()
+	if proof.IssuedAt.After(now.Add(v.config.Leeway)) || proof.IssuedAt.Before(now.Add(-v.config.MaxAge)) {
+		return nil, fmt.Errorf("%w: iat outside acceptable window", ErrInvalidDPoPProof)
+	}
+
+	if accessToken != "" {
+		ath, _ := claims["ath"].(string)
+		if subtle.ConstantTimeCompare([]byte(ath), []byte(accessTokenHash(accessToken))) != 1 {
+			return nil, fmt.Errorf("%w: ath does not match access token", ErrInvalidDPoPProof)
+		}
+	}
+
+	if proof.Thumbprint, err = jwk.Thumbprint(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.config.RequireNonce {
+		current := v.currentNonce()
+		if proof.Nonce == "" || (proof.Nonce != current && proof.Nonce != v.previousNonce) {
+			return nil, ErrUseDPoPNonce
+		}
+	}
+
+	// Reject replays; entries expire once the proof would fail the iat check anyway
+	if _, replayed := v.seen[proof.ID]; replayed {
+		return nil, fmt.Errorf("%w: proof replayed", ErrInvalidDPoPProof)
+	}
+	if len(v.seen) >= maxSeenProofs {
+		for jti, exp := range v.seen {
+			if now.After(exp) {
+				delete(v.seen, jti)
+			}
+		}
+		if len(v.seen) >= maxSeenProofs {
+			return nil, fmt.Errorf("%w: replay cache full", ErrInvalidDPoPProof)
+		}
+	}
+	v.seen[proof.ID] = proof.IssuedAt.Add(v.config.MaxAge + v.config.Leeway)
+
+	return proof, nil
+}
+
+// requestURI reconstructs the htu the client should have signed
+func (v *DPoPVerifier) requestURI(r *http.Request) string {
+	if v.config.BaseURL != "" {
+		htu, _ := dpopTargetURI(v.config.BaseURL + r.URL.EscapedPath())
+		return htu
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return strings.ToLower(scheme+"://"+r.Host) + r.URL.EscapedPath()
+}
@@ -16,6 +16,9 @@ var (
 	// ErrProviderNotFound indicates the requested provider doesn't exist
 	ErrProviderNotFound = errors.New("oauth provider not found")
 
+	// ErrProviderDisabled indicates the provider exists but is disabled
+	ErrProviderDisabled = errors.New("oauth provider disabled")
+
 	// ErrInvalidState indicates state parameter mismatch (CSRF protection)
 	ErrInvalidState = errors.New("invalid state parameter")
 
@@ -25,6 +28,10 @@ var (
 	// ErrNoRefreshToken indicates no refresh token is available
 	ErrNoRefreshToken = errors.New("no refresh token available")
 
+	// ErrGrantRevoked indicates the refresh grant was rejected or revoked and
+	// the user must authorize again
+	ErrGrantRevoked = errors.New("grant revoked")
+
 	// ErrPKCENotSupported indicates PKCE is not supported by provider
 	ErrPKCENotSupported = errors.New("PKCE not supported by provider")
 
@@ -41,6 +41,9 @@ func NewGitHub(config ProviderConfig) *GitHubProvider {
 	if config.UserInfoURL == "" {
 		config.UserInfoURL = "https://api.github.com/user"
 	}
+	if config.DeviceAuthURL == "" {
+		config.DeviceAuthURL = "https://github.com/login/device/code"
+	}
 
 	// Set default scopes if not provided
 	if len(config.Scopes) == 0 {
@@ -318,3 +321,25 @@ func (g *GitHubProvider) getPrimaryEmail(ctx context.Context, accessToken string
 
 	return "", fmt.Errorf("no verified email found")
 }
+
+// StartDeviceAuth starts the device authorization grant for TVs and CLIs
+func (g *GitHubProvider) StartDeviceAuth(ctx context.Context) (*DeviceAuthResponse, error) {
+	return g.deviceFlow().StartDeviceAuth(ctx)
+}
+
+// PollDeviceToken polls until the user authorizes the device
+func (g *GitHubProvider) PollDeviceToken(ctx context.Context, auth *DeviceAuthResponse) (*Token, error) {
+	return g.deviceFlow().PollDeviceToken(ctx, auth)
+}
+
+func (g *GitHubProvider) deviceFlow() *deviceFlow {
+	// GitHub's device flow authenticates with the client ID only
+	return &deviceFlow{
+		provider:      "github",
+		deviceAuthURL: g.config.DeviceAuthURL,
+		tokenURL:      g.config.TokenURL,
+		clientID:      g.config.ClientID,
+		scopes:        g.config.Scopes,
+		httpClient:    func() HTTPClient { return g.httpClient },
+	}
+}
@@ -41,6 +41,9 @@ func NewGoogle(config ProviderConfig) *GoogleProvider {
 	if config.UserInfoURL == "" {
 		config.UserInfoURL = "https://www.googleapis.com/oauth2/v2/userinfo"
 	}
+	if config.DeviceAuthURL == "" {
+		config.DeviceAuthURL = "https://oauth2.googleapis.com/device/code"
+	}
 
 	// Set default scopes if not provided
 	if len(config.Scopes) == 0 {
@@ -371,3 +374,25 @@ func (g *GoogleProvider) ParseIDToken(idToken string) (map[string]interface{}, e
 
 	return claims, nil
 }
+
+// StartDeviceAuth starts the device authorization grant for TVs and CLIs
+func (g *GoogleProvider) StartDeviceAuth(ctx context.Context) (*DeviceAuthResponse, error) {
+	return g.deviceFlow().StartDeviceAuth(ctx)
+}
+
+// PollDeviceToken polls until the user authorizes the device
+func (g *GoogleProvider) PollDeviceToken(ctx context.Context, auth *DeviceAuthResponse) (*Token, error) {
+	return g.deviceFlow().PollDeviceToken(ctx, auth)
+}
+
+func (g *GoogleProvider) deviceFlow() *deviceFlow {
+	return &deviceFlow{
+		provider:      "google",
+		deviceAuthURL: g.config.DeviceAuthURL,
+		tokenURL:      g.config.TokenURL,
+		clientID:      g.config.ClientID,
+		clientSecret:  g.config.ClientSecret,
+		scopes:        g.config.Scopes,
+		httpClient:    func() HTTPClient { return g.httpClient },
+	}
+}
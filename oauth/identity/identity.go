@@ -0,0 +1,85 @@
+// Package identity links external OAuth identities to internal user accounts.
+//
+// Every login is identified by its (provider, subject) pair. The Linker maps
+// those pairs to a stable internal user ID, lets an authenticated user attach
+// further providers, and decides what happens when a new login presents a
+// verified email that already belongs to another account.
+//
+// Example:
+//
+//	linker, err := identity.New(identity.NewMemoryStore(), identity.Config{
+//	    ConflictPolicy: identity.ConflictReject,
+//	})
+//
+//	// After a successful OAuth callback
+//	result, err := linker.Resolve(ctx, "github", userInfo)
+//	var conflict *identity.ConflictError
+//	if errors.As(err, &conflict) {
+//	    // Ask the user to sign in with one of conflict.Providers and link from there
+//	}
+//
+//	// From an authenticated session
+//	_, err = linker.Link(ctx, sess.UserID, "google", googleUserInfo)
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Package-level errors
+var (
+	// ErrIdentityNotFound indicates no identity exists for the provider and subject
+	ErrIdentityNotFound = errors.New("identity not found")
+
+	// ErrIdentityExists indicates the provider and subject are already stored
+	ErrIdentityExists = errors.New("identity already exists")
+
+	// ErrAlreadyLinked indicates the identity belongs to a different user
+	ErrAlreadyLinked = errors.New("identity linked to another user")
+
+	// ErrEmailConflict indicates a verified email already belongs to another user
+	ErrEmailConflict = errors.New("email already registered to another user")
+
+	// ErrLastLoginMethod indicates unlinking would leave the user unable to log in
+	ErrLastLoginMethod = errors.New("cannot remove the last login method")
+
+	// ErrInvalidIdentity indicates missing provider, subject or user ID
+	ErrInvalidIdentity = errors.New("invalid identity")
+)
+
+// Identity is one external login bound to an internal user
+type Identity struct {
+	UserID        string    `json:"user_id"`
+	Provider      string    `json:"provider"`
+	Subject       string    `json:"subject"` // Provider's stable user ID
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastLoginAt   time.Time `json:"last_login_at"`
+}
+
+// ConflictError describes a verified email collision with existing accounts.
+// It matches ErrEmailConflict with errors.Is.
+type ConflictError struct {
+	Email          string
+	ExistingUserID string
+	Providers      []string // Providers the existing user can log in with
+}
+
+// Error implements the error interface
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: %s (sign in with %s to link)", ErrEmailConflict, e.Email, strings.Join(e.Providers, ", "))
+}
+
+// Is reports whether target is ErrEmailConflict
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrEmailConflict
+}
+
+// normalizeEmail lowercases and trims an email for comparison
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
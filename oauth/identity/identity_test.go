@@ -0,0 +1,172 @@
+package identity_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/gobeaver/beaver-kit/oauth"
+	"github.com/gobeaver/beaver-kit/oauth/identity"
+)
+
+func stores(t *testing.T) map[string]identity.IdentityStore {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "identities.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sqlStore, err := identity.NewSQLStore(db, identity.SQLStoreConfig{Dialect: "sqlite"})
+	if err != nil {
+		t.Fatalf("Failed to create SQL store: %v", err)
+	}
+	if err := sqlStore.CreateSchema(context.Background()); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	return map[string]identity.IdentityStore{
+		"memory": identity.NewMemoryStore(),
+		"sql":    sqlStore,
+	}
+}
+
+func newLinker(t *testing.T, store identity.IdentityStore, policy identity.ConflictPolicy) *identity.Linker {
+	t.Helper()
+	linker, err := identity.New(store, identity.Config{ConflictPolicy: policy})
+	if err != nil {
+		t.Fatalf("Failed to create linker: %v", err)
+	}
+	return linker
+}
+
+func user(id, email string, verified bool) *oauth.UserInfo {
+	return &oauth.UserInfo{ID: id, Email: email, EmailVerified: verified}
+}
+
+func TestLinker_ResolveAndLink(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			linker := newLinker(t, store, identity.ConflictReject)
+			ctx := context.Background()
+
+			first, err := linker.Resolve(ctx, "google", user("g-1", "alice@example.com", true))
+			if err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+			if !first.Created || first.UserID == "" {
+				t.Fatalf("Expected a new user, got %+v", first)
+			}
+
+			again, err := linker.Resolve(ctx, "google", user("g-1", "alice@example.com", true))
+			if err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+			if again.Created || again.UserID != first.UserID {
+				t.Errorf("Expected the same user, got %+v", again)
+			}
+
+			if _, err := linker.Link(ctx, first.UserID, "github", user("gh-1", "alice@example.com", true)); err != nil {
+				t.Fatalf("Link failed: %v", err)
+			}
+
+			// Logging in with the linked provider resolves to the same user
+			viaGitHub, err := linker.Resolve(ctx, "github", user("gh-1", "alice@example.com", true))
+			if err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+			if viaGitHub.UserID != first.UserID {
+				t.Errorf("Expected linked user %s, got %s", first.UserID, viaGitHub.UserID)
+			}
+
+			// An identity cannot belong to two users
+			other, _ := linker.Resolve(ctx, "google", user("g-2", "bob@example.com", true))
+			if _, err := linker.Link(ctx, other.UserID, "github", user("gh-1", "", false)); !errors.Is(err, identity.ErrAlreadyLinked) {
+				t.Errorf("Expected ErrAlreadyLinked, got %v", err)
+			}
+
+			idents, err := linker.Identities(ctx, first.UserID)
+			if err != nil || len(idents) != 2 {
+				t.Errorf("Expected 2 identities, got %d (%v)", len(idents), err)
+			}
+		})
+	}
+}
+
+func TestLinker_ConflictPolicies(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			existing, err := newLinker(t, store, identity.ConflictReject).Resolve(ctx, "google", user("g-1", "Alice@Example.com", true))
+			if err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+
+			// Reject: verified email match is reported with the existing providers
+			_, err = newLinker(t, store, identity.ConflictReject).Resolve(ctx, "github", user("gh-1", "alice@example.com", true))
+			var conflict *identity.ConflictError
+			if !errors.As(err, &conflict) || !errors.Is(err, identity.ErrEmailConflict) {
+				t.Fatalf("Expected ConflictError, got %v", err)
+			}
+			if conflict.ExistingUserID != existing.UserID || len(conflict.Providers) != 1 || conflict.Providers[0] != "google" {
+				t.Errorf("Unexpected conflict: %+v", conflict)
+			}
+
+			// Unverified emails never match
+			unverified, err := newLinker(t, store, identity.ConflictReject).Resolve(ctx, "github", user("gh-2", "alice@example.com", false))
+			if err != nil || !unverified.Created {
+				t.Errorf("Expected new user for unverified email, got %+v (%v)", unverified, err)
+			}
+
+			// Auto-link attaches to the existing user
+			linked, err := newLinker(t, store, identity.ConflictAutoLink).Resolve(ctx, "microsoft", user("ms-1", "alice@example.com", true))
+			if err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+			if !linked.Linked || linked.UserID != existing.UserID {
+				t.Errorf("Expected auto-link to %s, got %+v", existing.UserID, linked)
+			}
+
+			// Create-new ignores the match
+			separate, err := newLinker(t, store, identity.ConflictCreateNew).Resolve(ctx, "apple", user("ap-1", "alice@example.com", true))
+			if err != nil || !separate.Created || separate.UserID == existing.UserID {
+				t.Errorf("Expected a separate user, got %+v (%v)", separate, err)
+			}
+		})
+	}
+}
+
+func TestLinker_UnlinkKeepsLastMethod(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			linker := newLinker(t, store, identity.ConflictReject)
+			ctx := context.Background()
+
+			res, _ := linker.Resolve(ctx, "google", user("g-1", "alice@example.com", true))
+			_, _ = linker.Link(ctx, res.UserID, "github", user("gh-1", "", false))
+
+			if err := linker.Unlink(ctx, res.UserID, "github", "gh-1"); err != nil {
+				t.Fatalf("Unlink failed: %v", err)
+			}
+			if err := linker.Unlink(ctx, res.UserID, "google", "g-1"); !errors.Is(err, identity.ErrLastLoginMethod) {
+				t.Errorf("Expected ErrLastLoginMethod, got %v", err)
+			}
+			if err := linker.Unlink(ctx, "someone-else", "google", "g-1"); !errors.Is(err, identity.ErrIdentityNotFound) {
+				t.Errorf("Expected ErrIdentityNotFound for another user's identity, got %v", err)
+			}
+
+			// A password (or other method) allows removing the last provider
+			withPassword, _ := identity.New(store, identity.Config{
+				OtherLoginMethods: func(ctx context.Context, userID string) (int, error) { return 1, nil },
+			})
+			if err := withPassword.Unlink(ctx, res.UserID, "google", "g-1"); err != nil {
+				t.Errorf("Expected unlink to succeed with another login method, got %v", err)
+			}
+		})
+	}
+}
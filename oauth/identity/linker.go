@@ -0,0 +1,239 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/gobeaver/beaver-kit/config"
+	"github.com/gobeaver/beaver-kit/oauth"
+)
+
+// ConflictPolicy decides what happens when a first-time login presents a
+// verified email that already belongs to another user
+type ConflictPolicy string
+
+const (
+	// ConflictReject fails with a *ConflictError so the user can sign in with
+	// an existing method and link the new provider explicitly (safest)
+	ConflictReject ConflictPolicy = "reject"
+
+	// ConflictAutoLink attaches the new identity to the existing user.
+	// Only safe when every configured provider verifies email ownership.
+	ConflictAutoLink ConflictPolicy = "link"
+
+	// ConflictCreateNew ignores the match and creates a separate user
+	ConflictCreateNew ConflictPolicy = "create"
+)
+
+// Config defines the identity linker configuration
+type Config struct {
+	// ConflictPolicy applies to first-time logins with a known verified email
+	ConflictPolicy ConflictPolicy `env:"OAUTH_IDENTITY_CONFLICT_POLICY" envDefault:"reject"`
+
+	// NewUserID generates internal user IDs (default: random UUID)
+	NewUserID func() string `env:"-"`
+
+	// OtherLoginMethods reports login methods outside this store (e.g. a
+	// password) so users who have one may unlink their last provider
+	OtherLoginMethods func(ctx context.Context, userID string) (int, error) `env:"-"`
+}
+
+// GetConfig returns config loaded from environment with optional options
+func GetConfig(opts ...config.Option) (*Config, error) {
+	cfg := &Config{}
+	if len(opts) == 0 {
+		opts = append(opts, config.WithPrefix("BEAVER_"))
+	}
+	if err := config.Load(cfg, opts...); err != nil {
+		return nil, fmt.Errorf("failed to load identity config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Result describes how a login was resolved
+type Result struct {
+	UserID   string
+	Identity *Identity
+	Created  bool // A new user was created
+	Linked   bool // The identity was newly linked to an existing user
+}
+
+// Linker maps provider identities to internal users
+type Linker struct {
+	store  IdentityStore
+	config Config
+}
+
+// New creates a new identity linker
+func New(store IdentityStore, cfg Config) (*Linker, error) {
+	if store == nil {
+		return nil, fmt.Errorf("identity store is required")
+	}
+	switch cfg.ConflictPolicy {
+	case "":
+		cfg.ConflictPolicy = ConflictReject
+	case ConflictReject, ConflictAutoLink, ConflictCreateNew:
+	default:
+		return nil, fmt.Errorf("unknown conflict policy: %q", cfg.ConflictPolicy)
+	}
+	if cfg.NewUserID == nil {
+		cfg.NewUserID = uuid.NewString
+	}
+
+	return &Linker{store: store, config: cfg}, nil
+}
+
+// Resolve returns the internal user for a login, creating the user on first
+// sight. A verified email already owned by another user is handled according
+// to the ConflictPolicy.
+func (l *Linker) Resolve(ctx context.Context, provider string, info *oauth.UserInfo) (*Result, error) {
+	if err := validate(provider, info); err != nil {
+		return nil, err
+	}
+
+	if ident, err := l.store.Get(ctx, provider, info.ID); err == nil {
+		if err := l.touch(ctx, ident, info); err != nil {
+			return nil, err
+		}
+		return &Result{UserID: ident.UserID, Identity: ident}, nil
+	} else if !errors.Is(err, ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	userID := ""
+	if info.EmailVerified && info.Email != "" && l.config.ConflictPolicy != ConflictCreateNew {
+		owner, conflict, err := l.emailOwner(ctx, info.Email)
+		if err != nil {
+			return nil, err
+		}
+		if conflict != nil {
+			if l.config.ConflictPolicy == ConflictReject || conflict.ExistingUserID == "" {
+				return nil, conflict
+			}
+			userID = owner
+		}
+	}
+
+	created := userID == ""
+	if created {
+		userID = l.config.NewUserID()
+	}
+
+	ident := newIdentity(userID, provider, info)
+	if err := l.store.Create(ctx, ident); err != nil {
+		if errors.Is(err, ErrIdentityExists) {
+			// Lost a race with a concurrent first login; use the winner
+			return l.Resolve(ctx, provider, info)
+		}
+		return nil, err
+	}
+
+	return &Result{UserID: userID, Identity: ident, Created: created, Linked: !created}, nil
+}
+
+// Link attaches a provider identity to an already authenticated user.
+// Linking is idempotent; an identity owned by another user fails with ErrAlreadyLinked.
+func (l *Linker) Link(ctx context.Context, userID, provider string, info *oauth.UserInfo) (*Identity, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("%w: user ID is required", ErrInvalidIdentity)
+	}
+	if err := validate(provider, info); err != nil {
+		return nil, err
+	}
+
+	ident, err := l.store.Get(ctx, provider, info.ID)
+	switch {
+	case err == nil && ident.UserID == userID:
+		return ident, l.touch(ctx, ident, info)
+	case err == nil:
+		return nil, ErrAlreadyLinked
+	case !errors.Is(err, ErrIdentityNotFound):
+		return nil, err
+	}
+
+	ident = newIdentity(userID, provider, info)
+	if err := l.store.Create(ctx, ident); err != nil {
+		if errors.Is(err, ErrIdentityExists) {
+			return nil, ErrAlreadyLinked
+		}
+		return nil, err
+	}
+	return ident, nil
+}
+
+// Unlink removes a provider identity from a user. It fails with
+// ErrLastLoginMethod if the user would have no way left to log in.
+func (l *Linker) Unlink(ctx context.Context, userID, provider, subject string) error {
+	keep := 1
+	if l.config.OtherLoginMethods != nil {
+		others, err := l.config.OtherLoginMethods(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to count login methods: %w", err)
+		}
+		if others > 0 {
+			keep = 0
+		}
+	}
+	return l.store.Delete(ctx, userID, provider, subject, keep)
+}
+
+// Identities returns every identity linked to a user
+func (l *Linker) Identities(ctx context.Context, userID string) ([]*Identity, error) {
+	return l.store.ListByUser(ctx, userID)
+}
+
+// emailOwner finds the user owning a verified email. A conflict with an
+// empty ExistingUserID means several users share the email, which is never auto-linked.
+func (l *Linker) emailOwner(ctx context.Context, email string) (string, *ConflictError, error) {
+	matches, err := l.store.FindByVerifiedEmail(ctx, email)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(matches) == 0 {
+		return "", nil, nil
+	}
+
+	conflict := &ConflictError{Email: normalizeEmail(email), ExistingUserID: matches[0].UserID}
+	for _, m := range matches {
+		if m.UserID != conflict.ExistingUserID {
+			conflict.ExistingUserID = ""
+		}
+		conflict.Providers = append(conflict.Providers, m.Provider)
+	}
+	return conflict.ExistingUserID, conflict, nil
+}
+
+// touch records a login and refreshes the email claims
+func (l *Linker) touch(ctx context.Context, ident *Identity, info *oauth.UserInfo) error {
+	ident.Email = info.Email
+	ident.EmailVerified = info.EmailVerified
+	ident.LastLoginAt = time.Now()
+	return l.store.Update(ctx, ident)
+}
+
+func newIdentity(userID, provider string, info *oauth.UserInfo) *Identity {
+	now := time.Now()
+	return &Identity{
+		UserID:        userID,
+		Provider:      provider,
+		Subject:       info.ID,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+		CreatedAt:     now,
+		LastLoginAt:   now,
+	}
+}
+
+func validate(provider string, info *oauth.UserInfo) error {
+	if provider == "" {
+		return fmt.Errorf("%w: provider is required", ErrInvalidIdentity)
+	}
+	if info == nil || info.ID == "" {
+		return fmt.Errorf("%w: subject is required", ErrInvalidIdentity)
+	}
+	return nil
+}
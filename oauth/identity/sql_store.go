@@ -0,0 +1,245 @@
+package identity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gobeaver/beaver-kit/database/sqldialect"
+)
+
+// SQLStoreConfig configures the SQL identity store
+type SQLStoreConfig struct {
+	// Dialect selects placeholder and DDL syntax: postgres, mysql or sqlite
+	Dialect string
+
+	// Table name (default oauth_identities)
+	Table string
+}
+
+// SQLStore implements IdentityStore on database/sql (PostgreSQL, MySQL, SQLite/libSQL)
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+	table   string
+}
+
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// NewSQLStore creates an identity store backed by a SQL database.
+// Call CreateSchema once (or run the equivalent migration) before use.
+func NewSQLStore(db *sql.DB, cfg SQLStoreConfig) (*SQLStore, error) {
+	if db == nil {
+		return nil, fmt.Errorf("database is required")
+	}
+
+	dialect, err := sqldialect.Of(cfg.Dialect)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported dialect: %q", cfg.Dialect)
+	}
+
+	table := cfg.Table
+	if table == "" {
+		table = "oauth_identities"
+	}
+	if !tableNamePattern.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name: %q", table)
+	}
+
+	return &SQLStore{db: db, dialect: dialect, table: table}, nil
+}
+
+// CreateSchema creates the identities table and indexes if they do not exist
+func (s *SQLStore) CreateSchema(ctx context.Context) error {
+	timestamp := "TIMESTAMP"
+	switch s.dialect {
+	case "postgres":
+		timestamp = "TIMESTAMPTZ"
+	case "mysql":
+		timestamp = "DATETIME(6)"
+	}
+
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	provider VARCHAR(64) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	user_id VARCHAR(255) NOT NULL,
+	email VARCHAR(320) NOT NULL DEFAULT '',
+	email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at %s NOT NULL,
+	last_login_at %s NOT NULL,
+	PRIMARY KEY (provider, subject)
+)`, s.table, timestamp, timestamp),
+	}
+
+	indexName := strings.ReplaceAll(s.table, ".", "_") + "_user_id_idx"
+	if s.dialect == "mysql" {
+		// MySQL has no CREATE INDEX IF NOT EXISTS; index inline on a fresh table
+		stmts[0] = strings.Replace(stmts[0], "PRIMARY KEY (provider, subject)",
+			"PRIMARY KEY (provider, subject),\n\tINDEX "+indexName+" (user_id)", 1)
+	} else {
+		stmts = append(stmts, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (user_id)", indexName, s.table))
+	}
+
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create identity schema: %w", err)
+		}
+	}
+	return nil
+}
+
+const identityColumns = "user_id, provider, subject, email, email_verified, created_at, last_login_at"
+
+// Get retrieves the identity for a provider and subject
+func (s *SQLStore) Get(ctx context.Context, provider, subject string) (*Identity, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(fmt.Sprintf(
+		"SELECT %s FROM %s WHERE provider = ? AND subject = ?", identityColumns, s.table)),
+		provider, subject)
+
+	ident, err := scanIdentity(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+	return ident, nil
+}
+
+// ListByUser returns every identity linked to a user
+func (s *SQLStore) ListByUser(ctx context.Context, userID string) ([]*Identity, error) {
+	return s.query(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s WHERE user_id = ? ORDER BY created_at", identityColumns, s.table), userID)
+}
+
+// FindByVerifiedEmail returns identities whose verified email matches
+func (s *SQLStore) FindByVerifiedEmail(ctx context.Context, email string) ([]*Identity, error) {
+	return s.query(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s WHERE LOWER(email) = ? AND email_verified = ? ORDER BY created_at", identityColumns, s.table),
+		normalizeEmail(email), true)
+}
+
+// Create stores a new identity
+func (s *SQLStore) Create(ctx context.Context, ident *Identity) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (?, ?, ?, ?, ?, ?, ?)", s.table, identityColumns)),
+		ident.UserID, ident.Provider, ident.Subject, ident.Email, ident.EmailVerified,
+		ident.CreatedAt.UTC(), ident.LastLoginAt.UTC())
+	if err != nil {
+		// Primary key violations differ per driver; check for the row instead
+		if _, getErr := s.Get(ctx, ident.Provider, ident.Subject); getErr == nil {
+			return ErrIdentityExists
+		}
+		return fmt.Errorf("failed to create identity: %w", err)
+	}
+	return nil
+}
+
+// Update replaces the mutable fields of an identity
+func (s *SQLStore) Update(ctx context.Context, ident *Identity) error {
+	res, err := s.db.ExecContext(ctx, s.rebind(fmt.Sprintf(
+		"UPDATE %s SET email = ?, email_verified = ?, last_login_at = ? WHERE provider = ? AND subject = ?", s.table)),
+		ident.Email, ident.EmailVerified, ident.LastLoginAt.UTC(), ident.Provider, ident.Subject)
+	if err != nil {
+		return fmt.Errorf("failed to update identity: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
+
+// Delete removes a user's identity if at least keep identities remain.
+// The user's rows are locked for the duration of the check.
+func (s *SQLStore) Delete(ctx context.Context, userID, provider, subject string, keep int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	lock := " FOR UPDATE"
+	if s.dialect == "sqlite" {
+		lock = "" // SQLite serializes writers at the database level
+	}
+
+	rows, err := tx.QueryContext(ctx, s.rebind(fmt.Sprintf(
+		"SELECT provider, subject FROM %s WHERE user_id = ?%s", s.table, lock)), userID)
+	if err != nil {
+		return fmt.Errorf("failed to lock identities: %w", err)
+	}
+	count, found := 0, false
+	for rows.Next() {
+		var p, sub string
+		if err := rows.Scan(&p, &sub); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan identity: %w", err)
+		}
+		count++
+		if p == provider && sub == subject {
+			found = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read identities: %w", err)
+	}
+
+	if !found {
+		return ErrIdentityNotFound
+	}
+	if count-1 < keep {
+		return ErrLastLoginMethod
+	}
+
+	if _, err := tx.ExecContext(ctx, s.rebind(fmt.Sprintf(
+		"DELETE FROM %s WHERE provider = ? AND subject = ? AND user_id = ?", s.table)),
+		provider, subject, userID); err != nil {
+		return fmt.Errorf("failed to delete identity: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) query(ctx context.Context, query string, args ...interface{}) ([]*Identity, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query identities: %w", err)
+	}
+	defer rows.Close()
+
+	var result []*Identity
+	for rows.Next() {
+		ident, err := scanIdentity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan identity: %w", err)
+		}
+		result = append(result, ident)
+	}
+	return result, rows.Err()
+}
+
+// rebind converts ? placeholders to $n for PostgreSQL
+func (s *SQLStore) rebind(query string) string {
+	return sqldialect.Rebind(s.dialect, query)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanIdentity(row scanner) (*Identity, error) {
+	var ident Identity
+	if err := row.Scan(&ident.UserID, &ident.Provider, &ident.Subject, &ident.Email,
+		&ident.EmailVerified, &ident.CreatedAt, &ident.LastLoginAt); err != nil {
+		return nil, err
+	}
+	return &ident, nil
+}
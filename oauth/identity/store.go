@@ -0,0 +1,146 @@
+package identity
+
+import (
+	"context"
+	"sync"
+)
+
+// IdentityStore persists identity links
+type IdentityStore interface {
+	// Get retrieves the identity for a provider and subject
+	Get(ctx context.Context, provider, subject string) (*Identity, error)
+
+	// ListByUser returns every identity linked to a user
+	ListByUser(ctx context.Context, userID string) ([]*Identity, error)
+
+	// FindByVerifiedEmail returns identities whose verified email matches
+	FindByVerifiedEmail(ctx context.Context, email string) ([]*Identity, error)
+
+	// Create stores a new identity; returns ErrIdentityExists if the pair is taken
+	Create(ctx context.Context, ident *Identity) error
+
+	// Update replaces the mutable fields (email, verification, last login)
+	Update(ctx context.Context, ident *Identity) error
+
+	// Delete removes a user's identity, failing with ErrLastLoginMethod when
+	// fewer than keep identities would remain. The check and delete are atomic.
+	Delete(ctx context.Context, userID, provider, subject string, keep int) error
+}
+
+type identityKey struct {
+	provider string
+	subject  string
+}
+
+// MemoryStore implements IdentityStore with in-memory storage.
+// Suitable for single-instance deployments and tests.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	identities map[identityKey]*Identity
+}
+
+// NewMemoryStore creates a new in-memory identity store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		identities: make(map[identityKey]*Identity),
+	}
+}
+
+// Get retrieves the identity for a provider and subject
+func (s *MemoryStore) Get(ctx context.Context, provider, subject string) (*Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ident, ok := s.identities[identityKey{provider, subject}]
+	if !ok {
+		return nil, ErrIdentityNotFound
+	}
+	c := *ident
+	return &c, nil
+}
+
+// ListByUser returns every identity linked to a user
+func (s *MemoryStore) ListByUser(ctx context.Context, userID string) ([]*Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []*Identity
+	for _, ident := range s.identities {
+		if ident.UserID == userID {
+			c := *ident
+			result = append(result, &c)
+		}
+	}
+	return result, nil
+}
+
+// FindByVerifiedEmail returns identities whose verified email matches
+func (s *MemoryStore) FindByVerifiedEmail(ctx context.Context, email string) ([]*Identity, error) {
+	email = normalizeEmail(email)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []*Identity
+	for _, ident := range s.identities {
+		if ident.EmailVerified && normalizeEmail(ident.Email) == email {
+			c := *ident
+			result = append(result, &c)
+		}
+	}
+	return result, nil
+}
+
+// Create stores a new identity
+func (s *MemoryStore) Create(ctx context.Context, ident *Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identityKey{ident.Provider, ident.Subject}
+	if _, exists := s.identities[key]; exists {
+		return ErrIdentityExists
+	}
+	c := *ident
+	s.identities[key] = &c
+	return nil
+}
+
+// Update replaces the mutable fields of an identity
+func (s *MemoryStore) Update(ctx context.Context, ident *Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.identities[identityKey{ident.Provider, ident.Subject}]
+	if !ok {
+		return ErrIdentityNotFound
+	}
+	existing.Email = ident.Email
+	existing.EmailVerified = ident.EmailVerified
+	existing.LastLoginAt = ident.LastLoginAt
+	return nil
+}
+
+// Delete removes a user's identity if at least keep identities remain
+func (s *MemoryStore) Delete(ctx context.Context, userID, provider, subject string, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identityKey{provider, subject}
+	ident, ok := s.identities[key]
+	if !ok || ident.UserID != userID {
+		return ErrIdentityNotFound
+	}
+
+	count := 0
+	for _, other := range s.identities {
+		if other.UserID == userID {
+			count++
+		}
+	}
+	if count-1 < keep {
+		return ErrLastLoginMethod
+	}
+
+	delete(s.identities, key)
+	return nil
+}
@@ -0,0 +1,100 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Introspector validates tokens with the authorization server (RFC 7662)
+type Introspector interface {
+	Introspect(ctx context.Context, token string) (*IntrospectionResponse, error)
+}
+
+// IntrospectionResponse is the token introspection response (RFC 7662 section 2.2)
+type IntrospectionResponse struct {
+	Active    bool          `json:"active"`
+	Scope     string        `json:"scope,omitempty"`
+	ClientID  string        `json:"client_id,omitempty"`
+	Username  string        `json:"username,omitempty"`
+	TokenType string        `json:"token_type,omitempty"`
+	ExpiresAt int64         `json:"exp,omitempty"`
+	IssuedAt  int64         `json:"iat,omitempty"`
+	NotBefore int64         `json:"nbf,omitempty"`
+	Subject   string        `json:"sub,omitempty"`
+	Audience  StringOrArray `json:"aud,omitempty"`
+	Issuer    string        `json:"iss,omitempty"`
+	JWTID     string        `json:"jti,omitempty"`
+
+	// Extra holds every member of the response, including non-standard ones
+	Extra map[string]interface{} `json:"-"`
+}
+
+// Scopes returns the granted scopes as a slice
+func (r *IntrospectionResponse) Scopes() []string {
+	return strings.Fields(r.Scope)
+}
+
+// Expiry returns the token expiry time, or zero if unknown
+func (r *IntrospectionResponse) Expiry() time.Time {
+	if r.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(r.ExpiresAt, 0)
+}
+
+// Introspect asks the provider whether a token is active (RFC 7662).
+// Inactive tokens are reported with Active=false, not as an error.
+func (c *CustomProvider) Introspect(ctx context.Context, token string) (*IntrospectionResponse, error) {
+	if c.config.IntrospectionURL == "" {
+		return nil, fmt.Errorf("%w: introspection_url not configured", ErrInvalidConfig)
+	}
+
+	data := url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.IntrospectionURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// The introspection endpoint requires client authentication (RFC 7662 section 2.1)
+	req.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(c.config.ClientSecret))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to introspect token: %v", ErrNetworkError, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read introspection response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return nil, fmt.Errorf("%w: introspection status code %d", ErrServerError, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("%w: introspection status code %d", ErrInvalidResponse, resp.StatusCode)
+	}
+
+	var result IntrospectionResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode introspection response: %w", err)
+	}
+	if err := json.Unmarshal(body, &result.Extra); err != nil {
+		return nil, fmt.Errorf("failed to decode introspection response: %w", err)
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,289 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrKeyNotFound indicates no verification key matches the token's key ID
+var ErrKeyNotFound = errors.New("verification key not found")
+
+// JWK is a JSON Web Key (RFC 7517) holding an RSA or EC public key
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set document
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK builds a JWK from an *rsa.PublicKey or *ecdsa.PublicKey
+func NewJWK(key crypto.PublicKey, keyID string) (*JWK, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			KeyType: "RSA",
+			KeyID:   keyID,
+			N:       base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		x := make([]byte, size)
+		y := make([]byte, size)
+		k.X.FillBytes(x)
+		k.Y.FillBytes(y)
+		return &JWK{
+			KeyType: "EC",
+			KeyID:   keyID,
+			Curve:   k.Curve.Params().Name,
+			X:       base64.RawURLEncoding.EncodeToString(x),
+			Y:       base64.RawURLEncoding.EncodeToString(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrInvalidSigningKey, key)
+	}
+}
+
+// PublicKey converts the JWK to an *rsa.PublicKey or *ecdsa.PublicKey
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", k.KeyType)
+	}
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 JWK thumbprint, base64url encoded
+func (k *JWK) Thumbprint() (string, error) {
+	var canonical string
+	switch k.KeyType {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Curve, k.X, k.Y)
+	default:
+		return "", fmt.Errorf("unsupported key type: %s", k.KeyType)
+	}
+
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// KeySet resolves verification keys by key ID
+type KeySet interface {
+	PublicKey(ctx context.Context, keyID string) (crypto.PublicKey, error)
+}
+
+// StaticKeySet is a fixed set of verification keys
+type StaticKeySet map[string]crypto.PublicKey
+
+// PublicKey returns the key with the given ID. A set holding a single key
+// also matches tokens without a kid header.
+func (s StaticKeySet) PublicKey(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	if key, ok := s[keyID]; ok {
+		return key, nil
+	}
+	if keyID == "" && len(s) == 1 {
+		for _, key := range s {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: kid %q", ErrKeyNotFound, keyID)
+}
+
+// RemoteKeySet fetches and caches a JWKS document from a URL.
+// Unknown key IDs trigger a refetch so key rotation is picked up; concurrent
+// refetches share one request and at most one is attempted per minRefresh.
+type RemoteKeySet struct {
+	url        string
+	httpClient HTTPClient
+	ttl        time.Duration
+
+	// minRefresh limits refetches triggered by unknown key IDs
+	minRefresh time.Duration
+
+	group       singleflight.Group
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time // last fetch, successful or not
+}
+
+// NewRemoteKeySet creates a key set backed by a JWKS URL. A zero ttl caches keys for 1 hour.
+func NewRemoteKeySet(jwksURL string, httpClient HTTPClient, ttl time.Duration) *RemoteKeySet {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	return &RemoteKeySet{
+		url:        jwksURL,
+		httpClient: httpClient,
+		ttl:        ttl,
+		minRefresh: 10 * time.Second,
+		keys:       make(map[string]crypto.PublicKey),
+	}
+}
+
+// PublicKey returns the key with the given ID, fetching the JWKS when needed
+func (s *RemoteKeySet) PublicKey(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	s.mu.RLock()
+	key, ok := s.lookup(keyID)
+	fresh := time.Since(s.fetchedAt) < s.ttl
+	recent := time.Since(s.attemptedAt) < s.minRefresh
+	s.mu.RUnlock()
+
+	if ok && (fresh || recent) {
+		return key, nil
+	}
+	if recent {
+		return nil, fmt.Errorf("%w: kid %q", ErrKeyNotFound, keyID)
+	}
+
+	if err := s.Refresh(ctx); err != nil {
+		if ok {
+			// Serve the stale key rather than failing when the JWKS endpoint is down
+			return key, nil
+		}
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if key, ok := s.lookup(keyID); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: kid %q", ErrKeyNotFound, keyID)
+}
+
+// Refresh refetches the JWKS document. Concurrent calls share one request.
+func (s *RemoteKeySet) Refresh(ctx context.Context) error {
+	_, err, _ := s.group.Do("refresh", func() (any, error) {
+		return nil, s.fetch(ctx)
+	})
+	return err
+}
+
+func (s *RemoteKeySet) fetch(ctx context.Context) error {
+	s.mu.Lock()
+	s.attemptedAt = time.Now()
+	s.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: failed to fetch JWKS: %v", ErrNetworkError, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: JWKS status code %d", ErrInvalidResponse, resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue // Skip keys we cannot use
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.fetchedAt = time.Now()
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *RemoteKeySet) lookup(keyID string) (crypto.PublicKey, bool) {
+	if key, ok := s.keys[keyID]; ok {
+		return key, true
+	}
+	if keyID == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
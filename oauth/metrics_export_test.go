@@ -0,0 +1,153 @@
+package oauth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/oauth"
+)
+
+func TestPrometheusCollector(t *testing.T) {
+	collector := oauth.NewPrometheusCollector(oauth.PrometheusConfig{Buckets: []float64{0.1, 1}})
+
+	collector.RecordTokenExchange("google", true, 50*time.Millisecond)
+	collector.RecordTokenExchange("google", false, 500*time.Millisecond)
+	collector.RecordUserInfoRequest("github", true, 2*time.Second)
+	collector.RecordError("google", "exchange", "invalid_state")
+	collector.RecordRateLimitHit("ip:192.0.2.1")
+
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type: %q", ct)
+	}
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE oauth_requests_total counter",
+		`oauth_requests_total{provider="google",operation="token_exchange",result="success"} 1`,
+		`oauth_requests_total{provider="google",operation="token_exchange",result="failure"} 1`,
+		"# TYPE oauth_request_duration_seconds histogram",
+		`oauth_request_duration_seconds_bucket{provider="google",operation="token_exchange",le="0.1"} 1`,
+		`oauth_request_duration_seconds_bucket{provider="google",operation="token_exchange",le="1"} 2`,
+		`oauth_request_duration_seconds_bucket{provider="google",operation="token_exchange",le="+Inf"} 2`,
+		`oauth_request_duration_seconds_count{provider="google",operation="token_exchange"} 2`,
+		`oauth_request_duration_seconds_sum{provider="google",operation="token_exchange"} 0.55`,
+		`oauth_request_duration_seconds_bucket{provider="github",operation="user_info",le="1"} 0`,
+		`oauth_errors_total{provider="google",operation="exchange",type="invalid_state"} 1`,
+		"oauth_rate_limit_hits_total 1",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Missing line %q in:\n%s", line, body)
+		}
+	}
+
+	// The in-memory view keeps working
+	if metrics := collector.GetMetrics(); metrics.TokenExchanges.Total != 2 {
+		t.Errorf("Expected 2 token exchanges, got %d", metrics.TokenExchanges.Total)
+	}
+
+	collector.Reset()
+	var sb strings.Builder
+	if err := collector.WritePrometheus(&sb); err != nil {
+		t.Fatalf("WritePrometheus failed: %v", err)
+	}
+	if strings.Contains(sb.String(), "oauth_requests_total{") {
+		t.Error("Expected no request series after reset")
+	}
+}
+
+func TestPrometheusCollector_EscapesLabels(t *testing.T) {
+	collector := oauth.NewPrometheusCollector(oauth.PrometheusConfig{Namespace: "auth"})
+	collector.RecordError(`we"ird`, "exchange", "line\nbreak")
+
+	var sb strings.Builder
+	_ = collector.WritePrometheus(&sb)
+	if !strings.Contains(sb.String(), `auth_errors_total{provider="we\"ird",operation="exchange",type="line\nbreak"} 1`) {
+		t.Errorf("Labels not escaped:\n%s", sb.String())
+	}
+}
+
+type fakeMeter struct {
+	mu       sync.Mutex
+	counters map[string]int64
+	records  map[string][]float64
+	attrs    map[string][]oauth.OTelAttribute
+}
+
+type fakeInstrument struct {
+	meter *fakeMeter
+	name  string
+}
+
+func (f fakeInstrument) Add(ctx context.Context, incr int64, attrs ...oauth.OTelAttribute) {
+	f.meter.mu.Lock()
+	defer f.meter.mu.Unlock()
+	f.meter.counters[f.name] += incr
+	f.meter.attrs[f.name] = attrs
+}
+
+func (f fakeInstrument) Record(ctx context.Context, value float64, attrs ...oauth.OTelAttribute) {
+	f.meter.mu.Lock()
+	defer f.meter.mu.Unlock()
+	f.meter.records[f.name] = append(f.meter.records[f.name], value)
+	f.meter.attrs[f.name] = attrs
+}
+
+func (m *fakeMeter) Int64Counter(name, description, unit string) (oauth.OTelInt64Counter, error) {
+	return fakeInstrument{m, name}, nil
+}
+
+func (m *fakeMeter) Float64Histogram(name, description, unit string) (oauth.OTelFloat64Histogram, error) {
+	return fakeInstrument{m, name}, nil
+}
+
+func TestOTelCollector(t *testing.T) {
+	meter := &fakeMeter{
+		counters: make(map[string]int64),
+		records:  make(map[string][]float64),
+		attrs:    make(map[string][]oauth.OTelAttribute),
+	}
+	collector, err := oauth.NewOTelCollector(meter)
+	if err != nil {
+		t.Fatalf("NewOTelCollector failed: %v", err)
+	}
+
+	var _ oauth.MetricsCollector = collector
+
+	collector.RecordTokenRefresh("microsoft", false, 250*time.Millisecond)
+	collector.RecordRateLimitHit("ip:192.0.2.1")
+	collector.RecordError("microsoft", "refresh", "unknown")
+
+	if meter.counters["oauth.requests"] != 1 || meter.counters["oauth.errors"] != 1 || meter.counters["oauth.rate_limit.hits"] != 1 {
+		t.Errorf("Unexpected counters: %v", meter.counters)
+	}
+	if got := meter.records["oauth.request.duration"]; len(got) != 1 || got[0] != 0.25 {
+		t.Errorf("Unexpected duration records: %v", got)
+	}
+
+	want := []oauth.OTelAttribute{
+		{Key: "oauth.provider", Value: "microsoft"},
+		{Key: "oauth.operation", Value: oauth.OperationTokenRefresh},
+		{Key: "oauth.result", Value: "failure"},
+	}
+	got := meter.attrs["oauth.requests"]
+	if len(got) != len(want) {
+		t.Fatalf("Unexpected attributes: %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Attribute %d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+
+	if collector.GetMetrics().TokenRefreshes.Failed != 1 {
+		t.Error("Expected in-memory metrics to be recorded")
+	}
+}
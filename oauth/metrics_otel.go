@@ -0,0 +1,129 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// OTelAttribute is a metric attribute (dimension)
+type OTelAttribute struct {
+	Key   string
+	Value string
+}
+
+// OTelInt64Counter mirrors the OpenTelemetry Int64Counter instrument
+type OTelInt64Counter interface {
+	Add(ctx context.Context, incr int64, attrs ...OTelAttribute)
+}
+
+// OTelFloat64Histogram mirrors the OpenTelemetry Float64Histogram instrument
+type OTelFloat64Histogram interface {
+	Record(ctx context.Context, value float64, attrs ...OTelAttribute)
+}
+
+// OTelMeter mirrors the subset of the OpenTelemetry metric.Meter API used by
+// OTelCollector. It keeps this package free of the OpenTelemetry dependency;
+// an adapter over a real meter only converts attributes to attribute.String.
+type OTelMeter interface {
+	Int64Counter(name, description, unit string) (OTelInt64Counter, error)
+	Float64Histogram(name, description, unit string) (OTelFloat64Histogram, error)
+}
+
+// OTelCollector is a MetricsCollector that records every measurement on
+// OpenTelemetry instruments. GetMetrics keeps working as for
+// DefaultMetricsCollector.
+//
+// Instruments:
+//
+//	oauth.requests          {oauth.provider, oauth.operation, oauth.result}
+//	oauth.request.duration  {oauth.provider, oauth.operation} (seconds)
+//	oauth.errors            {oauth.provider, oauth.operation, error.type}
+//	oauth.rate_limit.hits
+type OTelCollector struct {
+	*DefaultMetricsCollector
+
+	requests      OTelInt64Counter
+	duration      OTelFloat64Histogram
+	errors        OTelInt64Counter
+	rateLimitHits OTelInt64Counter
+}
+
+// NewOTelCollector creates a metrics collector reporting to an OpenTelemetry meter
+func NewOTelCollector(meter OTelMeter) (*OTelCollector, error) {
+	if meter == nil {
+		return nil, fmt.Errorf("%w: meter is required", ErrInvalidConfig)
+	}
+
+	c := &OTelCollector{DefaultMetricsCollector: NewDefaultMetricsCollector()}
+
+	var err error
+	if c.requests, err = meter.Int64Counter("oauth.requests", "OAuth provider requests by operation and result", "{request}"); err != nil {
+		return nil, fmt.Errorf("failed to create requests counter: %w", err)
+	}
+	if c.duration, err = meter.Float64Histogram("oauth.request.duration", "OAuth provider request latency", "s"); err != nil {
+		return nil, fmt.Errorf("failed to create duration histogram: %w", err)
+	}
+	if c.errors, err = meter.Int64Counter("oauth.errors", "OAuth errors by provider, operation and type", "{error}"); err != nil {
+		return nil, fmt.Errorf("failed to create errors counter: %w", err)
+	}
+	if c.rateLimitHits, err = meter.Int64Counter("oauth.rate_limit.hits", "Requests rejected by the rate limiter", "{request}"); err != nil {
+		return nil, fmt.Errorf("failed to create rate limit counter: %w", err)
+	}
+	return c, nil
+}
+
+// RecordAuthRequest records an authorization request
+func (c *OTelCollector) RecordAuthRequest(provider string, success bool, duration time.Duration) {
+	c.DefaultMetricsCollector.RecordAuthRequest(provider, success, duration)
+	c.observe(provider, OperationAuthRequest, success, duration)
+}
+
+// RecordTokenExchange records a token exchange
+func (c *OTelCollector) RecordTokenExchange(provider string, success bool, duration time.Duration) {
+	c.DefaultMetricsCollector.RecordTokenExchange(provider, success, duration)
+	c.observe(provider, OperationTokenExchange, success, duration)
+}
+
+// RecordTokenRefresh records a token refresh
+func (c *OTelCollector) RecordTokenRefresh(provider string, success bool, duration time.Duration) {
+	c.DefaultMetricsCollector.RecordTokenRefresh(provider, success, duration)
+	c.observe(provider, OperationTokenRefresh, success, duration)
+}
+
+// RecordUserInfoRequest records a user info request
+func (c *OTelCollector) RecordUserInfoRequest(provider string, success bool, duration time.Duration) {
+	c.DefaultMetricsCollector.RecordUserInfoRequest(provider, success, duration)
+	c.observe(provider, OperationUserInfo, success, duration)
+}
+
+// RecordRateLimitHit records a rate limit hit
+func (c *OTelCollector) RecordRateLimitHit(key string) {
+	c.DefaultMetricsCollector.RecordRateLimitHit(key)
+	c.rateLimitHits.Add(context.Background(), 1)
+}
+
+// RecordError records an error
+func (c *OTelCollector) RecordError(provider string, operation string, errorType string) {
+	c.DefaultMetricsCollector.RecordError(provider, operation, errorType)
+	c.errors.Add(context.Background(), 1,
+		OTelAttribute{"oauth.provider", provider},
+		OTelAttribute{"oauth.operation", operation},
+		OTelAttribute{"error.type", errorType})
+}
+
+func (c *OTelCollector) observe(provider, operation string, success bool, duration time.Duration) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	ctx := context.Background()
+
+	c.requests.Add(ctx, 1,
+		OTelAttribute{"oauth.provider", provider},
+		OTelAttribute{"oauth.operation", operation},
+		OTelAttribute{"oauth.result", result})
+	c.duration.Record(ctx, duration.Seconds(),
+		OTelAttribute{"oauth.provider", provider},
+		OTelAttribute{"oauth.operation", operation})
+}
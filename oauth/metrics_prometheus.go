@@ -0,0 +1,269 @@
+package oauth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDurationBuckets are the histogram buckets (seconds) used when
+// PrometheusConfig.Buckets is empty
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Operation labels shared by the metrics exporters
+const (
+	OperationAuthRequest   = "auth_request"
+	OperationTokenExchange = "token_exchange"
+	OperationTokenRefresh  = "token_refresh"
+	OperationUserInfo      = "user_info"
+)
+
+// PrometheusConfig configures the Prometheus exporter
+type PrometheusConfig struct {
+	// Namespace prefixes every metric name (default "oauth")
+	Namespace string `env:"OAUTH_METRICS_NAMESPACE" envDefault:"oauth"`
+
+	// Buckets are the request duration histogram upper bounds in seconds
+	Buckets []float64 `env:"-"`
+}
+
+// PrometheusCollector is a MetricsCollector that also serves its metrics in
+// the Prometheus text exposition format. GetMetrics keeps working as for
+// DefaultMetricsCollector.
+//
+// Exported series:
+//
+//	<ns>_requests_total{provider,operation,result}
+//	<ns>_request_duration_seconds{provider,operation} (histogram)
+//	<ns>_errors_total{provider,operation,type}
+//	<ns>_rate_limit_hits_total
+type PrometheusCollector struct {
+	*DefaultMetricsCollector
+
+	namespace string
+	buckets   []float64
+
+	mu            sync.Mutex
+	requests      map[metricLabels]int64
+	durations     map[metricLabels]*histogram
+	errors        map[metricLabels]int64
+	rateLimitHits int64
+}
+
+// metricLabels identifies a series; value holds the result or error type
+type metricLabels struct {
+	provider  string
+	operation string
+	value     string
+}
+
+// histogram holds non-cumulative bucket counts; the last entry is +Inf
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewPrometheusCollector creates a metrics collector with a Prometheus exporter
+func NewPrometheusCollector(config PrometheusConfig) *PrometheusCollector {
+	if config.Namespace == "" {
+		config.Namespace = "oauth"
+	}
+	buckets := config.Buckets
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &PrometheusCollector{
+		DefaultMetricsCollector: NewDefaultMetricsCollector(),
+		namespace:               config.Namespace,
+		buckets:                 buckets,
+		requests:                make(map[metricLabels]int64),
+		durations:               make(map[metricLabels]*histogram),
+		errors:                  make(map[metricLabels]int64),
+	}
+}
+
+// RecordAuthRequest records an authorization request
+func (c *PrometheusCollector) RecordAuthRequest(provider string, success bool, duration time.Duration) {
+	c.DefaultMetricsCollector.RecordAuthRequest(provider, success, duration)
+	c.observe(provider, OperationAuthRequest, success, duration)
+}
+
+// RecordTokenExchange records a token exchange
+func (c *PrometheusCollector) RecordTokenExchange(provider string, success bool, duration time.Duration) {
+	c.DefaultMetricsCollector.RecordTokenExchange(provider, success, duration)
+	c.observe(provider, OperationTokenExchange, success, duration)
+}
+
+// RecordTokenRefresh records a token refresh
+func (c *PrometheusCollector) RecordTokenRefresh(provider string, success bool, duration time.Duration) {
+	c.DefaultMetricsCollector.RecordTokenRefresh(provider, success, duration)
+	c.observe(provider, OperationTokenRefresh, success, duration)
+}
+
+// RecordUserInfoRequest records a user info request
+func (c *PrometheusCollector) RecordUserInfoRequest(provider string, success bool, duration time.Duration) {
+	c.DefaultMetricsCollector.RecordUserInfoRequest(provider, success, duration)
+	c.observe(provider, OperationUserInfo, success, duration)
+}
+
+// RecordRateLimitHit records a rate limit hit. The key is not exported as a
+// label to keep series cardinality bounded.
+func (c *PrometheusCollector) RecordRateLimitHit(key string) {
+	c.DefaultMetricsCollector.RecordRateLimitHit(key)
+
+	c.mu.Lock()
+	c.rateLimitHits++
+	c.mu.Unlock()
+}
+
+// RecordError records an error
+func (c *PrometheusCollector) RecordError(provider string, operation string, errorType string) {
+	c.DefaultMetricsCollector.RecordError(provider, operation, errorType)
+
+	c.mu.Lock()
+	c.errors[metricLabels{provider, operation, errorType}]++
+	c.mu.Unlock()
+}
+
+// Reset resets all metrics
+func (c *PrometheusCollector) Reset() {
+	c.DefaultMetricsCollector.Reset()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = make(map[metricLabels]int64)
+	c.durations = make(map[metricLabels]*histogram)
+	c.errors = make(map[metricLabels]int64)
+	c.rateLimitHits = 0
+}
+
+func (c *PrometheusCollector) observe(provider, operation string, success bool, duration time.Duration) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	seconds := duration.Seconds()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests[metricLabels{provider, operation, result}]++
+
+	key := metricLabels{provider: provider, operation: operation}
+	h, ok := c.durations[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(c.buckets)+1)}
+		c.durations[key] = h
+	}
+	h.counts[sort.SearchFloat64s(c.buckets, seconds)]++
+	h.sum += seconds
+	h.count++
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format
+func (c *PrometheusCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = c.WritePrometheus(w)
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format
+func (c *PrometheusCollector) WritePrometheus(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	ns := c.namespace
+
+	writeHeader(bw, ns+"_requests_total", "counter", "OAuth provider requests by operation and result.")
+	for _, l := range sortedLabels(c.requests) {
+		fmt.Fprintf(bw, "%s_requests_total%s %d\n", ns,
+			formatLabels("provider", l.provider, "operation", l.operation, "result", l.value), c.requests[l])
+	}
+
+	writeHeader(bw, ns+"_request_duration_seconds", "histogram", "OAuth provider request latency in seconds.")
+	for _, l := range sortedLabels(c.durations) {
+		h := c.durations[l]
+		var cumulative uint64
+		for i, upper := range c.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(bw, "%s_request_duration_seconds_bucket%s %d\n", ns,
+				formatLabels("provider", l.provider, "operation", l.operation, "le", formatFloat(upper)), cumulative)
+		}
+		labels := formatLabels("provider", l.provider, "operation", l.operation)
+		fmt.Fprintf(bw, "%s_request_duration_seconds_bucket%s %d\n", ns,
+			formatLabels("provider", l.provider, "operation", l.operation, "le", "+Inf"), h.count)
+		fmt.Fprintf(bw, "%s_request_duration_seconds_sum%s %s\n", ns, labels, formatFloat(h.sum))
+		fmt.Fprintf(bw, "%s_request_duration_seconds_count%s %d\n", ns, labels, h.count)
+	}
+
+	writeHeader(bw, ns+"_errors_total", "counter", "OAuth errors by provider, operation and type.")
+	for _, l := range sortedLabels(c.errors) {
+		fmt.Fprintf(bw, "%s_errors_total%s %d\n", ns,
+			formatLabels("provider", l.provider, "operation", l.operation, "type", l.value), c.errors[l])
+	}
+
+	writeHeader(bw, ns+"_rate_limit_hits_total", "counter", "Requests rejected by the rate limiter.")
+	fmt.Fprintf(bw, "%s_rate_limit_hits_total %d\n", ns, c.rateLimitHits)
+
+	return bw.Flush()
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sortedLabels returns map keys in a stable order so scrapes are diffable
+func sortedLabels[V any](m map[metricLabels]V) []metricLabels {
+	keys := make([]metricLabels, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.provider != b.provider {
+			return a.provider < b.provider
+		}
+		if a.operation != b.operation {
+			return a.operation < b.operation
+		}
+		return a.value < b.value
+	})
+	return keys
+}
+
+// formatLabels renders name/value pairs as {a="1",b="2"}
+func formatLabels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
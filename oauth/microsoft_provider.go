@@ -0,0 +1,52 @@
+package oauth
+
+import (
+	"fmt"
+)
+
+// MicrosoftProvider implements OAuth provider for the Microsoft identity platform
+// (Entra ID / Azure AD and personal Microsoft accounts).
+//
+// It is a CustomProvider preconfigured with the v2.0 endpoints for the
+// configured tenant, so it supports PKCE, refresh and the device flow.
+type MicrosoftProvider struct {
+	*CustomProvider
+}
+
+// NewMicrosoft creates a new Microsoft OAuth provider.
+// Tenant defaults to "common", which accepts both work and personal accounts.
+func NewMicrosoft(config ProviderConfig) (*MicrosoftProvider, error) {
+	tenant := config.Tenant
+	if tenant == "" {
+		tenant = "common"
+	}
+	base := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0", tenant)
+
+	// Set default endpoints if not provided
+	if config.AuthURL == "" {
+		config.AuthURL = base + "/authorize"
+	}
+	if config.TokenURL == "" {
+		config.TokenURL = base + "/token"
+	}
+	if config.DeviceAuthURL == "" {
+		config.DeviceAuthURL = base + "/devicecode"
+	}
+	if config.UserInfoURL == "" {
+		config.UserInfoURL = "https://graph.microsoft.com/oidc/userinfo"
+	}
+
+	// Set default scopes if not provided (offline_access yields a refresh token)
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email", "offline_access"}
+	}
+
+	config.Type = "microsoft"
+
+	custom, err := NewCustom(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MicrosoftProvider{CustomProvider: custom}, nil
+}
@@ -3,6 +3,7 @@ package oauth
 import (
 	"context"
 	"fmt"
+	"math"
 	"net/http"
 	"strings"
 	"time"
@@ -21,6 +22,7 @@ type Middleware struct {
 	service      *Service
 	multiService *MultiProviderService
 	rateLimiter  RateLimiter
+	audit        AuditSink
 	config       MiddlewareConfig
 }
 
@@ -81,12 +83,25 @@ func (m *Middleware) WithService(service *Service) *Middleware {
 	return m
 }
 
+// WithRateLimiter replaces the rate limiter, e.g. with a RedisRateLimiter
+// shared by every replica
+func (m *Middleware) WithRateLimiter(limiter RateLimiter) *Middleware {
+	m.rateLimiter = limiter
+	return m
+}
+
 // WithMultiProviderService sets the multi-provider service for the middleware
 func (m *Middleware) WithMultiProviderService(service *MultiProviderService) *Middleware {
 	m.multiService = service
 	return m
 }
 
+// WithAuditSink records rate limit rejections to sink
+func (m *Middleware) WithAuditSink(sink AuditSink) *Middleware {
+	m.audit = sink
+	return m
+}
+
 // SecurityHeaders adds security headers to responses
 func (m *Middleware) SecurityHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -175,31 +190,64 @@ func (m *Middleware) RateLimit(next http.Handler) http.Handler {
 		// Get rate limit key (IP address or user ID)
 		key := m.getRateLimitKey(r)
 
-		// Check rate limit
-		allowed, err := m.rateLimiter.Allow(r.Context(), key)
+		// Check rate limit, in a single round trip when the limiter supports it
+		var (
+			allowed bool
+			status  *RateLimitStatus
+			err     error
+		)
+		if limiter, ok := m.rateLimiter.(RateLimiterWithStatus); ok {
+			allowed, status, err = limiter.AllowNWithStatus(r.Context(), key, 1)
+		} else if allowed, err = m.rateLimiter.Allow(r.Context(), key); err == nil {
+			status, _ = m.rateLimiter.GetStatus(r.Context(), key)
+		}
 		if err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		// Get status for headers
-		status, _ := m.rateLimiter.GetStatus(r.Context(), key)
 		if status != nil {
-			w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", status.Limit))
-			w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", status.Remaining))
-			w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", status.Reset.Unix()))
+			setRateLimitHeaders(w.Header(), status, time.Now())
+		}
 
-			if !allowed {
-				w.Header().Set("Retry-After", fmt.Sprintf("%d", int(status.RetryAfter.Seconds())))
-				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
-				return
+		if !allowed {
+			recordAudit(r.Context(), m.audit, AuditEvent{
+				Type:      AuditRateLimitExceeded,
+				IP:        m.getClientIP(r),
+				UserAgent: r.UserAgent(),
+				Details:   map[string]string{"key": key, "path": r.URL.Path},
+			})
+
+			retryAfter := time.Second
+			if status != nil {
+				retryAfter = max(status.RetryAfter, time.Second)
 			}
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int64(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+// setRateLimitHeaders writes the IETF RateLimit-* fields (delta seconds)
+// alongside the legacy X-RateLimit-* headers (Unix reset time)
+func setRateLimitHeaders(h http.Header, status *RateLimitStatus, now time.Time) {
+	reset := int64(math.Ceil(status.Reset.Sub(now).Seconds()))
+	if reset < 0 {
+		reset = 0
+	}
+
+	h.Set("RateLimit-Limit", fmt.Sprintf("%d", status.Limit))
+	h.Set("RateLimit-Remaining", fmt.Sprintf("%d", status.Remaining))
+	h.Set("RateLimit-Reset", fmt.Sprintf("%d", reset))
+
+	h.Set("X-RateLimit-Limit", fmt.Sprintf("%d", status.Limit))
+	h.Set("X-RateLimit-Remaining", fmt.Sprintf("%d", status.Remaining))
+	h.Set("X-RateLimit-Reset", fmt.Sprintf("%d", status.Reset.Unix()))
+}
+
 // RequestLogging logs incoming requests
 func (m *Middleware) RequestLogging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -306,6 +354,7 @@ func (m *Middleware) Chain(handlers ...func(http.Handler) http.Handler) func(htt
 // DefaultChain returns the default middleware chain
 func (m *Middleware) DefaultChain() func(http.Handler) http.Handler {
 	return m.Chain(
+		m.AuditClient,
 		m.RequireHTTPS,
 		m.SecurityHeaders,
 		m.CORS,
@@ -113,18 +113,27 @@ func loadProviderFromEnv(name string) *ProviderConfig {
 
 	// Load all fields for this provider
 	cfg := &ProviderConfig{
-		Type:         name,
-		ClientID:     clientID,
-		ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),  //nolint:forbidigo
-		RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),   //nolint:forbidigo
-		AuthURL:      os.Getenv(prefix + "AUTH_URL"),       //nolint:forbidigo
-		TokenURL:     os.Getenv(prefix + "TOKEN_URL"),      //nolint:forbidigo
-		UserInfoURL:  os.Getenv(prefix + "USERINFO_URL"),   //nolint:forbidigo
-		RevokeURL:    os.Getenv(prefix + "REVOKE_URL"),     //nolint:forbidigo
-		TeamID:       os.Getenv(prefix + "TEAM_ID"),        //nolint:forbidigo
-		KeyID:        os.Getenv(prefix + "KEY_ID"),         //nolint:forbidigo
-		PrivateKey:   os.Getenv(prefix + "PRIVATE_KEY"),    //nolint:forbidigo
-		APIVersion:   os.Getenv(prefix + "API_VERSION"),    //nolint:forbidigo
+		Type:             name,
+		ClientID:         clientID,
+		ClientSecret:     os.Getenv(prefix + "CLIENT_SECRET"),     //nolint:forbidigo
+		RedirectURL:      os.Getenv(prefix + "REDIRECT_URL"),      //nolint:forbidigo
+		AuthURL:          os.Getenv(prefix + "AUTH_URL"),          //nolint:forbidigo
+		TokenURL:         os.Getenv(prefix + "TOKEN_URL"),         //nolint:forbidigo
+		UserInfoURL:      os.Getenv(prefix + "USERINFO_URL"),      //nolint:forbidigo
+		RevokeURL:        os.Getenv(prefix + "REVOKE_URL"),        //nolint:forbidigo
+		IntrospectionURL: os.Getenv(prefix + "INTROSPECTION_URL"), //nolint:forbidigo
+		DeviceAuthURL:    os.Getenv(prefix + "DEVICE_AUTH_URL"),   //nolint:forbidigo
+		PARURL:           os.Getenv(prefix + "PAR_URL"),           //nolint:forbidigo
+		Issuer:           os.Getenv(prefix + "ISSUER"),            //nolint:forbidigo
+		TeamID:           os.Getenv(prefix + "TEAM_ID"),           //nolint:forbidigo
+		KeyID:            os.Getenv(prefix + "KEY_ID"),            //nolint:forbidigo
+		PrivateKey:       os.Getenv(prefix + "PRIVATE_KEY"),       //nolint:forbidigo
+		APIVersion:       os.Getenv(prefix + "API_VERSION"),       //nolint:forbidigo
+		Tenant:           os.Getenv(prefix + "TENANT"),            //nolint:forbidigo
+
+		RequestObjectKey:     os.Getenv(prefix + "REQUEST_OBJECT_KEY"),      //nolint:forbidigo
+		RequestObjectKeyFile: os.Getenv(prefix + "REQUEST_OBJECT_KEY_FILE"), //nolint:forbidigo
+		RequestObjectKeyID:   os.Getenv(prefix + "REQUEST_OBJECT_KEY_ID"),   //nolint:forbidigo
 	}
 
 	// Parse scopes
@@ -3,6 +3,7 @@ package oauth
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -11,12 +12,15 @@ import (
 // MultiProviderService manages multiple OAuth providers
 type MultiProviderService struct {
 	providers   map[string]Provider
+	managed     map[string]ProviderConfig // providers created from configs
+	disabled    map[string]bool
 	sessions    SessionStore
 	tokens      TokenStore
 	config      MultiProviderConfig
 	stateGen    StateGenerator
 	mu          sync.RWMutex
 	httpTimeout time.Duration
+	audit       AuditSink
 }
 
 // MultiProviderConfig defines configuration for multi-provider service
@@ -61,6 +65,8 @@ func NewMultiProviderService(config MultiProviderConfig) (*MultiProviderService,
 
 	service := &MultiProviderService{
 		providers:   make(map[string]Provider),
+		managed:     make(map[string]ProviderConfig),
+		disabled:    make(map[string]bool),
 		sessions:    sessionStore,
 		tokens:      tokenStore,
 		config:      config,
@@ -76,6 +82,7 @@ func NewMultiProviderService(config MultiProviderConfig) (*MultiProviderService,
 				return nil, fmt.Errorf("failed to create provider %s: %w", name, err)
 			}
 			service.providers[name] = provider
+			service.managed[name] = providerConfig
 		}
 	}
 
@@ -108,34 +115,41 @@ func (s *MultiProviderService) UnregisterProvider(name string) error {
 	defer s.mu.Unlock()
 
 	if _, exists := s.providers[name]; !exists {
-		return fmt.Errorf("provider %s not found", name)
+		return fmt.Errorf("%w: %s", ErrProviderNotFound, name)
 	}
 
 	delete(s.providers, name)
+	delete(s.managed, name)
+	delete(s.disabled, name)
 	return nil
 }
 
-// GetProvider retrieves a registered provider by name
+// GetProvider retrieves a registered, enabled provider by name
 func (s *MultiProviderService) GetProvider(name string) (Provider, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	provider, exists := s.providers[name]
 	if !exists {
-		return nil, fmt.Errorf("provider %s not found", name)
+		return nil, fmt.Errorf("%w: %s", ErrProviderNotFound, name)
+	}
+	if s.disabled[name] {
+		return nil, fmt.Errorf("%w: %s", ErrProviderDisabled, name)
 	}
 
 	return provider, nil
 }
 
-// ListProviders returns a list of registered provider names
+// ListProviders returns a list of enabled provider names
 func (s *MultiProviderService) ListProviders() []string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	names := make([]string, 0, len(s.providers))
 	for name := range s.providers {
-		names = append(names, name)
+		if !s.disabled[name] {
+			names = append(names, name)
+		}
 	}
 	return names
 }
@@ -171,11 +185,26 @@ func (s *MultiProviderService) GetAuthURL(ctx context.Context, providerName stri
 		}
 	}
 
+	// Get authorization URL from provider, with any extra scopes and parameters
+	extra := url.Values{}
+	for key, values := range options.params {
+		extra[key] = values
+	}
+	if len(options.scopes) > 0 {
+		extra["scope"] = options.scopes
+	}
+	authCtx := withAuthParams(ctx, extra)
+	authURL, err := buildAuthURL(authCtx, provider, state, pkce)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to build authorization URL: %w", err)
+	}
+
 	// Store session data
 	sessionData := &SessionData{
 		State:         state,
 		PKCEChallenge: pkce,
 		Provider:      providerName,
+		Scope:         requestedScope(authCtx, provider, authURL),
 		CreatedAt:     time.Now(),
 		ExpiresAt:     time.Now().Add(s.config.SessionTimeout),
 		Metadata:      options.metadata,
@@ -184,14 +213,15 @@ func (s *MultiProviderService) GetAuthURL(ctx context.Context, providerName stri
 	if err := s.sessions.Store(ctx, state, sessionData); err != nil {
 		return "", "", fmt.Errorf("failed to store session: %w", err)
 	}
-
-	// Get authorization URL from provider
-	authURL := provider.GetAuthURL(state, pkce)
 	return authURL, state, nil
 }
 
 // Exchange exchanges an authorization code for tokens
-func (s *MultiProviderService) Exchange(ctx context.Context, providerName, code, state string) (*Token, error) {
+func (s *MultiProviderService) Exchange(ctx context.Context, providerName, code, state string) (token *Token, err error) {
+	defer func() {
+		auditOutcome(ctx, s.audit, providerName, AuditLoginSucceeded, AuditLoginFailed, err)
+	}()
+
 	// Retrieve and immediately delete session to prevent replay attacks
 	sessionData, err := s.sessions.RetrieveAndDelete(ctx, state)
 	if err != nil {
@@ -221,11 +251,16 @@ func (s *MultiProviderService) Exchange(ctx context.Context, providerName, code,
 	}
 
 	// Exchange code for token
-	token, err := provider.Exchange(ctx, code, sessionData.PKCEChallenge)
+	token, err = provider.Exchange(WithExchangeState(ctx, state), code, sessionData.PKCEChallenge)
 	if err != nil {
 		return nil, err
 	}
 
+	// An omitted scope means the requested scope was granted (RFC 6749 section 5.1)
+	if token.Scope == "" {
+		token.Scope = sessionData.Scope
+	}
+
 	// Calculate expiration time if not set
 	if token.ExpiresAt.IsZero() && token.ExpiresIn > 0 {
 		token.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
@@ -252,6 +287,7 @@ func (s *MultiProviderService) RefreshToken(ctx context.Context, providerName, r
 	}
 
 	token, err := provider.RefreshToken(ctx, refreshToken)
+	auditOutcome(ctx, s.audit, providerName, AuditTokenRefreshed, AuditTokenRefreshFailed, err)
 	if err != nil {
 		return nil, err
 	}
@@ -289,23 +325,36 @@ func (s *MultiProviderService) RevokeToken(ctx context.Context, providerName, to
 		return err
 	}
 
-	return provider.RevokeToken(ctx, token)
+	err = provider.RevokeToken(ctx, token)
+	auditOutcome(ctx, s.audit, providerName, AuditTokenRevoked, "", err)
+	return err
 }
 
 // ValidateState validates the state parameter for CSRF protection
 func (s *MultiProviderService) ValidateState(ctx context.Context, state string) (*SessionData, error) {
 	sessionData, err := s.sessions.Retrieve(ctx, state)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrInvalidState, err)
+		err = fmt.Errorf("%w: %w", ErrInvalidState, err)
+		auditOutcome(ctx, s.audit, "", "", AuditStateInvalid, err)
+		return nil, err
 	}
 
 	if sessionData.IsExpired() {
-		return nil, fmt.Errorf("%w: session expired", ErrInvalidState)
+		err = fmt.Errorf("%w: session expired", ErrInvalidState)
+		auditOutcome(ctx, s.audit, sessionData.Provider, "", AuditStateInvalid, err)
+		return nil, err
 	}
 
 	return sessionData, nil
 }
 
+// WithAuditSink records logins, refreshes, revocations and state failures to
+// sink. Call it before the service is used.
+func (s *MultiProviderService) WithAuditSink(sink AuditSink) *MultiProviderService {
+	s.audit = sink
+	return s
+}
+
 // AuthOption defines options for GetAuthURL
 type AuthOption func(*authOptions)
 
@@ -313,6 +362,8 @@ type authOptions struct {
 	pkceEnabled bool
 	pkceMethod  string
 	metadata    map[string]interface{}
+	scopes      []string
+	params      url.Values
 }
 
 // WithPKCE enables or disables PKCE for this auth request
@@ -360,6 +411,12 @@ func createProvider(name string, config ProviderConfig) (Provider, error) {
 	case "twitter":
 		provider := NewTwitter(config)
 		return provider, nil
+	case "microsoft":
+		provider, err := NewMicrosoft(config)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
 	case "custom":
 		provider, err := NewCustom(config)
 		if err != nil {
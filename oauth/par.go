@@ -0,0 +1,196 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/gobeaver/beaver-kit/krypto"
+)
+
+// ErrPARNotSupported is returned when no pushed authorization request endpoint is configured
+var ErrPARNotSupported = errors.New("pushed authorization requests not supported by provider")
+
+// requestObjectLifetime bounds JAR validity; FAPI 2.0 requires at most 60 minutes
+const requestObjectLifetime = 5 * time.Minute
+
+// AuthURLContextProvider is implemented by providers whose authorization URL
+// may need a network call (PAR, RFC 9126) or signing (JAR, RFC 9101).
+// Service and MultiProviderService prefer it over Provider.GetAuthURL.
+type AuthURLContextProvider interface {
+	AuthURLContext(ctx context.Context, state string, pkce *PKCEChallenge) (string, error)
+}
+
+// PushedAuthorizationResponse is the RFC 9126 pushed authorization response
+type PushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int    `json:"expires_in"`
+}
+
+// buildAuthURL returns the provider's authorization URL, using AuthURLContext when available
+func buildAuthURL(ctx context.Context, provider Provider, state string, pkce *PKCEChallenge) (string, error) {
+	if p, ok := provider.(AuthURLContextProvider); ok {
+		return p.AuthURLContext(ctx, state, pkce)
+	}
+	return applyAuthURLParams(ctx, provider.GetAuthURL(state, pkce))
+}
+
+// AuthURLContext returns the authorization URL. With PARURL configured the
+// parameters are pushed first and the URL only carries client_id and
+// request_uri; with a request object signer they travel as a signed JWT
+// (JAR). Otherwise it is equivalent to GetAuthURL.
+func (c *CustomProvider) AuthURLContext(ctx context.Context, state string, pkce *PKCEChallenge) (string, error) {
+	params := url.Values{"client_id": {c.config.ClientID}}
+
+	switch {
+	case c.config.PARURL != "":
+		par, err := c.PushAuthorizationRequest(ctx, state, pkce)
+		if err != nil {
+			return "", err
+		}
+		params.Set("request_uri", par.RequestURI)
+	case c.requestSigner != nil:
+		authParams := c.authParams(state, pkce)
+		applyAuthParams(ctx, authParams)
+		request, err := c.RequestObject(authParams)
+		if err != nil {
+			return "", err
+		}
+		params.Set("request", request)
+	default:
+		return applyAuthURLParams(ctx, c.GetAuthURL(state, pkce))
+	}
+
+	return c.config.AuthURL + "?" + params.Encode(), nil
+}
+
+// PushAuthorizationRequest sends the authorization parameters to the PAR
+// endpoint (RFC 9126) and returns the request_uri to redirect with.
+// Parameters are sent as a signed request object when a signer is configured.
+func (c *CustomProvider) PushAuthorizationRequest(ctx context.Context, state string, pkce *PKCEChallenge) (*PushedAuthorizationResponse, error) {
+	if c.config.PARURL == "" {
+		return nil, ErrPARNotSupported
+	}
+
+	data := c.authParams(state, pkce)
+	applyAuthParams(ctx, data)
+	if c.requestSigner != nil {
+		request, err := c.RequestObject(data)
+		if err != nil {
+			return nil, err
+		}
+		data = url.Values{"client_id": {c.config.ClientID}, "request": {request}}
+	}
+	if c.config.ClientSecret != "" {
+		data.Set("client_secret", c.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.PARURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNetworkError, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+			ErrorURI         string `json:"error_uri"`
+		}
+		if err := json.Unmarshal(body, &errResp); err != nil || errResp.Error == "" {
+			return nil, fmt.Errorf("%w: unexpected status code: %d", ErrInvalidResponse, resp.StatusCode)
+		}
+		return nil, ParseError(c.name, errResp.Error, errResp.ErrorDescription, errResp.ErrorURI)
+	}
+
+	var par PushedAuthorizationResponse
+	if err := json.Unmarshal(body, &par); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	if par.RequestURI == "" {
+		return nil, fmt.Errorf("%w: missing request_uri", ErrInvalidResponse)
+	}
+	return &par, nil
+}
+
+// RequestObject signs authorization parameters as an RFC 9101 request object
+func (c *CustomProvider) RequestObject(params url.Values) (string, error) {
+	if c.requestSigner == nil {
+		return "", fmt.Errorf("%w: no request object signing key configured", ErrInvalidConfig)
+	}
+
+	jti, err := krypto.GenerateSecureToken(16)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate jti: %w", err)
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for k, v := range params {
+		if len(v) > 0 {
+			claims[k] = v[0]
+		}
+	}
+	claims["iss"] = c.config.ClientID
+	claims["aud"] = c.issuer()
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(requestObjectLifetime).Unix()
+	claims["jti"] = jti
+
+	return c.requestSigner.Sign(claims)
+}
+
+// authParams returns the authorization request parameters
+func (c *CustomProvider) authParams(state string, pkce *PKCEChallenge) url.Values {
+	params := url.Values{
+		"client_id":     {c.config.ClientID},
+		"redirect_uri":  {c.config.RedirectURL},
+		"response_type": {"code"},
+		"state":         {state},
+	}
+
+	if len(c.config.Scopes) > 0 {
+		params.Set("scope", strings.Join(c.config.Scopes, " "))
+	}
+
+	if pkce != nil {
+		params.Set("code_challenge", pkce.Challenge)
+		params.Set("code_challenge_method", pkce.ChallengeMethod)
+	}
+
+	return params
+}
+
+// issuer returns the authorization server identifier used as the JAR
+// audience, defaulting to the origin of the authorization endpoint
+func (c *CustomProvider) issuer() string {
+	if c.config.Issuer != "" {
+		return c.config.Issuer
+	}
+	u, err := url.Parse(c.config.AuthURL)
+	if err != nil {
+		return c.config.AuthURL
+	}
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,372 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrTenantNotFound indicates no providers are configured for a tenant
+var ErrTenantNotFound = errors.New("oauth tenant not found")
+
+// ProviderRecord is a provider configuration managed at runtime, as loaded
+// from a file or database
+type ProviderRecord struct {
+	// TenantID scopes the provider to a tenant; empty for single-tenant setups
+	TenantID string         `json:"tenant_id,omitempty"`
+	Name     string         `json:"name"`
+	Disabled bool           `json:"disabled,omitempty"`
+	Config   ProviderConfig `json:"config"`
+}
+
+// ProviderSource loads provider records
+type ProviderSource interface {
+	LoadProviders(ctx context.Context) ([]ProviderRecord, error)
+}
+
+// ChangeDetector is implemented by sources that can cheaply tell whether they
+// changed since their last LoadProviders. WatchProviders only reloads such
+// sources when they report a change.
+type ChangeDetector interface {
+	Changed(ctx context.Context) (bool, error)
+}
+
+// AddProvider creates a provider from config and registers it
+func (s *MultiProviderService) AddProvider(name string, config ProviderConfig) error {
+	if name == "" {
+		return fmt.Errorf("provider name cannot be empty")
+	}
+
+	provider, err := createProvider(name, config)
+	if err != nil {
+		return fmt.Errorf("failed to create provider %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.providers[name]; exists {
+		return fmt.Errorf("provider %s already registered", name)
+	}
+
+	s.providers[name] = provider
+	s.managed[name] = config
+	return nil
+}
+
+// UpdateProvider replaces a provider with one built from config. In-flight
+// requests finish on the old instance; pending sessions stay valid.
+func (s *MultiProviderService) UpdateProvider(name string, config ProviderConfig) error {
+	provider, err := createProvider(name, config)
+	if err != nil {
+		return fmt.Errorf("failed to create provider %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.providers[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrProviderNotFound, name)
+	}
+
+	s.providers[name] = provider
+	s.managed[name] = config
+	return nil
+}
+
+// DisableProvider keeps a provider registered but rejects new requests for it
+func (s *MultiProviderService) DisableProvider(name string) error {
+	return s.setDisabled(name, true)
+}
+
+// EnableProvider re-enables a disabled provider
+func (s *MultiProviderService) EnableProvider(name string) error {
+	return s.setDisabled(name, false)
+}
+
+func (s *MultiProviderService) setDisabled(name string, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.providers[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrProviderNotFound, name)
+	}
+
+	if disabled {
+		s.disabled[name] = true
+	} else {
+		delete(s.disabled, name)
+	}
+	return nil
+}
+
+// ApplyProviders reconciles config-managed providers with records: new
+// providers are added, changed ones rebuilt and missing ones removed.
+// Providers added with RegisterProvider are left alone. Either every record
+// is applied or, if any fails to build, none is. TenantID is ignored; use
+// TenantProviders for per-tenant sets.
+func (s *MultiProviderService) ApplyProviders(records []ProviderRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[string]ProviderRecord, len(records))
+	built := make(map[string]Provider)
+	for _, record := range records {
+		if record.Name == "" {
+			return fmt.Errorf("%w: provider name cannot be empty", ErrInvalidConfig)
+		}
+		if _, dup := wanted[record.Name]; dup {
+			return fmt.Errorf("%w: duplicate provider %s", ErrInvalidConfig, record.Name)
+		}
+		wanted[record.Name] = record
+
+		current, managed := s.managed[record.Name]
+		if !managed {
+			if _, exists := s.providers[record.Name]; exists {
+				return fmt.Errorf("%w: provider %s is registered manually", ErrInvalidConfig, record.Name)
+			}
+		} else if reflect.DeepEqual(current, record.Config) {
+			continue
+		}
+
+		provider, err := createProvider(record.Name, record.Config)
+		if err != nil {
+			return fmt.Errorf("failed to create provider %s: %w", record.Name, err)
+		}
+		built[record.Name] = provider
+	}
+
+	for name := range s.managed {
+		if _, keep := wanted[name]; !keep {
+			delete(s.providers, name)
+			delete(s.managed, name)
+			delete(s.disabled, name)
+		}
+	}
+	for name, provider := range built {
+		s.providers[name] = provider
+		s.managed[name] = wanted[name].Config
+	}
+	for name, record := range wanted {
+		if record.Disabled {
+			s.disabled[name] = true
+		} else {
+			delete(s.disabled, name)
+		}
+	}
+
+	return nil
+}
+
+// LoadProviders applies the records of a source
+func (s *MultiProviderService) LoadProviders(ctx context.Context, source ProviderSource) error {
+	records, err := source.LoadProviders(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load providers: %w", err)
+	}
+	return s.ApplyProviders(records)
+}
+
+// WatchProviders loads a source, then checks it every interval until ctx is
+// cancelled, reloading it when it changed (see ChangeDetector). Reload
+// failures keep the current providers and go to onError.
+func (s *MultiProviderService) WatchProviders(ctx context.Context, source ProviderSource, interval time.Duration, onError func(error)) error {
+	return watchProviders(ctx, source, interval, onError, func() error {
+		return s.LoadProviders(ctx, source)
+	})
+}
+
+func (s *MultiProviderService) providerCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.providers)
+}
+
+// TenantProviders keeps a separate provider set per tenant, for SaaS setups
+// where each customer brings their own IdP credentials. Every tenant gets its
+// own MultiProviderService, so sessions and tokens never cross tenants.
+type TenantProviders struct {
+	config MultiProviderConfig
+
+	mu      sync.RWMutex
+	tenants map[string]*MultiProviderService
+}
+
+// NewTenantProviders creates a tenant registry. config supplies the settings
+// shared by all tenants; its Providers field is ignored.
+func NewTenantProviders(config MultiProviderConfig) (*TenantProviders, error) {
+	config.Providers = nil
+	if _, err := NewMultiProviderService(config); err != nil {
+		return nil, err
+	}
+
+	return &TenantProviders{
+		config:  config,
+		tenants: make(map[string]*MultiProviderService),
+	}, nil
+}
+
+// Service returns the provider service of a tenant
+func (t *TenantProviders) Service(tenantID string) (*MultiProviderService, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	service, exists := t.tenants[tenantID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	return service, nil
+}
+
+// GetProvider retrieves an enabled provider of a tenant
+func (t *TenantProviders) GetProvider(tenantID, name string) (Provider, error) {
+	service, err := t.Service(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return service.GetProvider(name)
+}
+
+// AddProvider adds a provider to a tenant, creating the tenant if needed
+func (t *TenantProviders) AddProvider(tenantID, name string, config ProviderConfig) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	service, err := t.tenant(tenantID)
+	if err != nil {
+		return err
+	}
+	return service.AddProvider(name, config)
+}
+
+// RemoveTenant drops a tenant and all of its providers and sessions
+func (t *TenantProviders) RemoveTenant(tenantID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.tenants, tenantID)
+}
+
+// Tenants returns the IDs of all tenants, sorted
+func (t *TenantProviders) Tenants() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	ids := make([]string, 0, len(t.tenants))
+	for id := range t.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// ApplyProviders reconciles every tenant with records grouped by TenantID.
+// Tenants are applied independently: one tenant's invalid configuration is
+// reported but does not block the others, and that tenant keeps its previous
+// providers. Tenants left without providers are removed.
+func (t *TenantProviders) ApplyProviders(records []ProviderRecord) error {
+	byTenant := make(map[string][]ProviderRecord)
+	for _, record := range records {
+		byTenant[record.TenantID] = append(byTenant[record.TenantID], record)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var errs []error
+	for tenantID, tenantRecords := range byTenant {
+		service, err := t.tenant(tenantID)
+		if err == nil {
+			err = service.ApplyProviders(tenantRecords)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", tenantID, err))
+		}
+	}
+
+	for tenantID, service := range t.tenants {
+		if _, listed := byTenant[tenantID]; !listed {
+			_ = service.ApplyProviders(nil)
+		}
+		if service.providerCount() == 0 {
+			delete(t.tenants, tenantID)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// LoadProviders applies the records of a source
+func (t *TenantProviders) LoadProviders(ctx context.Context, source ProviderSource) error {
+	records, err := source.LoadProviders(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load providers: %w", err)
+	}
+	return t.ApplyProviders(records)
+}
+
+// WatchProviders loads a source, then checks it every interval until ctx is
+// cancelled, reloading it when it changed. Reload failures go to onError.
+func (t *TenantProviders) WatchProviders(ctx context.Context, source ProviderSource, interval time.Duration, onError func(error)) error {
+	return watchProviders(ctx, source, interval, onError, func() error {
+		return t.LoadProviders(ctx, source)
+	})
+}
+
+// tenant returns or creates a tenant service; callers hold t.mu
+func (t *TenantProviders) tenant(tenantID string) (*MultiProviderService, error) {
+	if service, exists := t.tenants[tenantID]; exists {
+		return service, nil
+	}
+
+	service, err := NewMultiProviderService(t.config)
+	if err != nil {
+		return nil, err
+	}
+	t.tenants[tenantID] = service
+	return service, nil
+}
+
+// watchProviders runs load once, then in the background every interval in
+// which the source changed. Sources without change detection always reload.
+func watchProviders(ctx context.Context, source ProviderSource, interval time.Duration, onError func(error), load func() error) error {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	if err := load(); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if detector, ok := source.(ChangeDetector); ok {
+					changed, err := detector.Changed(ctx)
+					if err != nil {
+						if onError != nil {
+							onError(err)
+						}
+						continue
+					}
+					if !changed {
+						continue
+					}
+				}
+				if err := load(); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
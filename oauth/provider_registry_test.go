@@ -0,0 +1,326 @@
+package oauth_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/gobeaver/beaver-kit/krypto"
+	"github.com/gobeaver/beaver-kit/oauth"
+)
+
+func customConfig(clientID string) oauth.ProviderConfig {
+	return oauth.ProviderConfig{
+		Type:        "custom",
+		ClientID:    clientID,
+		RedirectURL: "http://localhost/callback",
+		AuthURL:     "https://idp.example.com/authorize",
+		TokenURL:    "https://idp.example.com/token",
+	}
+}
+
+func TestMultiProviderService_RuntimeManagement(t *testing.T) {
+	service, err := oauth.NewMultiProviderService(oauth.MultiProviderConfig{SessionTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := service.AddProvider("okta", customConfig("v1")); err != nil {
+		t.Fatalf("AddProvider failed: %v", err)
+	}
+	if err := service.AddProvider("okta", customConfig("v1")); err == nil {
+		t.Error("Expected error adding a duplicate provider")
+	}
+
+	// A pending login survives a credential rotation
+	_, state, err := service.GetAuthURL(ctx, "okta")
+	if err != nil {
+		t.Fatalf("GetAuthURL failed: %v", err)
+	}
+	if err := service.UpdateProvider("okta", customConfig("v2")); err != nil {
+		t.Fatalf("UpdateProvider failed: %v", err)
+	}
+	if _, err := service.ValidateState(ctx, state); err != nil {
+		t.Errorf("Expected session to survive update: %v", err)
+	}
+	authURL, _, _ := service.GetAuthURL(ctx, "okta")
+	if !strings.Contains(authURL, "client_id=v2") {
+		t.Errorf("Expected rotated client ID in %s", authURL)
+	}
+
+	if err := service.DisableProvider("okta"); err != nil {
+		t.Fatalf("DisableProvider failed: %v", err)
+	}
+	if _, err := service.GetProvider("okta"); !errors.Is(err, oauth.ErrProviderDisabled) {
+		t.Errorf("Expected ErrProviderDisabled, got %v", err)
+	}
+	if len(service.ListProviders()) != 0 {
+		t.Errorf("Expected disabled provider to be hidden, got %v", service.ListProviders())
+	}
+	if err := service.EnableProvider("okta"); err != nil {
+		t.Fatalf("EnableProvider failed: %v", err)
+	}
+
+	if err := service.UnregisterProvider("okta"); err != nil {
+		t.Fatalf("UnregisterProvider failed: %v", err)
+	}
+	if _, err := service.GetProvider("okta"); !errors.Is(err, oauth.ErrProviderNotFound) {
+		t.Errorf("Expected ErrProviderNotFound, got %v", err)
+	}
+	if err := service.UpdateProvider("okta", customConfig("v3")); !errors.Is(err, oauth.ErrProviderNotFound) {
+		t.Errorf("Expected ErrProviderNotFound on update, got %v", err)
+	}
+}
+
+func TestMultiProviderService_ConcurrentUpdates(t *testing.T) {
+	service, _ := oauth.NewMultiProviderService(oauth.MultiProviderConfig{})
+	_ = service.AddProvider("okta", customConfig("v0"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			_ = service.UpdateProvider("okta", customConfig(fmt.Sprintf("v%d", i)))
+			_ = service.ApplyProviders([]oauth.ProviderRecord{{Name: "okta", Config: customConfig("applied")}})
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := service.GetProvider("okta"); err != nil {
+				t.Errorf("GetProvider failed during update: %v", err)
+			}
+			_ = service.ListProviders()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMultiProviderService_ApplyProviders(t *testing.T) {
+	service, _ := oauth.NewMultiProviderService(oauth.MultiProviderConfig{
+		Providers: map[string]oauth.ProviderConfig{"okta": customConfig("env")},
+	})
+	manual := oauth.NewGitHub(oauth.ProviderConfig{ClientID: "gh", RedirectURL: "http://localhost/callback"})
+	_ = service.RegisterProvider("github", manual)
+
+	err := service.ApplyProviders([]oauth.ProviderRecord{
+		{Name: "auth0", Config: customConfig("a")},
+		{Name: "keycloak", Config: customConfig("k"), Disabled: true},
+	})
+	if err != nil {
+		t.Fatalf("ApplyProviders failed: %v", err)
+	}
+
+	if _, err := service.GetProvider("okta"); !errors.Is(err, oauth.ErrProviderNotFound) {
+		t.Errorf("Expected config provider missing from records to be removed, got %v", err)
+	}
+	if _, err := service.GetProvider("github"); err != nil {
+		t.Errorf("Expected manually registered provider to be kept: %v", err)
+	}
+	if _, err := service.GetProvider("keycloak"); !errors.Is(err, oauth.ErrProviderDisabled) {
+		t.Errorf("Expected keycloak to be disabled, got %v", err)
+	}
+
+	// An invalid record leaves the current providers untouched
+	err = service.ApplyProviders([]oauth.ProviderRecord{
+		{Name: "auth0", Config: customConfig("a2")},
+		{Name: "broken", Config: oauth.ProviderConfig{Type: "unknown"}},
+	})
+	if err == nil {
+		t.Fatal("Expected error for invalid provider")
+	}
+	if _, err := service.GetProvider("keycloak"); !errors.Is(err, oauth.ErrProviderDisabled) {
+		t.Errorf("Expected failed apply to keep keycloak, got %v", err)
+	}
+
+	if err := service.ApplyProviders([]oauth.ProviderRecord{{Name: "github", Config: customConfig("x")}}); err == nil {
+		t.Error("Expected error overriding a manually registered provider")
+	}
+}
+
+func TestFileProviderSource_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "providers.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write providers file: %v", err)
+		}
+	}
+	write(`{"okta": {"type": "custom", "client_id": "v1", "redirect_url": "http://localhost/callback",
+		"auth_url": "https://idp.example.com/authorize", "token_url": "https://idp.example.com/token"}}`)
+
+	service, _ := oauth.NewMultiProviderService(oauth.MultiProviderConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 10)
+	source := oauth.NewFileProviderSource(path)
+	if err := service.WatchProviders(ctx, source, 10*time.Millisecond, func(err error) { errs <- err }); err != nil {
+		t.Fatalf("WatchProviders failed: %v", err)
+	}
+	if _, err := service.GetProvider("okta"); err != nil {
+		t.Fatalf("Expected okta after initial load: %v", err)
+	}
+
+	write(`[{"name": "auth0", "config": {"type": "custom", "client_id": "a", "redirect_url": "http://localhost/callback",
+		"auth_url": "https://idp.example.com/authorize", "token_url": "https://idp.example.com/token"}}]`)
+	waitFor(t, func() bool {
+		_, err := service.GetProvider("auth0")
+		return err == nil
+	})
+	if _, err := service.GetProvider("okta"); err == nil {
+		t.Error("Expected okta to be removed after reload")
+	}
+
+	write(`not json`)
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("Expected reload error")
+	}
+	if _, err := service.GetProvider("auth0"); err != nil {
+		t.Errorf("Expected providers to survive a bad reload: %v", err)
+	}
+
+	if _, err := oauth.NewFileProviderSource("providers.yaml").LoadProviders(ctx); !errors.Is(err, oauth.ErrInvalidConfig) {
+		t.Errorf("Expected YAML without decoder to be rejected, got %v", err)
+	}
+}
+
+func TestFileProviderSource_ChangedAndKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	pair, err := krypto.GenerateRSAKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	keyPath := filepath.Join(dir, "keys", "jar.pem")
+	_ = os.MkdirAll(filepath.Dir(keyPath), 0o700)
+	if err := os.WriteFile(keyPath, []byte(pair.PrivateKey), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	path := filepath.Join(dir, "providers.json")
+	if err := os.WriteFile(path, []byte(`{"okta": {"type": "custom", "client_id": "c", "redirect_url": "http://localhost/callback",
+		"auth_url": "https://idp.example.com/authorize", "token_url": "https://idp.example.com/token",
+		"request_object_key_file": "keys/jar.pem", "request_object_key_id": "jar-1"}}`), 0o600); err != nil {
+		t.Fatalf("Failed to write providers file: %v", err)
+	}
+
+	ctx := context.Background()
+	source := oauth.NewFileProviderSource(path)
+	if changed, _ := source.Changed(ctx); !changed {
+		t.Error("Expected an unloaded source to report a change")
+	}
+
+	service, _ := oauth.NewMultiProviderService(oauth.MultiProviderConfig{})
+	if err := service.LoadProviders(ctx, source); err != nil {
+		t.Fatalf("LoadProviders failed: %v", err)
+	}
+	provider, _ := service.GetProvider("okta")
+	authURL, err := provider.(oauth.AuthURLContextProvider).AuthURLContext(ctx, "state", nil)
+	if err != nil || !strings.Contains(authURL, "request=") {
+		t.Errorf("Expected a signed request object from the key file, got %s (%v)", authURL, err)
+	}
+
+	if changed, err := source.Changed(ctx); err != nil || changed {
+		t.Errorf("Expected no change after loading, got %v (%v)", changed, err)
+	}
+	if err := os.WriteFile(keyPath, []byte(pair.PrivateKey+"\n"), 0o600); err != nil {
+		t.Fatalf("Failed to rotate key: %v", err)
+	}
+	if changed, _ := source.Changed(ctx); !changed {
+		t.Error("Expected a rotated key file to be a change")
+	}
+}
+
+func TestTenantProviders_SQLSource(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "providers.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	source, err := oauth.NewSQLProviderSource(db, oauth.SQLProviderSourceConfig{Dialect: "sqlite"})
+	if err != nil {
+		t.Fatalf("Failed to create source: %v", err)
+	}
+	if err := source.CreateSchema(ctx); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	for _, record := range []oauth.ProviderRecord{
+		{TenantID: "acme", Name: "okta", Config: customConfig("acme-okta")},
+		{TenantID: "acme", Name: "azure", Config: customConfig("acme-azure"), Disabled: true},
+		{TenantID: "globex", Name: "okta", Config: customConfig("globex-okta")},
+		{TenantID: "initech", Name: "broken", Config: oauth.ProviderConfig{Type: "unknown"}},
+	} {
+		if err := source.SaveProvider(ctx, record); err != nil {
+			t.Fatalf("SaveProvider failed: %v", err)
+		}
+	}
+
+	tenants, err := oauth.NewTenantProviders(oauth.MultiProviderConfig{SessionTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("Failed to create tenant providers: %v", err)
+	}
+
+	// One tenant's bad config must not block the others
+	if err := tenants.LoadProviders(ctx, source); err == nil {
+		t.Error("Expected error for initech")
+	}
+	if got := tenants.Tenants(); len(got) != 2 || got[0] != "acme" || got[1] != "globex" {
+		t.Fatalf("Unexpected tenants: %v", got)
+	}
+
+	acme, _ := tenants.Service("acme")
+	globex, _ := tenants.Service("globex")
+	authURL, state, err := acme.GetAuthURL(ctx, "okta")
+	if err != nil || !strings.Contains(authURL, "client_id=acme-okta") {
+		t.Fatalf("Unexpected acme auth URL %s: %v", authURL, err)
+	}
+	if _, err := globex.Exchange(ctx, "okta", "code", state); !errors.Is(err, oauth.ErrInvalidState) {
+		t.Errorf("Expected sessions to be isolated per tenant, got %v", err)
+	}
+	if _, err := tenants.GetProvider("acme", "azure"); !errors.Is(err, oauth.ErrProviderDisabled) {
+		t.Errorf("Expected azure disabled, got %v", err)
+	}
+
+	if changed, err := source.Changed(ctx); err != nil || changed {
+		t.Errorf("Expected no change after loading, got %v (%v)", changed, err)
+	}
+	if err := source.DeleteProvider(ctx, "globex", "okta"); err != nil {
+		t.Fatalf("DeleteProvider failed: %v", err)
+	}
+	if err := source.DeleteProvider(ctx, "initech", "broken"); err != nil {
+		t.Fatalf("DeleteProvider failed: %v", err)
+	}
+	if changed, _ := source.Changed(ctx); !changed {
+		t.Error("Expected deleted rows to be a change")
+	}
+	if err := tenants.LoadProviders(ctx, source); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if _, err := tenants.Service("globex"); !errors.Is(err, oauth.ErrTenantNotFound) {
+		t.Errorf("Expected globex to be removed, got %v", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,336 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/database/sqldialect"
+)
+
+// FileProviderSource loads providers from a JSON file, or from a YAML file
+// when Unmarshal is set to a YAML decoder; the package ships no YAML decoder
+// of its own and rejects .yaml and .yml files without one. The file
+// holds either a list of ProviderRecord objects or, like OAUTH_PROVIDERS, an
+// object mapping provider names to configurations. It implements
+// ChangeDetector by comparing the modification time and size of the file and
+// of the request object key files it references.
+type FileProviderSource struct {
+	Path string
+
+	// Unmarshal decodes the file (default encoding/json). YAML files require
+	// a decoder that honours json tags, such as sigs.k8s.io/yaml.Unmarshal.
+	Unmarshal func(data []byte, v interface{}) error
+
+	mu     sync.Mutex
+	stamps map[string]fileStamp // files read by the last successful load
+}
+
+// fileStamp identifies a version of a file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func stampOf(info os.FileInfo) fileStamp {
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+// NewFileProviderSource creates a file provider source
+func NewFileProviderSource(path string) *FileProviderSource {
+	return &FileProviderSource{Path: path}
+}
+
+// LoadProviders reads and decodes the file
+func (f *FileProviderSource) LoadProviders(_ context.Context) ([]ProviderRecord, error) {
+	unmarshal := f.Unmarshal
+	if unmarshal == nil {
+		switch strings.ToLower(filepath.Ext(f.Path)) {
+		case ".yaml", ".yml":
+			return nil, fmt.Errorf("%w: %s needs a YAML Unmarshal function", ErrInvalidConfig, f.Path)
+		}
+		unmarshal = json.Unmarshal
+	}
+
+	// Stat before reading, so a write in between is seen as a change
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider file: %w", err)
+	}
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider file: %w", err)
+	}
+	records, err := f.parse(data, unmarshal)
+	if err != nil {
+		return nil, err
+	}
+
+	stamps := map[string]fileStamp{f.Path: stampOf(info)}
+	dir := filepath.Dir(f.Path)
+	for i := range records {
+		keyFile := records[i].Config.RequestObjectKeyFile
+		if keyFile == "" {
+			continue
+		}
+		if !filepath.IsAbs(keyFile) {
+			keyFile = filepath.Join(dir, keyFile)
+			records[i].Config.RequestObjectKeyFile = keyFile
+		}
+		if info, err := os.Stat(keyFile); err == nil {
+			stamps[keyFile] = stampOf(info)
+		}
+	}
+
+	f.mu.Lock()
+	f.stamps = stamps
+	f.mu.Unlock()
+	return records, nil
+}
+
+// Changed reports whether the file or a key file it references changed since
+// the last successful LoadProviders
+func (f *FileProviderSource) Changed(_ context.Context) (bool, error) {
+	f.mu.Lock()
+	stamps := f.stamps
+	f.mu.Unlock()
+	if stamps == nil {
+		return true, nil
+	}
+
+	for path, stamp := range stamps {
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, fmt.Errorf("failed to check provider file: %w", err)
+		}
+		if stampOf(info) != stamp {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *FileProviderSource) parse(data []byte, unmarshal func([]byte, interface{}) error) ([]ProviderRecord, error) {
+	var records []ProviderRecord
+	if err := unmarshal(data, &records); err == nil {
+		return records, nil
+	}
+
+	configs := make(map[string]ProviderConfig)
+	if err := unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse provider file %s: %w", f.Path, err)
+	}
+
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	records = make([]ProviderRecord, 0, len(configs))
+	for _, name := range names {
+		records = append(records, ProviderRecord{Name: name, Config: configs[name]})
+	}
+	return records, nil
+}
+
+// SQLProviderSourceConfig configures the SQL provider source
+type SQLProviderSourceConfig struct {
+	// Dialect selects placeholder and DDL syntax: postgres, mysql or sqlite
+	Dialect string
+
+	// Table name (default oauth_providers)
+	Table string
+}
+
+// SQLProviderSource stores provider records in a database table, one row per
+// tenant and provider with the configuration as JSON. Client secrets are
+// stored as given; use database encryption at rest where required.
+type SQLProviderSource struct {
+	db      *sql.DB
+	dialect string
+	table   string
+
+	mu            sync.Mutex
+	loaded        bool
+	loadedVersion string
+}
+
+var sqlTablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// NewSQLProviderSource creates a provider source backed by a SQL database,
+// e.g. database.DB(). Call CreateSchema once (or run the equivalent
+// migration) before use.
+func NewSQLProviderSource(db *sql.DB, cfg SQLProviderSourceConfig) (*SQLProviderSource, error) {
+	if db == nil {
+		return nil, fmt.Errorf("%w: database is required", ErrInvalidConfig)
+	}
+
+	dialect, err := sqlDialect(cfg.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	table := cfg.Table
+	if table == "" {
+		table = "oauth_providers"
+	}
+	if !sqlTablePattern.MatchString(table) {
+		return nil, fmt.Errorf("%w: invalid table name %q", ErrInvalidConfig, table)
+	}
+
+	return &SQLProviderSource{db: db, dialect: dialect, table: table}, nil
+}
+
+// CreateSchema creates the providers table if it does not exist
+func (s *SQLProviderSource) CreateSchema(ctx context.Context) error {
+	timestamp := "TIMESTAMP"
+	switch s.dialect {
+	case "postgres":
+		timestamp = "TIMESTAMPTZ"
+	case "mysql":
+		timestamp = "DATETIME(6)"
+	}
+
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	tenant_id VARCHAR(255) NOT NULL DEFAULT '',
+	name VARCHAR(64) NOT NULL,
+	disabled BOOLEAN NOT NULL DEFAULT FALSE,
+	config TEXT NOT NULL,
+	updated_at %s NOT NULL,
+	PRIMARY KEY (tenant_id, name)
+)`, s.table, timestamp))
+	if err != nil {
+		return fmt.Errorf("failed to create provider schema: %w", err)
+	}
+	return nil
+}
+
+// LoadProviders returns all provider records ordered by tenant and name
+func (s *SQLProviderSource) LoadProviders(ctx context.Context) ([]ProviderRecord, error) {
+	// Read the version first, so changes made during the load are reloaded
+	version, err := s.version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT tenant_id, name, disabled, config FROM %s ORDER BY tenant_id, name", s.table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query providers: %w", err)
+	}
+	defer rows.Close()
+
+	var records []ProviderRecord
+	for rows.Next() {
+		var record ProviderRecord
+		var config string
+		if err := rows.Scan(&record.TenantID, &record.Name, &record.Disabled, &config); err != nil {
+			return nil, fmt.Errorf("failed to scan provider: %w", err)
+		}
+		if err := json.Unmarshal([]byte(config), &record.Config); err != nil {
+			return nil, fmt.Errorf("invalid config for provider %s/%s: %w", record.TenantID, record.Name, err)
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.loaded, s.loadedVersion = true, version
+	s.mu.Unlock()
+	return records, nil
+}
+
+// Changed reports whether rows were added, updated or deleted since the last
+// LoadProviders, by comparing the row count and latest updated_at
+func (s *SQLProviderSource) Changed(ctx context.Context) (bool, error) {
+	version, err := s.version(ctx)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.loaded || version != s.loadedVersion, nil
+}
+
+// version summarizes the table contents for change detection
+func (s *SQLProviderSource) version(ctx context.Context) (string, error) {
+	var count int64
+	var latest interface{}
+	if err := s.db.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT COUNT(*), MAX(updated_at) FROM %s", s.table)).Scan(&count, &latest); err != nil {
+		return "", fmt.Errorf("failed to check providers: %w", err)
+	}
+	return fmt.Sprintf("%d/%v", count, latest), nil
+}
+
+// SaveProvider inserts or replaces a provider record
+func (s *SQLProviderSource) SaveProvider(ctx context.Context, record ProviderRecord) error {
+	if record.Name == "" {
+		return fmt.Errorf("%w: provider name cannot be empty", ErrInvalidConfig)
+	}
+	config, err := json.Marshal(record.Config)
+	if err != nil {
+		return fmt.Errorf("failed to encode provider config: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Delete and insert instead of dialect-specific upserts
+	if _, err := tx.ExecContext(ctx, s.rebind(fmt.Sprintf(
+		"DELETE FROM %s WHERE tenant_id = ? AND name = ?", s.table)),
+		record.TenantID, record.Name); err != nil {
+		return fmt.Errorf("failed to save provider: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(fmt.Sprintf(
+		"INSERT INTO %s (tenant_id, name, disabled, config, updated_at) VALUES (?, ?, ?, ?, ?)", s.table)),
+		record.TenantID, record.Name, record.Disabled, string(config), time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to save provider: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// DeleteProvider removes a provider record
+func (s *SQLProviderSource) DeleteProvider(ctx context.Context, tenantID, name string) error {
+	res, err := s.db.ExecContext(ctx, s.rebind(fmt.Sprintf(
+		"DELETE FROM %s WHERE tenant_id = ? AND name = ?", s.table)), tenantID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete provider: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %s", ErrProviderNotFound, name)
+	}
+	return nil
+}
+
+// rebind converts ? placeholders to $n for PostgreSQL
+func (s *SQLProviderSource) rebind(query string) string {
+	return sqldialect.Rebind(s.dialect, query)
+}
+
+// sqlDialect normalizes a dialect name to postgres, mysql or sqlite
+func sqlDialect(name string) (string, error) {
+	dialect, err := sqldialect.Of(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: unsupported dialect %q", ErrInvalidConfig, name)
+	}
+	return dialect, nil
+}
@@ -41,6 +41,17 @@ func NewTwitterProvider(config ProviderConfig) (Provider, error) {
 	return provider, nil
 }
 
+func NewMicrosoftProvider(config ProviderConfig) (Provider, error) {
+	provider, err := NewMicrosoft(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := provider.ValidateConfig(); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
 func NewCustomProvider(config ProviderConfig) (Provider, error) {
 	// Placeholder - will be implemented in providers/custom.go
 	return nil, fmt.Errorf("custom provider not yet implemented")
@@ -41,6 +41,10 @@ type RateLimiterConfig struct {
 	BurstSize       int           // Maximum burst size
 	MaxEntries      int           // Maximum number of tracked entries
 	CleanupInterval time.Duration // Interval for cleaning up old entries
+
+	// Distributed limiters only (RedisRateLimiter, CacheRateLimiter)
+	Algorithm RateLimitAlgorithm // token_bucket (default) or gcra
+	KeyPrefix string             // Storage key prefix (default "ratelimit:")
 }
 
 // bucket represents a token bucket for a single key
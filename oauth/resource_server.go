@@ -0,0 +1,458 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Resource server errors (RFC 6750 section 3.1)
+var (
+	// ErrMissingToken indicates the request carries no bearer token
+	ErrMissingToken = errors.New("bearer token missing")
+
+	// ErrInvalidToken indicates the token is expired, revoked, malformed or otherwise invalid
+	ErrInvalidToken = errors.New("invalid access token")
+
+	// ErrInsufficientScope indicates the token lacks a scope required by the route
+	ErrInsufficientScope = errors.New("insufficient scope")
+)
+
+const principalContextKey contextKey = "principal"
+
+// Principal is the authenticated caller behind an access token
+type Principal struct {
+	Subject   string
+	ClientID  string
+	Username  string
+	Issuer    string
+	Audience  []string
+	Scopes    []string
+	ExpiresAt time.Time
+
+	// Claims holds the JWT claims or introspection response members
+	Claims map[string]interface{}
+}
+
+// HasScope reports whether the principal was granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// HasScopes reports whether the principal was granted every scope
+func (p *Principal) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !p.HasScope(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// Confirmation returns the cnf.jkt thumbprint a principal's token is bound to
+func (p *Principal) Confirmation() string {
+	cnf, _ := p.Claims["cnf"].(map[string]interface{})
+	jkt, _ := cnf["jkt"].(string)
+	return jkt
+}
+
+// PrincipalFromContext returns the principal stored by ResourceServer, or nil
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalContextKey).(*Principal)
+	return p
+}
+
+// ContextWithPrincipal returns a context carrying the principal
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey, p)
+}
+
+// ResourceServerConfig configures bearer token validation for APIs
+type ResourceServerConfig struct {
+	// Introspector validates opaque tokens (RFC 7662), e.g. a *CustomProvider
+	Introspector Introspector
+
+	// KeySet verifies JWT access tokens locally. When set, tokens that look
+	// like JWTs are verified with it and never sent to the Introspector.
+	KeySet KeySet
+
+	// Issuer and Audience are required to match when set, for JWTs and
+	// introspection responses alike; responses that omit them are rejected
+	Issuer   string
+	Audience string
+
+	// Algorithms accepted for local JWT verification (default RS256, ES256)
+	Algorithms []string
+
+	// Leeway tolerates clock skew when checking exp/nbf/iat
+	Leeway time.Duration
+
+	// CacheTTL caches positive validation results. Zero uses 30s, negative disables caching.
+	// Entries never outlive the token itself.
+	CacheTTL time.Duration
+
+	// Realm is reported in WWW-Authenticate challenges
+	Realm string
+
+	// DPoP accepts sender-constrained tokens (RFC 9449). Tokens bound with
+	// cnf.jkt are only accepted with a matching proof, never as bearer tokens.
+	DPoP *DPoPVerifier
+}
+
+// ResourceServer is middleware for APIs that accept OAuth 2.0 bearer tokens
+//
+// Example:
+//
+//	rs, err := oauth.NewResourceServer(oauth.ResourceServerConfig{
+//	    KeySet:   oauth.NewRemoteKeySet("https://auth.example.com/.well-known/jwks.json", nil, 0),
+//	    Issuer:   "https://auth.example.com",
+//	    Audience: "orders-api",
+//	})
+//
+//	mux.Handle("/orders", rs.RequireScopes("orders:read")(ordersHandler))
+type ResourceServer struct {
+	config ResourceServerConfig
+	parser *jwt.Parser
+
+	mu    sync.RWMutex
+	cache map[string]cachedPrincipal
+}
+
+type cachedPrincipal struct {
+	principal *Principal
+	expiresAt time.Time
+}
+
+// maxCachedPrincipals bounds the validation cache
+const maxCachedPrincipals = 10000
+
+// NewResourceServer creates a new resource server middleware
+func NewResourceServer(cfg ResourceServerConfig) (*ResourceServer, error) {
+	if cfg.Introspector == nil && cfg.KeySet == nil {
+		return nil, fmt.Errorf("%w: introspector or key set required", ErrInvalidConfig)
+	}
+	if len(cfg.Algorithms) == 0 {
+		cfg.Algorithms = []string{"RS256", "ES256"}
+	}
+	if cfg.CacheTTL == 0 {
+		cfg.CacheTTL = 30 * time.Second
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(cfg.Algorithms),
+		jwt.WithLeeway(cfg.Leeway),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+
+	return &ResourceServer{
+		config: cfg,
+		parser: jwt.NewParser(opts...),
+		cache:  make(map[string]cachedPrincipal),
+	}, nil
+}
+
+// Authenticate requires a valid bearer token and stores the principal in the request context
+func (rs *ResourceServer) Authenticate(next http.Handler) http.Handler {
+	return rs.RequireScopes()(next)
+}
+
+// RequireScopes returns middleware that requires a valid bearer token granting every scope
+func (rs *ResourceServer) RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, scheme := authorizationToken(r)
+			if token == "" || (scheme == TokenTypeDPoP && rs.config.DPoP == nil) {
+				rs.challenge(w, ErrMissingToken, scopes)
+				return
+			}
+
+			principal, err := rs.Validate(r.Context(), token)
+			if err != nil {
+				rs.challenge(w, err, scopes)
+				return
+			}
+
+			if err := rs.checkBinding(r, token, scheme, principal); err != nil {
+				rs.challenge(w, err, scopes)
+				return
+			}
+			if scheme == TokenTypeDPoP && rs.config.DPoP.config.RequireNonce {
+				// Hand out the current nonce so clients never hit a stale one
+				w.Header().Set("DPoP-Nonce", rs.config.DPoP.Nonce())
+			}
+
+			if !principal.HasScopes(scopes...) {
+				rs.challenge(w, ErrInsufficientScope, scopes)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// Validate checks a bearer token and returns its principal.
+// Failures wrap ErrInvalidToken; infrastructure errors (e.g. introspection
+// endpoint down) are returned unwrapped.
+func (rs *ResourceServer) Validate(ctx context.Context, token string) (*Principal, error) {
+	key := cacheKey(token)
+	if p := rs.cached(key); p != nil {
+		return p, nil
+	}
+
+	var (
+		principal *Principal
+		err       error
+	)
+	if rs.config.KeySet != nil && strings.Count(token, ".") == 2 {
+		principal, err = rs.verifyJWT(ctx, token)
+	} else if rs.config.Introspector != nil {
+		principal, err = rs.introspect(ctx, token)
+	} else {
+		err = fmt.Errorf("%w: token is not a JWT", ErrInvalidToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rs.store(key, principal)
+	return principal, nil
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer" header
+func BearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[7:])
+}
+
+// authorizationToken extracts the token and scheme (Bearer or DPoP)
+func authorizationToken(r *http.Request) (string, string) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 5 && strings.EqualFold(auth[:5], "DPoP ") {
+		return strings.TrimSpace(auth[5:]), TokenTypeDPoP
+	}
+	return BearerToken(r), "Bearer"
+}
+
+// checkBinding enforces DPoP sender constraints (RFC 9449 section 7)
+func (rs *ResourceServer) checkBinding(r *http.Request, token, scheme string, p *Principal) error {
+	jkt := p.Confirmation()
+
+	if scheme != TokenTypeDPoP {
+		if jkt != "" {
+			return fmt.Errorf("%w: DPoP-bound token presented as bearer token", ErrInvalidToken)
+		}
+		if rs.config.DPoP != nil && rs.config.DPoP.config.Required {
+			return fmt.Errorf("%w: DPoP-bound token required", ErrInvalidToken)
+		}
+		return nil
+	}
+
+	proof, err := rs.config.DPoP.Verify(r, token)
+	if err != nil {
+		return err
+	}
+	if jkt == "" || subtle.ConstantTimeCompare([]byte(jkt), []byte(proof.Thumbprint)) != 1 {
+		return fmt.Errorf("%w: token is not bound to the DPoP key", ErrInvalidToken)
+	}
+	return nil
+}
+
+func (rs *ResourceServer) verifyJWT(ctx context.Context, token string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := rs.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return rs.config.KeySet.PublicKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	p := &Principal{Claims: claims}
+	p.Subject, _ = claims["sub"].(string)
+	p.Issuer, _ = claims["iss"].(string)
+	p.Username, _ = claims["username"].(string)
+	p.ClientID, _ = claims["client_id"].(string)
+	if p.ClientID == "" {
+		p.ClientID, _ = claims["azp"].(string)
+	}
+	if aud, err := claims.GetAudience(); err == nil {
+		p.Audience = aud
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		p.ExpiresAt = exp.Time
+	}
+	p.Scopes = scopesFromClaims(claims)
+
+	return p, nil
+}
+
+func (rs *ResourceServer) introspect(ctx context.Context, token string) (*Principal, error) {
+	resp, err := rs.config.Introspector.Introspect(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Active {
+		return nil, fmt.Errorf("%w: token is not active", ErrInvalidToken)
+	}
+
+	now := time.Now()
+	if exp := resp.Expiry(); !exp.IsZero() && now.After(exp.Add(rs.config.Leeway)) {
+		return nil, fmt.Errorf("%w: token is expired", ErrInvalidToken)
+	}
+	if resp.NotBefore != 0 && now.Add(rs.config.Leeway).Before(time.Unix(resp.NotBefore, 0)) {
+		return nil, fmt.Errorf("%w: token is not yet valid", ErrInvalidToken)
+	}
+	// A configured issuer or audience must be present in the response, so
+	// tokens of other servers sharing the introspection endpoint are rejected
+	if rs.config.Issuer != "" && resp.Issuer != rs.config.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, resp.Issuer)
+	}
+	if rs.config.Audience != "" && !slices.Contains(resp.Audience, rs.config.Audience) {
+		return nil, fmt.Errorf("%w: token not intended for this audience", ErrInvalidToken)
+	}
+
+	return &Principal{
+		Subject:   resp.Subject,
+		ClientID:  resp.ClientID,
+		Username:  resp.Username,
+		Issuer:    resp.Issuer,
+		Audience:  resp.Audience,
+		Scopes:    resp.Scopes(),
+		ExpiresAt: resp.Expiry(),
+		Claims:    resp.Extra,
+	}, nil
+}
+
+// challenge writes an RFC 6750 (and RFC 9449 for DPoP) error response
+func (rs *ResourceServer) challenge(w http.ResponseWriter, err error, scopes []string) {
+	params := []string{}
+	if rs.config.Realm != "" {
+		params = append(params, fmt.Sprintf("realm=%q", rs.config.Realm))
+	}
+
+	status := http.StatusUnauthorized
+	dpopError := false
+	switch {
+	case errors.Is(err, ErrMissingToken):
+		// No error code when the request lacks authentication (RFC 6750 section 3.1)
+	case errors.Is(err, ErrInsufficientScope):
+		status = http.StatusForbidden
+		params = append(params, `error="insufficient_scope"`, fmt.Sprintf("scope=%q", strings.Join(scopes, " ")))
+	case errors.Is(err, ErrUseDPoPNonce):
+		dpopError = true
+		params = append(params, `error="use_dpop_nonce"`)
+		w.Header().Set("DPoP-Nonce", rs.config.DPoP.Nonce())
+	case errors.Is(err, ErrInvalidDPoPProof):
+		dpopError = true
+		params = append(params, `error="invalid_dpop_proof"`)
+	case errors.Is(err, ErrInvalidToken):
+		params = append(params, `error="invalid_token"`)
+	default:
+		// Validation could not be completed; do not blame the token
+		status = http.StatusServiceUnavailable
+	}
+
+	if !dpopError && (rs.config.DPoP == nil || !rs.config.DPoP.config.Required) {
+		w.Header().Add("WWW-Authenticate", authChallenge("Bearer", params))
+	}
+	if rs.config.DPoP != nil {
+		algs := fmt.Sprintf("algs=%q", strings.Join(rs.config.DPoP.config.Algorithms, " "))
+		w.Header().Add("WWW-Authenticate", authChallenge("DPoP", append(params, algs)))
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+func authChallenge(scheme string, params []string) string {
+	if len(params) == 0 {
+		return scheme
+	}
+	return scheme + " " + strings.Join(params, ", ")
+}
+
+func (rs *ResourceServer) cached(key string) *Principal {
+	if rs.config.CacheTTL < 0 {
+		return nil
+	}
+
+	rs.mu.RLock()
+	entry, ok := rs.cache[key]
+	rs.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil
+	}
+	return entry.principal
+}
+
+func (rs *ResourceServer) store(key string, p *Principal) {
+	if rs.config.CacheTTL < 0 {
+		return
+	}
+
+	expiresAt := time.Now().Add(rs.config.CacheTTL)
+	if !p.ExpiresAt.IsZero() && p.ExpiresAt.Before(expiresAt) {
+		expiresAt = p.ExpiresAt
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if len(rs.cache) >= maxCachedPrincipals {
+		now := time.Now()
+		for k, entry := range rs.cache {
+			if now.After(entry.expiresAt) {
+				delete(rs.cache, k)
+			}
+		}
+		if len(rs.cache) >= maxCachedPrincipals {
+			rs.cache = make(map[string]cachedPrincipal)
+		}
+	}
+	rs.cache[key] = cachedPrincipal{principal: p, expiresAt: expiresAt}
+}
+
+// cacheKey hashes tokens so raw credentials are never kept as map keys
+func cacheKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// scopesFromClaims reads "scope" (space separated) or "scp" (string or array)
+func scopesFromClaims(claims jwt.MapClaims) []string {
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	switch scp := claims["scp"].(type) {
+	case string:
+		return strings.Fields(scp)
+	case []interface{}:
+		scopes := make([]string, 0, len(scp))
+		for _, s := range scp {
+			if str, ok := s.(string); ok {
+				scopes = append(scopes, str)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
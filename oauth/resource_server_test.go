@@ -0,0 +1,323 @@
+package oauth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/gobeaver/beaver-kit/oauth"
+)
+
+func newIntrospectionProvider(t *testing.T, handler http.HandlerFunc) *oauth.CustomProvider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	provider, err := oauth.NewCustom(oauth.ProviderConfig{
+		ClientID:         "api",
+		ClientSecret:     "api-secret",
+		RedirectURL:      "http://localhost/callback",
+		AuthURL:          server.URL + "/authorize",
+		TokenURL:         server.URL + "/token",
+		RevokeURL:        server.URL + "/revoke",
+		IntrospectionURL: server.URL + "/introspect",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	return provider
+}
+
+func TestCustomProvider_Introspect(t *testing.T) {
+	provider := newIntrospectionProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "api" || pass != "api-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("token") != "good" {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"active": false})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"active":    true,
+			"scope":     "orders:read orders:write",
+			"sub":       "user-1",
+			"client_id": "web",
+			"aud":       "orders-api",
+			"exp":       time.Now().Add(time.Hour).Unix(),
+			"tenant":    "acme",
+		})
+	})
+
+	ctx := context.Background()
+	resp, err := provider.Introspect(ctx, "good")
+	if err != nil {
+		t.Fatalf("Introspect failed: %v", err)
+	}
+	if !resp.Active || resp.Subject != "user-1" || len(resp.Scopes()) != 2 {
+		t.Errorf("Unexpected introspection response: %+v", resp)
+	}
+	if resp.Audience[0] != "orders-api" || resp.Extra["tenant"] != "acme" {
+		t.Errorf("Expected audience and extra members, got %+v", resp)
+	}
+
+	resp, err = provider.Introspect(ctx, "bad")
+	if err != nil {
+		t.Fatalf("Introspect failed: %v", err)
+	}
+	if resp.Active {
+		t.Error("Expected inactive token")
+	}
+}
+
+func TestCustomProvider_RevokeTokenWithHint(t *testing.T) {
+	var hint string
+	provider := newIntrospectionProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		hint = r.FormValue("token_type_hint")
+		if r.FormValue("token") == "unavailable" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ctx := context.Background()
+	if err := provider.RevokeTokenWithHint(ctx, "refresh-1", "refresh_token"); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if hint != "refresh_token" {
+		t.Errorf("Expected token_type_hint=refresh_token, got %q", hint)
+	}
+
+	if err := provider.RevokeToken(ctx, "unavailable"); !errors.Is(err, oauth.ErrTemporarilyUnavailable) {
+		t.Errorf("Expected ErrTemporarilyUnavailable, got %v", err)
+	}
+}
+
+func TestResourceServer_Introspection(t *testing.T) {
+	var calls int32
+	provider := newIntrospectionProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		_ = r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": r.FormValue("token") == "good",
+			"scope":  "orders:read",
+			"sub":    "user-1",
+		})
+	})
+
+	rs, err := oauth.NewResourceServer(oauth.ResourceServerConfig{
+		Introspector: provider,
+		Realm:        "orders",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create resource server: %v", err)
+	}
+
+	handler := rs.RequireScopes("orders:read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(oauth.PrincipalFromContext(r.Context()).Subject))
+	}))
+
+	do := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/orders", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 3; i++ {
+		rec := do("good")
+		if rec.Code != http.StatusOK || rec.Body.String() != "user-1" {
+			t.Fatalf("Unexpected response: %d %q", rec.Code, rec.Body.String())
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Expected positive result to be cached (1 call), got %d", got)
+	}
+
+	rec := do("bad")
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Header().Get("WWW-Authenticate"), `error="invalid_token"`) {
+		t.Errorf("Expected invalid_token challenge, got %d %q", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+
+	rec = do("")
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != `Bearer realm="orders"` {
+		t.Errorf("Expected bare challenge, got %d %q", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+
+	// Inactive results are not cached
+	do("bad")
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("Expected negative results to be re-checked, got %d calls", got)
+	}
+}
+
+func TestResourceServer_IntrospectionIssuerAudience(t *testing.T) {
+	provider := newIntrospectionProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		resp := map[string]interface{}{"active": true, "sub": "user-1"}
+		switch r.FormValue("token") {
+		case "ours":
+			resp["iss"], resp["aud"] = "https://auth.example.com", "orders-api"
+		case "no-iss":
+			resp["aud"] = "orders-api"
+		case "no-aud":
+			resp["iss"] = "https://auth.example.com"
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+
+	rs, err := oauth.NewResourceServer(oauth.ResourceServerConfig{
+		Introspector: provider,
+		Issuer:       "https://auth.example.com",
+		Audience:     "orders-api",
+		CacheTTL:     -1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create resource server: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := rs.Validate(ctx, "ours"); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	for _, token := range []string{"no-iss", "no-aud"} {
+		if _, err := rs.Validate(ctx, token); !errors.Is(err, oauth.ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", token, err)
+		}
+	}
+}
+
+func TestRemoteKeySet_RefreshStampede(t *testing.T) {
+	var fetches int32
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		time.Sleep(50 * time.Millisecond)
+		_ = json.NewEncoder(w).Encode(oauth.JWKSet{})
+	}))
+	defer jwks.Close()
+
+	keys := oauth.NewRemoteKeySet(jwks.URL, nil, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := keys.PublicKey(context.Background(), "unknown"); !errors.Is(err, oauth.ErrKeyNotFound) {
+				t.Errorf("Expected ErrKeyNotFound, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Unknown key IDs within the minimum refresh interval do not refetch
+	_, _ = keys.PublicKey(context.Background(), "another")
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Errorf("Expected a single JWKS fetch, got %d", got)
+	}
+}
+
+func TestResourceServer_LocalJWT(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signer, err := oauth.NewJWTSignerFromKey(key, "k1")
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	jwk, _ := oauth.NewJWK(&key.PublicKey, "k1")
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(oauth.JWKSet{Keys: []oauth.JWK{*jwk}})
+	}))
+	defer jwks.Close()
+
+	rs, err := oauth.NewResourceServer(oauth.ResourceServerConfig{
+		KeySet:   oauth.NewRemoteKeySet(jwks.URL, nil, 0),
+		Issuer:   "https://auth.example.com",
+		Audience: "orders-api",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create resource server: %v", err)
+	}
+
+	issue := func(claims jwt.MapClaims) string {
+		base := jwt.MapClaims{
+			"iss":   "https://auth.example.com",
+			"aud":   "orders-api",
+			"sub":   "user-1",
+			"scope": "orders:read",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range claims {
+			base[k] = v
+		}
+		token, err := signer.Sign(base)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return token
+	}
+
+	ctx := context.Background()
+	principal, err := rs.Validate(ctx, issue(nil))
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if principal.Subject != "user-1" || !principal.HasScope("orders:read") {
+		t.Errorf("Unexpected principal: %+v", principal)
+	}
+
+	tests := map[string]jwt.MapClaims{
+		"expired":        {"exp": time.Now().Add(-time.Minute).Unix()},
+		"wrong audience": {"aud": "billing-api"},
+		"wrong issuer":   {"iss": "https://evil.example.com"},
+	}
+	for name, claims := range tests {
+		if _, err := rs.Validate(ctx, issue(claims)); !errors.Is(err, oauth.ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+
+	// Scope enforcement
+	handler := rs.RequireScopes("orders:write")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest("POST", "/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+issue(nil))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403, got %d", rec.Code)
+	}
+	if challenge := rec.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, `error="insufficient_scope"`) || !strings.Contains(challenge, `scope="orders:write"`) {
+		t.Errorf("Unexpected challenge: %q", challenge)
+	}
+}
+
+func TestNewResourceServer_RequiresValidator(t *testing.T) {
+	if _, err := oauth.NewResourceServer(oauth.ResourceServerConfig{}); !errors.Is(err, oauth.ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig, got %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package saml
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/oauth"
+)
+
+// maxMetadataSize bounds fetched metadata documents
+const maxMetadataSize = 10 << 20
+
+// IDPMetadata is the subset of IdP metadata the service provider needs
+type IDPMetadata struct {
+	EntityID string
+
+	// SSOURL is the HTTP-Redirect SingleSignOnService location
+	SSOURL string
+
+	// SigningCertificates verify response and assertion signatures
+	SigningCertificates []*x509.Certificate
+
+	NameIDFormats           []string
+	WantAuthnRequestsSigned bool
+	ValidUntil              time.Time
+}
+
+type entitiesDescriptor struct {
+	XMLName           xml.Name           `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntitiesDescriptor"`
+	EntityDescriptors []entityDescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+}
+
+type entityDescriptor struct {
+	XMLName           xml.Name           `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID          string             `xml:"entityID,attr"`
+	ValidUntil        string             `xml:"validUntil,attr,omitempty"`
+	IDPSSODescriptors []idpSSODescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata IDPSSODescriptor"`
+	SPSSODescriptors  []spSSODescriptor  `xml:"urn:oasis:names:tc:SAML:2.0:metadata SPSSODescriptor"`
+}
+
+type idpSSODescriptor struct {
+	WantAuthnRequestsSigned    bool            `xml:"WantAuthnRequestsSigned,attr"`
+	ProtocolSupportEnumeration string          `xml:"protocolSupportEnumeration,attr"`
+	KeyDescriptors             []keyDescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata KeyDescriptor"`
+	NameIDFormats              []string        `xml:"urn:oasis:names:tc:SAML:2.0:metadata NameIDFormat"`
+	SingleSignOnServices       []endpoint      `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleSignOnService"`
+}
+
+type spSSODescriptor struct {
+	AuthnRequestsSigned        bool              `xml:"AuthnRequestsSigned,attr"`
+	WantAssertionsSigned       bool              `xml:"WantAssertionsSigned,attr"`
+	ProtocolSupportEnumeration string            `xml:"protocolSupportEnumeration,attr"`
+	KeyDescriptors             []keyDescriptor   `xml:"urn:oasis:names:tc:SAML:2.0:metadata KeyDescriptor"`
+	NameIDFormats              []string          `xml:"urn:oasis:names:tc:SAML:2.0:metadata NameIDFormat"`
+	AssertionConsumerServices  []indexedEndpoint `xml:"urn:oasis:names:tc:SAML:2.0:metadata AssertionConsumerService"`
+}
+
+type endpoint struct {
+	Binding  string `xml:"Binding,attr"`
+	Location string `xml:"Location,attr"`
+}
+
+type indexedEndpoint struct {
+	Binding   string `xml:"Binding,attr"`
+	Location  string `xml:"Location,attr"`
+	Index     int    `xml:"index,attr"`
+	IsDefault bool   `xml:"isDefault,attr,omitempty"`
+}
+
+type keyDescriptor struct {
+	Use     string  `xml:"use,attr,omitempty"`
+	KeyInfo keyInfo `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo"`
+}
+
+type keyInfo struct {
+	X509Data x509Data `xml:"http://www.w3.org/2000/09/xmldsig# X509Data"`
+}
+
+type x509Data struct {
+	Certificates []string `xml:"http://www.w3.org/2000/09/xmldsig# X509Certificate"`
+}
+
+// ParseIDPMetadata parses an EntityDescriptor, or the first IdP of an
+// EntitiesDescriptor. Metadata signatures are not checked, so load it from a
+// trusted location (HTTPS or a local file).
+func ParseIDPMetadata(data []byte) (*IDPMetadata, error) {
+	var entity entityDescriptor
+	if err := xml.Unmarshal(data, &entity); err != nil {
+		var entities entitiesDescriptor
+		if xml.Unmarshal(data, &entities) != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMetadata, err)
+		}
+		found := false
+		for _, e := range entities.EntityDescriptors {
+			if len(e.IDPSSODescriptors) > 0 {
+				entity, found = e, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: no IdP entity found", ErrInvalidMetadata)
+		}
+	}
+
+	if entity.EntityID == "" || len(entity.IDPSSODescriptors) == 0 {
+		return nil, fmt.Errorf("%w: missing entityID or IDPSSODescriptor", ErrInvalidMetadata)
+	}
+	descriptor := entity.IDPSSODescriptors[0]
+
+	meta := &IDPMetadata{
+		EntityID:                entity.EntityID,
+		NameIDFormats:           descriptor.NameIDFormats,
+		WantAuthnRequestsSigned: descriptor.WantAuthnRequestsSigned,
+	}
+
+	if entity.ValidUntil != "" {
+		validUntil, err := parseTime(entity.ValidUntil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid validUntil", ErrInvalidMetadata)
+		}
+		if time.Now().After(validUntil) {
+			return nil, fmt.Errorf("%w: metadata expired at %s", ErrInvalidMetadata, validUntil)
+		}
+		meta.ValidUntil = validUntil
+	}
+
+	for _, sso := range descriptor.SingleSignOnServices {
+		if sso.Binding == BindingHTTPRedirect {
+			meta.SSOURL = sso.Location
+			break
+		}
+	}
+	if meta.SSOURL == "" {
+		return nil, fmt.Errorf("%w: no HTTP-Redirect SingleSignOnService", ErrInvalidMetadata)
+	}
+
+	for _, kd := range descriptor.KeyDescriptors {
+		if kd.Use != "" && kd.Use != "signing" {
+			continue
+		}
+		for _, encoded := range kd.KeyInfo.X509Data.Certificates {
+			der, err := decodeBase64(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid certificate encoding", ErrInvalidMetadata)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidMetadata, err)
+			}
+			meta.SigningCertificates = append(meta.SigningCertificates, cert)
+		}
+	}
+	if len(meta.SigningCertificates) == 0 {
+		return nil, fmt.Errorf("%w: no signing certificate", ErrInvalidMetadata)
+	}
+
+	return meta, nil
+}
+
+// FetchIDPMetadata downloads and parses IdP metadata. A nil client uses
+// http.DefaultClient.
+func FetchIDPMetadata(ctx context.Context, client oauth.HTTPClient, metadataURL string) (*IDPMetadata, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metadata request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", oauth.ErrNetworkError, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: metadata endpoint returned status %d", ErrInvalidMetadata, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", oauth.ErrNetworkError, err)
+	}
+	return ParseIDPMetadata(data)
+}
+
+// parseTime parses an xs:dateTime value
+func parseTime(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, value)
+}
@@ -0,0 +1,308 @@
+package saml
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/krypto"
+	"github.com/gobeaver/beaver-kit/oauth"
+)
+
+// TokenTypeSAML is the token type of handles returned by Provider.Exchange
+const TokenTypeSAML = "SAML"
+
+// defaultSessionLifetime applies when the IdP sets no SessionNotOnOrAfter
+const defaultSessionLifetime = time.Hour
+
+// AttributeMapping lists, per oauth.UserInfo field, the attribute names (or
+// friendly names) to read; the first present attribute wins
+type AttributeMapping struct {
+	ID        []string
+	Email     []string
+	Name      []string
+	FirstName []string
+	LastName  []string
+	Picture   []string
+	Locale    []string
+}
+
+// DefaultAttributeMapping covers common LDAP, OID and Microsoft claim names
+var DefaultAttributeMapping = AttributeMapping{
+	Email: []string{
+		"email", "mail", "emailAddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	},
+	Name: []string{
+		"displayName", "name",
+		"urn:oid:2.16.840.1.113730.3.1.241",
+		"http://schemas.microsoft.com/identity/claims/displayname",
+	},
+	FirstName: []string{
+		"givenName", "firstName", "first_name",
+		"urn:oid:2.5.4.42",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname",
+	},
+	LastName: []string{
+		"sn", "surname", "lastName", "last_name",
+		"urn:oid:2.5.4.4",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname",
+	},
+	Locale: []string{"preferredLanguage", "locale", "urn:oid:2.16.840.1.113730.3.1.39"},
+}
+
+// withDefaults fills unset fields from DefaultAttributeMapping. ID has no
+// default: the NameID is used unless an ID attribute is configured.
+func (m AttributeMapping) withDefaults() AttributeMapping {
+	fill := func(field *[]string, defaults []string) {
+		if len(*field) == 0 {
+			*field = defaults
+		}
+	}
+	fill(&m.Email, DefaultAttributeMapping.Email)
+	fill(&m.Name, DefaultAttributeMapping.Name)
+	fill(&m.FirstName, DefaultAttributeMapping.FirstName)
+	fill(&m.LastName, DefaultAttributeMapping.LastName)
+	fill(&m.Picture, DefaultAttributeMapping.Picture)
+	fill(&m.Locale, DefaultAttributeMapping.Locale)
+	return m
+}
+
+// UserInfo maps an assertion to oauth.UserInfo
+func (sp *ServiceProvider) UserInfo(assertion *Assertion) *oauth.UserInfo {
+	m := sp.config.Attributes
+	first := func(names []string) string {
+		for _, name := range names {
+			if value := assertion.Attribute(name); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	info := &oauth.UserInfo{
+		ID:        first(m.ID),
+		Email:     first(m.Email),
+		Name:      first(m.Name),
+		FirstName: first(m.FirstName),
+		LastName:  first(m.LastName),
+		Picture:   first(m.Picture),
+		Locale:    first(m.Locale),
+		Raw: map[string]interface{}{
+			"name_id":        assertion.NameID,
+			"name_id_format": assertion.NameIDFormat,
+			"session_index":  assertion.SessionIndex,
+			"issuer":         assertion.Issuer,
+			"attributes":     assertion.Attributes,
+		},
+	}
+	if info.ID == "" {
+		info.ID = assertion.NameID
+	}
+	if info.Email == "" && assertion.NameIDFormat == NameIDFormatEmailAddress {
+		info.Email = assertion.NameID
+	}
+	if info.Name == "" {
+		info.Name = strings.TrimSpace(info.FirstName + " " + info.LastName)
+	}
+	info.EmailVerified = sp.config.TrustEmail && info.Email != ""
+
+	return info
+}
+
+// Provider adapts a ServiceProvider to oauth.Provider so SAML IdPs can be
+// registered in oauth.MultiProviderService. GetAuthURL sends the OAuth state
+// as RelayState; Exchange takes the POSTed SAMLResponse as the code and
+// returns an opaque handle (token type "SAML") for GetUserInfo.
+//
+// Each AuthnRequest is bound to its state: Exchange only accepts a response
+// to the request started with the state in its context (see
+// oauth.WithExchangeState, set by Service and MultiProviderService), so a
+// response cannot complete another browser's login.
+//
+// Pending requests and handles are kept in memory, so the ACS request must
+// reach the instance that created the AuthnRequest (use sticky sessions or a
+// single instance per IdP).
+type Provider struct {
+	name string
+	sp   *ServiceProvider
+
+	mu       sync.Mutex
+	pending  map[string]pendingRequest // state (RelayState) -> AuthnRequest
+	sessions map[string]*session       // handle -> session
+}
+
+type pendingRequest struct {
+	id        string
+	expiresAt time.Time
+}
+
+type session struct {
+	assertion *Assertion
+	user      *oauth.UserInfo
+	expiresAt time.Time
+}
+
+// NewProvider creates a SAML provider
+func NewProvider(name string, cfg Config) (*Provider, error) {
+	sp, err := NewServiceProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Provider{
+		name:     name,
+		sp:       sp,
+		pending:  make(map[string]pendingRequest),
+		sessions: make(map[string]*session),
+	}, nil
+}
+
+// ServiceProvider returns the underlying service provider (e.g. for metadata)
+func (p *Provider) ServiceProvider() *ServiceProvider {
+	return p.sp
+}
+
+// GetAuthURL returns the IdP redirect URL, or "" if the request cannot be built
+func (p *Provider) GetAuthURL(state string, _ *oauth.PKCEChallenge) string {
+	authURL, id, err := p.sp.AuthnRequestURL(state)
+	if err != nil {
+		return ""
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for pendingState, req := range p.pending {
+		if now.After(req.expiresAt) {
+			delete(p.pending, pendingState)
+		}
+	}
+	p.pending[state] = pendingRequest{id: id, expiresAt: now.Add(p.sp.config.RequestLifetime)}
+	return authURL
+}
+
+// Exchange validates a SAMLResponse and returns a handle to the login. The
+// response must answer the AuthnRequest of the RelayState in ctx (see
+// oauth.WithExchangeState); without a pending request only unsolicited
+// responses are accepted, and only with AllowIdPInitiated.
+func (p *Provider) Exchange(ctx context.Context, samlResponse string, _ *oauth.PKCEChallenge) (*oauth.Token, error) {
+	now := time.Now()
+	var requestIDs []string
+	if state, ok := oauth.ExchangeStateFromContext(ctx); ok {
+		// Each request can be answered once, whatever the outcome
+		p.mu.Lock()
+		req, exists := p.pending[state]
+		delete(p.pending, state)
+		p.mu.Unlock()
+		if exists && now.Before(req.expiresAt) {
+			requestIDs = []string{req.id}
+		}
+	}
+	if requestIDs == nil && !p.sp.config.AllowIdPInitiated {
+		return nil, fmt.Errorf("%w: no pending request for this RelayState", ErrUnknownRequest)
+	}
+
+	assertion, err := p.sp.ParseResponse(samlResponse, requestIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	user := p.sp.UserInfo(assertion)
+	user.Provider = p.name
+
+	handle, err := krypto.GenerateSecureToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session handle: %w", err)
+	}
+	expiresAt := assertion.SessionNotOnOrAfter
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(defaultSessionLifetime)
+	}
+
+	p.mu.Lock()
+	for h, s := range p.sessions {
+		if now.After(s.expiresAt) {
+			delete(p.sessions, h)
+		}
+	}
+	p.sessions[handle] = &session{assertion: assertion, user: user, expiresAt: expiresAt}
+	p.mu.Unlock()
+
+	return &oauth.Token{
+		AccessToken: handle,
+		TokenType:   TokenTypeSAML,
+		ExpiresIn:   int(time.Until(expiresAt).Seconds()),
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// RefreshToken is not supported by SAML
+func (p *Provider) RefreshToken(_ context.Context, _ string) (*oauth.Token, error) {
+	return nil, fmt.Errorf("%w: SAML has no refresh tokens", oauth.ErrNoRefreshToken)
+}
+
+// GetUserInfo returns the user of a handle from Exchange
+func (p *Provider) GetUserInfo(_ context.Context, accessToken string) (*oauth.UserInfo, error) {
+	s, err := p.session(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	user := *s.user
+	return &user, nil
+}
+
+// Assertion returns the validated assertion of a handle (e.g. its SessionIndex)
+func (p *Provider) Assertion(_ context.Context, accessToken string) (*Assertion, error) {
+	s, err := p.session(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.assertion, nil
+}
+
+func (p *Provider) session(handle string) (*session, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, exists := p.sessions[handle]
+	if !exists {
+		return nil, oauth.ErrSessionNotFound
+	}
+	if time.Now().After(s.expiresAt) {
+		delete(p.sessions, handle)
+		return nil, oauth.ErrTokenExpired
+	}
+	return s, nil
+}
+
+// Name returns the provider name
+func (p *Provider) Name() string {
+	return p.name
+}
+
+// SupportsRefresh returns false
+func (p *Provider) SupportsRefresh() bool {
+	return false
+}
+
+// SupportsPKCE returns false; AuthnRequests are bound by InResponseTo instead
+func (p *Provider) SupportsPKCE() bool {
+	return false
+}
+
+// RevokeToken forgets a handle
+func (p *Provider) RevokeToken(_ context.Context, token string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sessions, token)
+	return nil
+}
+
+// ValidateConfig validates the provider configuration
+func (p *Provider) ValidateConfig() error {
+	_, err := NewServiceProvider(p.sp.config)
+	return err
+}
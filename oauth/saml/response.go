@@ -0,0 +1,329 @@
+package saml
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxResponseSize bounds decoded SAML responses
+const maxResponseSize = 1 << 20
+
+// Assertion is a validated SAML assertion
+type Assertion struct {
+	ID           string
+	Issuer       string
+	InResponseTo string
+
+	NameID       string
+	NameIDFormat string
+
+	SessionIndex        string
+	AuthnInstant        time.Time
+	SessionNotOnOrAfter time.Time
+
+	// NotOnOrAfter is when the assertion stops being acceptable
+	NotOnOrAfter time.Time
+
+	// Attributes by Name; attributes with a FriendlyName are also listed under it
+	Attributes map[string][]string
+}
+
+// Attribute returns the first value of an attribute
+func (a *Assertion) Attribute(name string) string {
+	if values := a.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// ParseResponse validates a base64-encoded SAMLResponse (HTTP-POST binding).
+// requestIDs are the IDs of pending AuthnRequests; the response must answer
+// one of them unless IdP-initiated login is allowed. A valid assertion can
+// only be consumed once.
+func (sp *ServiceProvider) ParseResponse(encoded string, requestIDs []string) (*Assertion, error) {
+	if len(encoded) > maxResponseSize*4/3+4 {
+		return nil, fmt.Errorf("%w: response too large", ErrInvalidResponse)
+	}
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid base64 encoding", ErrInvalidResponse)
+	}
+
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if !root.is(NamespaceProtocol, "Response") {
+		return nil, fmt.Errorf("%w: expected a Response element", ErrInvalidResponse)
+	}
+	if err := root.collectIDs(map[string]bool{}); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if root.attr("Version") != "2.0" {
+		return nil, fmt.Errorf("%w: unsupported version %q", ErrInvalidResponse, root.attr("Version"))
+	}
+
+	now := time.Now()
+	skew := sp.config.ClockSkew
+	certs := sp.config.IDP.SigningCertificates
+
+	responseSigned := root.child(dsigNamespace, "Signature") != nil
+	if responseSigned {
+		if err := verifySignature(root, certs); err != nil {
+			return nil, err
+		}
+	}
+
+	if destination := root.attr("Destination"); destination != "" && destination != sp.config.ACSURL {
+		return nil, fmt.Errorf("%w: destination %q does not match ACS URL", ErrInvalidResponse, destination)
+	}
+
+	inResponseTo := root.attr("InResponseTo")
+	if inResponseTo != "" {
+		if !slices.Contains(requestIDs, inResponseTo) {
+			return nil, ErrUnknownRequest
+		}
+	} else if !sp.config.AllowIdPInitiated {
+		return nil, fmt.Errorf("%w: unsolicited responses are not allowed", ErrUnknownRequest)
+	}
+
+	if issuer := root.child(NamespaceAssertion, "Issuer"); issuer != nil && issuer.text() != sp.config.IDP.EntityID {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidResponse, issuer.text())
+	}
+
+	if err := checkStatus(root); err != nil {
+		return nil, err
+	}
+
+	if root.child(NamespaceAssertion, "EncryptedAssertion") != nil {
+		return nil, fmt.Errorf("%w: encrypted assertions are not supported", ErrInvalidResponse)
+	}
+	assertions := root.children(NamespaceAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, fmt.Errorf("%w: expected exactly one assertion, got %d", ErrInvalidResponse, len(assertions))
+	}
+	el := assertions[0]
+
+	assertionSigned := el.child(dsigNamespace, "Signature") != nil
+	if assertionSigned {
+		if err := verifySignature(el, certs); err != nil {
+			return nil, err
+		}
+	} else if sp.config.RequireSignedAssertion || !responseSigned {
+		return nil, fmt.Errorf("%w: assertion is not signed", ErrInvalidSignature)
+	}
+
+	assertion := &Assertion{
+		ID:           el.attr("ID"),
+		InResponseTo: inResponseTo,
+		Attributes:   make(map[string][]string),
+	}
+	if assertion.ID == "" || el.attr("Version") != "2.0" {
+		return nil, fmt.Errorf("%w: assertion ID and version 2.0 are required", ErrInvalidResponse)
+	}
+
+	issuer := el.child(NamespaceAssertion, "Issuer")
+	if issuer == nil || issuer.text() != sp.config.IDP.EntityID {
+		return nil, fmt.Errorf("%w: unexpected assertion issuer", ErrInvalidResponse)
+	}
+	assertion.Issuer = issuer.text()
+
+	if err := sp.checkSubject(el, assertion, now); err != nil {
+		return nil, err
+	}
+	if err := sp.checkConditions(el, assertion, now); err != nil {
+		return nil, err
+	}
+
+	if authn := el.child(NamespaceAssertion, "AuthnStatement"); authn != nil {
+		assertion.SessionIndex = authn.attr("SessionIndex")
+		assertion.AuthnInstant, _ = parseTime(authn.attr("AuthnInstant"))
+		if value := authn.attr("SessionNotOnOrAfter"); value != "" {
+			if assertion.SessionNotOnOrAfter, err = parseTime(value); err != nil {
+				return nil, fmt.Errorf("%w: invalid SessionNotOnOrAfter", ErrInvalidResponse)
+			}
+			if now.After(assertion.SessionNotOnOrAfter.Add(skew)) {
+				return nil, fmt.Errorf("%w: session ended at %s", ErrExpired, assertion.SessionNotOnOrAfter)
+			}
+		}
+	}
+
+	for _, statement := range el.children(NamespaceAssertion, "AttributeStatement") {
+		for _, attribute := range statement.children(NamespaceAssertion, "Attribute") {
+			var values []string
+			for _, value := range attribute.children(NamespaceAssertion, "AttributeValue") {
+				values = append(values, value.text())
+			}
+			name := attribute.attr("Name")
+			assertion.Attributes[name] = append(assertion.Attributes[name], values...)
+			if friendly := attribute.attr("FriendlyName"); friendly != "" && friendly != name {
+				if _, taken := assertion.Attributes[friendly]; !taken {
+					assertion.Attributes[friendly] = values
+				}
+			}
+		}
+	}
+
+	if !sp.replay.add(assertion.ID, assertion.NotOnOrAfter.Add(skew), now) {
+		return nil, ErrReplay
+	}
+
+	return assertion, nil
+}
+
+// checkStatus returns a *StatusError for non-success responses
+func checkStatus(root *element) error {
+	status := root.child(NamespaceProtocol, "Status")
+	if status == nil {
+		return fmt.Errorf("%w: missing Status", ErrInvalidResponse)
+	}
+	code := status.child(NamespaceProtocol, "StatusCode")
+	if code == nil {
+		return fmt.Errorf("%w: missing StatusCode", ErrInvalidResponse)
+	}
+	if code.attr("Value") == StatusSuccess {
+		return nil
+	}
+
+	statusErr := &StatusError{Code: code.attr("Value")}
+	if sub := code.child(NamespaceProtocol, "StatusCode"); sub != nil {
+		statusErr.SubCode = sub.attr("Value")
+	}
+	if message := status.child(NamespaceProtocol, "StatusMessage"); message != nil {
+		statusErr.Message = message.text()
+	}
+	return statusErr
+}
+
+// checkSubject validates the NameID and the bearer subject confirmation
+func (sp *ServiceProvider) checkSubject(el *element, assertion *Assertion, now time.Time) error {
+	subject := el.child(NamespaceAssertion, "Subject")
+	if subject == nil {
+		return fmt.Errorf("%w: missing Subject", ErrInvalidResponse)
+	}
+	nameID := subject.child(NamespaceAssertion, "NameID")
+	if nameID == nil || nameID.text() == "" {
+		return fmt.Errorf("%w: missing NameID", ErrInvalidResponse)
+	}
+	assertion.NameID = nameID.text()
+	assertion.NameIDFormat = nameID.attr("Format")
+
+	skew := sp.config.ClockSkew
+	var lastErr error = fmt.Errorf("%w: no bearer subject confirmation", ErrInvalidResponse)
+	for _, confirmation := range subject.children(NamespaceAssertion, "SubjectConfirmation") {
+		if confirmation.attr("Method") != confirmationBearer {
+			continue
+		}
+		data := confirmation.child(NamespaceAssertion, "SubjectConfirmationData")
+		if data == nil {
+			lastErr = fmt.Errorf("%w: missing SubjectConfirmationData", ErrInvalidResponse)
+			continue
+		}
+		if data.attr("Recipient") != sp.config.ACSURL {
+			lastErr = fmt.Errorf("%w: recipient does not match ACS URL", ErrInvalidResponse)
+			continue
+		}
+		if data.attr("InResponseTo") != assertion.InResponseTo {
+			lastErr = fmt.Errorf("%w: subject confirmation InResponseTo mismatch", ErrInvalidResponse)
+			continue
+		}
+		notOnOrAfter, err := parseTime(data.attr("NotOnOrAfter"))
+		if err != nil {
+			lastErr = fmt.Errorf("%w: subject confirmation requires NotOnOrAfter", ErrInvalidResponse)
+			continue
+		}
+		if !now.Before(notOnOrAfter.Add(skew)) {
+			lastErr = fmt.Errorf("%w: subject confirmation expired at %s", ErrExpired, notOnOrAfter)
+			continue
+		}
+		if value := data.attr("NotBefore"); value != "" {
+			if notBefore, err := parseTime(value); err != nil || now.Add(skew).Before(notBefore) {
+				lastErr = fmt.Errorf("%w: subject confirmation not yet valid", ErrExpired)
+				continue
+			}
+		}
+
+		assertion.NotOnOrAfter = notOnOrAfter
+		return nil
+	}
+	return lastErr
+}
+
+// checkConditions validates the validity window and audience restriction
+func (sp *ServiceProvider) checkConditions(el *element, assertion *Assertion, now time.Time) error {
+	conditions := el.child(NamespaceAssertion, "Conditions")
+	if conditions == nil {
+		return fmt.Errorf("%w: missing Conditions", ErrInvalidResponse)
+	}
+
+	skew := sp.config.ClockSkew
+	if value := conditions.attr("NotBefore"); value != "" {
+		notBefore, err := parseTime(value)
+		if err != nil {
+			return fmt.Errorf("%w: invalid NotBefore", ErrInvalidResponse)
+		}
+		if now.Add(skew).Before(notBefore) {
+			return fmt.Errorf("%w: not valid before %s", ErrExpired, notBefore)
+		}
+	}
+	if value := conditions.attr("NotOnOrAfter"); value != "" {
+		notOnOrAfter, err := parseTime(value)
+		if err != nil {
+			return fmt.Errorf("%w: invalid NotOnOrAfter", ErrInvalidResponse)
+		}
+		if !now.Before(notOnOrAfter.Add(skew)) {
+			return fmt.Errorf("%w: expired at %s", ErrExpired, notOnOrAfter)
+		}
+		if notOnOrAfter.After(assertion.NotOnOrAfter) {
+			assertion.NotOnOrAfter = notOnOrAfter
+		}
+	}
+
+	restrictions := conditions.children(NamespaceAssertion, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return fmt.Errorf("%w: missing AudienceRestriction", ErrInvalidResponse)
+	}
+	// Every restriction must be satisfied
+	for _, restriction := range restrictions {
+		matched := false
+		for _, audience := range restriction.children(NamespaceAssertion, "Audience") {
+			if audience.text() == sp.config.EntityID {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%w: audience does not include %s", ErrInvalidResponse, sp.config.EntityID)
+		}
+	}
+	return nil
+}
+
+// replayCache remembers consumed assertion IDs until they expire
+type replayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{seen: make(map[string]time.Time)}
+}
+
+// add records id until expiry and reports false if it was already recorded
+func (c *replayCache) add(id string, expiry, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if until, seen := c.seen[id]; seen && now.Before(until) {
+		return false
+	}
+	for seenID, until := range c.seen {
+		if !now.Before(until) {
+			delete(c.seen, seenID)
+		}
+	}
+	c.seen[id] = expiry
+	return true
+}
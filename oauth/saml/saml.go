@@ -0,0 +1,110 @@
+// Package saml implements a SAML 2.0 service provider that plugs into
+// oauth.MultiProviderService next to the OAuth providers.
+//
+// It parses IdP metadata, publishes SP metadata, sends AuthnRequests with the
+// HTTP-Redirect binding and accepts Responses with the HTTP-POST binding.
+// Responses and assertions are verified with XML-DSig (exclusive c14n,
+// RSA/ECDSA with SHA-256 or SHA-512) against the IdP's metadata certificates;
+// audience, recipient, validity windows (with clock skew) and assertion
+// replay are checked before attributes are mapped to oauth.UserInfo.
+// Encrypted assertions are not supported.
+//
+// Example:
+//
+//	idp, err := saml.FetchIDPMetadata(ctx, nil, "https://idp.example.com/metadata")
+//	provider, err := saml.NewProvider("acme", saml.Config{
+//	    EntityID: "https://app.example.com/saml/metadata",
+//	    ACSURL:   "https://app.example.com/saml/acs",
+//	    IDP:      idp,
+//	})
+//	_ = multi.RegisterProvider("acme", provider)
+//
+//	// GET /login: redirect to the IdP
+//	authURL, state, err := multi.GetAuthURL(ctx, "acme")
+//
+//	// POST /saml/acs: the IdP posts SAMLResponse and RelayState
+//	token, err := multi.Exchange(ctx, "acme", r.PostFormValue("SAMLResponse"), r.PostFormValue("RelayState"))
+//	user, err := multi.GetUserInfo(ctx, "acme", token.AccessToken)
+package saml
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gobeaver/beaver-kit/oauth"
+)
+
+// SAML namespaces, bindings and identifiers
+const (
+	NamespaceAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	NamespaceProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	NamespaceMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	BindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	BindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	NameIDFormatUnspecified  = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	NameIDFormatEmailAddress = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatPersistent   = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	NameIDFormatTransient    = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+
+	StatusSuccess       = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	StatusRequester     = "urn:oasis:names:tc:SAML:2.0:status:Requester"
+	StatusResponder     = "urn:oasis:names:tc:SAML:2.0:status:Responder"
+	StatusAuthnFailed   = "urn:oasis:names:tc:SAML:2.0:status:AuthnFailed"
+	StatusRequestDenied = "urn:oasis:names:tc:SAML:2.0:status:RequestDenied"
+
+	confirmationBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	protocolSupport    = "urn:oasis:names:tc:SAML:2.0:protocol"
+)
+
+// Package-level errors
+var (
+	// ErrInvalidMetadata indicates unusable IdP metadata
+	ErrInvalidMetadata = errors.New("invalid SAML metadata")
+
+	// ErrInvalidResponse indicates a malformed or non-conforming SAML response
+	ErrInvalidResponse = errors.New("invalid SAML response")
+
+	// ErrInvalidSignature indicates a missing or invalid XML signature
+	ErrInvalidSignature = errors.New("invalid XML signature")
+
+	// ErrExpired indicates the assertion is outside its validity window
+	ErrExpired = errors.New("SAML assertion expired or not yet valid")
+
+	// ErrReplay indicates the assertion was already consumed
+	ErrReplay = errors.New("SAML assertion replayed")
+
+	// ErrUnknownRequest indicates InResponseTo does not match a pending request
+	ErrUnknownRequest = errors.New("SAML response does not match a pending request")
+)
+
+// StatusError is returned when the IdP responds with a non-success status
+type StatusError struct {
+	Code    string
+	SubCode string
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("SAML status %s", e.Code)
+	if e.SubCode != "" {
+		msg += " (" + e.SubCode + ")"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Unwrap maps authentication failures to oauth.ErrAccessDenied
+func (e *StatusError) Unwrap() error {
+	switch e.SubCode {
+	case StatusAuthnFailed, StatusRequestDenied:
+		return oauth.ErrAccessDenied
+	}
+	if e.Code == StatusResponder {
+		return oauth.ErrServerError
+	}
+	return nil
+}
@@ -0,0 +1,401 @@
+package saml_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/oauth"
+	"github.com/gobeaver/beaver-kit/oauth/saml"
+	"github.com/gobeaver/beaver-kit/oauth/saml/samltest"
+)
+
+const (
+	spEntityID = "https://app.example.com/saml/metadata"
+	spACSURL   = "https://app.example.com/saml/acs"
+)
+
+func newIdP(t *testing.T, cfg samltest.Config) *samltest.IdentityProvider {
+	t.Helper()
+	idp, err := samltest.NewIdentityProvider(cfg)
+	if err != nil {
+		t.Fatalf("Failed to start IdP: %v", err)
+	}
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func spConfig(idp *samltest.IdentityProvider) saml.Config {
+	return saml.Config{
+		EntityID: spEntityID,
+		ACSURL:   spACSURL,
+		IDP:      idp.IDPMetadata(),
+	}
+}
+
+func newSP(t *testing.T, cfg saml.Config) *saml.ServiceProvider {
+	t.Helper()
+	sp, err := saml.NewServiceProvider(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create service provider: %v", err)
+	}
+	return sp
+}
+
+// login runs an SP-initiated login and returns the response and request ID
+func login(t *testing.T, idp *samltest.IdentityProvider, sp *saml.ServiceProvider) (string, string) {
+	t.Helper()
+	authURL, requestID, err := sp.AuthnRequestURL("state-1")
+	if err != nil {
+		t.Fatalf("AuthnRequestURL failed: %v", err)
+	}
+	response, relayState, err := idp.Login(authURL)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if relayState != "state-1" {
+		t.Errorf("Expected RelayState to round-trip, got %q", relayState)
+	}
+	return response, requestID
+}
+
+func TestMetadata(t *testing.T) {
+	idp := newIdP(t, samltest.Config{})
+
+	fetched, err := saml.FetchIDPMetadata(context.Background(), nil, idp.MetadataURL())
+	if err != nil {
+		t.Fatalf("FetchIDPMetadata failed: %v", err)
+	}
+	if fetched.EntityID != idp.EntityID() || fetched.SSOURL != idp.URL()+"/sso" {
+		t.Errorf("Unexpected metadata: %+v", fetched)
+	}
+	if len(fetched.SigningCertificates) != 1 || !fetched.SigningCertificates[0].Equal(idp.Signer().Certificate) {
+		t.Error("Expected the IdP signing certificate")
+	}
+
+	if _, err := saml.ParseIDPMetadata([]byte(`<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="x"/>`)); !errors.Is(err, saml.ErrInvalidMetadata) {
+		t.Errorf("Expected ErrInvalidMetadata, got %v", err)
+	}
+
+	signer, _ := saml.NewSelfSignedSigner("sp")
+	cfg := spConfig(idp)
+	cfg.Signer = signer
+	cfg.SignAuthnRequests = true
+	metadata, err := newSP(t, cfg).Metadata()
+	if err != nil {
+		t.Fatalf("Metadata failed: %v", err)
+	}
+	for _, want := range []string{
+		`entityID="` + spEntityID + `"`,
+		`AuthnRequestsSigned="true"`,
+		`Location="` + spACSURL + `"`,
+		base64.StdEncoding.EncodeToString(signer.Certificate.Raw)[:40],
+	} {
+		if !strings.Contains(string(metadata), want) {
+			t.Errorf("SP metadata missing %s:\n%s", want, metadata)
+		}
+	}
+}
+
+func TestProvider_MultiProviderLogin(t *testing.T) {
+	idp := newIdP(t, samltest.Config{})
+
+	provider, err := saml.NewProvider("acme", spConfig(idp))
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	multi, _ := oauth.NewMultiProviderService(oauth.MultiProviderConfig{PKCEEnabled: true, SessionTimeout: time.Minute})
+	if err := multi.RegisterProvider("acme", provider); err != nil {
+		t.Fatalf("RegisterProvider failed: %v", err)
+	}
+
+	ctx := context.Background()
+	authURL, state, err := multi.GetAuthURL(ctx, "acme")
+	if err != nil {
+		t.Fatalf("GetAuthURL failed: %v", err)
+	}
+	response, relayState, err := idp.Login(authURL)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if relayState != state {
+		t.Fatalf("Expected RelayState %q, got %q", state, relayState)
+	}
+
+	token, err := multi.Exchange(ctx, "acme", response, relayState)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if token.TokenType != saml.TokenTypeSAML || token.ExpiresAt.IsZero() {
+		t.Errorf("Unexpected token: %+v", token)
+	}
+
+	user, err := multi.GetUserInfo(ctx, "acme", token.AccessToken)
+	if err != nil {
+		t.Fatalf("GetUserInfo failed: %v", err)
+	}
+	if user.ID != "test@example.com" || user.Email != "test@example.com" || user.Name != "Test User" ||
+		user.FirstName != "Test" || user.LastName != "User" || user.Provider != "acme" {
+		t.Errorf("Unexpected user info: %+v", user)
+	}
+	if user.EmailVerified {
+		t.Error("Expected email to be unverified without TrustEmail")
+	}
+
+	// The request was consumed; the same response cannot be exchanged again
+	if _, err := provider.Exchange(ctx, response, nil); !errors.Is(err, saml.ErrUnknownRequest) {
+		t.Errorf("Expected ErrUnknownRequest for a reused response, got %v", err)
+	}
+
+	if err := multi.RevokeToken(ctx, "acme", token.AccessToken); err != nil {
+		t.Fatalf("RevokeToken failed: %v", err)
+	}
+	if _, err := multi.GetUserInfo(ctx, "acme", token.AccessToken); !errors.Is(err, oauth.ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound after revoke, got %v", err)
+	}
+}
+
+func TestProvider_ResponseBoundToRelayState(t *testing.T) {
+	idp := newIdP(t, samltest.Config{})
+	provider, err := saml.NewProvider("acme", spConfig(idp))
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	multi, _ := oauth.NewMultiProviderService(oauth.MultiProviderConfig{SessionTimeout: time.Minute})
+	_ = multi.RegisterProvider("acme", provider)
+
+	ctx := context.Background()
+	victimURL, victimState, _ := multi.GetAuthURL(ctx, "acme")
+	attackerURL, attackerState, _ := multi.GetAuthURL(ctx, "acme")
+
+	// The attacker's response cannot complete the victim's pending login
+	attackerResponse, _, err := idp.Login(attackerURL)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if _, err := multi.Exchange(ctx, "acme", attackerResponse, victimState); !errors.Is(err, saml.ErrUnknownRequest) {
+		t.Errorf("Expected ErrUnknownRequest for a response to another request, got %v", err)
+	}
+
+	// Nor can it be replayed against its own state once the request is used
+	victimResponse, _, _ := idp.Login(victimURL)
+	if _, err := provider.Exchange(oauth.WithExchangeState(ctx, attackerState), victimResponse, nil); !errors.Is(err, saml.ErrUnknownRequest) {
+		t.Errorf("Expected ErrUnknownRequest for a mismatched RelayState, got %v", err)
+	}
+	if _, err := provider.Exchange(oauth.WithExchangeState(ctx, attackerState), attackerResponse, nil); !errors.Is(err, saml.ErrUnknownRequest) {
+		t.Errorf("Expected the request to be consumed, got %v", err)
+	}
+}
+
+func TestParseResponse_SigningModes(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          samltest.SigningMode
+		requireSigned bool
+		wantErr       error
+	}{
+		{"assertion signed", samltest.SignAssertion, false, nil},
+		{"response signed", samltest.SignResponse, false, nil},
+		{"both signed", samltest.SignBoth, true, nil},
+		{"unsigned", samltest.SignNone, false, saml.ErrInvalidSignature},
+		{"response only but assertion required", samltest.SignResponse, true, saml.ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newIdP(t, samltest.Config{Signing: tt.mode})
+			cfg := spConfig(idp)
+			cfg.RequireSignedAssertion = tt.requireSigned
+			sp := newSP(t, cfg)
+
+			response, requestID := login(t, idp, sp)
+			assertion, err := sp.ParseResponse(response, []string{requestID})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && (assertion.NameID != "test@example.com" || assertion.InResponseTo != requestID) {
+				t.Errorf("Unexpected assertion: %+v", assertion)
+			}
+		})
+	}
+}
+
+func TestParseResponse_Tampering(t *testing.T) {
+	for _, mode := range []samltest.SigningMode{samltest.SignAssertion, samltest.SignResponse} {
+		idp := newIdP(t, samltest.Config{Signing: mode})
+		sp := newSP(t, spConfig(idp))
+		response, requestID := login(t, idp, sp)
+
+		decoded, _ := base64.StdEncoding.DecodeString(response)
+		tampered := strings.Replace(string(decoded), ">test@example.com</saml:AttributeValue>", ">admin@example.com</saml:AttributeValue>", 1)
+		if tampered == string(decoded) {
+			t.Fatal("Tampering did not change the response")
+		}
+
+		_, err := sp.ParseResponse(base64.StdEncoding.EncodeToString([]byte(tampered)), []string{requestID})
+		if !errors.Is(err, saml.ErrInvalidSignature) {
+			t.Errorf("Mode %d: expected ErrInvalidSignature, got %v", mode, err)
+		}
+	}
+}
+
+func TestParseResponse_SignatureWrapping(t *testing.T) {
+	idp := newIdP(t, samltest.Config{})
+	sp := newSP(t, spConfig(idp))
+	response, requestID := login(t, idp, sp)
+
+	decoded, _ := base64.StdEncoding.DecodeString(response)
+	doc := string(decoded)
+	start := strings.Index(doc, "<saml:Assertion")
+	end := strings.Index(doc, "</saml:Assertion>") + len("</saml:Assertion>")
+	signed := doc[start:end]
+
+	// Hide the signed assertion in Extensions and add a forged, unsigned copy
+	forged := strings.Replace(signed, ">test@example.com</saml:NameID>", ">admin@example.com</saml:NameID>", 1)
+	forged = forged[:strings.Index(forged, "<ds:Signature")] + forged[strings.Index(forged, "</ds:Signature>")+len("</ds:Signature>"):]
+	forged = strings.Replace(forged, `ID="`, `ID="forged`, 1)
+	wrapped := doc[:start] + `<samlp:Extensions>` + signed + `</samlp:Extensions>` + forged + doc[end:]
+
+	_, err := sp.ParseResponse(base64.StdEncoding.EncodeToString([]byte(wrapped)), []string{requestID})
+	if !errors.Is(err, saml.ErrInvalidSignature) {
+		t.Errorf("Expected wrapped response to be rejected, got %v", err)
+	}
+
+	// Two assertions are never accepted
+	doubled := doc[:end] + forged + doc[end:]
+	if _, err := sp.ParseResponse(base64.StdEncoding.EncodeToString([]byte(doubled)), []string{requestID}); !errors.Is(err, saml.ErrInvalidResponse) {
+		t.Errorf("Expected ErrInvalidResponse for two assertions, got %v", err)
+	}
+}
+
+func TestParseResponse_Validation(t *testing.T) {
+	idp := newIdP(t, samltest.Config{})
+	cfg := spConfig(idp)
+	cfg.AllowIdPInitiated = true
+	sp := newSP(t, cfg)
+
+	valid := samltest.ResponseOptions{InResponseTo: "_req1", Audience: spEntityID, Recipient: spACSURL}
+	tests := []struct {
+		name    string
+		modify  func(*samltest.ResponseOptions)
+		wantErr error
+	}{
+		{"valid", func(*samltest.ResponseOptions) {}, nil},
+		{"wrong audience", func(o *samltest.ResponseOptions) { o.Audience = "https://other.example.com" }, saml.ErrInvalidResponse},
+		{"wrong recipient", func(o *samltest.ResponseOptions) { o.Recipient = "https://evil.example.com/acs" }, saml.ErrInvalidResponse},
+		{"unknown request", func(o *samltest.ResponseOptions) { o.InResponseTo = "_unknown" }, saml.ErrUnknownRequest},
+		{"skew within tolerance", func(o *samltest.ResponseOptions) { o.IssueInstant = time.Now().Add(90 * time.Second) }, nil},
+		{"not yet valid", func(o *samltest.ResponseOptions) { o.IssueInstant = time.Now().Add(10 * time.Minute) }, saml.ErrExpired},
+		{"expired", func(o *samltest.ResponseOptions) { o.IssueInstant = time.Now().Add(-10 * time.Minute) }, saml.ErrExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := valid
+			tt.modify(&opts)
+			response, err := idp.Response(opts)
+			if err != nil {
+				t.Fatalf("Failed to build response: %v", err)
+			}
+			if _, err := sp.ParseResponse(response, []string{"_req1"}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseResponse_IdPInitiatedAndReplay(t *testing.T) {
+	idp := newIdP(t, samltest.Config{})
+	response, err := idp.Response(samltest.ResponseOptions{Audience: spEntityID, Recipient: spACSURL})
+	if err != nil {
+		t.Fatalf("Failed to build response: %v", err)
+	}
+
+	if _, err := newSP(t, spConfig(idp)).ParseResponse(response, nil); !errors.Is(err, saml.ErrUnknownRequest) {
+		t.Errorf("Expected unsolicited response to be rejected, got %v", err)
+	}
+
+	cfg := spConfig(idp)
+	cfg.AllowIdPInitiated = true
+	sp := newSP(t, cfg)
+	if _, err := sp.ParseResponse(response, nil); err != nil {
+		t.Fatalf("Expected IdP-initiated response to be accepted: %v", err)
+	}
+	if _, err := sp.ParseResponse(response, nil); !errors.Is(err, saml.ErrReplay) {
+		t.Errorf("Expected ErrReplay, got %v", err)
+	}
+}
+
+func TestParseResponse_StatusError(t *testing.T) {
+	idp := newIdP(t, samltest.Config{StatusCode: saml.StatusRequester, SubStatusCode: saml.StatusAuthnFailed})
+	sp := newSP(t, spConfig(idp))
+	response, requestID := login(t, idp, sp)
+
+	_, err := sp.ParseResponse(response, []string{requestID})
+	var statusErr *saml.StatusError
+	if !errors.As(err, &statusErr) || statusErr.SubCode != saml.StatusAuthnFailed {
+		t.Fatalf("Expected StatusError, got %v", err)
+	}
+	if !errors.Is(err, oauth.ErrAccessDenied) {
+		t.Error("Expected AuthnFailed to map to oauth.ErrAccessDenied")
+	}
+}
+
+func TestSignedAuthnRequests(t *testing.T) {
+	signer, err := saml.NewSelfSignedSigner("sp")
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	idp := newIdP(t, samltest.Config{WantAuthnRequestsSigned: true, SPCertificate: signer.Certificate})
+
+	if _, err := saml.NewServiceProvider(spConfig(idp)); !errors.Is(err, oauth.ErrInvalidConfig) {
+		t.Errorf("Expected a signer to be required, got %v", err)
+	}
+
+	cfg := spConfig(idp)
+	cfg.Signer = signer
+	sp := newSP(t, cfg)
+	response, requestID := login(t, idp, sp)
+	if _, err := sp.ParseResponse(response, []string{requestID}); err != nil {
+		t.Fatalf("ParseResponse failed: %v", err)
+	}
+	if requests := idp.Requests(); len(requests) != 1 || !requests[0].Signed || requests[0].Issuer != spEntityID {
+		t.Errorf("Expected one signed AuthnRequest, got %+v", requests)
+	}
+}
+
+func TestUserInfoMapping(t *testing.T) {
+	idp := newIdP(t, samltest.Config{User: samltest.User{
+		NameID:       "_transient123",
+		NameIDFormat: saml.NameIDFormatTransient,
+		Attributes: map[string][]string{
+			"urn:oid:0.9.2342.19200300.100.1.1":                                  {"jdoe"},
+			"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress": {"jdoe@corp.example"},
+			"urn:oid:2.5.4.42": {"Jane"},
+			"urn:oid:2.5.4.4":  {"Doe"},
+			"groups":           {"admins", "staff"},
+		},
+	}})
+
+	cfg := spConfig(idp)
+	cfg.TrustEmail = true
+	cfg.Attributes = saml.AttributeMapping{ID: []string{"urn:oid:0.9.2342.19200300.100.1.1"}}
+	sp := newSP(t, cfg)
+
+	response, requestID := login(t, idp, sp)
+	assertion, err := sp.ParseResponse(response, []string{requestID})
+	if err != nil {
+		t.Fatalf("ParseResponse failed: %v", err)
+	}
+
+	user := sp.UserInfo(assertion)
+	if user.ID != "jdoe" || user.Email != "jdoe@corp.example" || !user.EmailVerified || user.Name != "Jane Doe" {
+		t.Errorf("Unexpected user info: %+v", user)
+	}
+	if groups := assertion.Attributes["groups"]; len(groups) != 2 {
+		t.Errorf("Expected multi-valued attribute, got %v", groups)
+	}
+}
@@ -0,0 +1,442 @@
+// Package samltest provides an in-process SAML identity provider for tests.
+package samltest
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/oauth/saml"
+)
+
+// SigningMode selects which parts of a response the IdP signs
+type SigningMode int
+
+const (
+	// SignAssertion signs only the assertion (the default)
+	SignAssertion SigningMode = iota
+	// SignResponse signs only the enclosing Response
+	SignResponse
+	// SignBoth signs the assertion and the Response
+	SignBoth
+	// SignNone sends unsigned responses
+	SignNone
+)
+
+// User is the account the IdP logs in
+type User struct {
+	NameID       string
+	NameIDFormat string
+	Attributes   map[string][]string
+}
+
+// Config configures the IdP stand-in
+type Config struct {
+	// EntityID of the IdP (default <server URL>/metadata)
+	EntityID string
+
+	// User returned for every login
+	User User
+
+	Signing SigningMode
+
+	// AssertionLifetime bounds the assertion validity window (default 5m)
+	AssertionLifetime time.Duration
+
+	// ClockOffset shifts the IdP clock to simulate skew
+	ClockOffset time.Duration
+
+	// WantAuthnRequestsSigned is advertised in metadata and enforced
+	WantAuthnRequestsSigned bool
+
+	// SPCertificate verifies signed AuthnRequests when set
+	SPCertificate *x509.Certificate
+
+	// StatusCode and SubStatusCode, when set, make logins fail with that status
+	StatusCode    string
+	SubStatusCode string
+}
+
+// AuthnRequest is a request received by the IdP
+type AuthnRequest struct {
+	ID         string
+	Issuer     string
+	ACSURL     string
+	RelayState string
+	Signed     bool
+}
+
+// ResponseOptions controls a response built with Response. Zero values use
+// the IdP's configuration and clock.
+type ResponseOptions struct {
+	InResponseTo string
+	Audience     string
+	Recipient    string
+	Destination  string
+	User         *User
+
+	// IssueInstant anchors NotBefore and NotOnOrAfter (default now)
+	IssueInstant time.Time
+}
+
+// IdentityProvider is an in-process SAML IdP
+type IdentityProvider struct {
+	config Config
+	signer *saml.Signer
+	server *httptest.Server
+
+	mu       sync.Mutex
+	requests []AuthnRequest
+}
+
+// NewIdentityProvider starts an IdP stand-in on a local HTTP server
+func NewIdentityProvider(cfg Config) (*IdentityProvider, error) {
+	signer, err := saml.NewSelfSignedSigner("samltest IdP")
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AssertionLifetime <= 0 {
+		cfg.AssertionLifetime = 5 * time.Minute
+	}
+	if cfg.User.NameID == "" {
+		cfg.User = User{
+			NameID:       "test@example.com",
+			NameIDFormat: saml.NameIDFormatEmailAddress,
+			Attributes: map[string][]string{
+				"email":       {"test@example.com"},
+				"displayName": {"Test User"},
+				"givenName":   {"Test"},
+				"sn":          {"User"},
+			},
+		}
+	}
+
+	idp := &IdentityProvider{config: cfg, signer: signer}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metadata", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/samlmetadata+xml")
+		_, _ = w.Write(idp.Metadata())
+	})
+	mux.HandleFunc("/sso", idp.handleSSO)
+	idp.server = httptest.NewServer(mux)
+
+	if idp.config.EntityID == "" {
+		idp.config.EntityID = idp.server.URL + "/metadata"
+	}
+	return idp, nil
+}
+
+// URL returns the base URL of the IdP
+func (p *IdentityProvider) URL() string { return p.server.URL }
+
+// MetadataURL returns the metadata endpoint
+func (p *IdentityProvider) MetadataURL() string { return p.server.URL + "/metadata" }
+
+// EntityID returns the IdP entity ID
+func (p *IdentityProvider) EntityID() string { return p.config.EntityID }
+
+// Signer returns the IdP signing key, e.g. to forge responses in tests
+func (p *IdentityProvider) Signer() *saml.Signer { return p.signer }
+
+// Close shuts down the server
+func (p *IdentityProvider) Close() { p.server.Close() }
+
+// Requests returns the AuthnRequests received so far
+func (p *IdentityProvider) Requests() []AuthnRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]AuthnRequest(nil), p.requests...)
+}
+
+// Metadata returns the IdP metadata document
+func (p *IdentityProvider) Metadata() []byte {
+	cert := base64.StdEncoding.EncodeToString(p.signer.Certificate.Raw)
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="%s">
+  <md:IDPSSODescriptor WantAuthnRequestsSigned="%t" protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+        <ds:X509Data><ds:X509Certificate>%s</ds:X509Certificate></ds:X509Data>
+      </ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:NameIDFormat>%s</md:NameIDFormat>
+    <md:SingleSignOnService Binding="%s" Location="%s/sso"/>
+    <md:SingleSignOnService Binding="%s" Location="%s/sso"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`, escape(p.config.EntityID), p.config.WantAuthnRequestsSigned, cert,
+		saml.NameIDFormatEmailAddress,
+		saml.BindingHTTPPost, p.server.URL, saml.BindingHTTPRedirect, p.server.URL))
+}
+
+// IDPMetadata returns the parsed metadata for saml.Config.IDP
+func (p *IdentityProvider) IDPMetadata() *saml.IDPMetadata {
+	meta, err := saml.ParseIDPMetadata(p.Metadata())
+	if err != nil {
+		panic(fmt.Sprintf("samltest: invalid metadata: %v", err))
+	}
+	return meta
+}
+
+// Login follows an AuthnRequest URL like a browser and returns the
+// SAMLResponse and RelayState the IdP would POST to the ACS
+func (p *IdentityProvider) Login(authURL string) (samlResponse, relayState string, err error) {
+	resp, err := http.Get(authURL) //nolint:noctx // test helper
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("IdP returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	samlResponse = formValue(body, "SAMLResponse")
+	if samlResponse == "" {
+		return "", "", fmt.Errorf("IdP response has no SAMLResponse form")
+	}
+	return samlResponse, formValue(body, "RelayState"), nil
+}
+
+func (p *IdentityProvider) handleSSO(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	request, err := decodeAuthnRequest(query.Get("SAMLRequest"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request.RelayState = query.Get("RelayState")
+
+	if query.Get("Signature") != "" {
+		if err := p.verifyQuerySignature(r.URL.RawQuery, query); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request.Signed = true
+	} else if p.config.WantAuthnRequestsSigned {
+		http.Error(w, "AuthnRequest must be signed", http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	p.requests = append(p.requests, *request)
+	p.mu.Unlock()
+
+	encoded, err := p.Response(ResponseOptions{
+		InResponseTo: request.ID,
+		Audience:     request.Issuer,
+		Recipient:    request.ACSURL,
+		Destination:  request.ACSURL,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html><body onload="document.forms[0].submit()">
+<form method="post" action="%s">
+<input type="hidden" name="SAMLResponse" value="%s"/>
+<input type="hidden" name="RelayState" value="%s"/>
+</form></body></html>`, html.EscapeString(request.ACSURL), html.EscapeString(encoded), html.EscapeString(request.RelayState))
+}
+
+// Response builds a base64-encoded SAMLResponse signed per the configured mode
+func (p *IdentityProvider) Response(opts ResponseOptions) (string, error) {
+	now := opts.IssueInstant
+	if now.IsZero() {
+		now = time.Now().Add(p.config.ClockOffset)
+	}
+	user := p.config.User
+	if opts.User != nil {
+		user = *opts.User
+	}
+	if opts.Destination == "" {
+		opts.Destination = opts.Recipient
+	}
+
+	responseID, assertionID := newID(), newID()
+	notOnOrAfter := now.Add(p.config.AssertionLifetime)
+
+	inResponseTo := ""
+	if opts.InResponseTo != "" {
+		inResponseTo = fmt.Sprintf(` InResponseTo="%s"`, escape(opts.InResponseTo))
+	}
+
+	status := fmt.Sprintf(`<samlp:StatusCode Value="%s"/>`, saml.StatusSuccess)
+	assertion := ""
+	if p.config.StatusCode != "" {
+		status = fmt.Sprintf(`<samlp:StatusCode Value="%s">`, escape(p.config.StatusCode))
+		if p.config.SubStatusCode != "" {
+			status += fmt.Sprintf(`<samlp:StatusCode Value="%s"/>`, escape(p.config.SubStatusCode))
+		}
+		status += `</samlp:StatusCode><samlp:StatusMessage>Login failed</samlp:StatusMessage>`
+	} else {
+		var attributes strings.Builder
+		for name, values := range user.Attributes {
+			fmt.Fprintf(&attributes, `<saml:Attribute Name="%s" NameFormat="urn:oasis:names:tc:SAML:2.0:attrname-format:basic">`, escape(name))
+			for _, value := range values {
+				fmt.Fprintf(&attributes, `<saml:AttributeValue xsi:type="xs:string">%s</saml:AttributeValue>`, escape(value))
+			}
+			attributes.WriteString(`</saml:Attribute>`)
+		}
+
+		assertion = fmt.Sprintf(`<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ID="%s" Version="2.0" IssueInstant="%s">
+  <saml:Issuer>%s</saml:Issuer>
+  <saml:Subject>
+    <saml:NameID Format="%s">%s</saml:NameID>
+    <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+      <saml:SubjectConfirmationData%s NotOnOrAfter="%s" Recipient="%s"/>
+    </saml:SubjectConfirmation>
+  </saml:Subject>
+  <saml:Conditions NotBefore="%s" NotOnOrAfter="%s">
+    <saml:AudienceRestriction><saml:Audience>%s</saml:Audience></saml:AudienceRestriction>
+  </saml:Conditions>
+  <saml:AuthnStatement AuthnInstant="%s" SessionIndex="%s" SessionNotOnOrAfter="%s">
+    <saml:AuthnContext><saml:AuthnContextClassRef>urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport</saml:AuthnContextClassRef></saml:AuthnContext>
+  </saml:AuthnStatement>
+  <saml:AttributeStatement>%s</saml:AttributeStatement>
+</saml:Assertion>`,
+			assertionID, formatTime(now), escape(p.config.EntityID),
+			escape(user.NameIDFormat), escape(user.NameID),
+			inResponseTo, formatTime(notOnOrAfter), escape(opts.Recipient),
+			formatTime(now.Add(-30*time.Second)), formatTime(notOnOrAfter), escape(opts.Audience),
+			formatTime(now), newID(), formatTime(now.Add(8*time.Hour)),
+			attributes.String())
+
+		if p.config.Signing == SignAssertion || p.config.Signing == SignBoth {
+			signed, err := p.signer.SignXML([]byte(assertion))
+			if err != nil {
+				return "", err
+			}
+			assertion = string(signed)
+		}
+	}
+
+	response := fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s"%s>
+  <saml:Issuer>%s</saml:Issuer>
+  <samlp:Status>%s</samlp:Status>
+  %s
+</samlp:Response>`, responseID, formatTime(now), escape(opts.Destination), inResponseTo,
+		escape(p.config.EntityID), status, assertion)
+
+	data := []byte(response)
+	if p.config.Signing == SignResponse || p.config.Signing == SignBoth {
+		var err error
+		if data, err = p.signer.SignXML(data); err != nil {
+			return "", err
+		}
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// verifyQuerySignature checks an HTTP-Redirect binding signature over the
+// query parameters exactly as they were encoded by the sender
+func (p *IdentityProvider) verifyQuerySignature(rawQuery string, query url.Values) error {
+	if p.config.SPCertificate == nil {
+		return fmt.Errorf("no SP certificate configured")
+	}
+	if query.Get("SigAlg") != "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256" {
+		return fmt.Errorf("unsupported SigAlg")
+	}
+
+	raw := map[string]string{}
+	for _, part := range strings.Split(rawQuery, "&") {
+		if key, value, ok := strings.Cut(part, "="); ok {
+			raw[key] = value
+		}
+	}
+	signed := "SAMLRequest=" + raw["SAMLRequest"]
+	if value, ok := raw["RelayState"]; ok {
+		signed += "&RelayState=" + value
+	}
+	signed += "&SigAlg=" + raw["SigAlg"]
+
+	sig, err := base64.StdEncoding.DecodeString(query.Get("Signature"))
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding")
+	}
+	key, ok := p.config.SPCertificate.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("SP certificate is not RSA")
+	}
+	hashed := sha256.Sum256([]byte(signed))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig); err != nil {
+		return fmt.Errorf("invalid AuthnRequest signature")
+	}
+	return nil
+}
+
+func decodeAuthnRequest(encoded string) (*AuthnRequest, error) {
+	deflated, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAMLRequest encoding")
+	}
+	data, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAMLRequest compression")
+	}
+
+	var request struct {
+		ID     string `xml:"ID,attr"`
+		ACSURL string `xml:"AssertionConsumerServiceURL,attr"`
+		Issuer string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	}
+	if err := xml.Unmarshal(data, &request); err != nil {
+		return nil, fmt.Errorf("invalid AuthnRequest: %w", err)
+	}
+	if request.ID == "" || request.ACSURL == "" || request.Issuer == "" {
+		return nil, fmt.Errorf("AuthnRequest requires ID, ACS URL and Issuer")
+	}
+	return &AuthnRequest{ID: request.ID, Issuer: request.Issuer, ACSURL: request.ACSURL}, nil
+}
+
+var idCounter struct {
+	sync.Mutex
+	n int
+}
+
+func newID() string {
+	idCounter.Lock()
+	defer idCounter.Unlock()
+	idCounter.n++
+	return fmt.Sprintf("_samltest_%d_%d", time.Now().UnixNano(), idCounter.n)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func formValue(body []byte, name string) string {
+	match := regexp.MustCompile(`name="` + name + `" value="([^"]*)"`).FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	return html.UnescapeString(string(match[1]))
+}
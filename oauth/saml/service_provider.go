@@ -0,0 +1,224 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/oauth"
+)
+
+// Config configures a SAML service provider
+type Config struct {
+	// EntityID identifies this SP to the IdP (usually its metadata URL)
+	EntityID string
+
+	// ACSURL is the Assertion Consumer Service endpoint receiving POSTed responses
+	ACSURL string
+
+	// IDP is the identity provider's metadata
+	IDP *IDPMetadata
+
+	// NameIDFormat requested in AuthnRequests (empty lets the IdP choose)
+	NameIDFormat string
+
+	// Signer signs AuthnRequests and is published in SP metadata
+	Signer *Signer
+
+	// SignAuthnRequests signs requests even if the IdP does not ask for it
+	SignAuthnRequests bool
+
+	// ForceAuthn asks the IdP to re-authenticate the user
+	ForceAuthn bool
+
+	// ClockSkew tolerated when checking validity windows (default 2m)
+	ClockSkew time.Duration
+
+	// RequireSignedAssertion rejects responses where only the Response is signed
+	RequireSignedAssertion bool
+
+	// AllowIdPInitiated accepts unsolicited responses (no InResponseTo)
+	AllowIdPInitiated bool
+
+	// TrustEmail marks mapped emails as verified. Enable only for IdPs that
+	// are authoritative for their users' email domains.
+	TrustEmail bool
+
+	// Attributes maps assertion attributes to oauth.UserInfo fields
+	Attributes AttributeMapping
+
+	// RequestLifetime bounds how long an AuthnRequest may stay pending (default 10m)
+	RequestLifetime time.Duration
+}
+
+// ServiceProvider creates AuthnRequests and validates Responses
+type ServiceProvider struct {
+	config Config
+	replay *replayCache
+}
+
+// NewServiceProvider creates a service provider
+func NewServiceProvider(cfg Config) (*ServiceProvider, error) {
+	if cfg.EntityID == "" || cfg.ACSURL == "" {
+		return nil, fmt.Errorf("%w: EntityID and ACSURL are required", oauth.ErrInvalidConfig)
+	}
+	if cfg.IDP == nil || cfg.IDP.SSOURL == "" || len(cfg.IDP.SigningCertificates) == 0 {
+		return nil, fmt.Errorf("%w: IdP metadata with an SSO URL and signing certificate is required", oauth.ErrInvalidConfig)
+	}
+	if (cfg.SignAuthnRequests || cfg.IDP.WantAuthnRequestsSigned) && cfg.Signer == nil {
+		return nil, fmt.Errorf("%w: a Signer is required to sign AuthnRequests", oauth.ErrInvalidConfig)
+	}
+	if cfg.ClockSkew <= 0 {
+		cfg.ClockSkew = 2 * time.Minute
+	}
+	if cfg.RequestLifetime <= 0 {
+		cfg.RequestLifetime = 10 * time.Minute
+	}
+	cfg.Attributes = cfg.Attributes.withDefaults()
+
+	return &ServiceProvider{config: cfg, replay: newReplayCache()}, nil
+}
+
+// Config returns the service provider configuration
+func (sp *ServiceProvider) Config() Config {
+	return sp.config
+}
+
+type authnRequest struct {
+	XMLName                     xml.Name      `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string        `xml:"ID,attr"`
+	Version                     string        `xml:"Version,attr"`
+	IssueInstant                string        `xml:"IssueInstant,attr"`
+	Destination                 string        `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string        `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string        `xml:"ProtocolBinding,attr"`
+	ForceAuthn                  bool          `xml:"ForceAuthn,attr,omitempty"`
+	Issuer                      string        `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                *nameIDPolicy `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+}
+
+type nameIDPolicy struct {
+	Format      string `xml:"Format,attr,omitempty"`
+	AllowCreate bool   `xml:"AllowCreate,attr"`
+}
+
+// AuthnRequestURL returns the IdP URL carrying a new AuthnRequest (HTTP-Redirect
+// binding) and the request ID to match against the response's InResponseTo
+func (sp *ServiceProvider) AuthnRequestURL(relayState string) (string, string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", "", err
+	}
+
+	request := authnRequest{
+		ID:                          id,
+		Version:                     "2.0",
+		IssueInstant:                formatTime(time.Now()),
+		Destination:                 sp.config.IDP.SSOURL,
+		AssertionConsumerServiceURL: sp.config.ACSURL,
+		ProtocolBinding:             BindingHTTPPost,
+		ForceAuthn:                  sp.config.ForceAuthn,
+		Issuer:                      sp.config.EntityID,
+		NameIDPolicy:                &nameIDPolicy{Format: sp.config.NameIDFormat, AllowCreate: true},
+	}
+	data, err := xml.Marshal(request)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode AuthnRequest: %w", err)
+	}
+
+	var deflated bytes.Buffer
+	w, _ := flate.NewWriter(&deflated, flate.BestCompression)
+	if _, err := w.Write(data); err != nil {
+		return "", "", fmt.Errorf("failed to compress AuthnRequest: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", "", fmt.Errorf("failed to compress AuthnRequest: %w", err)
+	}
+
+	// The signature covers the exact encoded query, so build it by hand
+	query := "SAMLRequest=" + url.QueryEscape(base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	if relayState != "" {
+		query += "&RelayState=" + url.QueryEscape(relayState)
+	}
+	if sp.config.SignAuthnRequests || sp.config.IDP.WantAuthnRequestsSigned {
+		query += "&SigAlg=" + url.QueryEscape(algRSASHA256)
+		signature, err := sp.config.Signer.signQuery(query)
+		if err != nil {
+			return "", "", err
+		}
+		query += "&Signature=" + url.QueryEscape(signature)
+	}
+
+	separator := "?"
+	if strings.Contains(sp.config.IDP.SSOURL, "?") {
+		separator = "&"
+	}
+	return sp.config.IDP.SSOURL + separator + query, id, nil
+}
+
+// Metadata returns the SP metadata document to register with the IdP
+func (sp *ServiceProvider) Metadata() ([]byte, error) {
+	descriptor := spSSODescriptor{
+		AuthnRequestsSigned:        sp.config.SignAuthnRequests || sp.config.IDP.WantAuthnRequestsSigned,
+		WantAssertionsSigned:       sp.config.RequireSignedAssertion,
+		ProtocolSupportEnumeration: protocolSupport,
+		AssertionConsumerServices: []indexedEndpoint{
+			{Binding: BindingHTTPPost, Location: sp.config.ACSURL, Index: 0, IsDefault: true},
+		},
+	}
+	if sp.config.NameIDFormat != "" {
+		descriptor.NameIDFormats = []string{sp.config.NameIDFormat}
+	}
+	if sp.config.Signer != nil {
+		descriptor.KeyDescriptors = []keyDescriptor{{
+			Use: "signing",
+			KeyInfo: keyInfo{X509Data: x509Data{
+				Certificates: []string{base64.StdEncoding.EncodeToString(sp.config.Signer.Certificate.Raw)},
+			}},
+		}}
+	}
+
+	data, err := xml.MarshalIndent(entityDescriptor{
+		EntityID:         sp.config.EntityID,
+		SPSSODescriptors: []spSSODescriptor{descriptor},
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// MetadataHandler serves the SP metadata
+func (sp *ServiceProvider) MetadataHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := sp.Metadata()
+		if err != nil {
+			http.Error(w, "metadata unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/samlmetadata+xml")
+		_, _ = w.Write(data)
+	})
+}
+
+// newID returns a random xs:ID (which must not start with a digit)
+func newID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
+
+// formatTime formats an xs:dateTime in UTC
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
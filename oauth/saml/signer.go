@@ -0,0 +1,123 @@
+package saml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Signer holds an RSA key pair used to sign SAML messages. The certificate
+// is published in metadata so the other party can verify signatures;
+// self-signed certificates are normal in SAML.
+type Signer struct {
+	Key         *rsa.PrivateKey
+	Certificate *x509.Certificate
+}
+
+// NewSelfSignedSigner generates a 2048-bit RSA key and a self-signed
+// certificate valid for ten years
+func NewSelfSignedSigner(commonName string) (*Signer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return &Signer{Key: key, Certificate: cert}, nil
+}
+
+// ParseSigner loads a signer from a PEM certificate and a PEM RSA private
+// key (PKCS#1 or PKCS#8)
+func ParseSigner(certPEM, keyPEM string) (*Signer, error) {
+	cert, err := parseCertificatePEM(certPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode private key PEM")
+	}
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		var ok bool
+		if key, ok = parsed.(*rsa.PrivateKey); !ok {
+			return nil, fmt.Errorf("private key is not an RSA key")
+		}
+	} else if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok || !pub.Equal(&key.PublicKey) {
+		return nil, fmt.Errorf("certificate does not match private key")
+	}
+
+	return &Signer{Key: key, Certificate: cert}, nil
+}
+
+// SignXML adds an enveloped XML signature to the root element of doc, which
+// must carry an ID attribute
+func (s *Signer) SignXML(doc []byte) ([]byte, error) {
+	root, err := parseXML(doc)
+	if err != nil {
+		return nil, err
+	}
+	if err := signElement(root, s.Key, s.Certificate); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	root.serialize(&buf)
+	return buf.Bytes(), nil
+}
+
+// signQuery signs an HTTP-Redirect binding query string with RSA-SHA256
+func (s *Signer) signQuery(query string) (string, error) {
+	hashed := sha256.Sum256([]byte(query))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.Key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign request: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+func parseCertificatePEM(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,258 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xmlNamespace is the namespace bound to the reserved xml prefix
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// element is a minimal DOM node that keeps namespace prefixes and
+// declarations exactly as written, which XML-DSig canonicalization needs and
+// encoding/xml's namespace-translating decoder does not preserve
+type element struct {
+	Prefix   string
+	Local    string
+	Attrs    []xml.Attr    // Name.Space holds the prefix; includes xmlns declarations
+	Children []interface{} // *element or string (character data)
+	Parent   *element
+}
+
+// parseXML parses a document into an element tree. DTDs are rejected, and
+// comments and processing instructions are dropped.
+func parseXML(data []byte) (*element, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+
+	var root, current *element
+	for {
+		token, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed XML: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if root != nil && current == nil {
+				return nil, fmt.Errorf("malformed XML: multiple root elements")
+			}
+			el := &element{
+				Prefix: t.Name.Space,
+				Local:  t.Name.Local,
+				Attrs:  append([]xml.Attr(nil), t.Attr...),
+				Parent: current,
+			}
+			if current == nil {
+				root = el
+			} else {
+				current.Children = append(current.Children, el)
+			}
+			current = el
+		case xml.EndElement:
+			if current == nil || current.Prefix != t.Name.Space || current.Local != t.Name.Local {
+				return nil, fmt.Errorf("malformed XML: unexpected end element %s", t.Name.Local)
+			}
+			current = current.Parent
+		case xml.CharData:
+			if current != nil {
+				current.Children = append(current.Children, string(t))
+			} else if len(bytes.TrimSpace(t)) > 0 {
+				return nil, fmt.Errorf("malformed XML: text outside root element")
+			}
+		case xml.Directive:
+			return nil, fmt.Errorf("malformed XML: DTDs are not allowed")
+		}
+	}
+
+	if root == nil || current != nil {
+		return nil, fmt.Errorf("malformed XML: incomplete document")
+	}
+	if err := root.checkNamespaces(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// checkNamespaces ensures every prefix in the tree is bound
+func (e *element) checkNamespaces() error {
+	if _, ok := e.lookupNamespace(e.Prefix); !ok && e.Prefix != "" {
+		return fmt.Errorf("malformed XML: unbound prefix %q", e.Prefix)
+	}
+	for _, attr := range e.Attrs {
+		if attr.Name.Space == "" || attr.Name.Space == "xmlns" {
+			continue
+		}
+		if _, ok := e.lookupNamespace(attr.Name.Space); !ok {
+			return fmt.Errorf("malformed XML: unbound prefix %q", attr.Name.Space)
+		}
+	}
+	for _, child := range e.Children {
+		if el, ok := child.(*element); ok {
+			if err := el.checkNamespaces(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookupNamespace resolves a prefix ("" for the default namespace) in scope
+func (e *element) lookupNamespace(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlNamespace, true
+	}
+	for el := e; el != nil; el = el.Parent {
+		for _, attr := range el.Attrs {
+			if (prefix == "" && attr.Name.Space == "" && attr.Name.Local == "xmlns") ||
+				(prefix != "" && attr.Name.Space == "xmlns" && attr.Name.Local == prefix) {
+				return attr.Value, true
+			}
+		}
+	}
+	return "", prefix == ""
+}
+
+// Namespace returns the namespace URI of the element
+func (e *element) Namespace() string {
+	ns, _ := e.lookupNamespace(e.Prefix)
+	return ns
+}
+
+// is reports whether the element has the given namespace and local name
+func (e *element) is(namespace, local string) bool {
+	return e.Local == local && e.Namespace() == namespace
+}
+
+// attr returns the value of an unqualified attribute
+func (e *element) attr(name string) string {
+	for _, attr := range e.Attrs {
+		if attr.Name.Space == "" && attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// children returns the child elements with the given namespace and local name
+func (e *element) children(namespace, local string) []*element {
+	var result []*element
+	for _, child := range e.Children {
+		if el, ok := child.(*element); ok && el.is(namespace, local) {
+			result = append(result, el)
+		}
+	}
+	return result
+}
+
+// child returns the first child element with the given name, or nil
+func (e *element) child(namespace, local string) *element {
+	for _, child := range e.Children {
+		if el, ok := child.(*element); ok && el.is(namespace, local) {
+			return el
+		}
+	}
+	return nil
+}
+
+// text returns the element's direct character data, trimmed
+func (e *element) text() string {
+	var b strings.Builder
+	for _, child := range e.Children {
+		if s, ok := child.(string); ok {
+			b.WriteString(s)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// qname returns the element name as written
+func (e *element) qname() string {
+	if e.Prefix == "" {
+		return e.Local
+	}
+	return e.Prefix + ":" + e.Local
+}
+
+// removeChild detaches a child element
+func (e *element) removeChild(target *element) {
+	for i, child := range e.Children {
+		if child == target {
+			e.Children = append(e.Children[:i:i], e.Children[i+1:]...)
+			return
+		}
+	}
+}
+
+// insertChild inserts a child element at index
+func (e *element) insertChild(index int, child *element) {
+	child.Parent = e
+	e.Children = append(e.Children[:index], append([]interface{}{child}, e.Children[index:]...)...)
+}
+
+// collectIDs returns the ID attributes of the element and its descendants,
+// failing on duplicates (a signature wrapping precondition)
+func (e *element) collectIDs(seen map[string]bool) error {
+	if id := e.attr("ID"); id != "" {
+		if seen[id] {
+			return fmt.Errorf("duplicate ID %q", id)
+		}
+		seen[id] = true
+	}
+	for _, child := range e.Children {
+		if el, ok := child.(*element); ok {
+			if err := el.collectIDs(seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// serialize writes the element as XML, keeping prefixes and declarations
+func (e *element) serialize(buf *bytes.Buffer) {
+	buf.WriteByte('<')
+	buf.WriteString(e.qname())
+	for _, attr := range e.Attrs {
+		buf.WriteByte(' ')
+		if attr.Name.Space != "" {
+			buf.WriteString(attr.Name.Space)
+			buf.WriteByte(':')
+		}
+		buf.WriteString(attr.Name.Local)
+		buf.WriteString(`="`)
+		buf.WriteString(escapeAttr(attr.Value))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('>')
+	for _, child := range e.Children {
+		switch c := child.(type) {
+		case *element:
+			c.serialize(buf)
+		case string:
+			buf.WriteString(escapeText(c))
+		}
+	}
+	buf.WriteString("</")
+	buf.WriteString(e.qname())
+	buf.WriteByte('>')
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;",
+		"\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+// escapeText escapes character data as required by canonical XML
+func escapeText(s string) string { return textEscaper.Replace(s) }
+
+// escapeAttr escapes attribute values as required by canonical XML
+func escapeAttr(s string) string { return attrEscaper.Replace(s) }
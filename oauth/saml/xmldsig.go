@@ -0,0 +1,392 @@
+package saml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// XML-DSig algorithm identifiers
+const (
+	dsigNamespace = "http://www.w3.org/2000/09/xmldsig#"
+
+	algExcC14N          = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped        = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algSHA256           = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algSHA512           = "http://www.w3.org/2001/04/xmlenc#sha512"
+	algRSASHA256        = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512        = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	algECDSASHA256      = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	algECDSASHA512      = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512"
+	inclusiveNamespaces = "InclusiveNamespaces"
+)
+
+// Only SHA-2 digests are accepted; SHA-1 signatures are rejected
+var (
+	digestAlgorithms = map[string]crypto.Hash{
+		algSHA256: crypto.SHA256,
+		algSHA512: crypto.SHA512,
+	}
+	signatureAlgorithms = map[string]crypto.Hash{
+		algRSASHA256:   crypto.SHA256,
+		algRSASHA512:   crypto.SHA512,
+		algECDSASHA256: crypto.SHA256,
+		algECDSASHA512: crypto.SHA512,
+	}
+)
+
+// canonicalize serializes e with Exclusive XML Canonicalization (without
+// comments), omitting the exclude subtree (the enveloped signature).
+// inclusive lists prefixes from an InclusiveNamespaces PrefixList.
+func canonicalize(e, exclude *element, inclusive []string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c14nElement(&buf, e, exclude, map[string]string{}, inclusive); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type nsDecl struct{ prefix, uri string }
+
+type c14nAttr struct {
+	uri   string
+	qname string
+	local string
+	value string
+}
+
+func c14nElement(buf *bytes.Buffer, e, exclude *element, rendered map[string]string, inclusive []string) error {
+	// Namespaces visibly utilized by the element and its attributes, plus
+	// those listed in InclusiveNamespaces when they are in scope
+	needed := map[string]bool{e.Prefix: true}
+	for _, attr := range e.Attrs {
+		if attr.Name.Space != "" && attr.Name.Space != "xmlns" {
+			needed[attr.Name.Space] = true
+		}
+	}
+	for _, prefix := range inclusive {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		if _, ok := e.lookupNamespace(prefix); ok {
+			needed[prefix] = true
+		}
+	}
+
+	next := make(map[string]string, len(rendered))
+	for k, v := range rendered {
+		next[k] = v
+	}
+
+	var decls []nsDecl
+	for prefix := range needed {
+		if prefix == "xml" {
+			continue
+		}
+		uri, ok := e.lookupNamespace(prefix)
+		if !ok {
+			return fmt.Errorf("unbound prefix %q", prefix)
+		}
+		previous, wasRendered := rendered[prefix]
+		if prefix == "" && uri == "" && (!wasRendered || previous == "") {
+			continue // no default namespace to undeclare
+		}
+		if wasRendered && previous == uri {
+			continue
+		}
+		decls = append(decls, nsDecl{prefix, uri})
+		next[prefix] = uri
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].prefix < decls[j].prefix })
+
+	var attrs []c14nAttr
+	for _, attr := range e.Attrs {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+		a := c14nAttr{local: attr.Name.Local, qname: attr.Name.Local, value: attr.Value}
+		if attr.Name.Space != "" {
+			a.uri, _ = e.lookupNamespace(attr.Name.Space)
+			a.qname = attr.Name.Space + ":" + attr.Name.Local
+		}
+		attrs = append(attrs, a)
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].uri != attrs[j].uri {
+			return attrs[i].uri < attrs[j].uri
+		}
+		return attrs[i].local < attrs[j].local
+	})
+
+	buf.WriteByte('<')
+	buf.WriteString(e.qname())
+	for _, d := range decls {
+		if d.prefix == "" {
+			buf.WriteString(` xmlns="`)
+		} else {
+			buf.WriteString(" xmlns:" + d.prefix + `="`)
+		}
+		buf.WriteString(escapeAttr(d.uri))
+		buf.WriteByte('"')
+	}
+	for _, a := range attrs {
+		buf.WriteString(" " + a.qname + `="`)
+		buf.WriteString(escapeAttr(a.value))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('>')
+
+	for _, child := range e.Children {
+		switch c := child.(type) {
+		case *element:
+			if c == exclude {
+				continue
+			}
+			if err := c14nElement(buf, c, exclude, next, inclusive); err != nil {
+				return err
+			}
+		case string:
+			buf.WriteString(escapeText(c))
+		}
+	}
+
+	buf.WriteString("</")
+	buf.WriteString(e.qname())
+	buf.WriteByte('>')
+	return nil
+}
+
+// inclusivePrefixes reads the PrefixList of an InclusiveNamespaces child
+func inclusivePrefixes(transform *element) []string {
+	if transform == nil {
+		return nil
+	}
+	list := transform.child(algExcC14N, inclusiveNamespaces)
+	if list == nil {
+		return nil
+	}
+	return strings.Fields(list.attr("PrefixList"))
+}
+
+// verifySignature checks the enveloped signature that is a direct child of
+// e. The signature must reference e itself by ID, so callers can trust the
+// content of e (and only e) afterwards. Keys embedded in the signature are
+// ignored; only the given certificates are trusted.
+func verifySignature(e *element, certs []*x509.Certificate) error {
+	signatures := e.children(dsigNamespace, "Signature")
+	if len(signatures) == 0 {
+		return fmt.Errorf("%w: element is not signed", ErrInvalidSignature)
+	}
+	if len(signatures) > 1 {
+		return fmt.Errorf("%w: multiple signatures", ErrInvalidSignature)
+	}
+	signature := signatures[0]
+
+	signedInfo := signature.child(dsigNamespace, "SignedInfo")
+	if signedInfo == nil {
+		return fmt.Errorf("%w: missing SignedInfo", ErrInvalidSignature)
+	}
+
+	c14nMethod := signedInfo.child(dsigNamespace, "CanonicalizationMethod")
+	if c14nMethod == nil || c14nMethod.attr("Algorithm") != algExcC14N {
+		return fmt.Errorf("%w: unsupported canonicalization method", ErrInvalidSignature)
+	}
+	signatureMethod := signedInfo.child(dsigNamespace, "SignatureMethod")
+	if signatureMethod == nil {
+		return fmt.Errorf("%w: missing SignatureMethod", ErrInvalidSignature)
+	}
+	signatureHash, ok := signatureAlgorithms[signatureMethod.attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("%w: unsupported signature method %q", ErrInvalidSignature, signatureMethod.attr("Algorithm"))
+	}
+
+	references := signedInfo.children(dsigNamespace, "Reference")
+	if len(references) != 1 {
+		return fmt.Errorf("%w: expected exactly one reference", ErrInvalidSignature)
+	}
+	reference := references[0]
+	id := e.attr("ID")
+	if id == "" || reference.attr("URI") != "#"+id {
+		return fmt.Errorf("%w: signature does not reference the signed element", ErrInvalidSignature)
+	}
+
+	var prefixes []string
+	enveloped, excC14N := false, false
+	if transforms := reference.child(dsigNamespace, "Transforms"); transforms != nil {
+		for _, transform := range transforms.children(dsigNamespace, "Transform") {
+			switch transform.attr("Algorithm") {
+			case algEnveloped:
+				enveloped = true
+			case algExcC14N:
+				excC14N = true
+				prefixes = inclusivePrefixes(transform)
+			default:
+				return fmt.Errorf("%w: unsupported transform %q", ErrInvalidSignature, transform.attr("Algorithm"))
+			}
+		}
+	}
+	if !enveloped || !excC14N {
+		return fmt.Errorf("%w: expected enveloped-signature and exclusive c14n transforms", ErrInvalidSignature)
+	}
+
+	digestMethod := reference.child(dsigNamespace, "DigestMethod")
+	if digestMethod == nil {
+		return fmt.Errorf("%w: missing DigestMethod", ErrInvalidSignature)
+	}
+	digestHash, ok := digestAlgorithms[digestMethod.attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("%w: unsupported digest method %q", ErrInvalidSignature, digestMethod.attr("Algorithm"))
+	}
+	digestValue := reference.child(dsigNamespace, "DigestValue")
+	if digestValue == nil {
+		return fmt.Errorf("%w: missing DigestValue", ErrInvalidSignature)
+	}
+	expectedDigest, err := decodeBase64(digestValue.text())
+	if err != nil {
+		return fmt.Errorf("%w: invalid DigestValue", ErrInvalidSignature)
+	}
+
+	canonical, err := canonicalize(e, signature, prefixes)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	h := digestHash.New()
+	h.Write(canonical)
+	if subtle.ConstantTimeCompare(h.Sum(nil), expectedDigest) != 1 {
+		return fmt.Errorf("%w: digest mismatch", ErrInvalidSignature)
+	}
+
+	signatureValue := signature.child(dsigNamespace, "SignatureValue")
+	if signatureValue == nil {
+		return fmt.Errorf("%w: missing SignatureValue", ErrInvalidSignature)
+	}
+	sig, err := decodeBase64(signatureValue.text())
+	if err != nil {
+		return fmt.Errorf("%w: invalid SignatureValue", ErrInvalidSignature)
+	}
+
+	canonicalInfo, err := canonicalize(signedInfo, nil, inclusivePrefixes(c14nMethod))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	h = signatureHash.New()
+	h.Write(canonicalInfo)
+	hashed := h.Sum(nil)
+
+	for _, cert := range certs {
+		if verifyWithKey(cert.PublicKey, signatureHash, hashed, sig) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: signature does not match any trusted certificate", ErrInvalidSignature)
+}
+
+func verifyWithKey(key crypto.PublicKey, hash crypto.Hash, hashed, sig []byte) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, hash, hashed, sig) == nil
+	case *ecdsa.PublicKey:
+		// XML-DSig encodes ECDSA signatures as r || s
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(k, hashed, r, s)
+	}
+	return false
+}
+
+// signElement adds an enveloped RSA-SHA256 signature to e, placed after its
+// Issuer child as the SAML schema requires
+func signElement(e *element, key *rsa.PrivateKey, cert *x509.Certificate) error {
+	id := e.attr("ID")
+	if id == "" {
+		return fmt.Errorf("element %s has no ID attribute", e.Local)
+	}
+	if len(e.children(dsigNamespace, "Signature")) > 0 {
+		return fmt.Errorf("element %s is already signed", e.Local)
+	}
+
+	canonical, err := canonicalize(e, nil, nil)
+	if err != nil {
+		return err
+	}
+	digest := crypto.SHA256.New()
+	digest.Write(canonical)
+
+	ds := func(local string, attrs ...xml.Attr) *element {
+		return &element{Prefix: "ds", Local: local, Attrs: attrs}
+	}
+	algorithm := func(uri string) xml.Attr {
+		return xml.Attr{Name: xml.Name{Local: "Algorithm"}, Value: uri}
+	}
+	appendChildren := func(parent *element, children ...interface{}) *element {
+		for _, child := range children {
+			if el, ok := child.(*element); ok {
+				el.Parent = parent
+			}
+			parent.Children = append(parent.Children, child)
+		}
+		return parent
+	}
+
+	transforms := appendChildren(ds("Transforms"),
+		ds("Transform", algorithm(algEnveloped)),
+		ds("Transform", algorithm(algExcC14N)))
+	reference := appendChildren(ds("Reference", xml.Attr{Name: xml.Name{Local: "URI"}, Value: "#" + id}),
+		transforms,
+		ds("DigestMethod", algorithm(algSHA256)),
+		appendChildren(ds("DigestValue"), base64.StdEncoding.EncodeToString(digest.Sum(nil))))
+	signedInfo := appendChildren(ds("SignedInfo"),
+		ds("CanonicalizationMethod", algorithm(algExcC14N)),
+		ds("SignatureMethod", algorithm(algRSASHA256)),
+		reference)
+	signatureValue := ds("SignatureValue")
+	signature := appendChildren(ds("Signature", xml.Attr{Name: xml.Name{Space: "xmlns", Local: "ds"}, Value: dsigNamespace}),
+		signedInfo,
+		signatureValue,
+		appendChildren(ds("KeyInfo"),
+			appendChildren(ds("X509Data"),
+				appendChildren(ds("X509Certificate"), base64.StdEncoding.EncodeToString(cert.Raw)))))
+
+	index := 0
+	for i, child := range e.Children {
+		if el, ok := child.(*element); ok && el.Local == "Issuer" {
+			index = i + 1
+			break
+		}
+	}
+	e.insertChild(index, signature)
+
+	canonicalInfo, err := canonicalize(signedInfo, nil, nil)
+	if err != nil {
+		e.removeChild(signature)
+		return err
+	}
+	hashed := crypto.SHA256.New()
+	hashed.Write(canonicalInfo)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed.Sum(nil))
+	if err != nil {
+		e.removeChild(signature)
+		return fmt.Errorf("failed to sign: %w", err)
+	}
+	appendChildren(signatureValue, base64.StdEncoding.EncodeToString(sig))
+	return nil
+}
+
+// decodeBase64 decodes standard base64, ignoring embedded whitespace
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
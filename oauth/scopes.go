@@ -0,0 +1,185 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Scopes returns the granted scopes. Both space-delimited (RFC 6749) and
+// comma-delimited (GitHub) scope strings are accepted.
+func (t *Token) Scopes() []string {
+	return parseScopes(t.Scope)
+}
+
+// HasScopes reports whether the token was granted every scope
+func (t *Token) HasScopes(scopes ...string) bool {
+	return len(missingScopes(t.Scopes(), scopes)) == 0
+}
+
+// WithScopes requests scopes in addition to the provider's configured ones,
+// e.g. to ask for Drive access after an openid email login
+func WithScopes(scopes ...string) AuthOption {
+	return func(o *authOptions) {
+		o.scopes = append(o.scopes, scopes...)
+	}
+}
+
+// WithIncludeGrantedScopes asks the provider to add previously granted scopes
+// to the new token (include_granted_scopes=true), so an upgrade doesn't
+// narrow the user's grant. Google honors it; other providers ignore it.
+func WithIncludeGrantedScopes() AuthOption {
+	return WithAuthParam("include_granted_scopes", "true")
+}
+
+// WithPrompt sets the prompt parameter, e.g. "consent" to show the consent
+// screen again or "select_account"
+func WithPrompt(prompt string) AuthOption {
+	return WithAuthParam("prompt", prompt)
+}
+
+// WithAuthParam sets an additional authorization request parameter,
+// replacing any value set by the provider
+func WithAuthParam(key, value string) AuthOption {
+	return func(o *authOptions) {
+		if o.params == nil {
+			o.params = url.Values{}
+		}
+		o.params.Set(key, value)
+	}
+}
+
+// ScopeCheck is the result of CheckScopes
+type ScopeCheck struct {
+	// Granted reports whether the stored token covers every required scope
+	Granted bool
+
+	// Missing lists the required scopes the token lacks
+	Missing []string
+
+	// AuthURL and State start the upgrade flow when Granted is false;
+	// complete it with Exchange and cache the new token
+	AuthURL string
+	State   string
+}
+
+// CheckScopes reports whether the user's cached token for provider covers
+// the required scopes. If it doesn't, or no token is cached, it returns an
+// authorization URL requesting the missing scopes together with those
+// already granted, with include_granted_scopes and prompt=consent. opts are
+// passed to GetAuthURL and can override those defaults.
+func (tm *AdvancedTokenManager) CheckScopes(ctx context.Context, userID, provider string, required []string, opts ...AuthOption) (*ScopeCheck, error) {
+	var granted []string
+	if token, err := tm.GetCachedToken(ctx, userID, provider); err == nil {
+		granted = token.Scopes()
+	}
+
+	missing := missingScopes(granted, required)
+	if len(missing) == 0 {
+		return &ScopeCheck{Granted: true}, nil
+	}
+
+	if tm.providerService == nil {
+		return nil, fmt.Errorf("provider service not configured for scope upgrades")
+	}
+
+	opts = append([]AuthOption{
+		WithScopes(append(granted, missing...)...),
+		WithIncludeGrantedScopes(),
+		WithPrompt("consent"),
+	}, opts...)
+	authURL, state, err := tm.providerService.GetAuthURL(ctx, provider, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ScopeCheck{Missing: missing, AuthURL: authURL, State: state}, nil
+}
+
+// parseScopes splits a scope string on spaces and commas
+func parseScopes(scope string) []string {
+	return strings.FieldsFunc(scope, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+}
+
+// missingScopes returns the required scopes not in granted
+func missingScopes(granted, required []string) []string {
+	var missing []string
+	for _, scope := range required {
+		if !slices.Contains(granted, scope) && !slices.Contains(missing, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// mergeScopes adds extra to a scope string, keeping its order and skipping
+// duplicates. The result is always space-delimited.
+func mergeScopes(scope string, extra []string) string {
+	scopes := parseScopes(scope)
+	for _, s := range extra {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return strings.Join(scopes, " ")
+}
+
+// requestedScope returns the scope an authorization request asked for. PAR
+// and JAR keep it out of the authorization URL, so for those it is rebuilt
+// from the provider's parameters.
+func requestedScope(ctx context.Context, provider Provider, authURL string) string {
+	if u, err := url.Parse(authURL); err == nil && u.Query().Has("scope") {
+		return u.Query().Get("scope")
+	}
+	if p, ok := provider.(interface {
+		authParams(state string, pkce *PKCEChallenge) url.Values
+	}); ok {
+		params := p.authParams("", nil)
+		applyAuthParams(ctx, params)
+		return params.Get("scope")
+	}
+	return ""
+}
+
+type authParamsKey struct{}
+
+// withAuthParams passes extra authorization parameters to buildAuthURL. A
+// "scope" value is merged into the provider's scopes; other values replace
+// the provider's.
+func withAuthParams(ctx context.Context, params url.Values) context.Context {
+	if len(params) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, authParamsKey{}, params)
+}
+
+// applyAuthParams adds the extra parameters from ctx to params
+func applyAuthParams(ctx context.Context, params url.Values) {
+	extra, _ := ctx.Value(authParamsKey{}).(url.Values)
+	for key, values := range extra {
+		if key == "scope" {
+			params.Set("scope", mergeScopes(params.Get("scope"), values))
+			continue
+		}
+		params[key] = values
+	}
+}
+
+// applyAuthURLParams adds the extra parameters from ctx to an authorization URL
+func applyAuthURLParams(ctx context.Context, authURL string) (string, error) {
+	if ctx.Value(authParamsKey{}) == nil {
+		return authURL, nil
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization URL: %w", err)
+	}
+	params := u.Query()
+	applyAuthParams(ctx, params)
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,222 @@
+package oauth_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/oauth"
+)
+
+func TestTokenScopes(t *testing.T) {
+	tests := []struct {
+		scope string
+		want  []string
+	}{
+		{"openid email", []string{"openid", "email"}},
+		{"repo,read:user", []string{"repo", "read:user"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		token := &oauth.Token{Scope: tt.scope}
+		if got := token.Scopes(); !slices.Equal(got, tt.want) {
+			t.Errorf("Scopes(%q) = %v, want %v", tt.scope, got, tt.want)
+		}
+	}
+
+	token := &oauth.Token{Scope: "openid email"}
+	if !token.HasScopes("email") || !token.HasScopes() {
+		t.Error("Expected granted scopes to be covered")
+	}
+	if token.HasScopes("email", "drive") {
+		t.Error("Expected drive to be missing")
+	}
+}
+
+func TestGetAuthURLWithScopes(t *testing.T) {
+	service, _ := oauth.NewMultiProviderService(oauth.MultiProviderConfig{SessionTimeout: time.Minute})
+	_ = service.RegisterProvider("google", oauth.NewGoogle(oauth.ProviderConfig{
+		ClientID:    "client",
+		RedirectURL: "http://localhost/callback",
+		Scopes:      []string{"openid", "email"},
+	}))
+
+	authURL, _, err := service.GetAuthURL(context.Background(), "google",
+		oauth.WithScopes("email", "https://www.googleapis.com/auth/drive.file"),
+		oauth.WithIncludeGrantedScopes(),
+		oauth.WithPrompt("select_account"),
+	)
+	if err != nil {
+		t.Fatalf("GetAuthURL failed: %v", err)
+	}
+
+	u, _ := url.Parse(authURL)
+	query := u.Query()
+	if got := query.Get("scope"); got != "openid email https://www.googleapis.com/auth/drive.file" {
+		t.Errorf("Unexpected scope %q", got)
+	}
+	if query.Get("include_granted_scopes") != "true" {
+		t.Error("Expected include_granted_scopes=true")
+	}
+	if query.Get("prompt") != "select_account" {
+		t.Errorf("Expected prompt to be overridden, got %q", query.Get("prompt"))
+	}
+}
+
+func TestGetAuthURLWithScopesPAR(t *testing.T) {
+	var pushed url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		pushed = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"request_uri":"urn:example:par","expires_in":60}`))
+	}))
+	defer server.Close()
+
+	provider, err := oauth.NewCustom(oauth.ProviderConfig{
+		ClientID:    "client",
+		RedirectURL: "http://localhost/callback",
+		AuthURL:     server.URL + "/authorize",
+		TokenURL:    server.URL + "/token",
+		PARURL:      server.URL + "/par",
+		Scopes:      []string{"openid"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	service, _ := oauth.NewMultiProviderService(oauth.MultiProviderConfig{SessionTimeout: time.Minute})
+	_ = service.RegisterProvider("custom", provider)
+
+	authURL, _, err := service.GetAuthURL(context.Background(), "custom", oauth.WithScopes("repo"), oauth.WithPrompt("consent"))
+	if err != nil {
+		t.Fatalf("GetAuthURL failed: %v", err)
+	}
+	if strings.Contains(authURL, "scope=") {
+		t.Errorf("Expected scopes to be pushed, not in the URL: %s", authURL)
+	}
+	if pushed.Get("scope") != "openid repo" || pushed.Get("prompt") != "consent" {
+		t.Errorf("Unexpected pushed parameters: %v", pushed)
+	}
+}
+
+func TestAdvancedTokenManager_CheckScopes(t *testing.T) {
+	service, _ := oauth.NewMultiProviderService(oauth.MultiProviderConfig{SessionTimeout: time.Minute})
+	_ = service.RegisterProvider("github", oauth.NewGitHub(oauth.ProviderConfig{
+		ClientID:    "client",
+		RedirectURL: "http://localhost/callback",
+	}))
+
+	tm := oauth.NewAdvancedTokenManager(oauth.TokenManagerConfig{
+		Store:           oauth.NewMemoryTokenStore(time.Hour),
+		ProviderService: service,
+	})
+	defer tm.Stop()
+	ctx := context.Background()
+
+	_ = tm.CacheToken(ctx, "user", "github", &oauth.Token{
+		AccessToken: "at",
+		TokenType:   "Bearer",
+		ExpiresAt:   time.Now().Add(time.Hour),
+		Scope:       "read:user,user:email",
+	})
+
+	check, err := tm.CheckScopes(ctx, "user", "github", []string{"user:email"})
+	if err != nil {
+		t.Fatalf("CheckScopes failed: %v", err)
+	}
+	if !check.Granted || check.AuthURL != "" {
+		t.Errorf("Expected granted scopes, got %+v", check)
+	}
+
+	check, err = tm.CheckScopes(ctx, "user", "github", []string{"user:email", "repo"})
+	if err != nil {
+		t.Fatalf("CheckScopes failed: %v", err)
+	}
+	if check.Granted || !slices.Equal(check.Missing, []string{"repo"}) {
+		t.Fatalf("Expected repo to be missing, got %+v", check)
+	}
+	if _, err := service.ValidateState(ctx, check.State); err != nil {
+		t.Errorf("Expected upgrade state to be stored: %v", err)
+	}
+
+	u, _ := url.Parse(check.AuthURL)
+	query := u.Query()
+	if got := query.Get("scope"); got != "read:user user:email repo" {
+		t.Errorf("Unexpected upgrade scope %q", got)
+	}
+	if query.Get("prompt") != "consent" || query.Get("include_granted_scopes") != "true" {
+		t.Errorf("Expected consent and include_granted_scopes, got %v", query)
+	}
+
+	// Without a cached token every required scope is missing
+	check, _ = tm.CheckScopes(ctx, "other", "github", []string{"repo"})
+	if check.Granted || check.AuthURL == "" {
+		t.Errorf("Expected an upgrade URL for a user without a token, got %+v", check)
+	}
+}
+
+func TestExchangeOmittedScope(t *testing.T) {
+	var tokenScope string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/par" {
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"request_uri":"urn:example:par","expires_in":60}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"access_token":"at","token_type":"Bearer","expires_in":3600%s}`, tokenScope)
+	}))
+	defer server.Close()
+
+	for _, par := range []bool{false, true} {
+		config := oauth.ProviderConfig{
+			ClientID:    "client",
+			RedirectURL: "http://localhost/callback",
+			AuthURL:     server.URL + "/authorize",
+			TokenURL:    server.URL + "/token",
+			Scopes:      []string{"openid"},
+		}
+		if par {
+			config.PARURL = server.URL + "/par"
+		}
+		provider, err := oauth.NewCustom(config)
+		if err != nil {
+			t.Fatalf("Failed to create provider: %v", err)
+		}
+		service, _ := oauth.NewMultiProviderService(oauth.MultiProviderConfig{SessionTimeout: time.Minute})
+		_ = service.RegisterProvider("custom", provider)
+		ctx := context.Background()
+
+		// The server omits scope: the requested scope was granted
+		tokenScope = ""
+		_, state, err := service.GetAuthURL(ctx, "custom", oauth.WithScopes("repo"))
+		if err != nil {
+			t.Fatalf("GetAuthURL failed: %v", err)
+		}
+		token, err := service.Exchange(ctx, "custom", "code", state)
+		if err != nil {
+			t.Fatalf("Exchange failed: %v", err)
+		}
+		if !token.HasScopes("openid", "repo") {
+			t.Errorf("PAR %v: expected the requested scope, got %q", par, token.Scope)
+		}
+
+		// A returned scope is kept as granted
+		tokenScope = `,"scope":"openid"`
+		_, state, _ = service.GetAuthURL(ctx, "custom", oauth.WithScopes("repo"))
+		token, err = service.Exchange(ctx, "custom", "code", state)
+		if err != nil {
+			t.Fatalf("Exchange failed: %v", err)
+		}
+		if token.Scope != "openid" {
+			t.Errorf("PAR %v: expected the granted scope, got %q", par, token.Scope)
+		}
+	}
+}
@@ -36,6 +36,7 @@ type Service struct {
 	sessions SessionStore   // Session storage for state management
 	tokens   TokenStore     // Token storage for caching
 	stateGen StateGenerator // State parameter generator
+	audit    AuditSink      // Audit trail, optional
 }
 
 // Init initializes the global OAuth service instance using the provided configuration
@@ -215,6 +216,12 @@ func (s *Service) GetAuthURL(ctx context.Context) (string, error) {
 		}
 	}
 
+	// Get authorization URL from provider
+	authURL, err := buildAuthURL(ctx, s.provider, state, pkce)
+	if err != nil {
+		return "", fmt.Errorf("failed to build authorization URL: %w", err)
+	}
+
 	// Store session data
 	sessionData := &SessionData{
 		State:         state,
@@ -222,17 +229,31 @@ func (s *Service) GetAuthURL(ctx context.Context) (string, error) {
 		CreatedAt:     time.Now(),
 		ExpiresAt:     time.Now().Add(s.config.StateTimeout),
 		Provider:      s.provider.Name(),
+		Scope:         requestedScope(ctx, s.provider, authURL),
 	}
 
 	if err := s.sessions.Store(ctx, state, sessionData); err != nil {
 		return "", fmt.Errorf("failed to store session: %w", err)
 	}
-
-	// Get authorization URL from provider
-	authURL := s.provider.GetAuthURL(state, pkce)
 	return authURL, nil
 }
 
+type exchangeStateKey struct{}
+
+// WithExchangeState returns a context carrying the validated state of the
+// callback being exchanged. Service and MultiProviderService set it before
+// calling Provider.Exchange, so providers such as SAML can bind the response
+// to the request that started the login.
+func WithExchangeState(ctx context.Context, state string) context.Context {
+	return context.WithValue(ctx, exchangeStateKey{}, state)
+}
+
+// ExchangeStateFromContext returns the state set by WithExchangeState
+func ExchangeStateFromContext(ctx context.Context) (string, bool) {
+	state, ok := ctx.Value(exchangeStateKey{}).(string)
+	return state, ok && state != ""
+}
+
 // Exchange exchanges an authorization code for access and refresh tokens.
 // This method validates the state parameter to prevent CSRF attacks and
 // uses the PKCE verifier if PKCE was enabled during authorization.
@@ -264,10 +285,13 @@ func (s *Service) GetAuthURL(ctx context.Context) (string, error) {
 //
 //	// Use token.AccessToken for API calls
 //	userInfo, err := service.GetUserInfo(ctx, token.AccessToken)
-func (s *Service) Exchange(ctx context.Context, code, state string) (*Token, error) {
+func (s *Service) Exchange(ctx context.Context, code, state string) (token *Token, err error) {
 	if s == nil {
 		return nil, ErrNotInitialized
 	}
+	defer func() {
+		auditOutcome(ctx, s.audit, s.provider.Name(), AuditLoginSucceeded, AuditLoginFailed, err)
+	}()
 
 	// Retrieve and immediately delete session to prevent replay attacks
 	sessionData, err := s.sessions.RetrieveAndDelete(ctx, state)
@@ -297,11 +321,16 @@ func (s *Service) Exchange(ctx context.Context, code, state string) (*Token, err
 	}
 
 	// Exchange code for token
-	token, err := s.provider.Exchange(ctx, code, sessionData.PKCEChallenge)
+	token, err = s.provider.Exchange(WithExchangeState(ctx, state), code, sessionData.PKCEChallenge)
 	if err != nil {
 		return nil, err
 	}
 
+	// An omitted scope means the requested scope was granted (RFC 6749 section 5.1)
+	if token.Scope == "" {
+		token.Scope = sessionData.Scope
+	}
+
 	// Calculate expiration time if not set
 	if token.ExpiresAt.IsZero() && token.ExpiresIn > 0 {
 		token.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
@@ -349,6 +378,7 @@ func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*Token
 	}
 
 	token, err := s.provider.RefreshToken(ctx, refreshToken)
+	auditOutcome(ctx, s.audit, s.provider.Name(), AuditTokenRefreshed, AuditTokenRefreshFailed, err)
 	if err != nil {
 		return nil, err
 	}
@@ -401,10 +431,13 @@ func (s *Service) GetUserInfo(ctx context.Context, accessToken string) (*UserInf
 }
 
 // ValidateState validates the state parameter for CSRF protection
-func (s *Service) ValidateState(ctx context.Context, state string) error {
+func (s *Service) ValidateState(ctx context.Context, state string) (err error) {
 	if s == nil {
 		return ErrNotInitialized
 	}
+	defer func() {
+		auditOutcome(ctx, s.audit, s.provider.Name(), "", AuditStateInvalid, err)
+	}()
 
 	sessionData, err := s.sessions.Retrieve(ctx, state)
 	if err != nil {
@@ -418,6 +451,13 @@ func (s *Service) ValidateState(ctx context.Context, state string) error {
 	return nil
 }
 
+// WithAuditSink records logins, refreshes and state failures to sink. Call it
+// before the service is used.
+func (s *Service) WithAuditSink(sink AuditSink) *Service {
+	s.audit = sink
+	return s
+}
+
 // Provider returns the current provider
 func (s *Service) Provider() Provider {
 	if s == nil {
@@ -0,0 +1,569 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/config"
+)
+
+// Grant types for machine-to-machine flows
+const (
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange" // RFC 8693
+	GrantTypeJWTBearer         = "urn:ietf:params:oauth:grant-type:jwt-bearer"     // RFC 7523
+)
+
+// Token type identifiers (RFC 8693 section 3)
+const (
+	TokenTypeAccessToken  = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeRefreshToken = "urn:ietf:params:oauth:token-type:refresh_token"
+	TokenTypeIDToken      = "urn:ietf:params:oauth:token-type:id_token"
+	TokenTypeJWT          = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// Client authentication methods for the token endpoint
+const (
+	AuthMethodClientSecretBasic = "client_secret_basic"
+	AuthMethodClientSecretPost  = "client_secret_post"
+	AuthMethodPrivateKeyJWT     = "private_key_jwt"
+	AuthMethodNone              = "none"
+)
+
+// ServiceClientConfig configures a machine-to-machine OAuth client
+type ServiceClientConfig struct {
+	// ClientID identifies this service at the authorization server
+	ClientID string `env:"OAUTH_SERVICE_CLIENT_ID,required"`
+
+	// ClientSecret authenticates the client (client_secret_basic/post)
+	ClientSecret string `env:"OAUTH_SERVICE_CLIENT_SECRET"`
+
+	// TokenURL is the authorization server's token endpoint
+	TokenURL string `env:"OAUTH_SERVICE_TOKEN_URL,required"`
+
+	// Scopes requested for client_credentials tokens
+	Scopes []string `env:"OAUTH_SERVICE_SCOPES"`
+
+	// Audience of the requested tokens (sent as the audience parameter)
+	Audience string `env:"OAUTH_SERVICE_AUDIENCE"`
+
+	// AuthMethod selects client authentication. Defaults to private_key_jwt
+	// when a private key is configured, otherwise client_secret_basic.
+	AuthMethod string `env:"OAUTH_SERVICE_AUTH_METHOD"`
+
+	// PrivateKey is a PEM encoded RSA or ECDSA key used for private_key_jwt
+	// client authentication and JWT-bearer assertions
+	PrivateKey string `env:"OAUTH_SERVICE_PRIVATE_KEY"`
+
+	// KeyID is placed in the kid header of signed assertions
+	KeyID string `env:"OAUTH_SERVICE_KEY_ID"`
+
+	// AssertionLifetime bounds the validity of signed assertions
+	AssertionLifetime time.Duration `env:"OAUTH_SERVICE_ASSERTION_LIFETIME" envDefault:"5m"`
+
+	// ExpiryDelta refreshes cached tokens this long before they expire
+	ExpiryDelta time.Duration `env:"OAUTH_SERVICE_EXPIRY_DELTA" envDefault:"30s"`
+
+	// EndpointParams are added to every token request (e.g. resource)
+	EndpointParams url.Values `env:"-"`
+
+	// HTTPClient used for token requests
+	HTTPClient HTTPClient `env:"-"`
+}
+
+// GetServiceClientConfig returns service client config loaded from environment
+func GetServiceClientConfig(opts ...config.Option) (*ServiceClientConfig, error) {
+	cfg := &ServiceClientConfig{}
+	if err := config.Load(cfg, opts...); err != nil {
+		return nil, fmt.Errorf("failed to load service client config: %w", err)
+	}
+	return cfg, nil
+}
+
+// TokenSource supplies tokens for outgoing requests
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenSourceFunc adapts a function to the TokenSource interface
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+// Token returns a token from the function
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// ServiceClient obtains tokens for service-to-service calls using the
+// client_credentials, token exchange (RFC 8693) and JWT-bearer (RFC 7523) grants.
+//
+// Example:
+//
+//	client, err := oauth.NewServiceClient(oauth.ServiceClientConfig{
+//	    ClientID:     "billing-service",
+//	    ClientSecret: os.Getenv("BILLING_CLIENT_SECRET"),
+//	    TokenURL:     "https://auth.internal/oauth/token",
+//	    Scopes:       []string{"invoices:read"},
+//	})
+//
+//	// Tokens are cached and refreshed shortly before expiry
+//	httpClient := client.Client(nil)
+//	resp, err := httpClient.Get("https://invoices.internal/api/v1/invoices")
+type ServiceClient struct {
+	config     ServiceClientConfig
+	httpClient HTTPClient
+	signer     *JWTSigner
+	source     *CachedTokenSource
+}
+
+// NewServiceClient creates a new machine-to-machine OAuth client
+func NewServiceClient(cfg ServiceClientConfig) (*ServiceClient, error) {
+	if cfg.ClientID == "" {
+		return nil, fmt.Errorf("%w: client_id required", ErrInvalidConfig)
+	}
+	if cfg.TokenURL == "" {
+		return nil, fmt.Errorf("%w: token_url required", ErrInvalidConfig)
+	}
+	if cfg.AssertionLifetime <= 0 {
+		cfg.AssertionLifetime = 5 * time.Minute
+	}
+	if cfg.ExpiryDelta <= 0 {
+		cfg.ExpiryDelta = 30 * time.Second
+	}
+
+	c := &ServiceClient{
+		config:     cfg,
+		httpClient: cfg.HTTPClient,
+	}
+	if c.httpClient == nil {
+		c.httpClient = http.DefaultClient
+	}
+
+	if cfg.PrivateKey != "" {
+		signer, err := NewJWTSigner(cfg.PrivateKey, cfg.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		c.signer = signer
+	}
+
+	if c.config.AuthMethod == "" {
+		switch {
+		case c.signer != nil:
+			c.config.AuthMethod = AuthMethodPrivateKeyJWT
+		case cfg.ClientSecret != "":
+			c.config.AuthMethod = AuthMethodClientSecretBasic
+		default:
+			c.config.AuthMethod = AuthMethodNone
+		}
+	}
+
+	switch c.config.AuthMethod {
+	case AuthMethodClientSecretBasic, AuthMethodClientSecretPost:
+		if cfg.ClientSecret == "" {
+			return nil, fmt.Errorf("%w: client_secret required for %s", ErrInvalidConfig, c.config.AuthMethod)
+		}
+	case AuthMethodPrivateKeyJWT:
+		if c.signer == nil {
+			return nil, fmt.Errorf("%w: private_key required for %s", ErrInvalidConfig, c.config.AuthMethod)
+		}
+	case AuthMethodNone:
+	default:
+		return nil, fmt.Errorf("%w: unknown auth method: %s", ErrInvalidConfig, c.config.AuthMethod)
+	}
+
+	c.source = NewCachedTokenSource(TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		return c.ClientCredentials(ctx)
+	}), cfg.ExpiryDelta)
+
+	return c, nil
+}
+
+// SetHTTPClient sets a custom HTTP client for token requests
+func (c *ServiceClient) SetHTTPClient(client HTTPClient) {
+	c.httpClient = client
+}
+
+// Token returns a cached client_credentials token, fetching a new one when
+// the cached token is within ExpiryDelta of expiring
+func (c *ServiceClient) Token(ctx context.Context) (*Token, error) {
+	return c.source.Token(ctx)
+}
+
+// TokenSource returns the cached client_credentials token source
+func (c *ServiceClient) TokenSource() *CachedTokenSource {
+	return c.source
+}
+
+// Client returns an *http.Client that authenticates every request with a
+// client_credentials token. A nil base uses http.DefaultTransport.
+func (c *ServiceClient) Client(base http.RoundTripper) *http.Client {
+	return &http.Client{Transport: NewTransport(c.source, base)}
+}
+
+// ClientCredentials requests a new token with the client_credentials grant.
+// Scopes override the configured scopes when given. The result is not cached.
+func (c *ServiceClient) ClientCredentials(ctx context.Context, scopes ...string) (*Token, error) {
+	if len(scopes) == 0 {
+		scopes = c.config.Scopes
+	}
+
+	data := url.Values{"grant_type": {GrantTypeClientCredentials}}
+	if len(scopes) > 0 {
+		data.Set("scope", strings.Join(scopes, " "))
+	}
+
+	tok, _, err := c.requestToken(ctx, data)
+	return tok, err
+}
+
+// TokenExchangeRequest describes an RFC 8693 token exchange
+type TokenExchangeRequest struct {
+	SubjectToken       string   // Required: the token being exchanged
+	SubjectTokenType   string   // Defaults to TokenTypeAccessToken
+	ActorToken         string   // Optional: token of the acting party (delegation)
+	ActorTokenType     string   // Required when ActorToken is set; defaults to TokenTypeAccessToken
+	RequestedTokenType string   // Optional: desired token type
+	Audience           string   // Optional: logical name of the target service
+	Resource           string   // Optional: URI of the target service
+	Scopes             []string // Optional: requested scopes
+}
+
+// ExchangedToken is the result of a token exchange
+type ExchangedToken struct {
+	*Token
+
+	// IssuedTokenType identifies the type of the issued token (RFC 8693 section 2.2.1)
+	IssuedTokenType string `json:"issued_token_type"`
+}
+
+// ExchangeToken trades a subject token for a new token (RFC 8693), typically to
+// call a downstream service on behalf of the original caller
+func (c *ServiceClient) ExchangeToken(ctx context.Context, req TokenExchangeRequest) (*ExchangedToken, error) {
+	if req.SubjectToken == "" {
+		return nil, fmt.Errorf("subject token is required")
+	}
+	if req.SubjectTokenType == "" {
+		req.SubjectTokenType = TokenTypeAccessToken
+	}
+
+	data := url.Values{
+		"grant_type":         {GrantTypeTokenExchange},
+		"subject_token":      {req.SubjectToken},
+		"subject_token_type": {req.SubjectTokenType},
+	}
+	if req.ActorToken != "" {
+		if req.ActorTokenType == "" {
+			req.ActorTokenType = TokenTypeAccessToken
+		}
+		data.Set("actor_token", req.ActorToken)
+		data.Set("actor_token_type", req.ActorTokenType)
+	}
+	if req.RequestedTokenType != "" {
+		data.Set("requested_token_type", req.RequestedTokenType)
+	}
+	if req.Audience != "" {
+		data.Set("audience", req.Audience)
+	}
+	if req.Resource != "" {
+		data.Set("resource", req.Resource)
+	}
+	if len(req.Scopes) > 0 {
+		data.Set("scope", strings.Join(req.Scopes, " "))
+	}
+
+	tok, issuedType, err := c.requestToken(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	return &ExchangedToken{Token: tok, IssuedTokenType: issuedType}, nil
+}
+
+// JWTBearer requests a token with a signed JWT assertion (RFC 7523 section 2.1).
+// The assertion is issued by the client for subject and addressed to the token
+// endpoint; extra claims are merged into it. Requires PrivateKey.
+func (c *ServiceClient) JWTBearer(ctx context.Context, subject string, extra map[string]interface{}, scopes ...string) (*Token, error) {
+	if c.signer == nil {
+		return nil, fmt.Errorf("%w: private_key required for jwt-bearer grant", ErrInvalidConfig)
+	}
+	if subject == "" {
+		subject = c.config.ClientID
+	}
+
+	assertion, err := c.signer.assertion(c.config.ClientID, subject, c.assertionAudience(), c.config.AssertionLifetime, extra)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.JWTBearerAssertion(ctx, assertion, scopes...)
+}
+
+// JWTBearerAssertion requests a token with a pre-built assertion, for example
+// one issued by a workload identity provider
+func (c *ServiceClient) JWTBearerAssertion(ctx context.Context, assertion string, scopes ...string) (*Token, error) {
+	if assertion == "" {
+		return nil, fmt.Errorf("assertion is required")
+	}
+	if len(scopes) == 0 {
+		scopes = c.config.Scopes
+	}
+
+	data := url.Values{
+		"grant_type": {GrantTypeJWTBearer},
+		"assertion":  {assertion},
+	}
+	if len(scopes) > 0 {
+		data.Set("scope", strings.Join(scopes, " "))
+	}
+
+	tok, _, err := c.requestToken(ctx, data)
+	return tok, err
+}
+
+// requestToken authenticates the client, posts the grant and parses the response
+func (c *ServiceClient) requestToken(ctx context.Context, data url.Values) (*Token, string, error) {
+	for k, vs := range c.config.EndpointParams {
+		for _, v := range vs {
+			data.Add(k, v)
+		}
+	}
+	if c.config.Audience != "" && data.Get("audience") == "" {
+		data.Set("audience", c.config.Audience)
+	}
+
+	useBasic := false
+	switch c.config.AuthMethod {
+	case AuthMethodClientSecretBasic:
+		useBasic = true
+	case AuthMethodClientSecretPost:
+		data.Set("client_id", c.config.ClientID)
+		data.Set("client_secret", c.config.ClientSecret)
+	case AuthMethodPrivateKeyJWT:
+		assertion, err := c.signer.assertion(c.config.ClientID, c.config.ClientID, c.assertionAudience(), c.config.AssertionLifetime, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		data.Set("client_id", c.config.ClientID)
+		data.Set("client_assertion_type", clientAssertionType)
+		data.Set("client_assertion", assertion)
+	default:
+		data.Set("client_id", c.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.config.TokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useBasic {
+		// RFC 6749 section 2.3.1 requires form-encoding credentials for Basic auth
+		req.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(c.config.ClientSecret))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: token request failed: %v", ErrNetworkError, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+			ErrorURI         string `json:"error_uri"`
+		}
+		if err := json.Unmarshal(body, &errResp); err != nil || errResp.Error == "" {
+			if resp.StatusCode >= http.StatusInternalServerError {
+				return nil, "", fmt.Errorf("%w: status code %d", ErrServerError, resp.StatusCode)
+			}
+			return nil, "", fmt.Errorf("%w: unexpected status code %d", ErrInvalidResponse, resp.StatusCode)
+		}
+		return nil, "", ParseError("service", errResp.Error, errResp.ErrorDescription, errResp.ErrorURI)
+	}
+
+	var tokenResp struct {
+		AccessToken     string `json:"access_token"`
+		TokenType       string `json:"token_type"`
+		RefreshToken    string `json:"refresh_token"`
+		ExpiresIn       int    `json:"expires_in"`
+		IDToken         string `json:"id_token"`
+		Scope           string `json:"scope"`
+		IssuedTokenType string `json:"issued_token_type"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, "", fmt.Errorf("%w: missing access_token", ErrInvalidResponse)
+	}
+
+	var expiresAt time.Time
+	if tokenResp.ExpiresIn > 0 {
+		expiresAt = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	}
+
+	return &Token{
+		AccessToken:  tokenResp.AccessToken,
+		TokenType:    tokenResp.TokenType,
+		RefreshToken: tokenResp.RefreshToken,
+		ExpiresIn:    tokenResp.ExpiresIn,
+		ExpiresAt:    expiresAt,
+		IDToken:      tokenResp.IDToken,
+		Scope:        tokenResp.Scope,
+	}, tokenResp.IssuedTokenType, nil
+}
+
+// assertionAudience returns the aud claim for assertions: the token endpoint
+func (c *ServiceClient) assertionAudience() string {
+	return c.config.TokenURL
+}
+
+// CachedTokenSource caches tokens from another source until shortly before expiry.
+// Concurrent callers share a single in-flight fetch.
+type CachedTokenSource struct {
+	source      TokenSource
+	expiryDelta time.Duration
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// NewCachedTokenSource wraps a source with caching. Tokens are refreshed when
+// they are within expiryDelta of expiring.
+func NewCachedTokenSource(source TokenSource, expiryDelta time.Duration) *CachedTokenSource {
+	return &CachedTokenSource{
+		source:      source,
+		expiryDelta: expiryDelta,
+	}
+}
+
+// Token returns the cached token or fetches a new one
+func (s *CachedTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.valid(s.token) {
+		return s.token, nil
+	}
+
+	tok, err := s.source.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.token = tok
+	return tok, nil
+}
+
+// Invalidate drops the cached token so the next call fetches a new one
+func (s *CachedTokenSource) Invalidate() {
+	s.mu.Lock()
+	s.token = nil
+	s.mu.Unlock()
+}
+
+// invalidateIf drops the cached token only if it is still the given one
+func (s *CachedTokenSource) invalidateIf(tok *Token) {
+	s.mu.Lock()
+	if s.token == tok {
+		s.token = nil
+	}
+	s.mu.Unlock()
+}
+
+func (s *CachedTokenSource) valid(tok *Token) bool {
+	if tok == nil || tok.AccessToken == "" {
+		return false
+	}
+	if tok.ExpiresAt.IsZero() {
+		return true
+	}
+	return time.Until(tok.ExpiresAt) > s.expiryDelta
+}
+
+// Transport is an http.RoundTripper that adds bearer tokens from a TokenSource.
+// When the source is a *CachedTokenSource and the server answers 401, the
+// cached token is discarded and the request is retried once with a fresh token.
+type Transport struct {
+	Source TokenSource
+	Base   http.RoundTripper
+}
+
+// NewTransport creates a bearer token transport. A nil base uses http.DefaultTransport.
+func NewTransport(source TokenSource, base http.RoundTripper) *Transport {
+	return &Transport{Source: source, Base: base}
+}
+
+// RoundTrip authorizes and sends the request
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, tok, err := t.send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	cached, ok := t.Source.(*CachedTokenSource)
+	if resp.StatusCode != http.StatusUnauthorized || !ok {
+		return resp, nil
+	}
+
+	// The token may have been revoked early; retry once if the body can be replayed
+	cached.invalidateIf(tok)
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	resp, _, err = t.send(retry)
+	return resp, err
+}
+
+func (t *Transport) send(req *http.Request) (*http.Response, *Token, error) {
+	tok, err := t.Source.Token(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, nil, err
+	}
+
+	// RoundTrippers must not modify the caller's request
+	authed := req.Clone(req.Context())
+	tokenType := tok.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	authed.Header.Set("Authorization", tokenType+" "+tok.AccessToken)
+
+	resp, err := t.base().RoundTrip(authed)
+	return resp, tok, err
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
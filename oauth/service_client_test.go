@@ -0,0 +1,297 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/gobeaver/beaver-kit/krypto"
+	"github.com/gobeaver/beaver-kit/oauth"
+)
+
+func writeToken(w http.ResponseWriter, accessToken string, expiresIn int) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   expiresIn,
+	})
+}
+
+func TestServiceClient_ClientCredentialsTransport(t *testing.T) {
+	var tokenRequests int32
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "svc" || pass != "secret" {
+			t.Errorf("Expected basic client authentication, got %q/%q", user, pass)
+		}
+		if r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "read write" {
+			t.Errorf("Unexpected form: %v", r.Form)
+		}
+		atomic.AddInt32(&tokenRequests, 1)
+		writeToken(w, "token-1", 3600)
+	}))
+	defer authServer.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer api.Close()
+
+	client, err := oauth.NewServiceClient(oauth.ServiceClientConfig{
+		ClientID:     "svc",
+		ClientSecret: "secret",
+		TokenURL:     authServer.URL,
+		Scopes:       []string{"read", "write"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	httpClient := client.Client(nil)
+	for i := 0; i < 3; i++ {
+		resp, err := httpClient.Get(api.URL)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", resp.StatusCode)
+		}
+	}
+
+	if got := atomic.LoadInt32(&tokenRequests); got != 1 {
+		t.Errorf("Expected token to be cached (1 request), got %d", got)
+	}
+}
+
+func TestServiceClient_RefreshesBeforeExpiry(t *testing.T) {
+	var tokenRequests int32
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tokenRequests, 1)
+		// Expires within the default 30s expiry delta, so never reused
+		writeToken(w, "short-lived", 10)
+	}))
+	defer authServer.Close()
+
+	client, _ := oauth.NewServiceClient(oauth.ServiceClientConfig{
+		ClientID:     "svc",
+		ClientSecret: "secret",
+		TokenURL:     authServer.URL,
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := client.Token(ctx); err != nil {
+			t.Fatalf("Failed to get token: %v", err)
+		}
+	}
+
+	if got := atomic.LoadInt32(&tokenRequests); got != 2 {
+		t.Errorf("Expected 2 token requests, got %d", got)
+	}
+}
+
+func TestServiceClient_RetryOnUnauthorized(t *testing.T) {
+	var tokenRequests int32
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&tokenRequests, 1) == 1 {
+			writeToken(w, "revoked", 3600)
+			return
+		}
+		writeToken(w, "fresh", 3600)
+	}))
+	defer authServer.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer api.Close()
+
+	client, _ := oauth.NewServiceClient(oauth.ServiceClientConfig{
+		ClientID:     "svc",
+		ClientSecret: "secret",
+		TokenURL:     authServer.URL,
+	})
+
+	resp, err := client.Client(nil).Get(api.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected retry with fresh token to succeed, got %d", resp.StatusCode)
+	}
+}
+
+func TestServiceClient_TokenExchange(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.FormValue("grant_type") != oauth.GrantTypeTokenExchange {
+			t.Errorf("Unexpected grant_type %q", r.FormValue("grant_type"))
+		}
+		if r.FormValue("subject_token") != "user-token" || r.FormValue("subject_token_type") != oauth.TokenTypeAccessToken {
+			t.Errorf("Unexpected subject: %v", r.Form)
+		}
+		if r.FormValue("audience") != "inventory" {
+			t.Errorf("Expected audience=inventory, got %q", r.FormValue("audience"))
+		}
+		if r.FormValue("client_secret") != "secret" {
+			t.Errorf("Expected client_secret_post authentication")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":      "downstream-token",
+			"token_type":        "Bearer",
+			"issued_token_type": oauth.TokenTypeAccessToken,
+			"expires_in":        300,
+		})
+	}))
+	defer authServer.Close()
+
+	client, _ := oauth.NewServiceClient(oauth.ServiceClientConfig{
+		ClientID:     "gateway",
+		ClientSecret: "secret",
+		TokenURL:     authServer.URL,
+		AuthMethod:   oauth.AuthMethodClientSecretPost,
+	})
+
+	tok, err := client.ExchangeToken(context.Background(), oauth.TokenExchangeRequest{
+		SubjectToken: "user-token",
+		Audience:     "inventory",
+	})
+	if err != nil {
+		t.Fatalf("Token exchange failed: %v", err)
+	}
+	if tok.AccessToken != "downstream-token" || tok.IssuedTokenType != oauth.TokenTypeAccessToken {
+		t.Errorf("Unexpected exchanged token: %+v", tok)
+	}
+}
+
+func TestServiceClient_JWTBearerWithKryptoKey(t *testing.T) {
+	pair, err := krypto.GenerateRSAKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	publicKey, err := jwt.ParseRSAPublicKeyFromPEM([]byte(pair.PublicKey))
+	if err != nil {
+		t.Fatalf("Failed to parse public key: %v", err)
+	}
+
+	var tokenURL string
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+
+		verify := func(name, raw string) jwt.MapClaims {
+			claims := jwt.MapClaims{}
+			token, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+				if token.Header["kid"] != "key-1" {
+					t.Errorf("%s: expected kid key-1, got %v", name, token.Header["kid"])
+				}
+				return publicKey, nil
+			}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithAudience(tokenURL))
+			if err != nil || !token.Valid {
+				t.Errorf("%s: invalid signature: %v", name, err)
+			}
+			return claims
+		}
+
+		// private_key_jwt client authentication
+		if r.FormValue("client_assertion_type") != "urn:ietf:params:oauth:client-assertion-type:jwt-bearer" {
+			t.Errorf("Expected private_key_jwt client authentication")
+		}
+		verify("client_assertion", r.FormValue("client_assertion"))
+
+		// JWT-bearer authorization grant
+		if r.FormValue("grant_type") != oauth.GrantTypeJWTBearer {
+			t.Errorf("Unexpected grant_type %q", r.FormValue("grant_type"))
+		}
+		claims := verify("assertion", r.FormValue("assertion"))
+		if claims["sub"] != "user-42" || claims["iss"] != "svc" || claims["tenant"] != "acme" {
+			t.Errorf("Unexpected assertion claims: %v", claims)
+		}
+
+		writeToken(w, "bearer-token", 3600)
+	}))
+	defer authServer.Close()
+	tokenURL = authServer.URL
+
+	client, err := oauth.NewServiceClient(oauth.ServiceClientConfig{
+		ClientID:   "svc",
+		TokenURL:   tokenURL,
+		PrivateKey: pair.PrivateKey,
+		KeyID:      "key-1",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	tok, err := client.JWTBearer(context.Background(), "user-42", map[string]interface{}{"tenant": "acme"})
+	if err != nil {
+		t.Fatalf("JWT bearer grant failed: %v", err)
+	}
+	if tok.AccessToken != "bearer-token" {
+		t.Errorf("Expected bearer-token, got %s", tok.AccessToken)
+	}
+}
+
+func TestServiceClient_ErrorResponse(t *testing.T) {
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"error":             "invalid_scope",
+			"error_description": "scope admin not allowed",
+		})
+	}))
+	defer authServer.Close()
+
+	client, _ := oauth.NewServiceClient(oauth.ServiceClientConfig{
+		ClientID:     "svc",
+		ClientSecret: "secret",
+		TokenURL:     authServer.URL,
+	})
+
+	if _, err := client.ClientCredentials(context.Background(), "admin"); !errors.Is(err, oauth.ErrInvalidScope) {
+		t.Errorf("Expected ErrInvalidScope, got %v", err)
+	}
+}
+
+func TestNewServiceClient_InvalidConfig(t *testing.T) {
+	tests := []oauth.ServiceClientConfig{
+		{TokenURL: "https://example.com/token"},
+		{ClientID: "svc"},
+		{ClientID: "svc", TokenURL: "https://example.com/token", AuthMethod: oauth.AuthMethodClientSecretBasic},
+		{ClientID: "svc", TokenURL: "https://example.com/token", AuthMethod: oauth.AuthMethodPrivateKeyJWT},
+	}
+
+	for _, cfg := range tests {
+		if _, err := oauth.NewServiceClient(cfg); !errors.Is(err, oauth.ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig for %+v, got %v", cfg, err)
+		}
+	}
+
+	if _, err := oauth.NewServiceClient(oauth.ServiceClientConfig{
+		ClientID:   "svc",
+		TokenURL:   "https://example.com/token",
+		PrivateKey: "not a key",
+	}); !errors.Is(err, oauth.ErrInvalidSigningKey) {
+		t.Errorf("Expected ErrInvalidSigningKey, got %v", err)
+	}
+}
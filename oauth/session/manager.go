@@ -0,0 +1,373 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/config"
+	"github.com/gobeaver/beaver-kit/krypto"
+	"github.com/gobeaver/beaver-kit/oauth"
+)
+
+// contextKey is a custom type for context keys to avoid collisions
+type contextKey string
+
+const sessionContextKey contextKey = "session"
+
+// Config defines the session manager configuration
+type Config struct {
+	// SecretKey encrypts and authenticates cookie values
+	SecretKey string `env:"SESSION_SECRET_KEY,required"`
+
+	// Cookie attributes
+	CookieName string `env:"SESSION_COOKIE_NAME" envDefault:"beaver_session"`
+	Domain     string `env:"SESSION_COOKIE_DOMAIN"`
+	Path       string `env:"SESSION_COOKIE_PATH" envDefault:"/"`
+	Secure     bool   `env:"SESSION_COOKIE_SECURE" envDefault:"true"`
+	SameSite   string `env:"SESSION_COOKIE_SAMESITE" envDefault:"lax"` // strict, lax, none
+
+	// IdleTimeout expires sessions that have not been used for this long
+	IdleTimeout time.Duration `env:"SESSION_IDLE_TIMEOUT" envDefault:"30m"`
+
+	// AbsoluteTimeout expires sessions this long after creation regardless of activity
+	AbsoluteTimeout time.Duration `env:"SESSION_ABSOLUTE_TIMEOUT" envDefault:"24h"`
+
+	// TouchInterval limits how often activity is written back to the store
+	TouchInterval time.Duration `env:"SESSION_TOUCH_INTERVAL" envDefault:"1m"`
+}
+
+// GetConfig returns config loaded from environment with optional options
+func GetConfig(opts ...config.Option) (*Config, error) {
+	cfg := &Config{}
+	if len(opts) == 0 {
+		opts = append(opts, config.WithPrefix("BEAVER_"))
+	}
+	if err := config.Load(cfg, opts...); err != nil {
+		return nil, fmt.Errorf("failed to load session config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Manager issues, loads and invalidates sessions
+type Manager struct {
+	config    Config
+	store     Store
+	encryptor oauth.TokenEncryptor
+	sameSite  http.SameSite
+}
+
+// cookiePayload is the sealed content of a session cookie
+type cookiePayload struct {
+	ID       string `json:"i"`
+	IssuedAt int64  `json:"t"`
+}
+
+// New creates a new session manager
+func New(cfg Config, store Store) (*Manager, error) {
+	if err := validateConfig(&cfg); err != nil {
+		return nil, err
+	}
+	if store == nil {
+		return nil, fmt.Errorf("%w: store is required", ErrInvalidConfig)
+	}
+
+	encryptor, err := oauth.NewAESGCMEncryptor([]byte(cfg.SecretKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create encryptor: %w", err)
+	}
+
+	return &Manager{
+		config:    cfg,
+		store:     store,
+		encryptor: encryptor,
+		sameSite:  parseSameSite(cfg.SameSite),
+	}, nil
+}
+
+// validateConfig checks configuration validity and applies defaults
+func validateConfig(cfg *Config) error {
+	if len(cfg.SecretKey) < 32 {
+		return fmt.Errorf("%w: secret key must be at least 32 bytes", ErrInvalidConfig)
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = "beaver_session"
+	}
+	if cfg.Path == "" {
+		cfg.Path = "/"
+	}
+	if cfg.AbsoluteTimeout <= 0 {
+		cfg.AbsoluteTimeout = 24 * time.Hour
+	}
+	if cfg.IdleTimeout < 0 {
+		return fmt.Errorf("%w: idle timeout cannot be negative", ErrInvalidConfig)
+	}
+	if cfg.TouchInterval <= 0 {
+		cfg.TouchInterval = time.Minute
+	}
+	if strings.EqualFold(cfg.SameSite, "none") && !cfg.Secure {
+		return fmt.Errorf("%w: SameSite=None requires Secure cookies", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Create starts a new session for a user and sets the session cookie
+func (m *Manager) Create(ctx context.Context, w http.ResponseWriter, userID string) (*Session, error) {
+	id, err := krypto.GenerateSecureToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	now := time.Now()
+	sess := &Session{
+		ID:         id,
+		UserID:     userID,
+		Values:     make(map[string]interface{}),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(m.config.AbsoluteTimeout),
+	}
+
+	if err := m.store.Save(ctx, sess, m.config.AbsoluteTimeout); err != nil {
+		return nil, err
+	}
+
+	if err := m.writeCookie(w, sess); err != nil {
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+// Load reads the session referenced by the request cookie.
+// Expired sessions are removed from the store and reported as ErrSessionExpired.
+func (m *Manager) Load(ctx context.Context, r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(m.config.CookieName)
+	if err != nil {
+		return nil, ErrNoCookie
+	}
+
+	payload, err := m.decodeCookie(cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := m.store.Get(ctx, payload.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if sess.IsExpired(m.config.IdleTimeout) {
+		_ = m.store.Delete(ctx, sess.ID)
+		return nil, ErrSessionExpired
+	}
+
+	// Record activity without writing on every request
+	if time.Since(sess.LastSeenAt) >= m.config.TouchInterval {
+		sess.LastSeenAt = time.Now()
+		sess.dirty = true
+	}
+
+	return sess, nil
+}
+
+// Save persists session changes
+func (m *Manager) Save(ctx context.Context, sess *Session) error {
+	if sess.destroyed {
+		return ErrSessionNotFound
+	}
+	ttl := time.Until(sess.ExpiresAt)
+	if ttl <= 0 {
+		return ErrSessionExpired
+	}
+	if err := m.store.Save(ctx, sess, ttl); err != nil {
+		return err
+	}
+	sess.dirty = false
+	return nil
+}
+
+// Rotate replaces the session ID while keeping its data.
+// Call it on every privilege change (login, role elevation) to defeat session fixation.
+func (m *Manager) Rotate(ctx context.Context, w http.ResponseWriter, sess *Session) error {
+	oldID := sess.ID
+
+	newID, err := krypto.GenerateSecureToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	sess.ID = newID
+	sess.LastSeenAt = time.Now()
+	if err := m.Save(ctx, sess); err != nil {
+		sess.ID = oldID
+		return err
+	}
+
+	if err := m.writeCookie(w, sess); err != nil {
+		return err
+	}
+
+	return m.store.Delete(ctx, oldID)
+}
+
+// Destroy removes the session and clears the cookie
+func (m *Manager) Destroy(ctx context.Context, w http.ResponseWriter, sess *Session) error {
+	m.clearCookie(w)
+	if sess == nil {
+		return nil
+	}
+	sess.destroyed = true
+	return m.store.Delete(ctx, sess.ID)
+}
+
+// DestroyAll removes every session that belongs to a user ("log out everywhere")
+func (m *Manager) DestroyAll(ctx context.Context, userID string) error {
+	if userID == "" {
+		return fmt.Errorf("user ID is required")
+	}
+	return m.store.DeleteByUser(ctx, userID)
+}
+
+// Middleware loads the session (if any) into the request context.
+// Requests without a valid session continue without one; invalid, unknown and
+// expired cookies are cleared, but a cookie is kept when the store fails so a
+// backend outage does not log users out.
+// Modified sessions are saved after the handler returns.
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := m.Load(r.Context(), r)
+		if err != nil {
+			if errors.Is(err, ErrInvalidCookie) || errors.Is(err, ErrSessionNotFound) || errors.Is(err, ErrSessionExpired) {
+				m.clearCookie(w)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Persist activity before the handler writes the response
+		if sess.dirty {
+			_ = m.Save(r.Context(), sess)
+		}
+
+		ctx := NewContext(r.Context(), sess)
+		next.ServeHTTP(w, r.WithContext(ctx))
+
+		if sess.dirty && !sess.destroyed {
+			_ = m.Save(r.Context(), sess)
+		}
+	})
+}
+
+// RequireSession rejects requests that have no session in their context
+func (m *Manager) RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if FromContext(r.Context()) == nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NewContext returns a context carrying the session
+func NewContext(ctx context.Context, sess *Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey, sess)
+}
+
+// FromContext returns the session stored in the context, or nil
+func FromContext(ctx context.Context) *Session {
+	sess, _ := ctx.Value(sessionContextKey).(*Session)
+	return sess
+}
+
+// Helper methods
+
+func (m *Manager) writeCookie(w http.ResponseWriter, sess *Session) error {
+	value, err := m.encodeCookie(cookiePayload{ID: sess.ID, IssuedAt: time.Now().Unix()})
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.config.CookieName,
+		Value:    value,
+		Path:     m.config.Path,
+		Domain:   m.config.Domain,
+		Expires:  sess.ExpiresAt,
+		MaxAge:   int(time.Until(sess.ExpiresAt).Seconds()),
+		Secure:   m.config.Secure,
+		HttpOnly: true,
+		SameSite: m.sameSite,
+	})
+	return nil
+}
+
+func (m *Manager) clearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.config.CookieName,
+		Value:    "",
+		Path:     m.config.Path,
+		Domain:   m.config.Domain,
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		Secure:   m.config.Secure,
+		HttpOnly: true,
+		SameSite: m.sameSite,
+	})
+}
+
+func (m *Manager) encodeCookie(payload cookiePayload) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal cookie payload: %w", err)
+	}
+
+	// AES-GCM both encrypts and authenticates the payload
+	sealed, err := m.encryptor.Encrypt(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt cookie: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (m *Manager) decodeCookie(value string) (*cookiePayload, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+
+	data, err := m.encryptor.Decrypt(sealed)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+
+	var payload cookiePayload
+	if err := json.Unmarshal(data, &payload); err != nil || payload.ID == "" {
+		return nil, ErrInvalidCookie
+	}
+
+	// Reject cookies older than the absolute lifetime even if the record survived
+	if time.Since(time.Unix(payload.IssuedAt, 0)) > m.config.AbsoluteTimeout {
+		return nil, ErrSessionExpired
+	}
+
+	return &payload, nil
+}
+
+func parseSameSite(mode string) http.SameSite {
+	switch strings.ToLower(mode) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
@@ -0,0 +1,335 @@
+package session_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/cache"
+	"github.com/gobeaver/beaver-kit/cache/driver/memory"
+	"github.com/gobeaver/beaver-kit/oauth/session"
+)
+
+const testSecret = "test-session-secret-key-32-bytes!!"
+
+func newManager(t *testing.T, store session.Store, cfg session.Config) *session.Manager {
+	t.Helper()
+	cfg.SecretKey = testSecret
+	m, err := session.New(cfg, store)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	return m
+}
+
+func cookieFrom(t *testing.T, rec *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	cookies := rec.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("Expected a session cookie")
+	}
+	return cookies[len(cookies)-1]
+}
+
+func TestManager_CreateAndLoad(t *testing.T) {
+	m := newManager(t, session.NewMemoryStore(), session.Config{Secure: true})
+	ctx := context.Background()
+
+	rec := httptest.NewRecorder()
+	sess, err := m.Create(ctx, rec, "user-1")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	cookie := cookieFrom(t, rec)
+	if !cookie.HttpOnly || !cookie.Secure {
+		t.Error("Session cookie should be HttpOnly and Secure")
+	}
+	if cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("Expected SameSite=Lax, got %v", cookie.SameSite)
+	}
+	if strings.Contains(cookie.Value, sess.ID) {
+		t.Error("Cookie should not contain the raw session ID")
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+
+	loaded, err := m.Load(ctx, req)
+	if err != nil {
+		t.Fatalf("Failed to load session: %v", err)
+	}
+	if loaded.ID != sess.ID || loaded.UserID != "user-1" {
+		t.Errorf("Loaded wrong session: %+v", loaded)
+	}
+}
+
+func TestManager_TamperedCookie(t *testing.T) {
+	m := newManager(t, session.NewMemoryStore(), session.Config{})
+	ctx := context.Background()
+
+	rec := httptest.NewRecorder()
+	if _, err := m.Create(ctx, rec, "user-1"); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	cookie := cookieFrom(t, rec)
+
+	// Flip a character in the sealed value
+	b := []byte(cookie.Value)
+	if b[10] == 'A' {
+		b[10] = 'B'
+	} else {
+		b[10] = 'A'
+	}
+	cookie.Value = string(b)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+
+	if _, err := m.Load(ctx, req); !errors.Is(err, session.ErrInvalidCookie) {
+		t.Errorf("Expected ErrInvalidCookie, got %v", err)
+	}
+}
+
+func TestManager_IdleTimeout(t *testing.T) {
+	m := newManager(t, session.NewMemoryStore(), session.Config{
+		IdleTimeout:   50 * time.Millisecond,
+		TouchInterval: time.Hour,
+	})
+	ctx := context.Background()
+
+	rec := httptest.NewRecorder()
+	if _, err := m.Create(ctx, rec, "user-1"); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	cookie := cookieFrom(t, rec)
+
+	time.Sleep(100 * time.Millisecond)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	if _, err := m.Load(ctx, req); !errors.Is(err, session.ErrSessionExpired) {
+		t.Errorf("Expected ErrSessionExpired, got %v", err)
+	}
+}
+
+func TestManager_Rotate(t *testing.T) {
+	m := newManager(t, session.NewMemoryStore(), session.Config{})
+	ctx := context.Background()
+
+	rec := httptest.NewRecorder()
+	sess, err := m.Create(ctx, rec, "user-1")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	oldCookie := cookieFrom(t, rec)
+	oldID := sess.ID
+
+	sess.Set("role", "admin")
+	rec = httptest.NewRecorder()
+	if err := m.Rotate(ctx, rec, sess); err != nil {
+		t.Fatalf("Failed to rotate session: %v", err)
+	}
+	if sess.ID == oldID {
+		t.Fatal("Session ID should change after rotation")
+	}
+
+	// Old cookie must no longer work
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(oldCookie)
+	if _, err := m.Load(ctx, req); !errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound for old cookie, got %v", err)
+	}
+
+	// New cookie carries the data
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookieFrom(t, rec))
+	loaded, err := m.Load(ctx, req)
+	if err != nil {
+		t.Fatalf("Failed to load rotated session: %v", err)
+	}
+	if loaded.GetString("role") != "admin" {
+		t.Errorf("Expected role=admin, got %q", loaded.GetString("role"))
+	}
+}
+
+func TestManager_DestroyAll(t *testing.T) {
+	c, err := memory.New(memory.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer c.Close()
+
+	m := newManager(t, session.NewCacheStore(c, "sess:"), session.Config{})
+	ctx := context.Background()
+
+	var cookies []*http.Cookie
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		if _, err := m.Create(ctx, rec, "user-1"); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		cookies = append(cookies, cookieFrom(t, rec))
+	}
+
+	rec := httptest.NewRecorder()
+	if _, err := m.Create(ctx, rec, "user-2"); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	other := cookieFrom(t, rec)
+
+	if err := m.DestroyAll(ctx, "user-1"); err != nil {
+		t.Fatalf("Failed to destroy sessions: %v", err)
+	}
+
+	for _, cookie := range cookies {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookie)
+		if _, err := m.Load(ctx, req); err == nil {
+			t.Error("Expected session to be destroyed")
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(other)
+	if _, err := m.Load(ctx, req); err != nil {
+		t.Errorf("Other user's session should survive: %v", err)
+	}
+}
+
+func TestManager_Middleware(t *testing.T) {
+	m := newManager(t, session.NewMemoryStore(), session.Config{})
+	ctx := context.Background()
+
+	rec := httptest.NewRecorder()
+	if _, err := m.Create(ctx, rec, "user-1"); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	cookie := cookieFrom(t, rec)
+
+	handler := m.Middleware(m.RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess := session.FromContext(r.Context())
+		sess.Set("visited", true)
+		_, _ = w.Write([]byte(sess.UserID))
+	})))
+
+	// Without cookie
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without session, got %d", rec.Code)
+	}
+
+	// With cookie
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "user-1" {
+		t.Fatalf("Unexpected response: %d %q", rec.Code, rec.Body.String())
+	}
+
+	// Changes made by the handler are persisted
+	loaded, err := m.Load(ctx, req)
+	if err != nil {
+		t.Fatalf("Failed to load session: %v", err)
+	}
+	if v, _ := loaded.Get("visited"); v != true {
+		t.Error("Expected handler changes to be saved")
+	}
+}
+
+// unreachableCache fails every call, like a cache whose backend is down
+type unreachableCache struct{ cache.Cache }
+
+func (unreachableCache) Get(context.Context, string) ([]byte, error) {
+	return nil, errors.New("dial tcp: connection refused")
+}
+
+func TestManager_MiddlewareStoreOutage(t *testing.T) {
+	c, err := memory.New(memory.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer c.Close()
+	m := newManager(t, session.NewCacheStore(c, "sess:"), session.Config{})
+	ctx := context.Background()
+
+	rec := httptest.NewRecorder()
+	if _, err := m.Create(ctx, rec, "user-1"); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	cookie := cookieFrom(t, rec)
+
+	down := newManager(t, session.NewCacheStore(unreachableCache{c}, "sess:"), session.Config{})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	if _, err := down.Load(ctx, req); err == nil || errors.Is(err, session.ErrSessionNotFound) {
+		t.Errorf("Expected a store error distinct from ErrSessionNotFound, got %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	down.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(rec, req)
+	if cookies := rec.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("Expected the cookie to be kept during a store outage, got %v", cookies)
+	}
+
+	// A session that no longer exists still clears the cookie
+	if err := c.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	m.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(rec, req)
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("Expected the stale cookie to be cleared, got %v", cookies)
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	if _, err := session.New(session.Config{SecretKey: "short"}, session.NewMemoryStore()); !errors.Is(err, session.ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for short key, got %v", err)
+	}
+	if _, err := session.New(session.Config{SecretKey: testSecret, SameSite: "none"}, session.NewMemoryStore()); !errors.Is(err, session.ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig for SameSite=None without Secure, got %v", err)
+	}
+}
+
+func TestCacheStore_IndexExpiry(t *testing.T) {
+	c, err := memory.New(memory.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	defer c.Close()
+
+	store := session.NewCacheStore(c, "sess:")
+	ctx := context.Background()
+
+	save := func(id, userID string, ttl time.Duration) {
+		t.Helper()
+		if err := store.Save(ctx, &session.Session{ID: id, UserID: userID}, ttl); err != nil {
+			t.Fatalf("Failed to save session: %v", err)
+		}
+	}
+	save("short", "user-1", time.Second)
+	save("long", "user-1", time.Hour)
+	save("only", "user-2", time.Second)
+
+	time.Sleep(2100 * time.Millisecond)
+	save("newer", "user-1", time.Hour)
+
+	data, err := c.Get(ctx, "sess:user:user-1")
+	if err != nil {
+		t.Fatalf("Expected the index to exist: %v", err)
+	}
+	if index := string(data); strings.Contains(index, `"short"`) || !strings.Contains(index, `"long"`) || !strings.Contains(index, `"newer"`) {
+		t.Errorf("Expected expired IDs pruned, got %s", index)
+	}
+
+	if ok, _ := c.Exists(ctx, "sess:user:user-2"); ok {
+		t.Error("Expected the index to expire with its last session")
+	}
+}
@@ -0,0 +1,298 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/cache"
+)
+
+// Store persists server-side session records
+type Store interface {
+	// Get retrieves a session by ID
+	Get(ctx context.Context, id string) (*Session, error)
+
+	// Save creates or replaces a session; ttl is the remaining absolute lifetime
+	Save(ctx context.Context, sess *Session, ttl time.Duration) error
+
+	// Delete removes a session by ID
+	Delete(ctx context.Context, id string) error
+
+	// DeleteByUser removes every session that belongs to a user
+	DeleteByUser(ctx context.Context, userID string) error
+}
+
+// memoryPruneInterval is how often MemoryStore.Save sweeps expired sessions
+const memoryPruneInterval = time.Minute
+
+// MemoryStore implements Store with in-memory storage.
+// Suitable for single-instance deployments and tests. Expired sessions are
+// removed when read and swept at most once a minute on writes.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	sessions  map[string]*Session
+	byUser    map[string]map[string]struct{}
+	lastPrune time.Time
+}
+
+// NewMemoryStore creates a new in-memory session store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions:  make(map[string]*Session),
+		byUser:    make(map[string]map[string]struct{}),
+		lastPrune: time.Now(),
+	}
+}
+
+// Get retrieves a session by ID
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Session, error) {
+	s.mu.RLock()
+	sess, ok := s.sessions[id]
+	if ok && !expired(sess, time.Now()) {
+		sess = sess.clone()
+		s.mu.RUnlock()
+		return sess, nil
+	}
+	s.mu.RUnlock()
+
+	if ok {
+		s.mu.Lock()
+		if sess, ok := s.sessions[id]; ok && expired(sess, time.Now()) {
+			s.remove(sess)
+		}
+		s.mu.Unlock()
+	}
+	return nil, ErrSessionNotFound
+}
+
+// Save creates or replaces a session
+func (s *MemoryStore) Save(ctx context.Context, sess *Session, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := time.Now(); now.Sub(s.lastPrune) >= memoryPruneInterval {
+		for _, existing := range s.sessions {
+			if expired(existing, now) {
+				s.remove(existing)
+			}
+		}
+		s.lastPrune = now
+	}
+
+	s.sessions[sess.ID] = sess.clone()
+	if sess.UserID != "" {
+		if s.byUser[sess.UserID] == nil {
+			s.byUser[sess.UserID] = make(map[string]struct{})
+		}
+		s.byUser[sess.UserID][sess.ID] = struct{}{}
+	}
+	return nil
+}
+
+// Delete removes a session by ID
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sess, ok := s.sessions[id]; ok {
+		s.remove(sess)
+	}
+	return nil
+}
+
+// DeleteByUser removes every session that belongs to a user
+func (s *MemoryStore) DeleteByUser(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id := range s.byUser[userID] {
+		delete(s.sessions, id)
+	}
+	delete(s.byUser, userID)
+	return nil
+}
+
+// remove deletes a session and its user index entry; s.mu must be held
+func (s *MemoryStore) remove(sess *Session) {
+	if ids := s.byUser[sess.UserID]; ids != nil {
+		delete(ids, sess.ID)
+		if len(ids) == 0 {
+			delete(s.byUser, sess.UserID)
+		}
+	}
+	delete(s.sessions, sess.ID)
+}
+
+// expired reports whether a stored session is past its absolute lifetime
+func expired(sess *Session, now time.Time) bool {
+	return !sess.ExpiresAt.IsZero() && now.After(sess.ExpiresAt)
+}
+
+// CacheStore implements Store on top of any cache.Cache backend (memory, redis).
+//
+// A per-user index of session IDs is kept alongside the records so that
+// DeleteByUser works without scanning the keyspace. The index expires with
+// the longest-lived session in it, and expired IDs are pruned on every write.
+type CacheStore struct {
+	cache  cache.Cache
+	prefix string
+	mu     sync.Mutex // serializes index updates from this process
+}
+
+// NewCacheStore creates a session store backed by a cache.Cache
+func NewCacheStore(c cache.Cache, prefix string) *CacheStore {
+	if prefix == "" {
+		prefix = "session:"
+	}
+	return &CacheStore{
+		cache:  c,
+		prefix: prefix,
+	}
+}
+
+// Get retrieves a session by ID
+func (s *CacheStore) Get(ctx context.Context, id string) (*Session, error) {
+	data, err := s.cache.Get(ctx, s.sessionKey(id))
+	if errors.Is(err, cache.ErrKeyNotFound) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+
+	var sess Session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+	return &sess, nil
+}
+
+// Save creates or replaces a session
+func (s *CacheStore) Save(ctx context.Context, sess *Session, ttl time.Duration) error {
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	if err := s.cache.Set(ctx, s.sessionKey(sess.ID), data, ttl); err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+
+	if sess.UserID == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := indexEntry{ID: sess.ID}
+	if ttl > 0 {
+		entry.ExpiresAt = time.Now().Add(ttl).Unix()
+	}
+	entries := []indexEntry{entry}
+	for _, existing := range s.loadIndex(ctx, sess.UserID) {
+		if existing.ID != sess.ID {
+			entries = append(entries, existing)
+		}
+	}
+	return s.saveIndex(ctx, sess.UserID, entries)
+}
+
+// Delete removes a session by ID
+func (s *CacheStore) Delete(ctx context.Context, id string) error {
+	sess, err := s.Get(ctx, id)
+	if err := s.cache.Delete(ctx, s.sessionKey(id)); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if err != nil || sess.UserID == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := s.loadIndex(ctx, sess.UserID)
+	remaining := entries[:0]
+	for _, existing := range entries {
+		if existing.ID != id {
+			remaining = append(remaining, existing)
+		}
+	}
+	return s.saveIndex(ctx, sess.UserID, remaining)
+}
+
+// DeleteByUser removes every session that belongs to a user
+func (s *CacheStore) DeleteByUser(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.loadIndex(ctx, userID) {
+		if err := s.cache.Delete(ctx, s.sessionKey(entry.ID)); err != nil {
+			return fmt.Errorf("failed to delete session: %w", err)
+		}
+	}
+	return s.cache.Delete(ctx, s.userKey(userID))
+}
+
+func (s *CacheStore) sessionKey(id string) string {
+	return s.prefix + id
+}
+
+func (s *CacheStore) userKey(userID string) string {
+	return s.prefix + "user:" + userID
+}
+
+// indexEntry is a session ID in a user's index; ExpiresAt is zero for
+// sessions stored without a TTL
+type indexEntry struct {
+	ID        string `json:"id"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// loadIndex returns the unexpired entries of a user's index
+func (s *CacheStore) loadIndex(ctx context.Context, userID string) []indexEntry {
+	data, err := s.cache.Get(ctx, s.userKey(userID))
+	if err != nil {
+		return nil
+	}
+	var entries []indexEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	live := entries[:0]
+	for _, entry := range entries {
+		if entry.ExpiresAt == 0 || entry.ExpiresAt > now {
+			live = append(live, entry)
+		}
+	}
+	return live
+}
+
+// saveIndex stores a user's index until its last session expires, or
+// deletes it when empty
+func (s *CacheStore) saveIndex(ctx context.Context, userID string, entries []indexEntry) error {
+	if len(entries) == 0 {
+		return s.cache.Delete(ctx, s.userKey(userID))
+	}
+
+	var ttl time.Duration
+	for _, entry := range entries {
+		if entry.ExpiresAt == 0 {
+			ttl = 0 // a session without TTL keeps the index
+			break
+		}
+		ttl = max(ttl, time.Until(time.Unix(entry.ExpiresAt, 0))+time.Second)
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session index: %w", err)
+	}
+	return s.cache.Set(ctx, s.userKey(userID), data, ttl)
+}
@@ -2,12 +2,22 @@ package testing_test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gobeaver/beaver-kit/oauth"
 	oauthtest "github.com/gobeaver/beaver-kit/oauth/testing"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 func TestCompleteOAuthFlow(t *testing.T) {
@@ -320,3 +330,431 @@ func TestTokenExpiration(t *testing.T) {
 		t.Error("Expected error when using expired token")
 	}
 }
+
+func TestDeviceAuthorizationFlow(t *testing.T) {
+	mockServer := oauthtest.NewMockOAuthServer(oauthtest.MockServerConfig{
+		ProviderName:    "test",
+		ClientID:        "test-client",
+		SupportsRefresh: true,
+	})
+	defer mockServer.Close()
+
+	provider, err := oauth.NewCustom(oauth.ProviderConfig{
+		ClientID:      "test-client",
+		RedirectURL:   "http://localhost:8080/callback",
+		AuthURL:       mockServer.GetAuthURL(),
+		TokenURL:      mockServer.GetTokenURL(),
+		UserInfoURL:   mockServer.GetUserInfoURL(),
+		DeviceAuthURL: mockServer.GetDeviceAuthURL(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	ctx := context.Background()
+
+	t.Run("approved", func(t *testing.T) {
+		auth, err := provider.StartDeviceAuth(ctx)
+		if err != nil {
+			t.Fatalf("Failed to start device auth: %v", err)
+		}
+
+		// The user approves on another device while the client polls
+		go func() {
+			time.Sleep(1500 * time.Millisecond)
+			mockServer.ApproveDeviceCode(auth.UserCode, "device_user")
+		}()
+
+		token, err := provider.PollDeviceToken(ctx, auth)
+		if err != nil {
+			t.Fatalf("Failed to poll device token: %v", err)
+		}
+		if token.AccessToken == "" || token.RefreshToken == "" {
+			t.Errorf("Expected access and refresh tokens, got %+v", token)
+		}
+
+		userInfo, err := provider.GetUserInfo(ctx, token.AccessToken)
+		if err != nil {
+			t.Fatalf("Failed to get user info: %v", err)
+		}
+		if userInfo.ID != "device_user" {
+			t.Errorf("Expected device_user, got %s", userInfo.ID)
+		}
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		auth, err := provider.StartDeviceAuth(ctx)
+		if err != nil {
+			t.Fatalf("Failed to start device auth: %v", err)
+		}
+		mockServer.DenyDeviceCode(auth.UserCode)
+
+		if _, err := provider.PollDeviceToken(ctx, auth); !errors.Is(err, oauth.ErrAccessDenied) {
+			t.Errorf("Expected ErrAccessDenied, got %v", err)
+		}
+	})
+}
+
+func TestPushedAuthorizationRequests(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signer, err := oauth.NewJWTSignerFromKey(key, "jar-1")
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	mockServer := oauthtest.NewMockOAuthServer(oauthtest.MockServerConfig{
+		ProviderName:      "test",
+		ClientID:          "test-client",
+		ClientSecret:      "test-secret",
+		RequirePAR:        true,
+		RequestObjectKeys: oauth.StaticKeySet{"jar-1": key.Public()},
+	})
+	defer mockServer.Close()
+
+	newProvider := func(t *testing.T, parURL string, signer *oauth.JWTSigner) *oauth.CustomProvider {
+		t.Helper()
+		provider, err := oauth.NewCustom(oauth.ProviderConfig{
+			ClientID:            "test-client",
+			ClientSecret:        "test-secret",
+			RedirectURL:         "http://localhost:8080/callback",
+			AuthURL:             mockServer.GetAuthURL(),
+			TokenURL:            mockServer.GetTokenURL(),
+			PARURL:              parURL,
+			RequestObjectSigner: signer,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create provider: %v", err)
+		}
+		return provider
+	}
+
+	// authorize follows the authorization URL and returns the redirect
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	authorize := func(t *testing.T, authURL string) (*http.Response, *url.URL) {
+		t.Helper()
+		resp, err := client.Get(authURL)
+		if err != nil {
+			t.Fatalf("Authorization request failed: %v", err)
+		}
+		resp.Body.Close()
+		location, _ := url.Parse(resp.Header.Get("Location"))
+		return resp, location
+	}
+
+	ctx := context.Background()
+
+	for name, s := range map[string]*oauth.JWTSigner{"plain": nil, "signed": signer} {
+		t.Run("par_"+name, func(t *testing.T) {
+			provider := newProvider(t, mockServer.GetPARURL(), s)
+
+			authURL, err := provider.AuthURLContext(ctx, "state-"+name, nil)
+			if err != nil {
+				t.Fatalf("AuthURLContext failed: %v", err)
+			}
+			query, _ := url.Parse(authURL)
+			if !strings.HasPrefix(query.Query().Get("request_uri"), "urn:ietf:params:oauth:request_uri:") || query.Query().Has("scope") {
+				t.Fatalf("Expected only client_id and request_uri, got %s", authURL)
+			}
+
+			resp, location := authorize(t, authURL)
+			if resp.StatusCode != http.StatusFound || location.Query().Get("state") != "state-"+name {
+				t.Fatalf("Expected redirect with state, got %d %s", resp.StatusCode, location)
+			}
+			if scope := mockServer.LastAuthorizationRequest().Get("scope"); scope != "openid profile email" {
+				t.Errorf("Expected pushed scope, got %q", scope)
+			}
+
+			if _, err := provider.Exchange(ctx, location.Query().Get("code"), nil); err != nil {
+				t.Errorf("Exchange failed: %v", err)
+			}
+
+			// request_uri is single use
+			if resp, _ := authorize(t, authURL); resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected reused request_uri to fail, got %d", resp.StatusCode)
+			}
+		})
+	}
+
+	t.Run("par_required", func(t *testing.T) {
+		provider := newProvider(t, "", nil)
+		if resp, _ := authorize(t, provider.GetAuthURL("state", nil)); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected plain request to be rejected, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("bad_signature", func(t *testing.T) {
+		other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		badSigner, _ := oauth.NewJWTSignerFromKey(other, "jar-1")
+		provider := newProvider(t, mockServer.GetPARURL(), badSigner)
+
+		if _, err := provider.AuthURLContext(ctx, "state", nil); err == nil || !strings.Contains(err.Error(), "invalid_request_object") {
+			t.Errorf("Expected invalid_request_object, got %v", err)
+		}
+	})
+}
+
+func TestSignedRequestObject(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	signer, _ := oauth.NewJWTSignerFromKey(key, "")
+
+	mockServer := oauthtest.NewMockOAuthServer(oauthtest.MockServerConfig{
+		ProviderName:      "test",
+		ClientID:          "test-client",
+		ClientSecret:      "test-secret",
+		RequestObjectKeys: oauth.StaticKeySet{"": key.Public()},
+	})
+	defer mockServer.Close()
+
+	provider, err := oauth.NewCustom(oauth.ProviderConfig{
+		ClientID:            "test-client",
+		RedirectURL:         "http://localhost:8080/callback",
+		AuthURL:             mockServer.GetAuthURL(),
+		TokenURL:            mockServer.GetTokenURL(),
+		Scopes:              []string{"openid", "accounts"},
+		RequestObjectSigner: signer,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	authURL, err := provider.AuthURLContext(context.Background(), "jar-state", &oauth.PKCEChallenge{
+		Challenge:       "challenge",
+		ChallengeMethod: "S256",
+	})
+	if err != nil {
+		t.Fatalf("AuthURLContext failed: %v", err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("Authorization request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected redirect, got %d", resp.StatusCode)
+	}
+
+	params := mockServer.LastAuthorizationRequest()
+	if params.Get("scope") != "openid accounts" || params.Get("code_challenge") != "challenge" || params.Get("state") != "jar-state" {
+		t.Errorf("Unexpected request object parameters: %v", params)
+	}
+}
+
+func TestOIDCLoginWithJWKS(t *testing.T) {
+	mockServer := oauthtest.NewMockOAuthServer(oauthtest.MockServerConfig{
+		ProviderName:     "test",
+		ClientID:         "test-client",
+		ClientSecret:     "test-secret",
+		IDTokenAlgorithm: "ES256",
+	})
+	defer mockServer.Close()
+
+	mockServer.SetUserInfo("test_user", &oauth.UserInfo{ID: "test_user", Email: "jane@example.com", EmailVerified: true, Name: "Jane"})
+
+	provider, err := oauth.NewCustom(oauth.ProviderConfig{
+		ClientID:     "test-client",
+		ClientSecret: "test-secret",
+		RedirectURL:  "http://localhost:8080/callback",
+		AuthURL:      mockServer.GetAuthURL(),
+		TokenURL:     mockServer.GetTokenURL(),
+		UserInfoURL:  mockServer.GetUserInfoURL(),
+		Scopes:       []string{"openid", "email"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	ctx := context.Background()
+	keys := oauth.NewRemoteKeySet(mockServer.GetJWKSURL(), nil, time.Minute)
+	verify := func(t *testing.T, idToken string) jwt.MapClaims {
+		t.Helper()
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			return keys.PublicKey(ctx, kid)
+		}, jwt.WithIssuer(mockServer.GetURL()), jwt.WithAudience("test-client"), jwt.WithValidMethods([]string{"RS256", "ES256"}))
+		if err != nil {
+			t.Fatalf("ID token verification failed: %v", err)
+		}
+		return claims
+	}
+	login := func(t *testing.T, state string) *oauth.Token {
+		t.Helper()
+		callback, err := mockServer.Login(provider.GetAuthURL(state, nil)+"&nonce=nonce-"+state, true)
+		if err != nil {
+			t.Fatalf("Login failed: %v", err)
+		}
+		if callback.Query().Get("state") != state {
+			t.Fatalf("Expected state %q, got %s", state, callback)
+		}
+		token, err := provider.Exchange(ctx, callback.Query().Get("code"), nil)
+		if err != nil {
+			t.Fatalf("Exchange failed: %v", err)
+		}
+		return token
+	}
+
+	claims := verify(t, login(t, "first").IDToken)
+	if claims["sub"] != "test_user" || claims["email"] != "jane@example.com" || claims["nonce"] != "nonce-first" {
+		t.Errorf("Unexpected ID token claims: %v", claims)
+	}
+
+	// Tokens signed before a rotation still verify until the old key is retired
+	oldKeys := mockServer.SigningKeyIDs()
+	oldToken := login(t, "old").IDToken
+	newKey, err := mockServer.RotateSigningKey("RS256")
+	if err != nil {
+		t.Fatalf("RotateSigningKey failed: %v", err)
+	}
+	newToken := login(t, "new").IDToken
+	if header, _, _ := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{}); header.Header["kid"] != newKey || header.Method.Alg() != "RS256" {
+		t.Errorf("Expected ID token signed by the new key, got %v", header.Header)
+	}
+	if err := keys.Refresh(ctx); err != nil {
+		t.Fatalf("JWKS refresh failed: %v", err)
+	}
+	verify(t, oldToken)
+	verify(t, newToken)
+
+	mockServer.RetireSigningKey(oldKeys[0])
+	_ = keys.Refresh(ctx)
+	if _, err := keys.PublicKey(ctx, oldKeys[0]); !errors.Is(err, oauth.ErrKeyNotFound) {
+		t.Errorf("Expected retired key to be gone, got %v", err)
+	}
+
+	// Discovery advertises the JWKS and both algorithms
+	resp, err := http.Get(mockServer.GetURL() + "/.well-known/openid-configuration")
+	if err != nil {
+		t.Fatalf("Discovery request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var discovery struct {
+		JWKSURI string   `json:"jwks_uri"`
+		Algs    []string `json:"id_token_signing_alg_values_supported"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&discovery)
+	if discovery.JWKSURI != mockServer.GetJWKSURL() || len(discovery.Algs) != 2 {
+		t.Errorf("Unexpected discovery document: %+v", discovery)
+	}
+}
+
+func TestConsentScreen(t *testing.T) {
+	mockServer := oauthtest.NewMockOAuthServer(oauthtest.MockServerConfig{
+		ProviderName:  "test",
+		ClientID:      "test-client",
+		ClientSecret:  "test-secret",
+		ConsentScreen: true,
+	})
+	defer mockServer.Close()
+
+	provider := mockServer.CreateMockProvider()
+	ctx := context.Background()
+
+	callback, err := mockServer.Login(provider.GetAuthURL("approved", nil), true)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if _, err := provider.Exchange(ctx, callback.Query().Get("code"), nil); err != nil {
+		t.Errorf("Exchange after consent failed: %v", err)
+	}
+
+	callback, err = mockServer.Login(provider.GetAuthURL("denied", nil), false)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if q := callback.Query(); q.Get("error") != "access_denied" || q.Get("state") != "denied" || q.Has("code") {
+		t.Errorf("Expected access_denied redirect, got %s", callback)
+	}
+
+	// The consent scenario and scripted steps deny before the screen is shown
+	mockServer.SetFailureScenario("consent", true)
+	callback, _ = mockServer.Login(provider.GetAuthURL("scenario", nil), true)
+	if callback == nil || callback.Query().Get("error") != "access_denied" {
+		t.Errorf("Expected consent scenario to deny, got %v", callback)
+	}
+	mockServer.SetFailureScenario("consent", false)
+
+	mockServer.Script("authorize", oauthtest.Fail("temporarily_unavailable", "try later"))
+	callback, _ = mockServer.Login(provider.GetAuthURL("scripted", nil), true)
+	if callback == nil || callback.Query().Get("error") != "temporarily_unavailable" {
+		t.Errorf("Expected scripted error redirect, got %v", callback)
+	}
+}
+
+func TestScriptedScenarios(t *testing.T) {
+	mockServer := oauthtest.NewMockOAuthServer(oauthtest.MockServerConfig{
+		ProviderName:    "test",
+		ClientID:        "test-client",
+		ClientSecret:    "test-secret",
+		SupportsRefresh: true,
+	})
+	defer mockServer.Close()
+
+	provider := mockServer.CreateMockProvider()
+	ctx := context.Background()
+
+	callback, err := mockServer.Login(provider.GetAuthURL("state", nil), true)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	token, err := provider.Exchange(ctx, callback.Query().Get("code"), nil)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+
+	// First refresh fails, second succeeds
+	mockServer.Script("refresh", oauthtest.Fail("invalid_grant", "try again"), oauthtest.Succeed())
+	if _, err := provider.RefreshToken(ctx, token.RefreshToken); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("Expected scripted invalid_grant, got %v", err)
+	}
+	if _, err := provider.RefreshToken(ctx, token.RefreshToken); err != nil {
+		t.Errorf("Expected second refresh to succeed, got %v", err)
+	}
+	if n := mockServer.PendingSteps("refresh"); n != 0 {
+		t.Errorf("Expected all steps to be used, %d left", n)
+	}
+
+	mockServer.Script("userinfo", oauthtest.Delay(20*time.Millisecond), oauthtest.Fail("invalid_token", ""))
+	start := time.Now()
+	if _, err := provider.GetUserInfo(ctx, token.AccessToken); err != nil || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("Expected delayed success, got %v after %v", err, time.Since(start))
+	}
+	if _, err := provider.GetUserInfo(ctx, token.AccessToken); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected scripted 401, got %v", err)
+	}
+}
+
+func TestExpiredAuthorizationCode(t *testing.T) {
+	mockServer := oauthtest.NewMockOAuthServer(oauthtest.MockServerConfig{
+		ProviderName: "test",
+		ClientID:     "test-client",
+		ClientSecret: "test-secret",
+		CodeExpiry:   50 * time.Millisecond,
+	})
+	defer mockServer.Close()
+
+	provider := mockServer.CreateMockProvider()
+	ctx := context.Background()
+
+	callback, err := mockServer.Login(provider.GetAuthURL("state", nil), true)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := provider.Exchange(ctx, callback.Query().Get("code"), nil); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("Expected invalid_grant for an expired code, got %v", err)
+	}
+
+	code := mockServer.IssueAuthorizationCode("test_user", "state", "http://localhost:8080/callback", "")
+	mockServer.ExpireAuthorizationCodes()
+	if _, err := provider.Exchange(ctx, code, nil); err == nil {
+		t.Error("Expected expired code to be rejected")
+	}
+}
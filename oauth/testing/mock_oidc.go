@@ -0,0 +1,184 @@
+package testing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gobeaver/beaver-kit/oauth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GetJWKSURL returns the JWKS endpoint URL
+func (m *MockOAuthServer) GetJWKSURL() string {
+	return m.server.URL + "/jwks"
+}
+
+// RotateSigningKey generates a new ID token signing key and makes it current.
+// alg is RS256, ES256, ES384 or ES512; empty uses MockServerConfig.IDTokenAlgorithm.
+// Previous keys stay in the JWKS until retired, so tokens they signed still verify.
+func (m *MockOAuthServer) RotateSigningKey(alg string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	signer, err := m.addSigningKeyLocked(alg)
+	if err != nil {
+		return "", err
+	}
+	return signer.KeyID(), nil
+}
+
+// RetireSigningKey removes a key from the JWKS. Tokens it signed no longer
+// verify. Retiring the current key makes the previous one current again.
+func (m *MockOAuthServer) RetireSigningKey(keyID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, signer := range m.signingKeys {
+		if signer.KeyID() == keyID {
+			m.signingKeys = append(m.signingKeys[:i], m.signingKeys[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SigningKeyIDs returns the IDs of the published keys, current key last
+func (m *MockOAuthServer) SigningKeyIDs() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, len(m.signingKeys))
+	for i, signer := range m.signingKeys {
+		ids[i] = signer.KeyID()
+	}
+	return ids
+}
+
+// currentSigner returns the newest signing key, generating the first key on demand
+func (m *MockOAuthServer) currentSigner() (*oauth.JWTSigner, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n := len(m.signingKeys); n > 0 {
+		return m.signingKeys[n-1], nil
+	}
+	return m.addSigningKeyLocked("")
+}
+
+// addSigningKeyLocked generates and publishes a key; m.mu must be held
+func (m *MockOAuthServer) addSigningKeyLocked(alg string) (*oauth.JWTSigner, error) {
+	if alg == "" {
+		alg = m.config.IDTokenAlgorithm
+	}
+	key, err := generateSigningKey(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	m.keySeq++
+	signer, err := oauth.NewJWTSignerFromKey(key, fmt.Sprintf("mock-key-%d", m.keySeq))
+	if err != nil {
+		return nil, err
+	}
+	m.signingKeys = append(m.signingKeys, signer)
+	return signer, nil
+}
+
+func (m *MockOAuthServer) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	if m.scripted(w, "jwks") {
+		return
+	}
+	if _, err := m.currentSigner(); err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	m.mu.RLock()
+	set := oauth.JWKSet{Keys: make([]oauth.JWK, 0, len(m.signingKeys))}
+	for _, signer := range m.signingKeys {
+		jwk, err := oauth.NewJWK(signer.PublicKey(), signer.KeyID())
+		if err != nil {
+			continue
+		}
+		jwk.Use = "sig"
+		jwk.Algorithm = signer.Algorithm()
+		set.Keys = append(set.Keys, *jwk)
+	}
+	m.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(set)
+}
+
+// issueIDToken signs an OpenID Connect ID token with the current key
+func (m *MockOAuthServer) issueIDToken(userID, nonce string, authTime time.Time) (string, error) {
+	signer, err := m.currentSigner()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            m.server.URL,
+		"sub":            userID,
+		"aud":            m.config.ClientID,
+		"exp":            now.Add(m.config.TokenExpiry).Unix(),
+		"iat":            now.Unix(),
+		"auth_time":      authTime.Unix(),
+		"email":          userID + "@example.com",
+		"email_verified": true,
+		"name":           "Test User",
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	m.mu.RLock()
+	if info, exists := m.userInfo[userID]; exists {
+		claims["email"] = info.Email
+		claims["email_verified"] = info.EmailVerified
+		claims["name"] = info.Name
+		if info.Picture != "" {
+			claims["picture"] = info.Picture
+		}
+	}
+	m.mu.RUnlock()
+
+	return signer.Sign(claims)
+}
+
+// idTokenAlgorithms lists the algorithms of the published keys for discovery
+func (m *MockOAuthServer) idTokenAlgorithms() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	algs := []string{m.config.IDTokenAlgorithm}
+	for _, signer := range m.signingKeys {
+		if !contains(algs, signer.Algorithm()) {
+			algs = append(algs, signer.Algorithm())
+		}
+	}
+	return algs
+}
+
+func generateSigningKey(alg string) (crypto.Signer, error) {
+	switch alg {
+	case "RS256":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", oauth.ErrInvalidSigningKey, alg)
+	}
+}
@@ -0,0 +1,199 @@
+package testing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// requestURIPrefix is the RFC 9126 request_uri scheme
+const requestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+// PushedRequest represents authorization parameters pushed to the PAR endpoint
+type PushedRequest struct {
+	RequestURI string
+	ClientID   string
+	Params     url.Values
+	ExpiresAt  time.Time
+}
+
+// LastAuthorizationRequest returns the effective parameters of the most recent
+// authorization request, after resolving request_uri and request objects
+func (m *MockOAuthServer) LastAuthorizationRequest() url.Values {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	params := url.Values{}
+	for k, v := range m.lastAuthRequest {
+		params[k] = append([]string(nil), v...)
+	}
+	return params
+}
+
+func (m *MockOAuthServer) handlePushedAuthorization(w http.ResponseWriter, r *http.Request) {
+	if latency := m.getLatency("par"); latency > 0 {
+		time.Sleep(latency)
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if m.shouldFail("par") {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "PAR server error")
+		return
+	}
+	if m.scripted(w, "par") {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "malformed form body")
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != m.config.ClientID || clientSecret != m.config.ClientSecret {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "")
+		return
+	}
+
+	if r.PostForm.Has("request_uri") {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "request_uri is not allowed in pushed requests")
+		return
+	}
+
+	params := url.Values{}
+	if request := r.PostFormValue("request"); request != "" {
+		var err error
+		if params, err = m.verifyRequestObject(request); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request_object", err.Error())
+			return
+		}
+	} else {
+		for k, v := range r.PostForm {
+			if k != "client_secret" {
+				params[k] = v
+			}
+		}
+	}
+
+	if params.Get("client_id") != clientID {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "client_id mismatch")
+		return
+	}
+	if params.Get("redirect_uri") == "" || params.Get("response_type") == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "redirect_uri and response_type are required")
+		return
+	}
+
+	pushed := &PushedRequest{
+		RequestURI: fmt.Sprintf("%smock_%d", requestURIPrefix, time.Now().UnixNano()),
+		ClientID:   clientID,
+		Params:     params,
+		ExpiresAt:  time.Now().Add(m.config.PARRequestExpiry),
+	}
+
+	m.mu.Lock()
+	m.pushedRequests[pushed.RequestURI] = pushed
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"request_uri": pushed.RequestURI,
+		"expires_in":  int(m.config.PARRequestExpiry.Seconds()),
+	})
+}
+
+// authorizationParams resolves the effective authorization request parameters
+func (m *MockOAuthServer) authorizationParams(query url.Values) (url.Values, error) {
+	if requestURI := query.Get("request_uri"); requestURI != "" {
+		m.mu.Lock()
+		pushed, exists := m.pushedRequests[requestURI]
+		delete(m.pushedRequests, requestURI) // request_uri is single use
+		m.mu.Unlock()
+
+		if !exists || time.Now().After(pushed.ExpiresAt) {
+			return nil, fmt.Errorf("invalid or expired request_uri")
+		}
+		if query.Get("client_id") != pushed.ClientID {
+			return nil, fmt.Errorf("client_id does not match pushed request")
+		}
+		return pushed.Params, nil
+	}
+
+	if m.config.RequirePAR {
+		return nil, fmt.Errorf("pushed authorization request required")
+	}
+
+	if request := query.Get("request"); request != "" {
+		params, err := m.verifyRequestObject(request)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request object: %w", err)
+		}
+		if clientID := query.Get("client_id"); clientID != "" && clientID != params.Get("client_id") {
+			return nil, fmt.Errorf("client_id does not match request object")
+		}
+		return params, nil
+	}
+
+	return query, nil
+}
+
+// verifyRequestObject validates a signed RFC 9101 request object and returns its parameters
+func (m *MockOAuthServer) verifyRequestObject(raw string) (url.Values, error) {
+	if m.config.RequestObjectKeys == nil {
+		return nil, fmt.Errorf("request objects not supported")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return m.config.RequestObjectKeys.PublicKey(context.Background(), kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(m.config.ClientID),
+		jwt.WithAudience(m.server.URL),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	for k, v := range claims {
+		switch k {
+		case "iss", "aud", "iat", "nbf", "exp", "jti":
+			continue
+		}
+		if s, ok := v.(string); ok {
+			params.Set(k, s)
+		} else {
+			params.Set(k, fmt.Sprint(v))
+		}
+	}
+	if params.Get("client_id") == "" {
+		params.Set("client_id", m.config.ClientID)
+	}
+	return params, nil
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	body := map[string]string{"error": code}
+	if description != "" {
+		body["error_description"] = description
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -25,11 +25,20 @@ type MockOAuthServer struct {
 	issuedTokens    map[string]*IssuedToken
 	revokedTokens   map[string]time.Time
 	userInfo        map[string]*oauth.UserInfo
+	deviceCodes     map[string]*DeviceCode
+	pushedRequests  map[string]*PushedRequest
+	consents        map[string]*pendingConsent
+	lastAuthRequest url.Values
+
+	// ID token signing keys, current key last
+	signingKeys []*oauth.JWTSigner
+	keySeq      int
 
 	// Behavior control
 	failureScenarios map[string]bool
 	latencies        map[string]time.Duration
 	errorRates       map[string]float64
+	scripts          map[string][]Step
 }
 
 // MockServerConfig configures the mock OAuth server
@@ -42,6 +51,21 @@ type MockServerConfig struct {
 	TokenExpiry     time.Duration
 	RefreshExpiry   time.Duration
 	RequireHTTPS    bool
+
+	// Device flow settings (RFC 8628)
+	DevicePollInterval time.Duration // Interval returned to clients, default 1s
+	DeviceCodeExpiry   time.Duration // Device code lifetime, default 10m
+
+	// Pushed authorization requests (RFC 9126) and request objects (RFC 9101)
+	RequirePAR        bool          // Reject authorization requests without a request_uri
+	PARRequestExpiry  time.Duration // request_uri lifetime, default 60s
+	RequestObjectKeys oauth.KeySet  // Verifies signed request objects; nil rejects them
+
+	// OpenID Connect
+	IDTokenAlgorithm string        // ID token signing algorithm, default RS256
+	CodeExpiry       time.Duration // Authorization code lifetime, default 10m
+	ConsentScreen    bool          // Show a consent page instead of redirecting immediately
+	DefaultUserID    string        // User logged in by /authorize, default "test_user"
 }
 
 // AuthorizedCode represents an authorized code
@@ -51,12 +75,26 @@ type AuthorizedCode struct {
 	RedirectURI  string
 	State        string
 	PKCEVerifier string
+	Nonce        string
 	UserID       string
 	Scopes       []string
 	IssuedAt     time.Time
 	ExpiresAt    time.Time
 }
 
+// DeviceCode represents a pending device authorization
+type DeviceCode struct {
+	DeviceCode string
+	UserCode   string
+	ClientID   string
+	Scopes     []string
+	UserID     string // Set once approved
+	Approved   bool
+	Denied     bool
+	LastPollAt time.Time
+	ExpiresAt  time.Time
+}
+
 // IssuedToken represents an issued token
 type IssuedToken struct {
 	AccessToken  string
@@ -76,6 +114,24 @@ func NewMockOAuthServer(config MockServerConfig) *MockOAuthServer {
 	if config.RefreshExpiry <= 0 {
 		config.RefreshExpiry = 30 * 24 * time.Hour
 	}
+	if config.DevicePollInterval <= 0 {
+		config.DevicePollInterval = time.Second
+	}
+	if config.DeviceCodeExpiry <= 0 {
+		config.DeviceCodeExpiry = 10 * time.Minute
+	}
+	if config.PARRequestExpiry <= 0 {
+		config.PARRequestExpiry = 60 * time.Second
+	}
+	if config.IDTokenAlgorithm == "" {
+		config.IDTokenAlgorithm = "RS256"
+	}
+	if config.CodeExpiry <= 0 {
+		config.CodeExpiry = 10 * time.Minute
+	}
+	if config.DefaultUserID == "" {
+		config.DefaultUserID = "test_user"
+	}
 
 	mock := &MockOAuthServer{
 		config:           config,
@@ -83,9 +139,13 @@ func NewMockOAuthServer(config MockServerConfig) *MockOAuthServer {
 		issuedTokens:     make(map[string]*IssuedToken),
 		revokedTokens:    make(map[string]time.Time),
 		userInfo:         make(map[string]*oauth.UserInfo),
+		deviceCodes:      make(map[string]*DeviceCode),
+		pushedRequests:   make(map[string]*PushedRequest),
+		consents:         make(map[string]*pendingConsent),
 		failureScenarios: make(map[string]bool),
 		latencies:        make(map[string]time.Duration),
 		errorRates:       make(map[string]float64),
+		scripts:          make(map[string][]Step),
 	}
 
 	// Setup HTTP handlers
@@ -94,6 +154,10 @@ func NewMockOAuthServer(config MockServerConfig) *MockOAuthServer {
 	mux.HandleFunc("/token", mock.handleToken)
 	mux.HandleFunc("/userinfo", mock.handleUserInfo)
 	mux.HandleFunc("/revoke", mock.handleRevoke)
+	mux.HandleFunc("/device_authorization", mock.handleDeviceAuthorization)
+	mux.HandleFunc("/par", mock.handlePushedAuthorization)
+	mux.HandleFunc("/consent", mock.handleConsent)
+	mux.HandleFunc("/jwks", mock.handleJWKS)
 	mux.HandleFunc("/.well-known/openid-configuration", mock.handleDiscovery)
 
 	mock.server = httptest.NewServer(mux)
@@ -126,6 +190,16 @@ func (m *MockOAuthServer) GetRevokeURL() string {
 	return m.server.URL + "/revoke"
 }
 
+// GetDeviceAuthURL returns the device authorization endpoint URL
+func (m *MockOAuthServer) GetDeviceAuthURL() string {
+	return m.server.URL + "/device_authorization"
+}
+
+// GetPARURL returns the pushed authorization request endpoint URL
+func (m *MockOAuthServer) GetPARURL() string {
+	return m.server.URL + "/par"
+}
+
 // Close shuts down the mock server
 func (m *MockOAuthServer) Close() {
 	m.server.Close()
@@ -138,7 +212,9 @@ func (m *MockOAuthServer) SetUserInfo(userID string, info *oauth.UserInfo) {
 	m.userInfo[userID] = info
 }
 
-// SetFailureScenario enables a specific failure scenario
+// SetFailureScenario enables a specific failure scenario. Scenarios are
+// endpoint names, "slow_down" for device polling and "consent" to deny every
+// authorization request with access_denied.
 func (m *MockOAuthServer) SetFailureScenario(scenario string, enabled bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -161,23 +237,74 @@ func (m *MockOAuthServer) SetErrorRate(endpoint string, rate float64) {
 
 // IssueAuthorizationCode issues a new authorization code
 func (m *MockOAuthServer) IssueAuthorizationCode(userID, state, redirectURI string, pkceVerifier string) string {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	code := fmt.Sprintf("mock_code_%d", time.Now().UnixNano())
-	m.authorizedCodes[code] = &AuthorizedCode{
-		Code:         code,
-		ClientID:     m.config.ClientID,
+	return m.issueCode(&AuthorizedCode{
 		RedirectURI:  redirectURI,
 		State:        state,
 		PKCEVerifier: pkceVerifier,
 		UserID:       userID,
-		Scopes:       []string{"openid", "email", "profile"},
-		IssuedAt:     time.Now(),
-		ExpiresAt:    time.Now().Add(10 * time.Minute),
+	})
+}
+
+// issueCode stores an authorization code, filling in defaults
+func (m *MockOAuthServer) issueCode(authCode *AuthorizedCode) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	authCode.Code = fmt.Sprintf("mock_code_%d", now.UnixNano())
+	authCode.ClientID = m.config.ClientID
+	if len(authCode.Scopes) == 0 {
+		authCode.Scopes = []string{"openid", "email", "profile"}
 	}
+	authCode.IssuedAt = now
+	authCode.ExpiresAt = now.Add(m.config.CodeExpiry)
+	m.authorizedCodes[authCode.Code] = authCode
+
+	return authCode.Code
+}
+
+// redirectWithCode issues a code for an approved request and redirects back
+func (m *MockOAuthServer) redirectWithCode(w http.ResponseWriter, r *http.Request, userID string, params url.Values) {
+	code := m.issueCode(&AuthorizedCode{
+		RedirectURI: params.Get("redirect_uri"),
+		State:       params.Get("state"),
+		Nonce:       params.Get("nonce"),
+		UserID:      userID,
+		Scopes:      strings.Fields(params.Get("scope")),
+	})
+	redirectWithParams(w, r, params.Get("redirect_uri"), url.Values{
+		"code":  {code},
+		"state": {params.Get("state")},
+	})
+}
+
+// ApproveDeviceCode simulates the user entering userCode and granting access
+func (m *MockOAuthServer) ApproveDeviceCode(userCode, userID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	return code
+	for _, dc := range m.deviceCodes {
+		if dc.UserCode == userCode {
+			dc.Approved = true
+			dc.UserID = userID
+			return true
+		}
+	}
+	return false
+}
+
+// DenyDeviceCode simulates the user rejecting the device authorization
+func (m *MockOAuthServer) DenyDeviceCode(userCode string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, dc := range m.deviceCodes {
+		if dc.UserCode == userCode {
+			dc.Denied = true
+			return true
+		}
+	}
+	return false
 }
 
 // HTTP Handlers
@@ -194,11 +321,20 @@ func (m *MockOAuthServer) handleAuthorize(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Parse query parameters
-	clientID := r.URL.Query().Get("client_id")
-	redirectURI := r.URL.Query().Get("redirect_uri")
-	state := r.URL.Query().Get("state")
-	responseType := r.URL.Query().Get("response_type")
+	// Resolve parameters from a pushed request_uri, a request object or the query
+	query, err := m.authorizationParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	m.lastAuthRequest = query
+	m.mu.Unlock()
+
+	clientID := query.Get("client_id")
+	redirectURI := query.Get("redirect_uri")
+	responseType := query.Get("response_type")
 
 	// Validate request
 	if clientID != m.config.ClientID {
@@ -211,11 +347,32 @@ func (m *MockOAuthServer) handleAuthorize(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Generate authorization code
-	code := m.IssueAuthorizationCode("test_user", state, redirectURI, "")
+	// Scripted steps and the consent scenario answer with an error redirect
+	step, _ := m.nextStep("authorize")
+	if step.Delay > 0 {
+		time.Sleep(step.Delay)
+	}
+	m.mu.RLock()
+	denied := m.failureScenarios["consent"]
+	m.mu.RUnlock()
+	if step.Error == "" && denied {
+		step = DenyConsent()
+	}
+	if step.Error != "" {
+		redirectWithParams(w, r, redirectURI, url.Values{
+			"error":             {step.Error},
+			"error_description": {step.Description},
+			"state":             {query.Get("state")},
+		})
+		return
+	}
 
-	// Redirect back with code
-	http.Redirect(w, r, fmt.Sprintf("%s?code=%s&state=%s", redirectURI, code, state), http.StatusFound)
+	if m.config.ConsentScreen {
+		m.renderConsent(w, query)
+		return
+	}
+
+	m.redirectWithCode(w, r, m.config.DefaultUserID, query)
 }
 
 func (m *MockOAuthServer) handleToken(w http.ResponseWriter, r *http.Request) {
@@ -243,11 +400,20 @@ func (m *MockOAuthServer) handleToken(w http.ResponseWriter, r *http.Request) {
 
 	grantType := r.FormValue("grant_type")
 
+	if grantType == "refresh_token" && m.scripted(w, "refresh") {
+		return
+	}
+	if m.scripted(w, "token") {
+		return
+	}
+
 	switch grantType {
 	case "authorization_code":
 		m.handleAuthorizationCodeGrant(w, r)
 	case "refresh_token":
 		m.handleRefreshTokenGrant(w, r)
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		m.handleDeviceCodeGrant(w, r)
 	default:
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -277,7 +443,13 @@ func (m *MockOAuthServer) handleAuthorizationCodeGrant(w http.ResponseWriter, r
 	// Validate authorization code
 	m.mu.Lock()
 	authCode, exists := m.authorizedCodes[code]
-	if !exists || time.Now().After(authCode.ExpiresAt) {
+	if exists && time.Now().After(authCode.ExpiresAt) {
+		delete(m.authorizedCodes, code)
+		m.mu.Unlock()
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "authorization code expired")
+		return
+	}
+	if !exists {
 		m.mu.Unlock()
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -360,7 +532,12 @@ func (m *MockOAuthServer) handleAuthorizationCodeGrant(w http.ResponseWriter, r
 
 	// Add ID token for OpenID Connect
 	if contains(authCode.Scopes, "openid") {
-		response["id_token"] = m.generateMockIDToken(authCode.UserID)
+		idToken, err := m.issueIDToken(authCode.UserID, authCode.Nonce, authCode.IssuedAt)
+		if err != nil {
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+		response["id_token"] = idToken
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -430,6 +607,139 @@ func (m *MockOAuthServer) handleRefreshTokenGrant(w http.ResponseWriter, r *http
 	_ = json.NewEncoder(w).Encode(response)
 }
 
+func (m *MockOAuthServer) handleDeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	if m.shouldFail("device_authorization") {
+		http.Error(w, "Device authorization server error", http.StatusInternalServerError)
+		return
+	}
+	if m.scripted(w, "device_authorization") {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if r.FormValue("client_id") != m.config.ClientID {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"error": "invalid_client",
+		})
+		return
+	}
+
+	now := time.Now()
+	dc := &DeviceCode{
+		DeviceCode: fmt.Sprintf("mock_device_%d", now.UnixNano()),
+		UserCode:   fmt.Sprintf("USER-%04d", now.UnixNano()%10000),
+		ClientID:   m.config.ClientID,
+		Scopes:     strings.Fields(r.FormValue("scope")),
+		ExpiresAt:  now.Add(m.config.DeviceCodeExpiry),
+	}
+
+	m.mu.Lock()
+	m.deviceCodes[dc.DeviceCode] = dc
+	m.mu.Unlock()
+
+	verificationURI := m.server.URL + "/device"
+	response := map[string]interface{}{
+		"device_code":               dc.DeviceCode,
+		"user_code":                 dc.UserCode,
+		"verification_uri":          verificationURI,
+		"verification_uri_complete": verificationURI + "?user_code=" + dc.UserCode,
+		"expires_in":                int(m.config.DeviceCodeExpiry.Seconds()),
+		"interval":                  int(m.config.DevicePollInterval.Seconds()),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (m *MockOAuthServer) handleDeviceCodeGrant(w http.ResponseWriter, r *http.Request) {
+	writeError := func(code string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"error": code,
+		})
+	}
+
+	m.mu.Lock()
+	dc, exists := m.deviceCodes[r.FormValue("device_code")]
+	if !exists || dc.ClientID != r.FormValue("client_id") {
+		m.mu.Unlock()
+		writeError("invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	// Polling faster than the advertised interval triggers slow_down
+	tooFast := !dc.LastPollAt.IsZero() && now.Sub(dc.LastPollAt) < m.config.DevicePollInterval
+	dc.LastPollAt = now
+
+	switch {
+	case now.After(dc.ExpiresAt):
+		delete(m.deviceCodes, dc.DeviceCode)
+		m.mu.Unlock()
+		writeError("expired_token")
+		return
+	case dc.Denied:
+		delete(m.deviceCodes, dc.DeviceCode)
+		m.mu.Unlock()
+		writeError("access_denied")
+		return
+	case tooFast || m.failureScenarios["slow_down"]:
+		m.mu.Unlock()
+		writeError("slow_down")
+		return
+	case !dc.Approved:
+		m.mu.Unlock()
+		writeError("authorization_pending")
+		return
+	}
+
+	// Device codes are single use
+	delete(m.deviceCodes, dc.DeviceCode)
+
+	accessToken := fmt.Sprintf("mock_access_%d", now.UnixNano())
+	expiresAt := now.Add(m.config.TokenExpiry)
+	m.issuedTokens[accessToken] = &IssuedToken{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresAt:   expiresAt,
+		UserID:      dc.UserID,
+		Scopes:      dc.Scopes,
+		IssuedAt:    now,
+	}
+
+	response := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(m.config.TokenExpiry.Seconds()),
+		"scope":        strings.Join(dc.Scopes, " "),
+	}
+
+	if m.config.SupportsRefresh {
+		refreshToken := fmt.Sprintf("mock_refresh_%d", now.UnixNano())
+		m.issuedTokens[refreshToken] = &IssuedToken{
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			TokenType:    "Bearer",
+			ExpiresAt:    now.Add(m.config.RefreshExpiry),
+			UserID:       dc.UserID,
+			Scopes:       dc.Scopes,
+			IssuedAt:     now,
+		}
+		response["refresh_token"] = refreshToken
+	}
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
 func (m *MockOAuthServer) handleUserInfo(w http.ResponseWriter, r *http.Request) {
 	// Apply latency if configured
 	if latency := m.getLatency("userinfo"); latency > 0 {
@@ -441,6 +751,9 @@ func (m *MockOAuthServer) handleUserInfo(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "User info server error", http.StatusInternalServerError)
 		return
 	}
+	if m.scripted(w, "userinfo") {
+		return
+	}
 
 	// Extract access token from Authorization header
 	authHeader := r.Header.Get("Authorization")
@@ -490,6 +803,10 @@ func (m *MockOAuthServer) handleUserInfo(w http.ResponseWriter, r *http.Request)
 }
 
 func (m *MockOAuthServer) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if m.scripted(w, "revoke") {
+		return
+	}
+
 	// Parse form data
 	if err := r.ParseForm(); err != nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
@@ -507,18 +824,26 @@ func (m *MockOAuthServer) handleRevoke(w http.ResponseWriter, r *http.Request) {
 
 func (m *MockOAuthServer) handleDiscovery(w http.ResponseWriter, r *http.Request) {
 	discovery := map[string]interface{}{
-		"issuer":                                m.server.URL,
-		"authorization_endpoint":                m.GetAuthURL(),
-		"token_endpoint":                        m.GetTokenURL(),
-		"userinfo_endpoint":                     m.GetUserInfoURL(),
-		"revocation_endpoint":                   m.GetRevokeURL(),
-		"response_types_supported":              []string{"code"},
-		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
-		"subject_types_supported":               []string{"public"},
-		"id_token_signing_alg_values_supported": []string{"RS256"},
-		"scopes_supported":                      []string{"openid", "email", "profile"},
-		"token_endpoint_auth_methods_supported": []string{"client_secret_post", "client_secret_basic"},
-		"code_challenge_methods_supported":      []string{"S256"},
+		"issuer":                                      m.server.URL,
+		"authorization_endpoint":                      m.GetAuthURL(),
+		"token_endpoint":                              m.GetTokenURL(),
+		"userinfo_endpoint":                           m.GetUserInfoURL(),
+		"jwks_uri":                                    m.GetJWKSURL(),
+		"revocation_endpoint":                         m.GetRevokeURL(),
+		"device_authorization_endpoint":               m.GetDeviceAuthURL(),
+		"pushed_authorization_request_endpoint":       m.GetPARURL(),
+		"require_pushed_authorization_requests":       m.config.RequirePAR,
+		"request_parameter_supported":                 m.config.RequestObjectKeys != nil,
+		"request_object_signing_alg_values_supported": []string{"RS256", "ES256", "ES384", "ES512"},
+		"response_types_supported":                    []string{"code"},
+		"response_modes_supported":                    []string{"query"},
+		"grant_types_supported":                       []string{"authorization_code", "refresh_token", "urn:ietf:params:oauth:grant-type:device_code"},
+		"subject_types_supported":                     []string{"public"},
+		"id_token_signing_alg_values_supported":       m.idTokenAlgorithms(),
+		"scopes_supported":                            []string{"openid", "email", "profile"},
+		"claims_supported":                            []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified", "name", "picture"},
+		"token_endpoint_auth_methods_supported":       []string{"client_secret_post", "client_secret_basic"},
+		"code_challenge_methods_supported":            []string{"S256"},
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -556,23 +881,6 @@ func (m *MockOAuthServer) validatePKCE(stored, provided string) bool {
 	return stored == provided || stored == generateS256Challenge(provided)
 }
 
-func (m *MockOAuthServer) generateMockIDToken(userID string) string {
-	// Generate a simple mock ID token (not a real JWT)
-	claims := map[string]interface{}{
-		"iss":   m.server.URL,
-		"sub":   userID,
-		"aud":   m.config.ClientID,
-		"exp":   time.Now().Add(1 * time.Hour).Unix(),
-		"iat":   time.Now().Unix(),
-		"email": userID + "@example.com",
-		"name":  "Test User",
-	}
-
-	// For testing, just return a base64 encoded JSON
-	data, _ := json.Marshal(claims)
-	return "mock." + base64URLEncode(data) + ".signature"
-}
-
 // CreateMockProvider creates an OAuth provider configured for the mock server
 func (m *MockOAuthServer) CreateMockProvider() oauth.Provider {
 	return &MockProvider{
@@ -788,20 +1096,6 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
-func base64URLEncode(data []byte) string {
-	// Simple base64 URL encoding for testing
-	encoded := make([]byte, (len(data)+2)/3*4)
-	n := len(encoded)
-	for i := 0; i < len(data); i += 3 {
-		// Simplified encoding
-		encoded[i/3*4] = 'A' + byte(i%26)
-		encoded[i/3*4+1] = 'A' + byte((i+1)%26)
-		encoded[i/3*4+2] = 'A' + byte((i+2)%26)
-		encoded[i/3*4+3] = 'A' + byte((i+3)%26)
-	}
-	return string(encoded[:n])
-}
-
 func generateS256Challenge(verifier string) string {
 	// Simplified S256 challenge generation for testing
 	return "mock_challenge_" + verifier
@@ -0,0 +1,277 @@
+package testing
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Step is one scripted outcome for a mock endpoint. The zero Step lets the
+// request through unchanged.
+//
+// Endpoints are named "authorize", "token", "refresh" (refresh_token grants,
+// checked before "token"), "userinfo", "revoke", "par",
+// "device_authorization" and "jwks".
+type Step struct {
+	// Error is the OAuth error code returned instead of handling the request
+	Error       string
+	Description string
+
+	// Status overrides the HTTP status of the error response. Authorization
+	// errors are always redirected to the client's redirect_uri.
+	Status int
+
+	// Delay is applied before the request is handled
+	Delay time.Duration
+}
+
+// Succeed lets a request through unchanged
+func Succeed() Step {
+	return Step{}
+}
+
+// Fail returns an OAuth error for a request
+func Fail(code, description string) Step {
+	return Step{Error: code, Description: description}
+}
+
+// DenyConsent simulates the user declining the consent screen
+func DenyConsent() Step {
+	return Fail("access_denied", "The user denied the request")
+}
+
+// Delay slows a request down without changing its outcome
+func Delay(d time.Duration) Step {
+	return Step{Delay: d}
+}
+
+// Script queues steps for the next requests to an endpoint, in order. Once
+// the steps are used up the endpoint behaves normally again. For example,
+// Script("refresh", Fail("invalid_grant", ""), Succeed()) fails the first
+// refresh and lets the second through.
+func (m *MockOAuthServer) Script(endpoint string, steps ...Step) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scripts[endpoint] = append(m.scripts[endpoint], steps...)
+}
+
+// PendingSteps returns the number of scripted steps not yet used
+func (m *MockOAuthServer) PendingSteps(endpoint string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.scripts[endpoint])
+}
+
+// nextStep pops the next scripted step for an endpoint
+func (m *MockOAuthServer) nextStep(endpoint string) (Step, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	steps := m.scripts[endpoint]
+	if len(steps) == 0 {
+		return Step{}, false
+	}
+	m.scripts[endpoint] = steps[1:]
+	return steps[0], true
+}
+
+// scripted applies the next step for an endpoint and reports whether it
+// already wrote an error response
+func (m *MockOAuthServer) scripted(w http.ResponseWriter, endpoint string) bool {
+	step, ok := m.nextStep(endpoint)
+	if !ok {
+		return false
+	}
+	if step.Delay > 0 {
+		time.Sleep(step.Delay)
+	}
+	if step.Error == "" {
+		return false
+	}
+
+	status := step.Status
+	if status == 0 {
+		status = errorStatus(step.Error)
+	}
+	writeOAuthError(w, status, step.Error, step.Description)
+	return true
+}
+
+// errorStatus returns the conventional HTTP status for an OAuth error code
+func errorStatus(code string) int {
+	switch code {
+	case "invalid_client", "invalid_token":
+		return http.StatusUnauthorized
+	case "insufficient_scope":
+		return http.StatusForbidden
+	case "server_error":
+		return http.StatusInternalServerError
+	case "temporarily_unavailable":
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// ExpireAuthorizationCodes expires every outstanding authorization code, so
+// the next exchange fails with invalid_grant
+func (m *MockOAuthServer) ExpireAuthorizationCodes() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expired := time.Now().Add(-time.Second)
+	for _, code := range m.authorizedCodes {
+		code.ExpiresAt = expired
+	}
+}
+
+// pendingConsent is an authorization request waiting on the consent screen
+type pendingConsent struct {
+	params    url.Values
+	expiresAt time.Time
+}
+
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Authorize {{.ClientID}}</title></head>
+<body>
+<p>{{.ClientID}} is requesting access to: {{.Scope}}</p>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="ticket" value="{{.Ticket}}">
+<label>User <input type="text" name="user" value="{{.UserID}}"></label>
+<button type="submit" name="decision" value="approve">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+// renderConsent shows the consent screen for a validated authorization request
+func (m *MockOAuthServer) renderConsent(w http.ResponseWriter, params url.Values) {
+	ticket := fmt.Sprintf("mock_consent_%d", time.Now().UnixNano())
+
+	m.mu.Lock()
+	m.consents[ticket] = &pendingConsent{params: params, expiresAt: time.Now().Add(m.config.CodeExpiry)}
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = consentPage.Execute(w, map[string]string{
+		"ClientID": params.Get("client_id"),
+		"Scope":    params.Get("scope"),
+		"Action":   m.server.URL + "/consent",
+		"Ticket":   ticket,
+		"UserID":   m.config.DefaultUserID,
+	})
+}
+
+func (m *MockOAuthServer) handleConsent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	ticket := r.PostFormValue("ticket")
+	m.mu.Lock()
+	consent, exists := m.consents[ticket]
+	delete(m.consents, ticket)
+	m.mu.Unlock()
+
+	if !exists || time.Now().After(consent.expiresAt) {
+		http.Error(w, "Invalid or expired consent ticket", http.StatusBadRequest)
+		return
+	}
+
+	params := consent.params
+	if r.PostFormValue("decision") != "approve" {
+		step := DenyConsent()
+		redirectWithParams(w, r, params.Get("redirect_uri"), url.Values{
+			"error":             {step.Error},
+			"error_description": {step.Description},
+			"state":             {params.Get("state")},
+		})
+		return
+	}
+
+	userID := r.PostFormValue("user")
+	if userID == "" {
+		userID = m.config.DefaultUserID
+	}
+	m.redirectWithCode(w, r, userID, params)
+}
+
+// Login drives an authorization request the way a browser would: it follows
+// authURL, answers the consent screen (if enabled) with approve, and returns
+// the callback URL the user would be redirected to. The callback's query
+// holds either code and state or error and error_description.
+func (m *MockOAuthServer) Login(authURL string, approve bool) (*url.URL, error) {
+	client := &http.Client{
+		Timeout:       10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK && strings.Contains(string(body), `name="ticket"`) {
+		decision := "deny"
+		if approve {
+			decision = "approve"
+		}
+		resp, err = client.PostForm(m.server.URL+"/consent", url.Values{
+			"ticket":   {formField(string(body), "ticket")},
+			"decision": {decision},
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+	}
+
+	if resp.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("authorization failed: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return url.Parse(resp.Header.Get("Location"))
+}
+
+// formField extracts the value of a named input from the consent page
+func formField(page, name string) string {
+	marker := `name="` + name + `" value="`
+	start := strings.Index(page, marker)
+	if start < 0 {
+		return ""
+	}
+	value := page[start+len(marker):]
+	if end := strings.IndexByte(value, '"'); end >= 0 {
+		value = value[:end]
+	}
+	return value
+}
+
+// redirectWithParams redirects to redirectURI with params added to its query
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	query := target.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			query[k] = v
+		}
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
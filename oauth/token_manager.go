@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"sync"
 	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
 // TokenManager provides advanced token lifecycle management
@@ -44,6 +46,7 @@ type AdvancedTokenManager struct {
 	store           TokenStore
 	providerService *MultiProviderService
 	encryptor       TokenEncryptor
+	audit           AuditSink
 	mu              sync.RWMutex
 
 	// Configuration
@@ -57,6 +60,13 @@ type AdvancedTokenManager struct {
 	stats         *TokenStats
 	stopCh        chan struct{}
 	wg            sync.WaitGroup
+
+	// Refresh serialization, rotation and revocation
+	refreshGroup  singleflight.Group
+	retiredTokens map[string]map[string]time.Time // key -> refresh token hash -> retired at; per process
+	revokedGrants map[string]time.Time            // key -> revoked at; pruned after revokedGrantTTL
+	subscribers   map[int]func(TokenEvent)
+	subscriberSeq int
 }
 
 // TokenMetadata stores additional information about a token
@@ -85,6 +95,9 @@ type TokenManagerConfig struct {
 	RefreshThreshold time.Duration
 	CleanupInterval  time.Duration
 	MaxTokensPerUser int
+
+	// AuditSink receives refresh, revocation and grant revocation events
+	AuditSink AuditSink
 }
 
 // NewAdvancedTokenManager creates a new advanced token manager
@@ -103,11 +116,15 @@ func NewAdvancedTokenManager(config TokenManagerConfig) *AdvancedTokenManager {
 		store:            config.Store,
 		providerService:  config.ProviderService,
 		encryptor:        config.Encryptor,
+		audit:            config.AuditSink,
 		autoRefresh:      config.AutoRefresh,
 		refreshThreshold: config.RefreshThreshold,
 		cleanupInterval:  config.CleanupInterval,
 		maxTokensPerUser: config.MaxTokensPerUser,
 		tokenMetadata:    make(map[string]*TokenMetadata),
+		retiredTokens:    make(map[string]map[string]time.Time),
+		revokedGrants:    make(map[string]time.Time),
+		subscribers:      make(map[int]func(TokenEvent)),
 		stats: &TokenStats{
 			ProviderCounts: make(map[string]int),
 			LastCleanup:    time.Now(),
@@ -115,6 +132,10 @@ func NewAdvancedTokenManager(config TokenManagerConfig) *AdvancedTokenManager {
 		stopCh: make(chan struct{}),
 	}
 
+	if tm.audit != nil {
+		tm.Subscribe(tm.auditTokenEvent)
+	}
+
 	// Start background tasks if auto-refresh is enabled
 	if config.AutoRefresh {
 		tm.startBackgroundTasks()
@@ -123,23 +144,36 @@ func NewAdvancedTokenManager(config TokenManagerConfig) *AdvancedTokenManager {
 	return tm
 }
 
-// CacheToken stores a token with encryption if configured
+// CacheToken stores a token with encryption if configured. Caching a token
+// for a revoked grant (e.g. after the user logs in again) reinstates it.
 func (tm *AdvancedTokenManager) CacheToken(ctx context.Context, userID, provider string, token *Token) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
-	// Check user token limit
-	userTokens := 0
-	for key := range tm.tokenMetadata {
-		if md := tm.tokenMetadata[key]; md != nil && md.UserID == userID {
-			userTokens++
-		}
-	}
-	if userTokens >= tm.maxTokensPerUser {
-		return fmt.Errorf("user %s has reached maximum token limit (%d)", userID, tm.maxTokensPerUser)
+	if err := tm.cacheTokenLocked(ctx, userID, provider, token); err != nil {
+		return err
 	}
+	delete(tm.revokedGrants, tm.tokenKey(userID, provider))
+	return nil
+}
 
+// cacheTokenLocked encrypts and stores a token; tm.mu must be held
+func (tm *AdvancedTokenManager) cacheTokenLocked(ctx context.Context, userID, provider string, token *Token) error {
 	key := tm.tokenKey(userID, provider)
+	existing, replacing := tm.tokenMetadata[key]
+
+	// Check user token limit; replacing a token doesn't add one
+	if !replacing {
+		userTokens := 0
+		for _, md := range tm.tokenMetadata {
+			if md != nil && md.UserID == userID {
+				userTokens++
+			}
+		}
+		if userTokens >= tm.maxTokensPerUser {
+			return fmt.Errorf("user %s has reached maximum token limit (%d)", userID, tm.maxTokensPerUser)
+		}
+	}
 
 	// Encrypt token if encryptor is configured
 	var dataToStore []byte
@@ -171,15 +205,19 @@ func (tm *AdvancedTokenManager) CacheToken(ctx context.Context, userID, provider
 		return fmt.Errorf("failed to store token: %w", err)
 	}
 
-	// Update metadata
-	tm.tokenMetadata[key] = &TokenMetadata{
+	// Update metadata, keeping counters of a replaced token
+	metadata := &TokenMetadata{
 		UserID:       userID,
 		Provider:     provider,
 		CachedAt:     time.Now(),
 		LastAccessed: time.Now(),
-		AccessCount:  0,
-		RefreshCount: 0,
 	}
+	if replacing && existing != nil {
+		metadata.AccessCount = existing.AccessCount
+		metadata.RefreshCount = existing.RefreshCount
+		metadata.LastRefresh = existing.LastRefresh
+	}
+	tm.tokenMetadata[key] = metadata
 
 	// Update stats
 	tm.updateStats()
@@ -239,8 +277,10 @@ func (tm *AdvancedTokenManager) DeleteToken(ctx context.Context, userID, provide
 		return err
 	}
 
-	// Delete metadata
+	// Delete metadata and rotation state
 	delete(tm.tokenMetadata, key)
+	delete(tm.retiredTokens, key)
+	delete(tm.revokedGrants, key)
 
 	// Update stats
 	tm.updateStats()
@@ -248,8 +288,20 @@ func (tm *AdvancedTokenManager) DeleteToken(ctx context.Context, userID, provide
 	return nil
 }
 
-// RefreshIfNeeded checks if a token needs refresh and refreshes it
+// RefreshIfNeeded checks if a token needs refresh and refreshes it.
+//
+// Concurrent refreshes of the same grant share one provider call, so a
+// refresh token the provider rotates is used only once. The rotated token is
+// persisted before any caller returns. If the provider answers invalid_grant,
+// or a rotated-out refresh token shows up again, the grant is revoked: the
+// token is removed, GrantRevoked is emitted and ErrGrantRevoked is returned
+// until a new token is cached.
 func (tm *AdvancedTokenManager) RefreshIfNeeded(ctx context.Context, userID, provider string) (*Token, error) {
+	key := tm.tokenKey(userID, provider)
+	if tm.isRevoked(key) {
+		return nil, fmt.Errorf("%w: %s/%s", ErrGrantRevoked, userID, provider)
+	}
+
 	// Get the cached token
 	token, err := tm.GetCachedToken(ctx, userID, provider)
 	if err != nil {
@@ -261,41 +313,20 @@ func (tm *AdvancedTokenManager) RefreshIfNeeded(ctx context.Context, userID, pro
 		return token, nil
 	}
 
-	// Get the provider
-	if tm.providerService == nil {
-		return nil, fmt.Errorf("provider service not configured for automatic refresh")
-	}
-
-	prov, err := tm.providerService.GetProvider(provider)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get provider: %w", err)
-	}
-
-	if !prov.SupportsRefresh() {
-		return token, nil // Return existing token if refresh not supported
-	}
-
-	// Refresh the token
-	newToken, err := prov.RefreshToken(ctx, token.RefreshToken)
-	if err != nil {
-		return nil, fmt.Errorf("failed to refresh token: %w", err)
-	}
-
-	// Cache the new token
-	if err := tm.CacheToken(ctx, userID, provider, newToken); err != nil {
-		return nil, fmt.Errorf("failed to cache refreshed token: %w", err)
-	}
-
-	// Update metadata
-	tm.mu.Lock()
-	key := tm.tokenKey(userID, provider)
-	if metadata, exists := tm.tokenMetadata[key]; exists {
-		metadata.RefreshCount++
-		metadata.LastRefresh = time.Now()
+	// The shared refresh runs to completion even if callers give up,
+	// otherwise a rotated refresh token could be lost
+	ch := tm.refreshGroup.DoChan(key, func() (interface{}, error) {
+		return tm.refresh(context.WithoutCancel(ctx), userID, provider)
+	})
+	select {
+	case result := <-ch:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(*Token), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	tm.mu.Unlock()
-
-	return newToken, nil
 }
 
 // RevokeToken revokes a token with the provider and removes it from cache
@@ -311,6 +342,7 @@ func (tm *AdvancedTokenManager) RevokeToken(ctx context.Context, userID, provide
 	if tm.providerService != nil {
 		_ = tm.providerService.RevokeToken(ctx, provider, token.AccessToken)
 	}
+	recordAudit(ctx, tm.audit, AuditEvent{Type: AuditTokenRevoked, Provider: provider, UserID: userID})
 
 	// Remove from cache
 	return tm.DeleteToken(ctx, userID, provider)
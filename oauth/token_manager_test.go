@@ -2,7 +2,12 @@ package oauth_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -447,3 +452,215 @@ func TestEncryptedSessionStore(t *testing.T) {
 		t.Error("Session should have been deleted")
 	}
 }
+
+// newRotatingTokenServer issues a new refresh token on every refresh and
+// answers invalid_grant when a refresh token is used twice
+func newRotatingTokenServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	var mu sync.Mutex
+	used := map[string]bool{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		time.Sleep(20 * time.Millisecond) // let concurrent callers pile up
+
+		refreshToken := r.PostFormValue("refresh_token")
+		mu.Lock()
+		reused := used[refreshToken] || refreshToken == "revoked"
+		used[refreshToken] = true
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if reused {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"access_token":"at-%d","refresh_token":"rt-%d","token_type":"Bearer","expires_in":3600}`, n, n)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func newRotationManager(t *testing.T, tokenURL string) (*oauth.AdvancedTokenManager, *[]oauth.TokenEvent, *sync.Mutex) {
+	t.Helper()
+	provider, err := oauth.NewCustom(oauth.ProviderConfig{
+		ClientID:    "client",
+		RedirectURL: "http://localhost/callback",
+		AuthURL:     "http://localhost/authorize",
+		TokenURL:    tokenURL,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	service, _ := oauth.NewMultiProviderService(oauth.MultiProviderConfig{})
+	_ = service.RegisterProvider("custom", provider)
+
+	tm := oauth.NewAdvancedTokenManager(oauth.TokenManagerConfig{
+		Store:           oauth.NewMemoryTokenStore(time.Hour),
+		ProviderService: service,
+	})
+	t.Cleanup(tm.Stop)
+
+	var mu sync.Mutex
+	events := &[]oauth.TokenEvent{}
+	tm.Subscribe(func(e oauth.TokenEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		*events = append(*events, e)
+	})
+	return tm, events, &mu
+}
+
+func expiringToken(refreshToken string) *oauth.Token {
+	return &oauth.Token{
+		AccessToken:  "at-0",
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(time.Minute),
+	}
+}
+
+func TestAdvancedTokenManager_ConcurrentRefreshRotation(t *testing.T) {
+	server, calls := newRotatingTokenServer(t)
+	tm, events, mu := newRotationManager(t, server.URL)
+	ctx := context.Background()
+
+	if err := tm.CacheToken(ctx, "user", "custom", expiringToken("rt-0")); err != nil {
+		t.Fatalf("CacheToken failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*oauth.Token, 10)
+	errs := make([]error, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = tm.RefreshIfNeeded(ctx, "user", "custom")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("Refresh %d failed: %v", i, err)
+		}
+		if results[i].RefreshToken != "rt-1" {
+			t.Errorf("Refresh %d got refresh token %q, want rt-1", i, results[i].RefreshToken)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected one provider call, got %d", n)
+	}
+
+	stored, _ := tm.GetCachedToken(ctx, "user", "custom")
+	if stored.RefreshToken != "rt-1" || stored.AccessToken != "at-1" {
+		t.Errorf("Rotated token not persisted: %+v", stored)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(*events) != 1 || (*events)[0].Type != oauth.TokenRefreshed || !(*events)[0].Rotated {
+		t.Errorf("Expected one rotated TokenRefreshed event, got %+v", *events)
+	}
+}
+
+func TestAdvancedTokenManager_InvalidGrantRevokesGrant(t *testing.T) {
+	server, _ := newRotatingTokenServer(t)
+	tm, events, mu := newRotationManager(t, server.URL)
+	ctx := context.Background()
+
+	_ = tm.CacheToken(ctx, "user", "custom", expiringToken("revoked"))
+
+	if _, err := tm.RefreshIfNeeded(ctx, "user", "custom"); !errors.Is(err, oauth.ErrGrantRevoked) {
+		t.Fatalf("Expected ErrGrantRevoked, got %v", err)
+	}
+	if _, err := tm.GetCachedToken(ctx, "user", "custom"); err == nil {
+		t.Error("Expected revoked token to be removed")
+	}
+	if _, err := tm.RefreshIfNeeded(ctx, "user", "custom"); !errors.Is(err, oauth.ErrGrantRevoked) {
+		t.Errorf("Expected grant to stay revoked, got %v", err)
+	}
+
+	mu.Lock()
+	if len(*events) != 1 || (*events)[0].Type != oauth.GrantRevoked || (*events)[0].Reason != oauth.RevokeReasonInvalidGrant {
+		t.Errorf("Expected GrantRevoked event, got %+v", *events)
+	}
+	mu.Unlock()
+
+	// Logging in again reinstates the grant
+	_ = tm.CacheToken(ctx, "user", "custom", expiringToken("rt-fresh"))
+	if _, err := tm.RefreshIfNeeded(ctx, "user", "custom"); err != nil {
+		t.Errorf("Expected refresh after re-login to succeed, got %v", err)
+	}
+}
+
+func TestAdvancedTokenManager_InvalidGrantAfterRotationElsewhere(t *testing.T) {
+	var tm *oauth.AdvancedTokenManager
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Another instance sharing the store rotated the grant first
+		_ = tm.CacheToken(r.Context(), "user", "custom", &oauth.Token{
+			AccessToken:  "at-other",
+			RefreshToken: "rt-other",
+			TokenType:    "Bearer",
+			ExpiresAt:    time.Now().Add(time.Hour),
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+	}))
+	defer server.Close()
+
+	tm, events, mu := newRotationManager(t, server.URL)
+	ctx := context.Background()
+	_ = tm.CacheToken(ctx, "user", "custom", expiringToken("rt-0"))
+
+	token, err := tm.RefreshIfNeeded(ctx, "user", "custom")
+	if err != nil {
+		t.Fatalf("Expected the rotated token, got %v", err)
+	}
+	if token.RefreshToken != "rt-other" {
+		t.Errorf("Expected refresh token rt-other, got %q", token.RefreshToken)
+	}
+	if stored, err := tm.GetCachedToken(ctx, "user", "custom"); err != nil || stored.RefreshToken != "rt-other" {
+		t.Errorf("Expected the stored token kept, got %+v (%v)", stored, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, e := range *events {
+		if e.Type == oauth.GrantRevoked {
+			t.Errorf("Expected the grant not to be revoked, got %+v", e)
+		}
+	}
+}
+
+func TestAdvancedTokenManager_RefreshTokenReuse(t *testing.T) {
+	server, calls := newRotatingTokenServer(t)
+	tm, events, mu := newRotationManager(t, server.URL)
+	ctx := context.Background()
+
+	stale := expiringToken("rt-0")
+	_ = tm.CacheToken(ctx, "user", "custom", stale)
+	if _, err := tm.RefreshIfNeeded(ctx, "user", "custom"); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	// A stale copy with the rotated-out refresh token is written back
+	_ = tm.CacheToken(ctx, "user", "custom", stale)
+	if _, err := tm.RefreshIfNeeded(ctx, "user", "custom"); !errors.Is(err, oauth.ErrGrantRevoked) {
+		t.Fatalf("Expected ErrGrantRevoked on reuse, got %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected the reused refresh token not to be sent, got %d calls", n)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	last := (*events)[len(*events)-1]
+	if last.Type != oauth.GrantRevoked || last.Reason != oauth.RevokeReasonReuse {
+		t.Errorf("Expected GrantRevoked for reuse, got %+v", last)
+	}
+}
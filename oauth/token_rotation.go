@@ -0,0 +1,289 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxRetiredRefreshTokens bounds the rotated-out refresh tokens remembered per grant
+const maxRetiredRefreshTokens = 16
+
+// revokedGrantTTL is how long a revoked grant is reported as ErrGrantRevoked;
+// afterwards callers see the missing token like any other
+const revokedGrantTTL = 24 * time.Hour
+
+// refreshTimeout bounds a provider call made by a shared refresh, which runs
+// detached from its callers' contexts
+const refreshTimeout = 30 * time.Second
+
+// Grant revocation reasons reported in TokenEvent.Reason
+const (
+	RevokeReasonInvalidGrant = "invalid_grant"
+	RevokeReasonReuse        = "refresh_token_reuse"
+)
+
+// TokenEventType identifies a token lifecycle event
+type TokenEventType string
+
+const (
+	// TokenRefreshed is emitted after a refreshed token was persisted
+	TokenRefreshed TokenEventType = "token_refreshed"
+
+	// TokenRefreshFailed is emitted when a refresh fails without revoking the grant
+	TokenRefreshFailed TokenEventType = "token_refresh_failed"
+
+	// GrantRevoked is emitted when the provider rejects the refresh token
+	// (invalid_grant) or a rotated-out refresh token is used again
+	GrantRevoked TokenEventType = "grant_revoked"
+)
+
+// TokenEvent describes a token lifecycle event
+type TokenEvent struct {
+	Type     TokenEventType
+	UserID   string
+	Provider string
+	Time     time.Time
+
+	// Token is the new token for TokenRefreshed
+	Token *Token
+
+	// Rotated reports whether the provider issued a new refresh token
+	Rotated bool
+
+	// Reason is RevokeReasonInvalidGrant or RevokeReasonReuse for GrantRevoked
+	Reason string
+
+	// Err is the refresh error for TokenRefreshFailed and GrantRevoked
+	Err error
+
+	// Client is the AuditClient of the request that triggered the event
+	Client AuditClient
+}
+
+// Subscribe registers a handler for token events and returns a function that
+// removes it. Handlers run synchronously on the refreshing goroutine, so they
+// should return quickly.
+func (tm *AdvancedTokenManager) Subscribe(handler func(TokenEvent)) (unsubscribe func()) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.subscriberSeq++
+	id := tm.subscriberSeq
+	tm.subscribers[id] = handler
+
+	return func() {
+		tm.mu.Lock()
+		defer tm.mu.Unlock()
+		delete(tm.subscribers, id)
+	}
+}
+
+// auditTokenEvent forwards token events to the audit sink
+func (tm *AdvancedTokenManager) auditTokenEvent(event TokenEvent) {
+	audit := AuditEvent{Provider: event.Provider, UserID: event.UserID}
+	switch event.Type {
+	case TokenRefreshed:
+		audit.Type = AuditTokenRefreshed
+		if event.Rotated {
+			audit.Details = map[string]string{"rotated": "true"}
+		}
+	case TokenRefreshFailed:
+		audit.Type = AuditTokenRefreshFailed
+	case GrantRevoked:
+		audit.Type = AuditGrantRevoked
+		audit.Details = map[string]string{"reason": event.Reason}
+	default:
+		return
+	}
+	if event.Err != nil {
+		audit.Error = event.Err.Error()
+	}
+	recordAudit(WithAuditClient(context.Background(), event.Client), tm.audit, audit)
+}
+
+// emit delivers an event to all subscribers; tm.mu must not be held
+func (tm *AdvancedTokenManager) emit(ctx context.Context, event TokenEvent) {
+	event.Time = time.Now()
+	event.Client = AuditClientFromContext(ctx)
+
+	tm.mu.RLock()
+	handlers := make([]func(TokenEvent), 0, len(tm.subscribers))
+	for _, handler := range tm.subscribers {
+		handlers = append(handlers, handler)
+	}
+	tm.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// refresh refreshes a grant. Callers serialize it per grant with refreshGroup,
+// so a rotated refresh token is used exactly once within this process. Other
+// instances sharing the store are not serialized: a refresh that loses the race
+// re-reads the store before revoking, and reuse detection through
+// retiredTokens only covers tokens rotated by this process.
+func (tm *AdvancedTokenManager) refresh(ctx context.Context, userID, provider string) (*Token, error) {
+	key := tm.tokenKey(userID, provider)
+
+	// Another caller may have refreshed while this one waited
+	token, err := tm.GetCachedToken(ctx, userID, provider)
+	if err != nil {
+		return nil, err
+	}
+	if !tm.needsRefresh(token) {
+		return token, nil
+	}
+
+	if tm.providerService == nil {
+		return nil, fmt.Errorf("provider service not configured for automatic refresh")
+	}
+	prov, err := tm.providerService.GetProvider(provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provider: %w", err)
+	}
+	if !prov.SupportsRefresh() {
+		return token, nil // Return existing token if refresh not supported
+	}
+
+	if tm.isRetired(key, token.RefreshToken) {
+		// A rotated-out refresh token is back in the store: the grant may be
+		// compromised, so revoke it rather than trying it
+		revokeCtx, cancel := context.WithTimeout(ctx, refreshTimeout)
+		_ = tm.providerService.RevokeToken(revokeCtx, provider, token.RefreshToken)
+		cancel()
+		return nil, tm.revokeGrant(ctx, userID, provider, RevokeReasonReuse, nil)
+	}
+
+	// A hanging token endpoint must not block every caller waiting on this
+	// refresh; the result is still persisted with the detached ctx
+	refreshCtx, cancel := context.WithTimeout(ctx, refreshTimeout)
+	newToken, err := prov.RefreshToken(refreshCtx, token.RefreshToken)
+	cancel()
+	if err != nil {
+		if isInvalidGrant(err) {
+			// With a shared store another instance may have rotated the grant
+			// after this one read it; its token is valid, so keep the grant
+			if current, getErr := tm.GetCachedToken(ctx, userID, provider); getErr == nil &&
+				current.RefreshToken != "" && current.RefreshToken != token.RefreshToken {
+				return current, nil
+			}
+			return nil, tm.revokeGrant(ctx, userID, provider, RevokeReasonInvalidGrant, err)
+		}
+		err = fmt.Errorf("failed to refresh token: %w", err)
+		tm.emit(ctx, TokenEvent{Type: TokenRefreshFailed, UserID: userID, Provider: provider, Err: err})
+		return nil, err
+	}
+
+	// Providers that don't rotate omit the refresh token
+	if newToken.RefreshToken == "" {
+		newToken.RefreshToken = token.RefreshToken
+	}
+	rotated := newToken.RefreshToken != token.RefreshToken
+
+	// An omitted scope means the grant's scope is unchanged (RFC 6749 section 5.1)
+	if newToken.Scope == "" {
+		newToken.Scope = token.Scope
+	}
+
+	// Persist the new token and retire the old refresh token together
+	tm.mu.Lock()
+	err = tm.cacheTokenLocked(ctx, userID, provider, newToken)
+	if err == nil {
+		if rotated {
+			tm.retireLocked(key, token.RefreshToken)
+		}
+		if metadata, exists := tm.tokenMetadata[key]; exists {
+			metadata.RefreshCount++
+			metadata.LastRefresh = time.Now()
+		}
+	}
+	tm.mu.Unlock()
+
+	if err != nil {
+		err = fmt.Errorf("failed to cache refreshed token: %w", err)
+		tm.emit(ctx, TokenEvent{Type: TokenRefreshFailed, UserID: userID, Provider: provider, Err: err})
+		return nil, err
+	}
+
+	tm.emit(ctx, TokenEvent{Type: TokenRefreshed, UserID: userID, Provider: provider, Token: newToken, Rotated: rotated})
+	return newToken, nil
+}
+
+// revokeGrant removes a grant's token, remembers it as revoked and emits GrantRevoked
+func (tm *AdvancedTokenManager) revokeGrant(ctx context.Context, userID, provider, reason string, cause error) error {
+	key := tm.tokenKey(userID, provider)
+
+	tm.mu.Lock()
+	_ = tm.store.Delete(ctx, key)
+	delete(tm.tokenMetadata, key)
+	now := time.Now()
+	for revokedKey, at := range tm.revokedGrants {
+		if now.Sub(at) >= revokedGrantTTL {
+			delete(tm.revokedGrants, revokedKey)
+		}
+	}
+	tm.revokedGrants[key] = now
+	tm.updateStats()
+	tm.mu.Unlock()
+
+	tm.emit(ctx, TokenEvent{Type: GrantRevoked, UserID: userID, Provider: provider, Reason: reason, Err: cause})
+
+	if cause != nil {
+		return fmt.Errorf("%w (%s): %w", ErrGrantRevoked, reason, cause)
+	}
+	return fmt.Errorf("%w (%s)", ErrGrantRevoked, reason)
+}
+
+// isRevoked reports whether a grant was revoked within revokedGrantTTL and
+// not cached again since
+func (tm *AdvancedTokenManager) isRevoked(key string) bool {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	at, revoked := tm.revokedGrants[key]
+	return revoked && time.Since(at) < revokedGrantTTL
+}
+
+// isRetired reports whether refreshToken was rotated out of the grant
+func (tm *AdvancedTokenManager) isRetired(key, refreshToken string) bool {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	_, retired := tm.retiredTokens[key][hashRefreshToken(refreshToken)]
+	return retired
+}
+
+// retireLocked remembers a rotated-out refresh token; tm.mu must be held
+func (tm *AdvancedTokenManager) retireLocked(key, refreshToken string) {
+	retired := tm.retiredTokens[key]
+	if retired == nil {
+		retired = make(map[string]time.Time)
+		tm.retiredTokens[key] = retired
+	}
+
+	if len(retired) >= maxRetiredRefreshTokens {
+		var oldest string
+		for hash, at := range retired {
+			if oldest == "" || at.Before(retired[oldest]) {
+				oldest = hash
+			}
+		}
+		delete(retired, oldest)
+	}
+	retired[hashRefreshToken(refreshToken)] = time.Now()
+}
+
+// hashRefreshToken avoids keeping retired refresh tokens in memory
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// isInvalidGrant reports whether the provider rejected the refresh token
+func isInvalidGrant(err error) bool {
+	var oauthErr *Error
+	return errors.As(err, &oauthErr) && oauthErr.Code == "invalid_grant"
+}
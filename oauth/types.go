@@ -107,6 +107,7 @@ type SessionData struct {
 	CreatedAt     time.Time              `json:"created_at"`
 	ExpiresAt     time.Time              `json:"expires_at"`
 	Provider      string                 `json:"provider"`
+	Scope         string                 `json:"scope,omitempty"` // requested scope
 	Metadata      map[string]interface{} `json:"metadata,omitempty"`
 }
 
@@ -156,17 +157,34 @@ type TokenStore interface {
 // ProviderConfig represents configuration for a specific OAuth provider
 type ProviderConfig struct {
 	// Provider type (google, github, apple, twitter, custom)
-	Type         string     `json:"type,omitempty" env:"TYPE"`
-	ClientID     string     `json:"client_id" env:"CLIENT_ID"`
-	ClientSecret string     `json:"client_secret,omitempty" env:"CLIENT_SECRET"`
-	RedirectURL  string     `json:"redirect_url" env:"REDIRECT_URL"`
-	Scopes       []string   `json:"scopes,omitempty" env:"SCOPES"`
-	AuthURL      string     `json:"auth_url,omitempty" env:"AUTH_URL"`
-	TokenURL     string     `json:"token_url,omitempty" env:"TOKEN_URL"`
-	UserInfoURL  string     `json:"userinfo_url,omitempty" env:"USERINFO_URL"`
-	RevokeURL    string     `json:"revoke_url,omitempty" env:"REVOKE_URL"`
-	HTTPClient   HTTPClient `json:"-"`
-	Debug        bool       `json:"debug,omitempty" env:"DEBUG"`
+	Type         string   `json:"type,omitempty" env:"TYPE"`
+	ClientID     string   `json:"client_id" env:"CLIENT_ID"`
+	ClientSecret string   `json:"client_secret,omitempty" env:"CLIENT_SECRET"`
+	RedirectURL  string   `json:"redirect_url" env:"REDIRECT_URL"`
+	Scopes       []string `json:"scopes,omitempty" env:"SCOPES"`
+	AuthURL      string   `json:"auth_url,omitempty" env:"AUTH_URL"`
+	TokenURL     string   `json:"token_url,omitempty" env:"TOKEN_URL"`
+	UserInfoURL  string   `json:"userinfo_url,omitempty" env:"USERINFO_URL"`
+	RevokeURL    string   `json:"revoke_url,omitempty" env:"REVOKE_URL"`
+	// IntrospectionURL is the RFC 7662 token introspection endpoint
+	IntrospectionURL string `json:"introspection_url,omitempty" env:"INTROSPECTION_URL"`
+	// DeviceAuthURL is the RFC 8628 device authorization endpoint
+	DeviceAuthURL string `json:"device_auth_url,omitempty" env:"DEVICE_AUTH_URL"`
+	// PARURL is the RFC 9126 pushed authorization request endpoint
+	PARURL string `json:"par_url,omitempty" env:"PAR_URL"`
+	// Issuer identifies the authorization server (JAR audience); defaults to the AuthURL origin
+	Issuer     string     `json:"issuer,omitempty" env:"ISSUER"`
+	HTTPClient HTTPClient `json:"-"`
+	Debug      bool       `json:"debug,omitempty" env:"DEBUG"`
+
+	// Signed request objects (JAR, RFC 9101): a PEM private key or a signer.
+	// Provider files and tables reference the key by path instead, since the
+	// key itself is never serialized; relative paths in a FileProviderSource
+	// are resolved against the file's directory.
+	RequestObjectKey     string     `json:"-" env:"REQUEST_OBJECT_KEY"`
+	RequestObjectKeyFile string     `json:"request_object_key_file,omitempty" env:"REQUEST_OBJECT_KEY_FILE"`
+	RequestObjectKeyID   string     `json:"request_object_key_id,omitempty" env:"REQUEST_OBJECT_KEY_ID"`
+	RequestObjectSigner  *JWTSigner `json:"-"`
 
 	// Apple-specific
 	TeamID     string `json:"team_id,omitempty" env:"APPLE_TEAM_ID"`
@@ -175,4 +193,13 @@ type ProviderConfig struct {
 
 	// Twitter-specific
 	APIVersion string `json:"api_version,omitempty" env:"TWITTER_API_VERSION"`
+
+	// Microsoft-specific (tenant ID, domain, or common/organizations/consumers)
+	Tenant string `json:"tenant,omitempty" env:"MICROSOFT_TENANT"`
+}
+
+// isDeviceOnly reports whether the client only uses the device flow: it has
+// a device authorization endpoint but no redirect URI
+func (c ProviderConfig) isDeviceOnly() bool {
+	return c.RedirectURL == "" && c.DeviceAuthURL != ""
 }